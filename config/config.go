@@ -1,8 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"log/slog"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/utils"
 )
 
 // Config holds application configuration
@@ -15,18 +24,221 @@ type Config struct {
 	AirwallexClientID   string
 	AirwallexAPIKey     string
 	AirwallexBaseURL    string
+	// Secret used to verify Airwallex webhook notifications
+	AirwallexWebhookSecret string
+	// Optional JSON file mapping payment links to their Slack channel (in-memory if empty)
+	LinkOriginStore string
+	// Optional JSON file of per-workspace bot tokens and signing secrets keyed by team ID
+	TeamConfigPath string
+	// Slack app credentials for the OAuth install flow (disabled unless both are set)
+	SlackClientID     string
+	SlackClientSecret string
+	// Comma-separated bot scopes requested on install
+	SlackOAuthScopes string
+
+	// Log output: "plain" (default, the standard log package), "text" or "json" (log/slog handlers)
+	LogFormat string
+	// Minimum slog level: debug, info (default), warn or error. Plain logs are always info.
+	LogLevel slog.Level
+	// Log every HTTP request (default true), except for paths in AccessLogExcludePaths
+	AccessLog             bool
+	AccessLogExcludePaths []string
+
+	// Optional proxy for Stripe/Airwallex API calls (HTTPS_PROXY etc. are honoured when unset)
+	OutboundProxyURL string
+
+	// Optional PEM bundle of extra CA certificates trusted for Slack and provider API calls
+	ExtraCABundlePath string
+
+	// Retries for transient Airwallex API failures (connection errors and 5xx)
+	AirwallexMaxRetries     int
+	AirwallexRetryBaseDelay time.Duration
+
+	// Per-request timeouts for provider API calls
+	AirwallexHTTPTimeout time.Duration
+	StripeHTTPTimeout    time.Duration
+	// Optional Stripe API base URL, e.g. http://localhost:12111 for stripe-mock
+	StripeAPIBaseURL string
+
+	// Largest Stripe webhook body accepted, and how long event IDs are remembered to drop
+	// redelivered events (0 disables)
+	StripeWebhookMaxBodyBytes int64
+	StripeWebhookReplayWindow time.Duration
+
+	// How long in-flight requests get to finish after SIGTERM/SIGINT
+	ShutdownTimeout time.Duration
+
+	// Number of payment links created at once in the background after a modal is submitted
+	LinkWorkers int
+
+	// Check provider credentials at startup and log the result (never fatal)
+	ValidateProvidersOnStart bool
+
+	// Return fake payment links instead of calling Stripe and Airwallex, for demos and testing
+	DryRun bool
+
+	// Optional branding shown on Airwallex payment links
+	AirwallexMerchantName string
+	AirwallexLogoURL      string
+
+	// Slack user IDs allowed to run admin commands (e.g. /invoice-counter)
+	AdminUserIDs []string
+	// Channel or user ID that receives full provider error details (logged only if empty)
+	AdminAlertChannel string
+
+	// Also send the creator a private (ephemeral) copy of each link posted to a channel
+	EphemeralLinkCopy bool
+
+	// Tick "Calculate tax automatically" on new Stripe links by default (needs Stripe Tax)
+	StripeAutomaticTax bool
+
+	// Query parameters appended to posted payment links (off unless LINK_QUERY_PARAMS is set)
+	LinkQueryParams []utils.QueryParam
+
+	// URL shortening for posted payment links: "none" (default), "http" or "builtin"
+	Shortener         string
+	ShortenerAPIURL   string
+	ShortenerAPIToken string
+	PublicBaseURL     string // public URL of this server, used for built-in short links
+	ShortLinkStore    string // JSON file for built-in short links, required with the builtin shortener
+
+	// Invoice number counter backend: "slack" (default, channel messages), "file", "bolt" or "memory"
+	InvoiceCounterStore string
+	InvoiceCounterPath  string // JSON file or bolt database, required with the file and bolt backends
+
+	// How auto-assigned invoice numbers are written, e.g. INV-{year}-{seq:04d} (bare numbers if unset)
+	InvoiceNumberFormat utils.InvoiceNumberFormat
+
+	// Optional webhook that receives a signed JSON receipt for every link and invoice created
+	OutboundWebhookURL    string
+	OutboundWebhookSecret string
+
+	// Optional JSON Lines file, or bolt database, that gets an audit record for every link and
+	// invoice created. At most one is set.
+	AuditLogPath string
+	AuditDBPath  string
+
+	// Maximum number of line items accepted on a single invoice
+	InvoiceMaxLineItems int
+
+	// Window in which a near-identical invoice from the same user/channel needs confirmation (0 disables)
+	InvoiceDuplicateWindow time.Duration
+
+	// Default number of billing cycles for subscriptions (0 = unlimited)
+	DefaultEndDateCycles int64
+	// Billing interval and count preselected for new subscriptions (monthly by default)
+	DefaultInterval      string
+	DefaultIntervalCount int64
+
+	// Optional snapping of scheduled subscription cancellations (exact timing if unset)
+	CancelSnap utils.CancelSnap
+
+	// Optional UTF-8 TrueType fonts for invoice PDFs (core Arial/cp1252 is used otherwise)
+	InvoiceFontPath     string
+	InvoiceFontBoldPath string
+	// Transliterate characters the invoice font can't render (e.g. Cyrillic with core fonts)
+	InvoiceTransliterate bool
+
+	// Company shown in the invoice header (lines left blank are omitted)
+	InvoiceCompany models.InvoiceCompany
+	// Optional PNG/JPEG logo for the invoice header, as a file path or http(s) URL
+	InvoiceLogo string
+	// Widths in mm of the invoice Description, Qty, Unit Price and Amount columns
+	InvoiceColumnWidths [4]float64
 }
 
+const (
+	// SlackMaxModalBlocks is the maximum number of blocks Slack allows in a modal view
+	SlackMaxModalBlocks = 100
+	// MaxInvoiceLineItemsLimit leaves room for the invoice modal's fixed blocks within Slack's block limit
+	MaxInvoiceLineItemsLimit = SlackMaxModalBlocks - 20
+	// DefaultInvoiceMaxLineItems is used when INVOICE_MAX_LINE_ITEMS is not set
+	DefaultInvoiceMaxLineItems = 50
+	// InvoiceTableWidth is the printable width of an A4 invoice with 10mm margins
+	InvoiceTableWidth = 190.0
+	// Defaults for AIRWALLEX_MAX_RETRIES and AIRWALLEX_RETRY_BASE_DELAY
+	DefaultAirwallexMaxRetries     = 2
+	DefaultAirwallexRetryBaseDelay = 500 * time.Millisecond
+	// Defaults for AIRWALLEX_HTTP_TIMEOUT and STRIPE_HTTP_TIMEOUT (the Stripe SDK's own default)
+	DefaultAirwallexHTTPTimeout = 30 * time.Second
+	DefaultStripeHTTPTimeout    = 80 * time.Second
+	// DefaultSlackOAuthScopes covers the commands, modals, messages and invoice uploads the bot uses
+	DefaultSlackOAuthScopes = "commands,chat:write,chat:write.public,files:write,im:write"
+	// Defaults for STRIPE_WEBHOOK_MAX_BODY_BYTES and STRIPE_WEBHOOK_REPLAY_WINDOW
+	DefaultStripeWebhookMaxBodyBytes = 1 << 20
+	DefaultStripeWebhookReplayWindow = time.Hour
+	// DefaultShutdownTimeout is used when SHUTDOWN_TIMEOUT is not set
+	DefaultShutdownTimeout = 25 * time.Second
+	// DefaultLinkWorkers is used when LINK_WORKERS is not set
+	DefaultLinkWorkers = 4
+	// DefaultInvoiceDuplicateWindow is used when INVOICE_DUPLICATE_WINDOW is not set
+	DefaultInvoiceDuplicateWindow = 2 * time.Minute
+	// DefaultAccessLogExcludePaths are polled by infrastructure and would drown out the access log
+	DefaultAccessLogExcludePaths = "/healthz,/readyz,/metrics"
+)
+
 func LoadConfig() *Config {
 	cfg := &Config{
 		SlackBotToken:       os.Getenv("SLACK_BOT_TOKEN"),
 		SlackSigningSecret:  os.Getenv("SLACK_SIGNING_SECRET"),
 		Port:                os.Getenv("PORT"),
+		LogFormat:           strings.ToLower(os.Getenv("LOG_FORMAT")),
+		AccessLog:           os.Getenv("ACCESS_LOG") != "false",
 		StripeAPIKey:        os.Getenv("STRIPE_API_KEY"),
 		StripeWebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
 		AirwallexClientID:   os.Getenv("AIRWALLEX_CLIENT_ID"),
 		AirwallexAPIKey:     os.Getenv("AIRWALLEX_API_KEY"),
 		AirwallexBaseURL:    os.Getenv("AIRWALLEX_BASE_URL"),
+
+		AirwallexWebhookSecret: os.Getenv("AIRWALLEX_WEBHOOK_SECRET"),
+		LinkOriginStore:        os.Getenv("LINK_ORIGIN_STORE_PATH"),
+		TeamConfigPath:         os.Getenv("TEAM_CONFIG_PATH"),
+		SlackClientID:          os.Getenv("SLACK_CLIENT_ID"),
+		SlackClientSecret:      os.Getenv("SLACK_CLIENT_SECRET"),
+		SlackOAuthScopes:       strings.TrimSpace(os.Getenv("SLACK_OAUTH_SCOPES")),
+		OutboundProxyURL:       os.Getenv("OUTBOUND_PROXY_URL"),
+		StripeAPIBaseURL:       strings.TrimRight(os.Getenv("STRIPE_API_BASE_URL"), "/"),
+		ExtraCABundlePath:      os.Getenv("EXTRA_CA_BUNDLE_PATH"),
+
+		ValidateProvidersOnStart: os.Getenv("VALIDATE_PROVIDERS_ON_START") == "true",
+
+		DryRun: os.Getenv("DRY_RUN") == "true",
+
+		AirwallexMerchantName: os.Getenv("AIRWALLEX_MERCHANT_NAME"),
+		AirwallexLogoURL:      os.Getenv("AIRWALLEX_LOGO_URL"),
+
+		AdminUserIDs:      splitList(os.Getenv("ADMIN_USER_IDS")),
+		AdminAlertChannel: os.Getenv("ADMIN_ALERT_CHANNEL"),
+
+		EphemeralLinkCopy: os.Getenv("EPHEMERAL_LINK_COPY") != "false",
+
+		StripeAutomaticTax: os.Getenv("STRIPE_AUTOMATIC_TAX") == "true",
+
+		OutboundWebhookURL:    os.Getenv("OUTBOUND_WEBHOOK_URL"),
+		OutboundWebhookSecret: os.Getenv("OUTBOUND_WEBHOOK_SECRET"),
+
+		AuditLogPath: os.Getenv("AUDIT_LOG_PATH"),
+		AuditDBPath:  os.Getenv("AUDIT_DB_PATH"),
+
+		InvoiceCounterStore: strings.ToLower(os.Getenv("INVOICE_COUNTER_STORE")),
+		InvoiceCounterPath:  os.Getenv("INVOICE_COUNTER_PATH"),
+
+		InvoiceFontPath:      os.Getenv("INVOICE_FONT_PATH"),
+		InvoiceFontBoldPath:  os.Getenv("INVOICE_FONT_BOLD_PATH"),
+		InvoiceTransliterate: os.Getenv("INVOICE_TRANSLITERATE") != "false",
+
+		InvoiceCompany: models.InvoiceCompany{
+			Name:         strings.TrimSpace(os.Getenv("INVOICE_COMPANY_NAME")),
+			AddressLines: splitLines(os.Getenv("INVOICE_COMPANY_ADDRESS")),
+			Phone:        strings.TrimSpace(os.Getenv("INVOICE_COMPANY_PHONE")),
+		},
+		InvoiceLogo: strings.TrimSpace(os.Getenv("INVOICE_LOGO")),
+
+		Shortener:         strings.ToLower(os.Getenv("SHORTENER")),
+		ShortenerAPIURL:   os.Getenv("SHORTENER_API_URL"),
+		ShortenerAPIToken: os.Getenv("SHORTENER_API_TOKEN"),
+		PublicBaseURL:     os.Getenv("PUBLIC_BASE_URL"),
+		ShortLinkStore:    os.Getenv("SHORT_LINK_STORE_PATH"),
 	}
 
 	if cfg.SlackBotToken == "" {
@@ -39,18 +251,314 @@ func LoadConfig() *Config {
 		cfg.Port = "8080"
 		log.Printf("PORT environment variable not set, defaulting to %s", cfg.Port)
 	}
-	if cfg.StripeAPIKey == "" {
-		log.Fatal("STRIPE_API_KEY environment variable not set.")
-	}
-	if cfg.AirwallexClientID == "" {
-		log.Fatal("AIRWALLEX_CLIENT_ID environment variable not set.")
+	// Each provider is optional, but a half-configured one is almost certainly a mistake
+	if (cfg.AirwallexClientID == "") != (cfg.AirwallexAPIKey == "") {
+		log.Fatal("AIRWALLEX_CLIENT_ID and AIRWALLEX_API_KEY must be set together.")
 	}
-	if cfg.AirwallexAPIKey == "" {
-		log.Fatal("AIRWALLEX_API_KEY environment variable not set.")
+	if !cfg.StripeEnabled() && !cfg.AirwallexEnabled() {
+		log.Fatal("No payment provider configured. Set STRIPE_API_KEY and/or AIRWALLEX_CLIENT_ID and AIRWALLEX_API_KEY.")
 	}
 	if cfg.AirwallexBaseURL == "" {
 		cfg.AirwallexBaseURL = "https://api.airwallex.com"
 	}
+	if cfg.AirwallexLogoURL != "" && !isHTTPSURL(cfg.AirwallexLogoURL) {
+		log.Fatal("AIRWALLEX_LOGO_URL must be an absolute https:// URL.")
+	}
+	cfg.AirwallexMaxRetries = DefaultAirwallexMaxRetries
+	if raw := os.Getenv("AIRWALLEX_MAX_RETRIES"); raw != "" {
+		retries, err := strconv.Atoi(raw)
+		if err != nil || retries < 0 {
+			log.Fatalf("AIRWALLEX_MAX_RETRIES must be a non-negative integer, got %q", raw)
+		}
+		cfg.AirwallexMaxRetries = retries
+	}
+	cfg.AirwallexRetryBaseDelay = DefaultAirwallexRetryBaseDelay
+	if raw := os.Getenv("AIRWALLEX_RETRY_BASE_DELAY"); raw != "" {
+		delay, err := time.ParseDuration(raw)
+		if err != nil || delay < 0 {
+			log.Fatalf("AIRWALLEX_RETRY_BASE_DELAY must be a duration such as 500ms, got %q", raw)
+		}
+		cfg.AirwallexRetryBaseDelay = delay
+	}
+	switch cfg.LogFormat {
+	case "":
+		cfg.LogFormat = "plain"
+	case "plain", "text", "json":
+	default:
+		log.Fatalf("LOG_FORMAT must be plain, text or json, got %q", cfg.LogFormat)
+	}
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(raw)); err != nil {
+			log.Fatalf("LOG_LEVEL must be debug, info, warn or error, got %q", raw)
+		}
+	}
+	// Set but empty excludes nothing
+	excludePaths, ok := os.LookupEnv("ACCESS_LOG_EXCLUDE_PATHS")
+	if !ok {
+		excludePaths = DefaultAccessLogExcludePaths
+	}
+	cfg.AccessLogExcludePaths = splitList(excludePaths)
+	for _, path := range cfg.AccessLogExcludePaths {
+		if !strings.HasPrefix(path, "/") {
+			log.Fatalf("ACCESS_LOG_EXCLUDE_PATHS must be paths starting with /, got %q", path)
+		}
+	}
+	cfg.AirwallexHTTPTimeout = parseTimeout("AIRWALLEX_HTTP_TIMEOUT", DefaultAirwallexHTTPTimeout)
+	cfg.StripeHTTPTimeout = parseTimeout("STRIPE_HTTP_TIMEOUT", DefaultStripeHTTPTimeout)
+	cfg.ShutdownTimeout = parseTimeout("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)
+	cfg.LinkWorkers = DefaultLinkWorkers
+	if raw := os.Getenv("LINK_WORKERS"); raw != "" {
+		workers, err := strconv.Atoi(raw)
+		if err != nil || workers <= 0 {
+			log.Fatalf("LINK_WORKERS must be a positive integer, got %q", raw)
+		}
+		cfg.LinkWorkers = workers
+	}
+	if cfg.StripeAPIBaseURL != "" {
+		if u, err := url.Parse(cfg.StripeAPIBaseURL); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			log.Fatalf("STRIPE_API_BASE_URL must be an http(s) URL, got %q", cfg.StripeAPIBaseURL)
+		}
+	}
+	cfg.StripeWebhookMaxBodyBytes = DefaultStripeWebhookMaxBodyBytes
+	if raw := os.Getenv("STRIPE_WEBHOOK_MAX_BODY_BYTES"); raw != "" {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			log.Fatalf("STRIPE_WEBHOOK_MAX_BODY_BYTES must be a positive integer, got %q", raw)
+		}
+		cfg.StripeWebhookMaxBodyBytes = maxBytes
+	}
+	if os.Getenv("STRIPE_WEBHOOK_REPLAY_WINDOW") == "0" {
+		cfg.StripeWebhookReplayWindow = 0
+	} else {
+		cfg.StripeWebhookReplayWindow = parseTimeout("STRIPE_WEBHOOK_REPLAY_WINDOW", DefaultStripeWebhookReplayWindow)
+	}
+	cfg.InvoiceMaxLineItems = DefaultInvoiceMaxLineItems
+	if raw := os.Getenv("INVOICE_MAX_LINE_ITEMS"); raw != "" {
+		maxItems, err := strconv.Atoi(raw)
+		if err != nil || maxItems <= 0 {
+			log.Fatalf("INVOICE_MAX_LINE_ITEMS must be a positive integer, got %q", raw)
+		}
+		if maxItems > MaxInvoiceLineItemsLimit {
+			log.Printf("INVOICE_MAX_LINE_ITEMS=%d exceeds what fits in a Slack modal, capping at %d", maxItems, MaxInvoiceLineItemsLimit)
+			maxItems = MaxInvoiceLineItemsLimit
+		}
+		cfg.InvoiceMaxLineItems = maxItems
+	}
+
+	cfg.InvoiceColumnWidths = DefaultInvoiceColumnWidths
+	if raw := os.Getenv("INVOICE_COLUMN_WIDTHS"); raw != "" {
+		widths, err := parseColumnWidths(raw)
+		if err != nil {
+			log.Fatalf("INVOICE_COLUMN_WIDTHS is invalid: %v", err)
+		}
+		cfg.InvoiceColumnWidths = widths
+	}
+
+	cfg.InvoiceDuplicateWindow = DefaultInvoiceDuplicateWindow
+	if raw := os.Getenv("INVOICE_DUPLICATE_WINDOW"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if raw == "0" {
+			window, err = 0, nil
+		}
+		if err != nil || window < 0 {
+			log.Fatalf("INVOICE_DUPLICATE_WINDOW must be a duration such as 2m (or 0 to disable), got %q", raw)
+		}
+		cfg.InvoiceDuplicateWindow = window
+	}
+
+	if raw := os.Getenv("DEFAULT_END_DATE_CYCLES"); raw != "" {
+		cycles, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || cycles < 0 {
+			log.Fatalf("DEFAULT_END_DATE_CYCLES must be a non-negative integer, got %q", raw)
+		}
+		cfg.DefaultEndDateCycles = cycles
+	}
+	cfg.DefaultInterval = "month"
+	if raw := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_INTERVAL"))); raw != "" {
+		if !utils.IsValidInterval(raw) {
+			log.Fatalf("DEFAULT_INTERVAL must be day, week, month or year, got %q", raw)
+		}
+		cfg.DefaultInterval = raw
+	}
+	cfg.DefaultIntervalCount = 1
+	if raw := os.Getenv("DEFAULT_INTERVAL_COUNT"); raw != "" {
+		count, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || count < 1 {
+			log.Fatalf("DEFAULT_INTERVAL_COUNT must be a positive integer, got %q", raw)
+		}
+		cfg.DefaultIntervalCount = count
+	}
+
+	cancelSnap, err := utils.ParseCancelSnap(
+		os.Getenv("CANCEL_SNAP_TIME"),
+		os.Getenv("CANCEL_SNAP_TIMEZONE"),
+		os.Getenv("CANCEL_SNAP_BUSINESS_DAYS") != "false",
+		os.Getenv("CANCEL_SNAP_HOLIDAYS"),
+	)
+	if err != nil {
+		log.Fatalf("CANCEL_SNAP settings are invalid: %v", err)
+	}
+	cfg.CancelSnap = cancelSnap
+
+	if cfg.OutboundProxyURL != "" {
+		if u, err := url.Parse(cfg.OutboundProxyURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			log.Fatal("OUTBOUND_PROXY_URL must be an absolute http://, https:// or socks5:// URL.")
+		}
+	}
+
+	if cfg.OutboundWebhookURL != "" {
+		if u, err := url.Parse(cfg.OutboundWebhookURL); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			log.Fatal("OUTBOUND_WEBHOOK_URL must be an absolute http(s):// URL.")
+		}
+		if cfg.OutboundWebhookSecret == "" {
+			log.Fatal("OUTBOUND_WEBHOOK_SECRET environment variable not set (required when OUTBOUND_WEBHOOK_URL is set).")
+		}
+	}
+
+	if raw := os.Getenv("LINK_QUERY_PARAMS"); raw != "" {
+		params, err := utils.ParseQueryParamTemplate(raw)
+		if err != nil {
+			log.Fatalf("LINK_QUERY_PARAMS is invalid: %v", err)
+		}
+		cfg.LinkQueryParams = params
+	}
+
+	if raw := os.Getenv("INVOICE_NUMBER_FORMAT"); raw != "" {
+		format, err := utils.ParseInvoiceNumberFormat(raw)
+		if err != nil {
+			log.Fatalf("INVOICE_NUMBER_FORMAT is invalid: %v", err)
+		}
+		cfg.InvoiceNumberFormat = format
+	}
+
+	if cfg.AuditLogPath != "" && cfg.AuditDBPath != "" {
+		log.Fatalf("AUDIT_LOG_PATH and AUDIT_DB_PATH are both set. Set only one.")
+	}
+
+	switch cfg.InvoiceCounterStore {
+	case "":
+		cfg.InvoiceCounterStore = "slack"
+	case "file", "bolt":
+		// There's no default path: one that isn't on a persistent volume would restart numbering,
+		// and reissue invoice numbers, whenever the container is replaced
+		if cfg.InvoiceCounterPath == "" {
+			log.Fatalf("INVOICE_COUNTER_PATH environment variable not set (required when INVOICE_COUNTER_STORE=%s).", cfg.InvoiceCounterStore)
+		}
+	case "memory", "slack":
+	default:
+		log.Fatalf("Unknown INVOICE_COUNTER_STORE %q. Must be one of: slack, file, bolt, memory", cfg.InvoiceCounterStore)
+	}
+
+	switch cfg.Shortener {
+	case "", "none":
+		cfg.Shortener = "none"
+	case "http":
+		if cfg.ShortenerAPIURL == "" {
+			log.Fatal("SHORTENER_API_URL environment variable not set (required when SHORTENER=http).")
+		}
+	case "builtin":
+		if cfg.PublicBaseURL == "" {
+			log.Fatal("PUBLIC_BASE_URL environment variable not set (required when SHORTENER=builtin).")
+		}
+		// Short links have already been sent to customers, so they must outlive a restart
+		if cfg.ShortLinkStore == "" {
+			log.Fatal("SHORT_LINK_STORE_PATH environment variable not set (required when SHORTENER=builtin).")
+		}
+	default:
+		log.Fatalf("Unknown SHORTENER %q. Must be one of: none, http, builtin", cfg.Shortener)
+	}
+
+	if (cfg.SlackClientID == "") != (cfg.SlackClientSecret == "") {
+		log.Fatal("SLACK_CLIENT_ID and SLACK_CLIENT_SECRET must be set together to enable OAuth installs.")
+	}
+	if cfg.OAuthEnabled() && cfg.PublicBaseURL == "" {
+		log.Fatal("PUBLIC_BASE_URL environment variable not set (required for the OAuth redirect URL).")
+	}
+	if cfg.SlackOAuthScopes == "" {
+		cfg.SlackOAuthScopes = DefaultSlackOAuthScopes
+	}
 
 	return cfg
 }
+
+// OAuthEnabled reports whether the Slack OAuth install flow is configured
+func (c *Config) OAuthEnabled() bool {
+	return c.SlackClientID != "" && c.SlackClientSecret != ""
+}
+
+// StripeEnabled reports whether Stripe credentials are configured
+func (c *Config) StripeEnabled() bool {
+	return c.StripeAPIKey != ""
+}
+
+// AirwallexEnabled reports whether Airwallex credentials are configured
+func (c *Config) AirwallexEnabled() bool {
+	return c.AirwallexClientID != "" && c.AirwallexAPIKey != ""
+}
+
+// parseTimeout reads a positive duration such as 30s from the environment, or returns def if unset
+func parseTimeout(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		log.Fatalf("%s must be a positive duration such as 30s, got %q", name, raw)
+	}
+	return timeout
+}
+
+// isHTTPSURL reports whether raw is an absolute URL using the https scheme
+func isHTTPSURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// DefaultInvoiceColumnWidths is used when INVOICE_COLUMN_WIDTHS is not set
+var DefaultInvoiceColumnWidths = [4]float64{95, 25, 35, 35}
+
+// parseColumnWidths parses four comma-separated widths in mm that fit the invoice table
+func parseColumnWidths(raw string) ([4]float64, error) {
+	var widths [4]float64
+	parts := strings.Split(raw, ",")
+	if len(parts) != len(widths) {
+		return widths, fmt.Errorf("expected 4 comma-separated widths (description, qty, unit price, amount), got %q", raw)
+	}
+
+	var total float64
+	for i, part := range parts {
+		width, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || width <= 0 {
+			return widths, fmt.Errorf("width %q must be a positive number of mm", strings.TrimSpace(part))
+		}
+		widths[i] = width
+		total += width
+	}
+	if total > InvoiceTableWidth {
+		return widths, fmt.Errorf("widths add up to %gmm, more than the %gmm available", total, InvoiceTableWidth)
+	}
+	return widths, nil
+}
+
+// splitLines splits a multi-line value on newlines or '|' (env files can't easily hold newlines)
+func splitLines(raw string) []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == '|' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// splitList parses a comma-separated environment value, dropping empty entries
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestIsHTTPSURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"https://acme.test/logo.png", true},
+		{"http://acme.test/logo.png", false},
+		{"https:///logo.png", false},
+		{"acme.test/logo.png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isHTTPSURL(tt.raw); got != tt.want {
+			t.Errorf("isHTTPSURL(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigWithOneProvider(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantStripe    bool
+		wantAirwallex bool
+	}{
+		{"Stripe only", map[string]string{"STRIPE_API_KEY": "sk_test_123"}, true, false},
+		{"Airwallex only", map[string]string{"AIRWALLEX_CLIENT_ID": "client", "AIRWALLEX_API_KEY": "key"}, false, true},
+		{"both", map[string]string{"STRIPE_API_KEY": "sk_test_123", "AIRWALLEX_CLIENT_ID": "client", "AIRWALLEX_API_KEY": "key"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+			t.Setenv("SLACK_SIGNING_SECRET", "secret")
+			for _, name := range []string{"STRIPE_API_KEY", "AIRWALLEX_CLIENT_ID", "AIRWALLEX_API_KEY"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			cfg := LoadConfig()
+			if cfg.StripeEnabled() != tt.wantStripe {
+				t.Errorf("StripeEnabled() = %v, want %v", cfg.StripeEnabled(), tt.wantStripe)
+			}
+			if cfg.AirwallexEnabled() != tt.wantAirwallex {
+				t.Errorf("AirwallexEnabled() = %v, want %v", cfg.AirwallexEnabled(), tt.wantAirwallex)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvoiceCompany(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+	t.Setenv("INVOICE_COMPANY_NAME", " Acme Trading Ltd ")
+	t.Setenv("INVOICE_COMPANY_ADDRESS", "1 Harbour Road | Wan Chai\nHong Kong")
+	t.Setenv("INVOICE_COMPANY_PHONE", "+852 5555 0100")
+
+	company := LoadConfig().InvoiceCompany
+	if company.Name != "Acme Trading Ltd" || company.Phone != "+852 5555 0100" {
+		t.Errorf("company = %+v", company)
+	}
+	want := []string{"1 Harbour Road", "Wan Chai", "Hong Kong"}
+	if len(company.AddressLines) != len(want) {
+		t.Fatalf("address lines = %q, want %q", company.AddressLines, want)
+	}
+	for i := range want {
+		if company.AddressLines[i] != want[i] {
+			t.Errorf("address line %d = %q, want %q", i, company.AddressLines[i], want[i])
+		}
+	}
+}
+
+func TestLoadConfigProviderHTTPSettings(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+	for _, name := range []string{"AIRWALLEX_HTTP_TIMEOUT", "STRIPE_HTTP_TIMEOUT", "STRIPE_API_BASE_URL"} {
+		t.Setenv(name, "")
+	}
+
+	cfg := LoadConfig()
+	if cfg.AirwallexHTTPTimeout != DefaultAirwallexHTTPTimeout || cfg.StripeHTTPTimeout != DefaultStripeHTTPTimeout || cfg.StripeAPIBaseURL != "" {
+		t.Errorf("defaults = %v, %v, %q, want %v, %v and no base URL", cfg.AirwallexHTTPTimeout, cfg.StripeHTTPTimeout, cfg.StripeAPIBaseURL, DefaultAirwallexHTTPTimeout, DefaultStripeHTTPTimeout)
+	}
+
+	t.Setenv("AIRWALLEX_HTTP_TIMEOUT", "45s")
+	t.Setenv("STRIPE_HTTP_TIMEOUT", "2m")
+	t.Setenv("STRIPE_API_BASE_URL", "http://localhost:12111/")
+	cfg = LoadConfig()
+	if cfg.AirwallexHTTPTimeout != 45*time.Second || cfg.StripeHTTPTimeout != 2*time.Minute {
+		t.Errorf("timeouts = %v, %v, want 45s, 2m", cfg.AirwallexHTTPTimeout, cfg.StripeHTTPTimeout)
+	}
+	if cfg.StripeAPIBaseURL != "http://localhost:12111" {
+		t.Errorf("StripeAPIBaseURL = %q, want http://localhost:12111", cfg.StripeAPIBaseURL)
+	}
+}
+
+func TestLoadConfigDefaultInterval(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+	t.Setenv("DEFAULT_INTERVAL", "")
+	t.Setenv("DEFAULT_INTERVAL_COUNT", "")
+
+	cfg := LoadConfig()
+	if cfg.DefaultInterval != "month" || cfg.DefaultIntervalCount != 1 {
+		t.Errorf("defaults = every %d %s, want every 1 month", cfg.DefaultIntervalCount, cfg.DefaultInterval)
+	}
+
+	t.Setenv("DEFAULT_INTERVAL", " Year ")
+	t.Setenv("DEFAULT_INTERVAL_COUNT", "1")
+	cfg = LoadConfig()
+	if cfg.DefaultInterval != "year" || cfg.DefaultIntervalCount != 1 {
+		t.Errorf("configured = every %d %s, want every 1 year", cfg.DefaultIntervalCount, cfg.DefaultInterval)
+	}
+}
+
+func TestLoadConfigInvoiceNumberFormat(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+	issued := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+
+	t.Setenv("INVOICE_NUMBER_FORMAT", "")
+	if got := LoadConfig().InvoiceNumberFormat.Render(1001, issued); got != "1001" {
+		t.Errorf("unconfigured format renders %q, want 1001", got)
+	}
+
+	t.Setenv("INVOICE_NUMBER_FORMAT", "INV-{year}-{seq:04d}")
+	if got := LoadConfig().InvoiceNumberFormat.Render(7, issued); got != "INV-2026-0007" {
+		t.Errorf("configured format renders %q, want INV-2026-0007", got)
+	}
+}
+
+func TestLoadConfigInvoiceCounterStore(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+
+	// Upgrades keep the channel-message counter unless a persistent store is configured
+	t.Setenv("INVOICE_COUNTER_STORE", "")
+	t.Setenv("INVOICE_COUNTER_PATH", "")
+	if cfg := LoadConfig(); cfg.InvoiceCounterStore != "slack" || cfg.InvoiceCounterPath != "" {
+		t.Errorf("unconfigured store = %q at %q, want slack with no path", cfg.InvoiceCounterStore, cfg.InvoiceCounterPath)
+	}
+
+	t.Setenv("INVOICE_COUNTER_STORE", "Bolt")
+	t.Setenv("INVOICE_COUNTER_PATH", "/data/invoice_counters.db")
+	if cfg := LoadConfig(); cfg.InvoiceCounterStore != "bolt" || cfg.InvoiceCounterPath != "/data/invoice_counters.db" {
+		t.Errorf("configured store = %q at %q, want bolt at /data/invoice_counters.db", cfg.InvoiceCounterStore, cfg.InvoiceCounterPath)
+	}
+}
+
+func TestLoadConfigAuditDBPath(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+	t.Setenv("AUDIT_LOG_PATH", "")
+	t.Setenv("AUDIT_DB_PATH", "/data/audit.db")
+
+	if cfg := LoadConfig(); cfg.AuditDBPath != "/data/audit.db" || cfg.AuditLogPath != "" {
+		t.Errorf("audit paths = %q (db), %q (log), want only the database", cfg.AuditDBPath, cfg.AuditLogPath)
+	}
+}
+
+func TestLoadConfigLogging(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("STRIPE_API_KEY", "sk_test_123")
+
+	t.Setenv("LOG_FORMAT", "")
+	t.Setenv("LOG_LEVEL", "")
+	if cfg := LoadConfig(); cfg.LogFormat != "plain" || cfg.LogLevel != slog.LevelInfo {
+		t.Errorf("unconfigured logging = %q at %v, want plain at INFO", cfg.LogFormat, cfg.LogLevel)
+	}
+
+	t.Setenv("LOG_FORMAT", "JSON")
+	t.Setenv("LOG_LEVEL", "debug")
+	if cfg := LoadConfig(); cfg.LogFormat != "json" || cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("configured logging = %q at %v, want json at DEBUG", cfg.LogFormat, cfg.LogLevel)
+	}
+}
@@ -0,0 +1,169 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("invoice_counters")
+
+// errUnchanged aborts a bolt transaction that has nothing to write
+var errUnchanged = errors.New("counter unchanged")
+
+// BoltCounterStore keeps counters in a bolt database. Every change is committed and synced to
+// disk before it returns. The database is locked to one process, so replicas can't share it.
+type BoltCounterStore struct {
+	db   *bolt.DB
+	opts options
+}
+
+// NewBoltCounterStore opens (or creates) a bolt database at path
+func NewBoltCounterStore(path string, opts ...Option) (*BoltCounterStore, error) {
+	// Waiting forever for the file lock would hang startup if another process holds it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open counter database %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize counter database %s: %w", path, err)
+	}
+	return &BoltCounterStore{db: db, opts: newOptions(opts)}, nil
+}
+
+// Close releases the database and its file lock
+func (b *BoltCounterStore) Close() error {
+	return b.db.Close()
+}
+
+// Next reserves the next invoice number for the channel
+func (b *BoltCounterStore) Next(ctx context.Context, teamID, channelID string) (int, error) {
+	var next int
+	err := b.update(ctx, teamID, channelID, func(last int) (int, error) {
+		next = last + 1
+		return next, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// Last returns the last used invoice number for the channel
+func (b *BoltCounterStore) Last(ctx context.Context, teamID, channelID string) (int, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	last, ok, err := b.get(key)
+	if err != nil || ok {
+		return last, err
+	}
+	return b.opts.seedOrDefault(ctx, teamID, channelID)
+}
+
+// Set overwrites the last used invoice number for the channel
+func (b *BoltCounterStore) Set(ctx context.Context, teamID, channelID string, last int) error {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), []byte(strconv.Itoa(last)))
+	})
+}
+
+// Advance raises the last used invoice number for the channel to last if it's lower
+func (b *BoltCounterStore) Advance(ctx context.Context, teamID, channelID string, last int) (bool, error) {
+	err := b.update(ctx, teamID, channelID, func(previous int) (int, error) {
+		if last <= previous {
+			return 0, errUnchanged
+		}
+		return last, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release moves the counter back before reserved if nothing was reserved after it
+func (b *BoltCounterStore) Release(ctx context.Context, teamID, channelID string, reserved int) (bool, error) {
+	err := b.update(ctx, teamID, channelID, func(last int) (int, error) {
+		if last != reserved {
+			return 0, errUnchanged
+		}
+		return reserved - 1, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// update replaces the channel's last used number with change(last) in one transaction. A
+// channel with no counter is seeded first, outside the transaction so the seed's API calls
+// don't hold the database lock.
+func (b *BoltCounterStore) update(ctx context.Context, teamID, channelID string, change func(last int) (int, error)) error {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return err
+	}
+
+	_, ok, err := b.get(key)
+	if err != nil {
+		return err
+	}
+	seeded := DefaultStart
+	if !ok {
+		if seeded, err = b.opts.seedOrDefault(ctx, teamID, channelID); err != nil {
+			return err
+		}
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		last, ok, err := parseCounter(key, bucket.Get([]byte(key)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			last = seeded
+		}
+		next, err := change(last)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), []byte(strconv.Itoa(next)))
+	})
+}
+
+// get reads the channel's counter, reporting whether it has one
+func (b *BoltCounterStore) get(key string) (last int, ok bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		last, ok, err = parseCounter(key, tx.Bucket(boltBucket).Get([]byte(key)))
+		return err
+	})
+	return last, ok, err
+}
+
+func parseCounter(key string, value []byte) (int, bool, error) {
+	if value == nil {
+		return 0, false, nil
+	}
+	last, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid counter %q stored for %s: %w", value, key, err)
+	}
+	return last, true, nil
+}
@@ -0,0 +1,155 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// SlackCounterStore is the default backend. It keeps the counter as bare-number messages in the
+// invoice channel itself, so it needs no storage of its own and survives container restarts.
+//
+// Reading and posting the counter are separate API calls, so each channel has a lock held
+// across both. This keeps numbers distinct within one process only, so run a single replica.
+type SlackCounterStore struct {
+	client *slack.Client
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewSlackCounterStore creates a counter store backed by channel messages
+func NewSlackCounterStore(client *slack.Client) *SlackCounterStore {
+	return &SlackCounterStore{client: client, locks: make(map[string]*sync.Mutex)}
+}
+
+// lock takes the channel's lock and returns the function that releases it
+func (s *SlackCounterStore) lock(teamID, channelID string) (func(), error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[key] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock, nil
+}
+
+// Next reads the last number from the channel and posts the incremented one
+func (s *SlackCounterStore) Next(ctx context.Context, teamID, channelID string) (int, error) {
+	unlock, err := s.lock(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	last, err := s.last(ctx, channelID)
+	if err != nil {
+		return 0, err
+	}
+	next := last + 1
+	if err := s.post(ctx, channelID, next); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// Last scans recent channel messages for the most recent one that is only a number
+func (s *SlackCounterStore) Last(ctx context.Context, teamID, channelID string) (int, error) {
+	if _, err := counterKey(teamID, channelID); err != nil {
+		return 0, err
+	}
+	return s.last(ctx, channelID)
+}
+
+// Set posts the number to the channel as a plain message
+func (s *SlackCounterStore) Set(ctx context.Context, teamID, channelID string, last int) error {
+	unlock, err := s.lock(teamID, channelID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.post(ctx, channelID, last)
+}
+
+// Advance posts the number to the channel if it's higher than the last one there
+func (s *SlackCounterStore) Advance(ctx context.Context, teamID, channelID string, last int) (bool, error) {
+	unlock, err := s.lock(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := s.last(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+	if last <= current {
+		return false, nil
+	}
+	if err := s.post(ctx, channelID, last); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release posts the number before reserved if reserved is still the last one in the channel
+func (s *SlackCounterStore) Release(ctx context.Context, teamID, channelID string, reserved int) (bool, error) {
+	unlock, err := s.lock(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := s.last(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+	if current != reserved {
+		return false, nil
+	}
+	if err := s.post(ctx, channelID, reserved-1); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SlackCounterStore) last(ctx context.Context, channelID string) (int, error) {
+	history, err := s.client.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     100, // Check last 100 messages for counter
+	})
+	if err != nil {
+		log.Printf("Error getting conversation history for channel %s: %v", channelID, err)
+		return DefaultStart, nil
+	}
+
+	for _, message := range history.Messages {
+		if last, err := strconv.Atoi(strings.TrimSpace(message.Text)); err == nil {
+			return last, nil
+		}
+	}
+
+	log.Printf("No invoice counter found in channel %s, using default starting number %d", channelID, DefaultStart)
+	return DefaultStart, nil
+}
+
+func (s *SlackCounterStore) post(ctx context.Context, channelID string, last int) error {
+	_, _, err := s.client.PostMessageContext(ctx, channelID, slack.MsgOptionText(strconv.Itoa(last), false))
+	if err != nil {
+		return fmt.Errorf("failed to post invoice number to channel %s: %w", channelID, err)
+	}
+	return nil
+}
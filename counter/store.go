@@ -0,0 +1,329 @@
+package counter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"paymentbot/utils"
+)
+
+// DefaultStart is the "last used" number for a channel that has no counter yet,
+// so the first invoice is numbered DefaultStart+1.
+const DefaultStart = 1000
+
+// CounterStore persists the last used invoice number per team and channel
+type CounterStore interface {
+	// Next reserves and returns the next invoice number. Concurrent callers get distinct numbers.
+	Next(ctx context.Context, teamID, channelID string) (int, error)
+	// Last returns the last used invoice number without reserving a new one
+	Last(ctx context.Context, teamID, channelID string) (int, error)
+	// Set overwrites the last used invoice number
+	Set(ctx context.Context, teamID, channelID string, last int) error
+	// Advance raises the last used invoice number to last if it's currently lower, reporting
+	// whether it changed. It never moves the counter back past numbers Next handed out meanwhile.
+	Advance(ctx context.Context, teamID, channelID string, last int) (bool, error)
+	// Release hands back a number from Next that ended up unused. It only takes effect while
+	// that number is still the last one handed out, reporting whether it did.
+	Release(ctx context.Context, teamID, channelID string, reserved int) (bool, error)
+}
+
+// SeedFunc returns the last used invoice number for a channel the store has no counter for yet,
+// so a new store carries on from the previous backend's numbering
+type SeedFunc func(ctx context.Context, teamID, channelID string) (int, error)
+
+// Option customizes a persistent counter store
+type Option func(*options)
+
+type options struct {
+	seed SeedFunc
+}
+
+// WithSeed makes the store ask seed for the last used number of channels it hasn't seen before,
+// instead of starting them at DefaultStart
+func WithSeed(seed SeedFunc) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// seedOrDefault returns the seeded last used number for a channel with no counter, or
+// DefaultStart when there's no seed or it has no number for the channel
+func (o options) seedOrDefault(ctx context.Context, teamID, channelID string) (int, error) {
+	if o.seed == nil {
+		return DefaultStart, nil
+	}
+	last, err := o.seed(ctx, teamID, channelID)
+	if err != nil {
+		// Starting over would reissue numbers the previous backend already handed out
+		return 0, fmt.Errorf("failed to seed the invoice counter for channel %s: %w", channelID, err)
+	}
+	if last < DefaultStart {
+		return DefaultStart, nil
+	}
+	return last, nil
+}
+
+func counterKey(teamID, channelID string) (string, error) {
+	if teamID == "" || channelID == "" {
+		return "", fmt.Errorf("team and channel are required for the invoice counter (team=%q, channel=%q)", teamID, channelID)
+	}
+	return teamID + "/" + channelID, nil
+}
+
+// MemoryCounterStore keeps counters in memory. Counters reset on restart.
+type MemoryCounterStore struct {
+	mu       sync.Mutex
+	counters map[string]int
+}
+
+// NewMemoryCounterStore creates an empty in-memory counter store
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{counters: make(map[string]int)}
+}
+
+// Next reserves the next invoice number for the channel
+func (m *MemoryCounterStore) Next(ctx context.Context, teamID, channelID string) (int, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := lastOrDefault(m.counters, key) + 1
+	m.counters[key] = next
+	return next, nil
+}
+
+// Last returns the last used invoice number for the channel
+func (m *MemoryCounterStore) Last(ctx context.Context, teamID, channelID string) (int, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return lastOrDefault(m.counters, key), nil
+}
+
+// Set overwrites the last used invoice number for the channel
+func (m *MemoryCounterStore) Set(ctx context.Context, teamID, channelID string, last int) error {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key] = last
+	return nil
+}
+
+// Release moves the counter back before reserved if nothing was reserved after it
+func (m *MemoryCounterStore) Release(ctx context.Context, teamID, channelID string, reserved int) (bool, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if lastOrDefault(m.counters, key) != reserved {
+		return false, nil
+	}
+	m.counters[key] = reserved - 1
+	return true, nil
+}
+
+// Advance raises the last used invoice number for the channel to last if it's lower
+func (m *MemoryCounterStore) Advance(ctx context.Context, teamID, channelID string, last int) (bool, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if last <= lastOrDefault(m.counters, key) {
+		return false, nil
+	}
+	m.counters[key] = last
+	return true, nil
+}
+
+// FileCounterStore keeps counters in memory and mirrors them to a JSON file so they survive restarts
+type FileCounterStore struct {
+	mu       sync.Mutex
+	path     string
+	counters map[string]int
+	opts     options
+}
+
+// NewFileCounterStore loads (or creates) a JSON-backed counter store at path
+func NewFileCounterStore(path string, opts ...Option) (*FileCounterStore, error) {
+	store := &FileCounterStore{path: path, counters: make(map[string]int), opts: newOptions(opts)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read counter store %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.counters); err != nil {
+			return nil, fmt.Errorf("failed to parse counter store %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// Next reserves the next invoice number for the channel and persists it before returning
+func (f *FileCounterStore) Next(ctx context.Context, teamID, channelID string) (int, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last, err := f.last(ctx, key, teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	next := last + 1
+	f.counters[key] = next
+	if err := f.persist(); err != nil {
+		// Roll back so a failed write doesn't skip a number
+		f.counters[key] = last
+		return 0, err
+	}
+	return next, nil
+}
+
+// Last returns the last used invoice number for the channel
+func (f *FileCounterStore) Last(ctx context.Context, teamID, channelID string) (int, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last(ctx, key, teamID, channelID)
+}
+
+// Set overwrites the last used invoice number for the channel and rewrites the backing file
+func (f *FileCounterStore) Set(ctx context.Context, teamID, channelID string, last int) error {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous, existed := f.counters[key]
+	f.counters[key] = last
+	if err := f.persist(); err != nil {
+		if existed {
+			f.counters[key] = previous
+		} else {
+			delete(f.counters, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Advance raises the last used invoice number for the channel to last if it's lower, and
+// rewrites the backing file when it does
+func (f *FileCounterStore) Advance(ctx context.Context, teamID, channelID string, last int) (bool, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous, err := f.last(ctx, key, teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+	if last <= previous {
+		return false, nil
+	}
+	f.counters[key] = last
+	if err := f.persist(); err != nil {
+		f.counters[key] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// Release moves the counter back before reserved if nothing was reserved after it, and
+// rewrites the backing file when it does
+func (f *FileCounterStore) Release(ctx context.Context, teamID, channelID string, reserved int) (bool, error) {
+	key, err := counterKey(teamID, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if last, err := f.last(ctx, key, teamID, channelID); err != nil || last != reserved {
+		return false, err
+	}
+	f.counters[key] = reserved - 1
+	if err := f.persist(); err != nil {
+		f.counters[key] = reserved
+		return false, err
+	}
+	return true, nil
+}
+
+// last returns the channel's last used number, seeding it on first use. Callers must hold f.mu.
+func (f *FileCounterStore) last(ctx context.Context, key, teamID, channelID string) (int, error) {
+	if last, ok := f.counters[key]; ok {
+		return last, nil
+	}
+	last, err := f.opts.seedOrDefault(ctx, teamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	// Kept in memory only; the next write persists it along with the new number
+	f.counters[key] = last
+	return last, nil
+}
+
+// persist writes the counters to disk. Callers must hold f.mu.
+func (f *FileCounterStore) persist() error {
+	data, err := json.MarshalIndent(f.counters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode counter store: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save counter store: %w", err)
+	}
+	return nil
+}
+
+func lastOrDefault(counters map[string]int, key string) int {
+	if last, ok := counters[key]; ok {
+		return last
+	}
+	return DefaultStart
+}
@@ -0,0 +1,314 @@
+package counter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// fakeSlackChannels serves conversations.history and chat.postMessage from in-memory
+// channels. Each call is slow enough that unserialized read-then-post counters would collide.
+type fakeSlackChannels struct {
+	mu       sync.Mutex
+	messages map[string][]string // newest first
+}
+
+func newFakeSlackClient(t *testing.T) *slack.Client {
+	t.Helper()
+	f := &fakeSlackChannels{messages: map[string][]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		time.Sleep(time.Millisecond)
+		channel := r.Form.Get("channel")
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch filepath.Base(r.URL.Path) {
+		case "chat.postMessage":
+			f.messages[channel] = append([]string{r.Form.Get("text")}, f.messages[channel]...)
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "channel": channel, "ts": "1.0"})
+		case "conversations.history":
+			var history []map[string]string
+			for _, text := range f.messages[channel] {
+				history = append(history, map[string]string{"type": "message", "text": text})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "messages": history})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func newStores(t *testing.T) map[string]CounterStore {
+	t.Helper()
+	file, err := NewFileCounterStore(filepath.Join(t.TempDir(), "counters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]CounterStore{
+		"memory": NewMemoryCounterStore(),
+		"file":   file,
+		"bolt":   newBoltStore(t, filepath.Join(t.TempDir(), "counters.db")),
+		"slack":  NewSlackCounterStore(newFakeSlackClient(t)),
+	}
+}
+
+func newBoltStore(t *testing.T, path string, opts ...Option) *BoltCounterStore {
+	t.Helper()
+	store, err := NewBoltCounterStore(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestNextIsUniqueUnderConcurrency(t *testing.T) {
+	const workers = 20
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			var wg sync.WaitGroup
+			numbers := make(chan int, workers*2)
+			for i := 0; i < workers; i++ {
+				wg.Add(2)
+				// Two channels in parallel, so per-channel locking doesn't serialize everything
+				for _, channel := range []string{"C1", "C2"} {
+					go func(channel string) {
+						defer wg.Done()
+						n, err := store.Next(ctx, "T1", channel)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if channel == "C1" {
+							numbers <- n
+						}
+					}(channel)
+				}
+			}
+			wg.Wait()
+			close(numbers)
+
+			seen := map[int]bool{}
+			for n := range numbers {
+				if seen[n] {
+					t.Errorf("number %d was handed out twice", n)
+				}
+				seen[n] = true
+			}
+			if len(seen) != workers {
+				t.Errorf("got %d distinct numbers, want %d", len(seen), workers)
+			}
+			for n := DefaultStart + 1; n <= DefaultStart+workers; n++ {
+				if !seen[n] {
+					t.Errorf("number %d was skipped", n)
+				}
+			}
+		})
+	}
+}
+
+func TestAdvanceOnlyMovesForward(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if advanced, err := store.Advance(ctx, "T1", "C1", 1500); err != nil || !advanced {
+				t.Fatalf("Advance(1500) = %t, %v, want true", advanced, err)
+			}
+			if advanced, err := store.Advance(ctx, "T1", "C1", 1200); err != nil || advanced {
+				t.Fatalf("Advance(1200) = %t, %v, want false", advanced, err)
+			}
+			if next, _ := store.Next(ctx, "T1", "C1"); next != 1501 {
+				t.Errorf("Next after Advance = %d, want 1501", next)
+			}
+		})
+	}
+}
+
+func TestReleaseOnlyUndoesTheLatestNumber(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			first, _ := store.Next(ctx, "T1", "C1")
+			second, _ := store.Next(ctx, "T1", "C1")
+
+			// A later number was handed out, so the first one's gap can't be closed
+			if released, err := store.Release(ctx, "T1", "C1", first); err != nil || released {
+				t.Fatalf("Release(%d) = %t, %v, want false", first, released, err)
+			}
+			if released, err := store.Release(ctx, "T1", "C1", second); err != nil || !released {
+				t.Fatalf("Release(%d) = %t, %v, want true", second, released, err)
+			}
+			if next, _ := store.Next(ctx, "T1", "C1"); next != second {
+				t.Errorf("Next after Release = %d, want the released %d", next, second)
+			}
+		})
+	}
+}
+
+func TestCounterRequiresTeamAndChannel(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Next(context.Background(), "", "C1"); err == nil {
+				t.Error("Next without a team: want error")
+			}
+			if _, err := store.Next(context.Background(), "T1", ""); err == nil {
+				t.Error("Next without a channel: want error")
+			}
+		})
+	}
+}
+
+func TestSetAndLastAreScopedToTheChannel(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if last, err := store.Last(ctx, "T1", "C1"); err != nil || last != DefaultStart {
+				t.Fatalf("Last on a new channel = %d, %v, want %d", last, err, DefaultStart)
+			}
+			if err := store.Set(ctx, "T1", "C1", 1999); err != nil {
+				t.Fatal(err)
+			}
+			if next, _ := store.Next(ctx, "T1", "C1"); next != 2000 {
+				t.Errorf("Next after Set(1999) = %d, want 2000", next)
+			}
+			if last, _ := store.Last(ctx, "T1", "C2"); last != DefaultStart {
+				t.Errorf("Last in another channel = %d, want %d", last, DefaultStart)
+			}
+		})
+	}
+}
+
+func TestFileCounterStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.json")
+	store, err := NewFileCounterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Next(ctx, "T1", "C1")
+	store.Next(ctx, "T1", "C1")
+
+	reopened, err := NewFileCounterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := reopened.Next(ctx, "T1", "C1"); next != DefaultStart+3 {
+		t.Errorf("Next after restart = %d, want %d", next, DefaultStart+3)
+	}
+}
+
+func TestFileCounterStoreRejectsACorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileCounterStore(path); err == nil {
+		t.Error("NewFileCounterStore accepted a corrupt file, want an error rather than counters restarting")
+	}
+}
+
+func TestBoltCounterStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.db")
+	store, err := NewBoltCounterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Next(ctx, "T1", "C1")
+	store.Next(ctx, "T1", "C1")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newBoltStore(t, path)
+	if next, _ := reopened.Next(ctx, "T1", "C1"); next != DefaultStart+3 {
+		t.Errorf("Next after restart = %d, want %d", next, DefaultStart+3)
+	}
+}
+
+func TestPersistentStoresSeedNewChannels(t *testing.T) {
+	ctx := context.Background()
+	// The legacy channel-message counter is at 1041 in C1 and has never been used in C2
+	legacy := NewSlackCounterStore(newFakeSlackClient(t))
+	if err := legacy.Set(ctx, "T1", "C1", 1041); err != nil {
+		t.Fatal(err)
+	}
+	var seeds int
+	seed := func(ctx context.Context, teamID, channelID string) (int, error) {
+		seeds++
+		return legacy.Last(ctx, teamID, channelID)
+	}
+
+	file, err := NewFileCounterStore(filepath.Join(t.TempDir(), "counters.json"), WithSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]CounterStore{
+		"file": file,
+		"bolt": newBoltStore(t, filepath.Join(t.TempDir(), "counters.db"), WithSeed(seed)),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			seeds = 0
+			if last, err := store.Last(ctx, "T1", "C1"); err != nil || last != 1041 {
+				t.Errorf("Last = %d, %v, want 1041 from the legacy counter", last, err)
+			}
+			if next, err := store.Next(ctx, "T1", "C1"); err != nil || next != 1042 {
+				t.Errorf("Next = %d, %v, want 1042", next, err)
+			}
+			// Once a channel has its own counter the legacy one isn't read again
+			seeds = 0
+			if next, err := store.Next(ctx, "T1", "C1"); err != nil || next != 1043 {
+				t.Errorf("Next = %d, %v, want 1043", next, err)
+			}
+			if seeds != 0 {
+				t.Errorf("seeded %d times after the channel's first number, want 0", seeds)
+			}
+			if next, err := store.Next(ctx, "T1", "C2"); err != nil || next != DefaultStart+1 {
+				t.Errorf("Next in an unused channel = %d, %v, want %d", next, err, DefaultStart+1)
+			}
+			if last, _ := legacy.Last(ctx, "T1", "C1"); last != 1041 {
+				t.Errorf("legacy counter = %d, want it left at 1041", last)
+			}
+		})
+	}
+}
+
+func TestSeedFailureDoesntRestartNumbering(t *testing.T) {
+	ctx := context.Background()
+	seed := func(ctx context.Context, teamID, channelID string) (int, error) {
+		return 0, errors.New("slack is down")
+	}
+
+	file, err := NewFileCounterStore(filepath.Join(t.TempDir(), "counters.json"), WithSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]CounterStore{
+		"file": file,
+		"bolt": newBoltStore(t, filepath.Join(t.TempDir(), "counters.db"), WithSeed(seed)),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if next, err := store.Next(ctx, "T1", "C1"); err == nil {
+				t.Errorf("Next = %d, want an error rather than restarting at %d", next, DefaultStart+1)
+			}
+		})
+	}
+}
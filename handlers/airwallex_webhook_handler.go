@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"paymentbot/services"
+)
+
+// airwallexSignatureTolerance is how far the x-timestamp header may drift from now
+const airwallexSignatureTolerance = 5 * time.Minute
+
+// AirwallexWebhookHandler handles Airwallex webhook events
+type AirwallexWebhookHandler struct {
+	secret  string
+	service *services.SlackService
+}
+
+// NewAirwallexWebhookHandler creates a new Airwallex webhook handler
+func NewAirwallexWebhookHandler(secret string, svc *services.SlackService) *AirwallexWebhookHandler {
+	return &AirwallexWebhookHandler{
+		secret:  secret,
+		service: svc,
+	}
+}
+
+// airwallexEvent is the envelope Airwallex wraps every webhook notification in
+type airwallexEvent struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// airwallexPaymentObject holds the fields we use from payment intent and payment link objects
+type airwallexPaymentObject struct {
+	ID              string  `json:"id"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency"`
+	Reference       string  `json:"reference"`
+	MerchantOrderID string  `json:"merchant_order_id"`
+	PaymentLinkID   string  `json:"payment_link_id"`
+}
+
+// HandleWebhook processes incoming Airwallex webhook events
+func (h *AirwallexWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	const MaxBodyBytes = int64(65536)
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[Airwallex Webhook] Error reading payload: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := verifyAirwallexSignature(payload, r.Header.Get("x-timestamp"), r.Header.Get("x-signature"), h.secret, time.Now()); err != nil {
+		log.Printf("[Airwallex Webhook] Error verifying signature: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var event airwallexEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("[Airwallex Webhook] Error parsing event: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log.Printf("[Airwallex Webhook] Received event %s (%s)", event.Name, event.ID)
+
+	switch event.Name {
+	case "payment_intent.succeeded", "payment_link.paid":
+		h.handlePaymentSucceeded(r, event)
+	default:
+		log.Printf("[Airwallex Webhook] Unhandled event type: %s", event.Name)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePaymentSucceeded routes a successful payment back to the Slack channel the link came from
+func (h *AirwallexWebhookHandler) handlePaymentSucceeded(r *http.Request, event airwallexEvent) {
+	var object airwallexPaymentObject
+	if err := json.Unmarshal(event.Data.Object, &object); err != nil {
+		log.Printf("[Airwallex Webhook] Error parsing %s object: %v", event.Name, err)
+		return
+	}
+
+	// Payment intents point at their link; payment link events are the link itself
+	keys := []string{object.PaymentLinkID, object.Reference, object.MerchantOrderID}
+	if event.Name == "payment_link.paid" {
+		keys = append([]string{object.ID}, keys...)
+	}
+
+	if err := h.service.NotifyPaymentReceived(r.Context(), keys, object.Amount, object.Currency); err != nil {
+		log.Printf("[Airwallex Webhook] Error notifying Slack about %s: %v", event.ID, err)
+	}
+}
+
+// verifyAirwallexSignature checks the x-signature header, which is the hex HMAC-SHA256 of
+// the x-timestamp header (milliseconds) followed by the raw body
+func verifyAirwallexSignature(payload []byte, timestamp, signature, secret string, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("AIRWALLEX_WEBHOOK_SECRET is not set")
+	}
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("missing x-timestamp or x-signature header")
+	}
+
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid x-timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.UnixMilli(millis)); age > airwallexSignatureTolerance || age < -airwallexSignatureTolerance {
+		return fmt.Errorf("timestamp outside the %s tolerance", airwallexSignatureTolerance)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signAirwallex(payload []byte, timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyAirwallexSignature(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"name":"payment_intent.succeeded","data":{"object":{"id":"int_1"}}}`)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	stale := strconv.FormatInt(now.Add(-airwallexSignatureTolerance-time.Second).UnixMilli(), 10)
+	future := strconv.FormatInt(now.Add(airwallexSignatureTolerance+time.Second).UnixMilli(), 10)
+	valid := signAirwallex(payload, timestamp, secret)
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		timestamp string
+		signature string
+		secret    string
+		wantErr   string
+	}{
+		{"valid", payload, timestamp, valid, secret, ""},
+		{"within tolerance", payload, strconv.FormatInt(now.Add(-4*time.Minute).UnixMilli(), 10),
+			signAirwallex(payload, strconv.FormatInt(now.Add(-4*time.Minute).UnixMilli(), 10), secret), secret, ""},
+		{"tampered body", []byte(`{"name":"payment_intent.succeeded","data":{"object":{"id":"int_2"}}}`), timestamp, valid, secret, "signature mismatch"},
+		{"wrong secret", payload, timestamp, signAirwallex(payload, timestamp, "other"), secret, "signature mismatch"},
+		{"stale timestamp", payload, stale, signAirwallex(payload, stale, secret), secret, "tolerance"},
+		{"future timestamp", payload, future, signAirwallex(payload, future, secret), secret, "tolerance"},
+		{"non-numeric timestamp", payload, "yesterday", valid, secret, "invalid x-timestamp"},
+		{"missing timestamp", payload, "", valid, secret, "missing"},
+		{"missing signature", payload, timestamp, "", secret, "missing"},
+		{"missing secret", payload, timestamp, valid, "", "AIRWALLEX_WEBHOOK_SECRET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyAirwallexSignature(tt.payload, tt.timestamp, tt.signature, tt.secret, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyAirwallexSignature error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyAirwallexSignature error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
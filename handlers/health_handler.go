@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// readinessCacheTTL is how long a readiness result is reused so probes don't hammer Slack
+const readinessCacheTTL = 15 * time.Second
+
+// slackAuthTimeout bounds the auth.test call made by a readiness check
+const slackAuthTimeout = 5 * time.Second
+
+// readinessResult is the /readyz response body
+type readinessResult struct {
+	Status  string            `json:"status"`
+	Checks  map[string]string `json:"checks"`
+	Failing []string          `json:"failing,omitempty"`
+}
+
+// HealthHandler serves /healthz (the process is up) and /readyz (it can serve Slack requests)
+type HealthHandler struct {
+	slackClient *slack.Client
+	providers   map[string]bool // provider name -> credentials configured
+	startedAt   time.Time
+
+	mu        sync.Mutex
+	cached    *readinessResult
+	checkedAt time.Time
+}
+
+// NewHealthHandler creates the health handler. providers maps each provider's display name
+// to whether its credentials are configured.
+func NewHealthHandler(slackClient *slack.Client, providers map[string]bool) *HealthHandler {
+	return &HealthHandler{slackClient: slackClient, providers: providers, startedAt: time.Now()}
+}
+
+// HandleHealth always returns 200 with basic build information
+func (h *HealthHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	body := map[string]string{
+		"status": "ok",
+		"uptime": time.Since(h.startedAt).Round(time.Second).String(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		body["go_version"] = info.GoVersion
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				body["revision"] = setting.Value
+			case "vcs.time":
+				body["build_time"] = setting.Value
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// HandleReady returns 200 when Slack auth works and at least one payment provider is
+// configured, and 503 listing the failing dependencies otherwise
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	result := h.readiness(r.Context())
+	status := http.StatusOK
+	if len(result.Failing) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, result)
+}
+
+// readiness returns the cached result while it is fresh, checking again otherwise
+func (h *HealthHandler) readiness(ctx context.Context) *readinessResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached != nil && time.Since(h.checkedAt) < readinessCacheTTL {
+		return h.cached
+	}
+
+	result := &readinessResult{Status: "ready", Checks: make(map[string]string)}
+
+	authCtx, cancel := context.WithTimeout(ctx, slackAuthTimeout)
+	defer cancel()
+	if _, err := h.slackClient.AuthTestContext(authCtx); err != nil {
+		log.Printf("[Health] Slack auth.test failed: %v", err)
+		result.Checks["slack"] = err.Error()
+		result.Failing = append(result.Failing, "slack")
+	} else {
+		result.Checks["slack"] = "ok"
+	}
+
+	anyProvider := false
+	for name, configured := range h.providers {
+		if configured {
+			result.Checks[name] = "configured"
+			anyProvider = true
+		} else {
+			result.Checks[name] = "not configured"
+		}
+	}
+	if !anyProvider {
+		result.Failing = append(result.Failing, "payment_provider")
+	}
+
+	if len(result.Failing) > 0 {
+		result.Status = "not ready"
+	}
+	h.cached = result
+	h.checkedAt = time.Now()
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
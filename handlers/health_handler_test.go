@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// newAuthTestSlack fakes Slack's auth.test, succeeding when authOK is true, and counts the calls
+func newAuthTestSlack(t *testing.T, authOK bool) (*slack.Client, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if authOK {
+			w.Write([]byte(`{"ok":true,"team_id":"T1","user_id":"U_BOT"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+	}))
+	t.Cleanup(server.Close)
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+	return slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")), count
+}
+
+func TestHandleHealth(t *testing.T) {
+	client, authCalls := newAuthTestSlack(t, false)
+	h := NewHealthHandler(client, map[string]bool{"Stripe": false})
+
+	rec := httptest.NewRecorder()
+	h.HandleHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	if body["status"] != "ok" || body["uptime"] == "" || body["go_version"] == "" {
+		t.Errorf("body = %v, want status, uptime and go_version", body)
+	}
+	// Liveness doesn't depend on Slack
+	if calls := authCalls(); calls != 0 {
+		t.Errorf("made %d auth.test calls, want none", calls)
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		authOK      bool
+		providers   map[string]bool
+		wantStatus  int
+		wantFailing []string
+	}{
+		{"ready", true, map[string]bool{"Stripe": true, "Airwallex": false}, http.StatusOK, nil},
+		{"slack auth fails", false, map[string]bool{"Stripe": true}, http.StatusServiceUnavailable, []string{"slack"}},
+		{"no provider configured", true, map[string]bool{"Stripe": false, "Airwallex": false}, http.StatusServiceUnavailable, []string{"payment_provider"}},
+		{"nothing works", false, map[string]bool{"Stripe": false}, http.StatusServiceUnavailable, []string{"slack", "payment_provider"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newAuthTestSlack(t, tt.authOK)
+			h := NewHealthHandler(client, tt.providers)
+
+			rec := httptest.NewRecorder()
+			h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var result readinessResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+			}
+			if !reflect.DeepEqual(result.Failing, tt.wantFailing) {
+				t.Errorf("failing = %v, want %v", result.Failing, tt.wantFailing)
+			}
+			if len(result.Checks) != len(tt.providers)+1 {
+				t.Errorf("checks = %v, want Slack and every provider", result.Checks)
+			}
+		})
+	}
+}
+
+func TestHandleReadyCachesTheResult(t *testing.T) {
+	client, authCalls := newAuthTestSlack(t, true)
+	h := NewHealthHandler(client, map[string]bool{"Stripe": true})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("probe %d status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+	if calls := authCalls(); calls != 1 {
+		t.Errorf("made %d auth.test calls for 3 probes, want 1", calls)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := LoggingMiddleware(next, logger, []string{"/healthz"})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/slack/commands", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(rec, req)
+
+	line := logs.String()
+	for _, want := range []string{"method=POST", "path=/slack/commands", "status=418", "request_id=req-1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log %q is missing %s", line, want)
+		}
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "req-1" {
+		t.Errorf("X-Request-ID = %q, want the caller's ID echoed", got)
+	}
+
+	// Excluded paths are served but not logged
+	logs.Reset()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("excluded path status = %d, want the handler to run", rec.Code)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("excluded path was logged: %q", logs.String())
+	}
+}
+
+func TestLoggingMiddlewareGeneratesRequestIDs(t *testing.T) {
+	var logs bytes.Buffer
+	handler := LoggingMiddleware(http.NotFoundHandler(), slog.New(slog.NewTextHandler(&logs, nil)), nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	requestID := rec.Header().Get("X-Request-ID")
+	if len(requestID) != 16 {
+		t.Errorf("X-Request-ID = %q, want a generated 16 hex character ID", requestID)
+	}
+	if !strings.Contains(logs.String(), "request_id="+requestID) {
+		t.Errorf("access log %q doesn't carry the generated ID", logs.String())
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"paymentbot/shortener"
+)
+
+// RedirectHandler serves self-hosted short links (GET /l/{id})
+type RedirectHandler struct {
+	store shortener.LinkStore
+}
+
+// NewRedirectHandler creates a new short link redirect handler
+func NewRedirectHandler(store shortener.LinkStore) *RedirectHandler {
+	return &RedirectHandler{store: store}
+}
+
+// HandleRedirect responds with a 302 to the stored long URL, or 404 for unknown IDs
+func (h *RedirectHandler) HandleRedirect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/l/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	longURL, ok := h.store.Get(id)
+	if !ok {
+		log.Printf("[Redirect] Unknown short link ID: %s", id)
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, longURL, http.StatusFound)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"paymentbot/shortener"
+)
+
+func TestHandleRedirect(t *testing.T) {
+	store := shortener.NewMemoryLinkStore()
+	store.Save("abc123", "https://buy.stripe.com/test_abc123")
+	handler := NewRedirectHandler(store)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"known ID", http.MethodGet, "/l/abc123", http.StatusFound, "https://buy.stripe.com/test_abc123"},
+		{"HEAD", http.MethodHead, "/l/abc123", http.StatusFound, "https://buy.stripe.com/test_abc123"},
+		{"unknown ID", http.MethodGet, "/l/nope", http.StatusNotFound, ""},
+		{"no ID", http.MethodGet, "/l/", http.StatusNotFound, ""},
+		{"nested path", http.MethodGet, "/l/abc123/extra", http.StatusNotFound, ""},
+		{"POST", http.MethodPost, "/l/abc123", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.HandleRedirect(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestShortLinksRedirectToTheLongURL(t *testing.T) {
+	store := shortener.NewMemoryLinkStore()
+	short, err := shortener.NewRedirectShortener("https://pay.example.test", store).Shorten(context.Background(), "https://checkout.airwallex.com/pay/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewRedirectHandler(store).HandleRedirect(rec, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(short, "https://pay.example.test"), nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://checkout.airwallex.com/pay/123" {
+		t.Errorf("GET %s = %d to %q, want a 302 to the long URL", short, rec.Code, rec.Header().Get("Location"))
+	}
+}
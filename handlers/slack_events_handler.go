@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HandleSlackEvents receives Events API callbacks. It answers the URL verification challenge
+// sent when the Request URL is saved, and refreshes the Home tab on app_home_opened.
+func (sh *SlackHandler) HandleSlackEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sh.logger.Warn("Error reading Slack event body", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// As with commands, the team ID picks the signing secret and can't be forged without it
+	var envelope struct {
+		TeamID       string `json:"team_id"`
+		EnterpriseID string `json:"enterprise_id"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		sh.logger.Warn("Error parsing Slack event", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	teamID := envelope.TeamID
+	if teamID == "" {
+		teamID = envelope.EnterpriseID
+	}
+	if err := sh.verifyRequest(r.Header, body, teamID); err != nil {
+		sh.logger.Warn("Error verifying Slack event request", "team_id", teamID, "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		sh.logger.Warn("Error parsing Slack event", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(challenge.Challenge))
+		return
+	case slackevents.CallbackEvent:
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	logger := sh.logger.With("event_type", event.InnerEvent.Type, "team_id", teamID)
+	if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && sh.isSlackRetry(r, callback.EventID, logger) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch inner := event.InnerEvent.Data.(type) {
+	case *slackevents.AppHomeOpenedEvent:
+		if inner.Tab == "home" {
+			logger.Info("Publishing Home tab", "user_id", inner.User)
+			sh.service.PublishAppHome(sh.service.ContextForTeam(r.Context(), teamID), inner.User)
+		}
+	default:
+		logger.Debug("Unhandled Slack event")
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+	"paymentbot/services"
+
+	"github.com/slack-go/slack"
+)
+
+func TestSlackEventsURLVerification(t *testing.T) {
+	handler, _ := newCommandTestHandler(t, models.ProviderAirwallex)
+	body := `{"token":"legacy","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification","team_id":"T1"}`
+
+	rec := httptest.NewRecorder()
+	handler.HandleSlackEvents(rec, signedRequest("/slack/events", body))
+	if rec.Code != http.StatusOK || rec.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("response = %d %q, want 200 with the challenge", rec.Code, rec.Body.String())
+	}
+
+	// Without a valid signature the challenge isn't echoed
+	req := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", "1")
+	req.Header.Set("X-Slack-Signature", "v0=bad")
+	rec = httptest.NewRecorder()
+	handler.HandleSlackEvents(rec, req)
+	if rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "3eZbrw1a") {
+		t.Errorf("unsigned response = %d %q, want 401 without the challenge", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAppHomeOpenedPublishesTheHomeTab(t *testing.T) {
+	handler, views := newCommandTestHandler(t, models.ProviderAirwallex)
+	body := `{
+		"type": "event_callback",
+		"team_id": "T1",
+		"event_id": "Ev1",
+		"event": {"type": "app_home_opened", "user": "U1", "channel": "D1", "tab": "home"}
+	}`
+
+	rec := httptest.NewRecorder()
+	handler.HandleSlackEvents(rec, signedRequest("/slack/events", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	published := views.waitForPublish(t)
+	if published.UserID != "U1" || published.View.Type != slack.VTHomeTab {
+		t.Fatalf("published a %q view for %q, want the Home tab for U1", published.View.Type, published.UserID)
+	}
+	var actionIDs []string
+	for _, block := range published.View.Blocks.BlockSet {
+		if actions, ok := block.(*slack.ActionBlock); ok {
+			for _, element := range actions.Elements.ElementSet {
+				if button, ok := element.(*slack.ButtonBlockElement); ok {
+					actionIDs = append(actionIDs, button.ActionID)
+				}
+			}
+		}
+	}
+	want := []string{services.HomeCreateAirwallexLinkActionID, services.HomeCreateInvoiceActionID}
+	if strings.Join(actionIDs, ",") != strings.Join(want, ",") {
+		t.Errorf("Home tab buttons = %v, want %v", actionIDs, want)
+	}
+	blocks, _ := json.Marshal(published.View.Blocks)
+	if !strings.Contains(string(blocks), "Recent links are listed when the Stripe provider is enabled.") {
+		t.Errorf("Home tab %s doesn't explain the missing list", blocks)
+	}
+}
+
+func TestAppHomeMessagesTabIsNotPublished(t *testing.T) {
+	handler, views := newCommandTestHandler(t, models.ProviderAirwallex)
+	body := `{"type":"event_callback","team_id":"T1","event_id":"Ev2","event":{"type":"app_home_opened","user":"U1","tab":"messages"}}`
+
+	rec := httptest.NewRecorder()
+	handler.HandleSlackEvents(rec, signedRequest("/slack/events", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	views.mu.Lock()
+	defer views.mu.Unlock()
+	if len(views.published) != 0 {
+		t.Errorf("published %d views for the Messages tab, want none", len(views.published))
+	}
+}
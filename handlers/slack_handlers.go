@@ -1,50 +1,107 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"paymentbot/models"
 	"paymentbot/services"
+	"paymentbot/slackresp"
+	"paymentbot/utils"
 
 	"github.com/slack-go/slack"
 )
 
 type SlackHandler struct {
 	service *services.SlackService
+	seen    *seenRequests
+	logger  *slog.Logger
 }
 
-func NewSlackHandler(svc *services.SlackService) *SlackHandler {
-	return &SlackHandler{service: svc}
+// NewSlackHandler creates the Slack command and interaction handler. A nil logger uses slog's default.
+func NewSlackHandler(svc *services.SlackService, logger *slog.Logger) *SlackHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlackHandler{service: svc, seen: newSeenRequests(slackRetryWindow), logger: logger}
+}
+
+// isSlackRetry records the request's ID and reports whether this is a Slack retry of a
+// request that was already handled. First attempts are always processed.
+func (sh *SlackHandler) isSlackRetry(r *http.Request, id string, logger *slog.Logger) bool {
+	duplicate := sh.seen.markSeen(id, time.Now())
+	if !duplicate || r.Header.Get("X-Slack-Retry-Num") == "" {
+		return false
+	}
+	logger.Info("Ignoring Slack retry for already handled request", "request_id", id, "retry_num", r.Header.Get("X-Slack-Retry-Num"), "retry_reason", r.Header.Get("X-Slack-Retry-Reason"))
+	return true
+}
+
+// verifyRequest checks a request's Slack signature against the signing secret of teamID's
+// workspace
+func (sh *SlackHandler) verifyRequest(header http.Header, body []byte, teamID string) error {
+	verifier, err := slack.NewSecretsVerifier(header, sh.service.SigningSecretForTeam(teamID))
+	if err != nil {
+		return err
+	}
+	verifier.Write(body)
+	return verifier.Ensure()
 }
 
 func (sh *SlackHandler) HandleSlackCommands(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received Slack command request: method=%s, url=%s, remote=%s", r.Method, r.URL.String(), r.RemoteAddr)
-	verifier, err := slack.NewSecretsVerifier(r.Header, sh.service.GetSigningSecret())
+	sh.logger.Debug("Received Slack command request", "method", r.Method, "url", r.URL.String(), "remote", r.RemoteAddr)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error creating verifier: %v", err)
+		sh.logger.Warn("Error reading Slack command body", "error", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	r.Body = io.NopCloser(io.TeeReader(r.Body, &verifier))
-	sCmd, err := slack.SlashCommandParse(r)
+	// Team ID can be empty for org-wide installs; fall back to the enterprise ID for counter keying.
+	// It's read before verification to pick the workspace's signing secret; a forged team ID
+	// can't pass verification without that team's secret.
+	form, err := url.ParseQuery(string(body))
 	if err != nil {
-		log.Printf("Error parsing slash command: %v", err)
+		sh.logger.Warn("Error parsing slash command", "error", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	teamID := form.Get("team_id")
+	if teamID == "" {
+		teamID = form.Get("enterprise_id")
+	}
 
-	if err = verifier.Ensure(); err != nil {
-		log.Printf("Error verifying request: %v", err)
+	if err := sh.verifyRequest(r.Header, body, teamID); err != nil {
+		sh.logger.Warn("Error verifying Slack command request", "team_id", teamID, "error", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	log.Printf("Parsed Slack command: command=%s, text=%s, user_id=%s, channel_id=%s, team_id=%s", sCmd.Command, sCmd.Text, sCmd.UserID, sCmd.ChannelID, sCmd.TeamID)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	sCmd, err := slack.SlashCommandParse(r)
+	if err != nil {
+		sh.logger.Warn("Error parsing slash command", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	logger := sh.logger.With("command", sCmd.Command, "team_id", teamID, "channel_id", sCmd.ChannelID, "user_id", sCmd.UserID)
+	logger.Info("Received Slack command", "text", sCmd.Text)
+
+	if sh.isSlackRetry(r, sCmd.TriggerID, logger) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Slack calls for this command go to the workspace it came from
+	ctx := sh.service.ContextForTeam(r.Context(), teamID)
 
 	var provider models.PaymentProvider
 	switch sCmd.Command {
@@ -54,51 +111,179 @@ func (sh *SlackHandler) HandleSlackCommands(w http.ResponseWriter, r *http.Reque
 		provider = models.ProviderAirwallex
 	case "/create-invoice":
 		// Handle invoice command separately
-		if err := sh.service.OpenInvoiceModal(sCmd.TriggerID, sCmd.ChannelID, sCmd.TeamID); err != nil {
-			log.Printf("Error opening invoice modal: %v", err)
-			respondToSlack(w, "Error opening invoice form. Please try again.")
+		if err := sh.service.OpenInvoiceModal(ctx, sCmd.TriggerID, sCmd.ChannelID, teamID); err != nil {
+			logger.Error("Error opening invoice modal", "error", err)
+			slackresp.Ephemeral(w, "Error opening invoice form. Please try again.")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		return
+	case "/invoice-preview":
+		if err := sh.service.OpenInvoicePreviewModal(ctx, sCmd.TriggerID, sCmd.ChannelID, teamID); err != nil {
+			logger.Error("Error opening invoice preview modal", "error", err)
+			slackresp.Ephemeral(w, "Error opening invoice form. Please try again.")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	case "/create-donation-link":
+		if !sh.service.ProviderEnabled(models.ProviderStripe) {
+			slackresp.Ephemeral(w, "Sorry, donation links need the Stripe provider, which isn't enabled on this server.")
+			return
+		}
+		if err := sh.service.OpenDonationModal(ctx, sCmd.TriggerID, sCmd.ChannelID); err != nil {
+			logger.Error("Error opening donation modal", "error", err)
+			slackresp.Ephemeral(w, "Error opening donation form. Please try again.")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	case "/refund-payment":
+		if reply := sh.service.ProcessRefundCommand(ctx, sCmd.UserID, sCmd.ChannelID, sCmd.Text); reply != "" {
+			slackresp.Ephemeral(w, reply)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	case "/webhook-check":
+		slackresp.Ephemeral(w, sh.service.ProcessWebhookCheckCommand(sCmd.UserID))
+		return
+	case "/reconcile-subscriptions":
+		slackresp.Ephemeral(w, sh.service.ProcessReconcileSubscriptionsCommand(ctx, sCmd.UserID, sCmd.ChannelID, sCmd.Text))
+		return
+	case "/list-payments":
+		slackresp.Ephemeral(w, sh.service.ProcessListPaymentsCommand(ctx, sCmd.UserID, sCmd.ChannelID, sCmd.Text))
+		return
+	case "/invoice-counter":
+		slackresp.Ephemeral(w, sh.service.ProcessInvoiceCounterCommand(ctx, sCmd.UserID, teamID, sCmd.ChannelID, sCmd.Text))
+		return
 	default:
-		respondToSlack(w, fmt.Sprintf("Unknown command: %s", sCmd.Command))
+		slackresp.Ephemeral(w, fmt.Sprintf("Unknown command: %s", sCmd.Command))
 		return
 	}
 
-	// Always open the modal, do not parse direct arguments
-	if err := sh.service.OpenPaymentLinkModal(sCmd.TriggerID, provider, sCmd.ChannelID); err != nil {
-		log.Printf("Error opening modal: %v", err)
-		respondToSlack(w, "Error opening payment form. Please try again.")
+	if !sh.service.ProviderEnabled(provider) {
+		logger.Warn("Command used but the provider isn't enabled", "provider", provider)
+		slackresp.Ephemeral(w, fmt.Sprintf("Sorry, the %s provider isn't enabled on this server.", provider))
+		return
+	}
+
+	// Arguments prefill the modal rather than creating the link, so the user still reviews it
+	if strings.TrimSpace(sCmd.Text) != "" {
+		args, err := utils.ParseCommandArguments(sCmd.Text)
+		if err != nil {
+			slackresp.Ephemeral(w, fmt.Sprintf("Error: %v", err))
+			return
+		}
+		if args.IsSubscription && provider != models.ProviderStripe {
+			slackresp.Ephemeral(w, "Error: subscriptions are only available with `/create-stripe-link`.")
+			return
+		}
+		if err := sh.service.OpenPaymentLinkModalWithArguments(ctx, sCmd.TriggerID, provider, sCmd.ChannelID, args); err != nil {
+			logger.Error("Error opening payment modal", "provider", provider, "error", err)
+			slackresp.Ephemeral(w, "Error opening payment form. Please try again.")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := sh.service.OpenPaymentLinkModal(ctx, sCmd.TriggerID, provider, sCmd.ChannelID); err != nil {
+		logger.Error("Error opening payment modal", "provider", provider, "error", err)
+		slackresp.Ephemeral(w, "Error opening payment form. Please try again.")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 func (sh *SlackHandler) HandleSlackInteractions(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received Slack interaction request: method=%s, url=%s, remote=%s", r.Method, r.URL.String(), r.RemoteAddr)
-	payload := r.FormValue("payload")
+	sh.logger.Debug("Received Slack interaction request", "method", r.Method, "url", r.URL.String(), "remote", r.RemoteAddr)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sh.logger.Warn("Error reading Slack interaction body", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		sh.logger.Warn("Error parsing interaction form", "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
 	var interaction slack.InteractionCallback
-	if err := json.Unmarshal([]byte(payload), &interaction); err != nil {
-		log.Printf("Error parsing interaction payload: %v", err)
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		sh.logger.Warn("Error parsing interaction payload", "error", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
+	// As with commands, the team ID picks the signing secret and is only trusted once verified
+	teamID := interaction.Team.ID
+	if teamID == "" {
+		teamID = interaction.Enterprise.ID
+	}
+	if err := sh.verifyRequest(r.Header, body, teamID); err != nil {
+		sh.logger.Warn("Error verifying Slack interaction request", "team_id", teamID, "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Trigger IDs are unique per submission; the view ID covers payloads without one
+	requestID := interaction.TriggerID
+	if requestID == "" {
+		requestID = interaction.View.ID
+	}
+	logger := sh.logger.With("interaction_type", interaction.Type, "callback_id", interaction.View.CallbackID, "team_id", teamID, "user_id", interaction.User.ID)
+	logger.Info("Received Slack interaction")
+
+	if sh.isSlackRetry(r, requestID, logger) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx := sh.service.ContextForTeam(r.Context(), teamID)
+
 	switch interaction.Type {
 	case slack.InteractionTypeViewSubmission:
-		if interaction.View.CallbackID == "invoice_modal" {
-			sh.service.ProcessInvoiceSubmission(w, &interaction)
-		} else {
-			sh.service.ProcessModalSubmission(w, &interaction)
+		switch interaction.View.CallbackID {
+		case "invoice_modal", services.InvoicePreviewCallbackID:
+			sh.service.ProcessInvoiceSubmission(ctx, w, &interaction)
+		case services.DonationModalCallbackID:
+			sh.service.ProcessDonationSubmission(ctx, w, &interaction)
+		case services.PaymentPreviewCallbackID:
+			sh.service.ProcessPaymentPreviewConfirmation(ctx, w, &interaction)
+		case services.InvoiceDuplicateConfirmCallbackID:
+			sh.service.ProcessInvoiceDuplicateConfirmation(ctx, w, &interaction)
+		default:
+			sh.service.ProcessModalSubmission(ctx, w, &interaction)
+		}
+	case slack.InteractionTypeMessageAction:
+		if interaction.CallbackID != services.PaymentLinkShortcutCallbackID {
+			logger.Info("Unhandled message shortcut")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err := sh.service.OpenPaymentLinkModalFromMessage(ctx, interaction.TriggerID, interaction.Channel.ID, interaction.Message.Text); err != nil {
+			logger.Error("Error opening payment modal from message", "error", err)
 		}
+		w.WriteHeader(http.StatusOK)
+	case slack.InteractionTypeBlockActions:
+		for _, action := range interaction.ActionCallback.BlockActions {
+			switch action.ActionID {
+			case services.InvoiceAddLineItemActionID:
+				if err := sh.service.ProcessInvoiceAddLineItem(ctx, &interaction); err != nil {
+					logger.Error("Error adding invoice line item", "error", err)
+				}
+			case services.HomeCreateStripeLinkActionID, services.HomeCreateAirwallexLinkActionID, services.HomeCreateInvoiceActionID:
+				if err := sh.service.OpenModalFromAppHome(ctx, action.ActionID, interaction.TriggerID, interaction.User.ID, teamID); err != nil {
+					logger.Error("Error opening form from the Home tab", "action_id", action.ActionID, "error", err)
+				}
+			}
+		}
+		w.WriteHeader(http.StatusOK)
 	default:
-		log.Printf("Unhandled interaction type: %s", interaction.Type)
+		logger.Info("Unhandled interaction type")
 		w.WriteHeader(http.StatusOK)
 	}
 }
-
-func respondToSlack(w http.ResponseWriter, text string) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"text": text})
-}
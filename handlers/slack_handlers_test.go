@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/config"
+	"paymentbot/models"
+	"paymentbot/payment"
+	"paymentbot/services"
+	"paymentbot/shortener"
+
+	"github.com/slack-go/slack"
+)
+
+const testSigningSecret = "test-signing-secret"
+
+// fakeSlackViews records the views.open and views.publish calls a request makes
+type fakeSlackViews struct {
+	mu        sync.Mutex
+	opened    int
+	views     []slack.View
+	published []publishedView
+}
+
+// publishedView is a views.publish call
+type publishedView struct {
+	UserID string     `json:"user_id"`
+	View   slack.View `json:"view"`
+}
+
+// waitForPublish waits for a views.publish call, since Home tabs are published in the background
+func (f *fakeSlackViews) waitForPublish(t *testing.T) publishedView {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		if len(f.published) > 0 {
+			defer f.mu.Unlock()
+			return f.published[0]
+		}
+		f.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("no views.publish call")
+	return publishedView{}
+}
+
+// newCommandTestHandler builds a handler whose service only has the given providers enabled
+func newCommandTestHandler(t *testing.T, providers ...models.PaymentProvider) (*SlackHandler, *fakeSlackViews) {
+	t.Helper()
+	var stripeGen, airwallexGen payment.PaymentLinkGenerator
+	for _, provider := range providers {
+		switch provider {
+		case models.ProviderStripe:
+			stripeGen = payment.NewDryRunGenerator(provider)
+		case models.ProviderAirwallex:
+			airwallexGen = payment.NewDryRunGenerator(provider)
+		}
+	}
+	handler, _, views := newTestHandler(t, stripeGen, airwallexGen)
+	return handler, views
+}
+
+// newTestHandler builds a handler around the given generators (nil disables a provider),
+// with Slack API calls going to a fake
+func newTestHandler(t *testing.T, stripeGen, airwallexGen payment.PaymentLinkGenerator) (*SlackHandler, *services.SlackService, *fakeSlackViews) {
+	t.Helper()
+	views := &fakeSlackViews{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/views.open":
+			var req struct {
+				View slack.View `json:"view"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			views.mu.Lock()
+			views.opened++
+			views.views = append(views.views, req.View)
+			views.mu.Unlock()
+		case "/views.publish":
+			var req publishedView
+			json.NewDecoder(r.Body).Decode(&req)
+			views.mu.Lock()
+			views.published = append(views.published, req)
+			views.mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{SlackSigningSecret: testSigningSecret}
+	if stripeGen != nil {
+		cfg.StripeAPIKey = "sk_test_123"
+	}
+	if airwallexGen != nil {
+		cfg.AirwallexClientID, cfg.AirwallexAPIKey = "client", "key"
+	}
+	client := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+	svc := services.NewSlackService(cfg, client, stripeGen, airwallexGen, shortener.NewNoopShortener(), nil, nil, nil)
+	return NewSlackHandler(svc, nil), svc, views
+}
+
+// signedRequest builds a Slack request to path signed with testSigningSecret
+func signedRequest(path, body string) *http.Request {
+	return signedRequestWithSecret(testSigningSecret, path, body)
+}
+
+// signedRequestWithSecret builds a Slack request to path signed with secret
+func signedRequestWithSecret(secret, path, body string) *http.Request {
+	timestamp := fmt.Sprint(time.Now().Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+// signedCommand builds a slash command request signed with testSigningSecret
+func signedCommand(command string) *http.Request {
+	return signedRequest("/slack/commands", url.Values{
+		"command":    {command},
+		"team_id":    {"T1"},
+		"channel_id": {"C1"},
+		"user_id":    {"U1"},
+		"trigger_id": {"trigger-" + command},
+	}.Encode())
+}
+
+func TestCommandsForDisabledProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []models.PaymentProvider
+		command   string
+		wantReply string
+	}{
+		{"Stripe only, Stripe link", []models.PaymentProvider{models.ProviderStripe}, "/create-stripe-link", ""},
+		{"Stripe only, Airwallex link", []models.PaymentProvider{models.ProviderStripe}, "/create-airwallex-link", "Sorry, the airwallex provider isn't enabled on this server."},
+		{"Airwallex only, Airwallex link", []models.PaymentProvider{models.ProviderAirwallex}, "/create-airwallex-link", ""},
+		{"Airwallex only, Stripe link", []models.PaymentProvider{models.ProviderAirwallex}, "/create-stripe-link", "Sorry, the stripe provider isn't enabled on this server."},
+		{"Airwallex only, donation link", []models.PaymentProvider{models.ProviderAirwallex}, "/create-donation-link", "Sorry, donation links need the Stripe provider, which isn't enabled on this server."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, views := newCommandTestHandler(t, tt.providers...)
+			rec := httptest.NewRecorder()
+			handler.HandleSlackCommands(rec, signedCommand(tt.command))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if tt.wantReply == "" {
+				if views.opened != 1 {
+					t.Errorf("opened %d modals, want 1 (reply %q)", views.opened, rec.Body.String())
+				}
+				return
+			}
+			var reply struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+				t.Fatalf("decoding reply %q: %v", rec.Body.String(), err)
+			}
+			if reply.Text != tt.wantReply {
+				t.Errorf("reply = %q, want %q", reply.Text, tt.wantReply)
+			}
+			if views.opened != 0 {
+				t.Errorf("opened %d modals for a disabled provider, want 0", views.opened)
+			}
+		})
+	}
+}
+
+// countingGenerator counts the links it creates
+type countingGenerator struct {
+	mu    sync.Mutex
+	links int
+}
+
+func (g *countingGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links++
+	return fmt.Sprintf("https://buy.stripe.com/test_%d", g.links), fmt.Sprintf("plink_%d", g.links), nil
+}
+
+// donationSubmission is the form body of a donation modal submission
+func donationSubmission(t *testing.T) string {
+	t.Helper()
+	payload, err := json.Marshal(slack.InteractionCallback{
+		Type:      slack.InteractionTypeViewSubmission,
+		TriggerID: "trigger-donation-1",
+		User:      slack.User{ID: "U1"},
+		Team:      slack.Team{ID: "T1"},
+		View: slack.View{
+			ID:              "V1",
+			CallbackID:      services.DonationModalCallbackID,
+			PrivateMetadata: "C1",
+			State: &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+				"service_block":  {"service_input": {Value: "Food bank"}},
+				"currency_block": {"currency_select": {SelectedOption: slack.OptionBlockObject{Value: "USD"}}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url.Values{"payload": {string(payload)}}.Encode()
+}
+
+func TestRetriedViewSubmissionCreatesOneLink(t *testing.T) {
+	generator := &countingGenerator{}
+	handler, svc, _ := newTestHandler(t, generator, nil)
+	body := donationSubmission(t)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		req := signedRequest("/slack/interactions", body)
+		if attempt > 0 {
+			req.Header.Set("X-Slack-Retry-Num", fmt.Sprint(attempt))
+			req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+		}
+		rec := httptest.NewRecorder()
+		handler.HandleSlackInteractions(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d: status = %d, want %d", attempt+1, rec.Code, http.StatusOK)
+		}
+	}
+
+	if err := svc.DrainLinkJobs(context.Background()); err != nil {
+		t.Fatalf("DrainLinkJobs error: %v", err)
+	}
+	if generator.links != 1 {
+		t.Errorf("created %d links for one submission retried twice, want 1", generator.links)
+	}
+}
+
+func TestInteractionSignatureIsVerified(t *testing.T) {
+	body := donationSubmission(t)
+	tests := []struct {
+		name       string
+		request    func() *http.Request
+		wantStatus int
+		wantLinks  int
+	}{
+		{"valid signature", func() *http.Request { return signedRequest("/slack/interactions", body) }, http.StatusOK, 1},
+		{"wrong signature", func() *http.Request {
+			req := signedRequest("/slack/interactions", body)
+			req.Header.Set("X-Slack-Signature", "v0="+strings.Repeat("0", 64))
+			return req
+		}, http.StatusUnauthorized, 0},
+		{"tampered body", func() *http.Request {
+			req := signedRequest("/slack/interactions", body)
+			req.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "Food+bank", "Other", 1)))
+			return req
+		}, http.StatusUnauthorized, 0},
+		{"stale timestamp", func() *http.Request {
+			req := signedRequest("/slack/interactions", body)
+			req.Header.Set("X-Slack-Request-Timestamp", fmt.Sprint(time.Now().Add(-time.Hour).Unix()))
+			return req
+		}, http.StatusUnauthorized, 0},
+		{"unsigned", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/slack/interactions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return req
+		}, http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &countingGenerator{}
+			handler, svc, _ := newTestHandler(t, generator, nil)
+			rec := httptest.NewRecorder()
+			handler.HandleSlackInteractions(rec, tt.request())
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if err := svc.DrainLinkJobs(context.Background()); err != nil {
+				t.Fatalf("DrainLinkJobs error: %v", err)
+			}
+			if generator.links != tt.wantLinks {
+				t.Errorf("created %d links, want %d", generator.links, tt.wantLinks)
+			}
+		})
+	}
+}
+
+func TestCommandSignatureUsesTheTeamsSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		teamID     string
+		secret     string
+		wantStatus int
+	}{
+		{"team signed with its own secret", "T2", "team-two-secret", http.StatusOK},
+		{"team signed with another team's secret", "T2", "team-three-secret", http.StatusUnauthorized},
+		{"team signed with the default secret", "T2", testSigningSecret, http.StatusUnauthorized},
+		{"team without its own secret", "T4", testSigningSecret, http.StatusOK},
+		{"unknown team", "T9", testSigningSecret, http.StatusOK},
+		{"unknown team signed with a team's secret", "T9", "team-two-secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, svc, _ := newTestHandler(t, payment.NewDryRunGenerator(models.ProviderStripe), nil)
+			teams := services.NewMemoryTeamConfigStore()
+			teams.Save(services.TeamConfig{TeamID: "T2", BotToken: "xoxb-two", SigningSecret: "team-two-secret"})
+			teams.Save(services.TeamConfig{TeamID: "T3", BotToken: "xoxb-three", SigningSecret: "team-three-secret"})
+			teams.Save(services.TeamConfig{TeamID: "T4", BotToken: "xoxb-four"})
+			svc.UseTeamConfigs(teams, func(token string) *slack.Client { return slack.New(token) })
+
+			// The Airwallex command is answered inline, so the request never reaches the Slack API
+			body := url.Values{
+				"command":    {"/create-airwallex-link"},
+				"team_id":    {tt.teamID},
+				"channel_id": {"C1"},
+				"user_id":    {"U1"},
+			}.Encode()
+			rec := httptest.NewRecorder()
+			handler.HandleSlackCommands(rec, signedRequestWithSecret(tt.secret, "/slack/commands", body))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+// blockingGenerator holds every link until release is closed
+type blockingGenerator struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return "https://buy.stripe.com/test_slow", "plink_slow", nil
+}
+
+func TestViewSubmissionIsAcknowledgedBeforeTheLinkIsCreated(t *testing.T) {
+	generator := &blockingGenerator{started: make(chan struct{}, 1), release: make(chan struct{})}
+	handler, svc, _ := newTestHandler(t, generator, nil)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.HandleSlackInteractions(rec, signedRequest("/slack/interactions", donationSubmission(t)))
+		done <- rec
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		// An empty 200 closes the modal
+		if rec.Body.Len() != 0 {
+			t.Errorf("response = %s, want an empty acknowledgement", rec.Body.String())
+		}
+	case <-time.After(time.Second):
+		close(generator.release)
+		t.Fatal("handler waited for the generator instead of acknowledging the submission")
+	}
+
+	select {
+	case <-generator.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("link was never created in the background")
+	}
+	close(generator.release)
+	if err := svc.DrainLinkJobs(context.Background()); err != nil {
+		t.Fatalf("DrainLinkJobs error: %v", err)
+	}
+}
+
+// inputInitialValue returns the initial value of the plain-text input in view's blockID
+func inputInitialValue(t *testing.T, view slack.View, blockID string) string {
+	t.Helper()
+	for _, block := range view.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && input.BlockID == blockID {
+			element, ok := input.Element.(*slack.PlainTextInputBlockElement)
+			if !ok {
+				t.Fatalf("%s has a %T, want a plain-text input", blockID, input.Element)
+			}
+			return element.InitialValue
+		}
+	}
+	t.Fatalf("view has no %s", blockID)
+	return ""
+}
+
+func TestMessageShortcutOpensAPrefilledPaymentModal(t *testing.T) {
+	handler, views := newCommandTestHandler(t, models.ProviderStripe)
+
+	payload, err := json.Marshal(slack.InteractionCallback{
+		Type:       slack.InteractionTypeMessageAction,
+		CallbackID: services.PaymentLinkShortcutCallbackID,
+		TriggerID:  "trigger-shortcut-1",
+		User:       slack.User{ID: "U1"},
+		Team:       slack.Team{ID: "T1"},
+		Channel:    slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C_SALES"}}},
+		Message:    slack.Message{Msg: slack.Msg{Text: "\nLogo redesign\nTwo rounds of revisions, delivered by Friday"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.HandleSlackInteractions(rec, signedRequest("/slack/interactions", url.Values{"payload": {string(payload)}}.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if len(views.views) != 1 {
+		t.Fatalf("opened %d modals, want 1", len(views.views))
+	}
+	view := views.views[0]
+	if view.CallbackID != "payment_link_modal_stripe" || view.PrivateMetadata != "C_SALES" {
+		t.Errorf("opened %q for channel %q, want the Stripe payment modal for C_SALES", view.CallbackID, view.PrivateMetadata)
+	}
+	if got := inputInitialValue(t, view, "service_block"); got != "Logo redesign" {
+		t.Errorf("service prefilled with %q, want the message's first line", got)
+	}
+	if got := inputInitialValue(t, view, "reference_block"); got != "Logo redesign Two rounds of revisions, delivered by Friday" {
+		t.Errorf("description prefilled with %q, want the whole message", got)
+	}
+}
+
+func TestUnknownMessageShortcutIsIgnored(t *testing.T) {
+	handler, views := newCommandTestHandler(t, models.ProviderStripe)
+	payload, _ := json.Marshal(slack.InteractionCallback{Type: slack.InteractionTypeMessageAction, CallbackID: "something_else", TriggerID: "trigger-1"})
+	rec := httptest.NewRecorder()
+	handler.HandleSlackInteractions(rec, signedRequest("/slack/interactions", url.Values{"payload": {string(payload)}}.Encode()))
+	if rec.Code != http.StatusOK || views.opened != 0 {
+		t.Errorf("status = %d with %d modals opened, want 200 and none", rec.Code, views.opened)
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"paymentbot/services"
+
+	"github.com/slack-go/slack"
+)
+
+// slackAuthorizeURL is where installs start on Slack's side
+const slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// oauthStateTTL is how long an install link stays valid before the callback rejects it
+const oauthStateTTL = 10 * time.Minute
+
+var installSuccessPage = template.Must(template.New("installed").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Payment bot installed</title></head>
+<body style="font-family: sans-serif; margin: 3em;">
+<h1>Installed</h1>
+<p>The payment bot is now installed in <strong>{{.}}</strong>. You can close this tab and use its slash commands in Slack.</p>
+</body></html>`))
+
+// SlackOAuthHandler runs the OAuth v2 install flow and stores each workspace's bot token
+type SlackOAuthHandler struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	store        services.TeamConfigStore
+	httpClient   *http.Client
+
+	mu     sync.Mutex
+	states map[string]time.Time // state -> issued at
+}
+
+// NewSlackOAuthHandler creates the install handler. redirectURL must match a Redirect URL in the
+// Slack app's OAuth settings; scopes is the comma-separated bot scope list.
+func NewSlackOAuthHandler(clientID, clientSecret, redirectURL, scopes string, store services.TeamConfigStore, httpClient *http.Client) *SlackOAuthHandler {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &SlackOAuthHandler{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		store:        store,
+		httpClient:   httpClient,
+		states:       make(map[string]time.Time),
+	}
+}
+
+// HandleInstall redirects to Slack's authorize page with a one-time state value
+func (h *SlackOAuthHandler) HandleInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := url.Values{
+		"client_id":    {h.clientID},
+		"scope":        {h.scopes},
+		"redirect_uri": {h.redirectURL},
+		"state":        {h.issueState(time.Now())},
+	}
+	http.Redirect(w, r, slackAuthorizeURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// HandleCallback exchanges the authorization code for a bot token and stores it keyed by team
+func (h *SlackOAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		log.Printf("[OAuth] Install was not completed: %s", errCode)
+		http.Error(w, "The installation was cancelled or denied.", http.StatusBadRequest)
+		return
+	}
+	if !h.consumeState(query.Get("state"), time.Now()) {
+		log.Printf("[OAuth] Rejected callback with an unknown or expired state")
+		http.Error(w, "This install link has expired. Please start the installation again.", http.StatusBadRequest)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "Missing authorization code", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := slack.GetOAuthV2ResponseContext(r.Context(), h.httpClient, h.clientID, h.clientSecret, code, h.redirectURL)
+	if err != nil {
+		log.Printf("[OAuth] Token exchange failed: %v", err)
+		http.Error(w, "Slack rejected the installation. Please try again.", http.StatusBadGateway)
+		return
+	}
+
+	// Org-wide installs arrive with the enterprise ID and requests carry it in place of a team ID
+	teamID, teamName := resp.Team.ID, resp.Team.Name
+	if resp.IsEnterpriseInstall || teamID == "" {
+		teamID, teamName = resp.Enterprise.ID, resp.Enterprise.Name
+	}
+	if teamID == "" || resp.AccessToken == "" {
+		log.Printf("[OAuth] Token exchange response had no team ID or bot token")
+		http.Error(w, "Slack returned an incomplete installation. Please try again.", http.StatusBadGateway)
+		return
+	}
+
+	installation := services.TeamConfig{
+		TeamID:      teamID,
+		TeamName:    teamName,
+		BotToken:    resp.AccessToken,
+		BotUserID:   resp.BotUserID,
+		InstalledBy: resp.AuthedUser.ID,
+		InstalledAt: time.Now().UTC(),
+	}
+	// Keep a signing secret configured for the team by hand; Slack signs per app, not per install
+	if existing, ok := h.store.Get(teamID); ok {
+		installation.SigningSecret = existing.SigningSecret
+	}
+	if err := h.store.Save(installation); err != nil {
+		log.Printf("[OAuth] Failed to save installation for team %s: %v", teamID, err)
+		http.Error(w, "The installation couldn't be saved. Please try again.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[OAuth] Installed in team %s (%s) by user %s", teamID, teamName, resp.AuthedUser.ID)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	installSuccessPage.Execute(w, teamName)
+}
+
+// issueState returns a new random state value and forgets expired ones
+func (h *SlackOAuthHandler) issueState(now time.Time) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	state := hex.EncodeToString(buf)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s, issued := range h.states {
+		if now.Sub(issued) > oauthStateTTL {
+			delete(h.states, s)
+		}
+	}
+	h.states[state] = now
+	return state
+}
+
+// consumeState reports whether state was issued recently, and invalidates it
+func (h *SlackOAuthHandler) consumeState(state string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	issued, ok := h.states[state]
+	if !ok {
+		return false
+	}
+	delete(h.states, state)
+	return now.Sub(issued) <= oauthStateTTL
+}
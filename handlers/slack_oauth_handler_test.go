@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/services"
+)
+
+// fakeSlackOAuth answers oauth.v2.access with a canned response, recording the codes exchanged
+type fakeSlackOAuth struct {
+	mu       sync.Mutex
+	response string
+	codes    []string
+}
+
+func (f *fakeSlackOAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes = append(f.codes, req.Form.Get("code"))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(f.response)),
+		Request:    req,
+	}, nil
+}
+
+const oauthInstalled = `{
+	"ok": true,
+	"access_token": "xoxb-new-token",
+	"token_type": "bot",
+	"bot_user_id": "B1",
+	"team": {"id": "T1", "name": "Acme"},
+	"enterprise": null,
+	"is_enterprise_install": false,
+	"authed_user": {"id": "U1"}
+}`
+
+// startInstall runs the install redirect and returns the state it issued
+func startInstall(t *testing.T, h *SlackOAuthHandler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.HandleInstall(rec, httptest.NewRequest(http.MethodGet, "/slack/oauth/install", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("install status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), slackAuthorizeURL) {
+		t.Fatalf("install redirected to %q, want Slack's authorize page", rec.Header().Get("Location"))
+	}
+	if got := location.Query().Get("client_id"); got != "client" {
+		t.Errorf("client_id = %q, want client", got)
+	}
+	return location.Query().Get("state")
+}
+
+func callback(h *SlackOAuthHandler, query url.Values) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.HandleCallback(rec, httptest.NewRequest(http.MethodGet, "/slack/oauth/callback?"+query.Encode(), nil))
+	return rec
+}
+
+func TestOAuthCallbackStoresTheInstallation(t *testing.T) {
+	slackAPI := &fakeSlackOAuth{response: oauthInstalled}
+	store := services.NewMemoryTeamConfigStore()
+	store.Save(services.TeamConfig{TeamID: "T1", BotToken: "xoxb-old", SigningSecret: "team-secret"})
+	h := NewSlackOAuthHandler("client", "secret", "https://bot.test/slack/oauth/callback", "commands,chat:write", store, &http.Client{Transport: slackAPI})
+
+	state := startInstall(t, h)
+	rec := callback(h, url.Values{"state": {state}, "code": {"code-1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "<strong>Acme</strong>") {
+		t.Errorf("success page %q doesn't name the workspace", rec.Body.String())
+	}
+	if len(slackAPI.codes) != 1 || slackAPI.codes[0] != "code-1" {
+		t.Errorf("exchanged codes %v, want [code-1]", slackAPI.codes)
+	}
+
+	installed, ok := store.Get("T1")
+	if !ok {
+		t.Fatal("installation wasn't stored")
+	}
+	if installed.BotToken != "xoxb-new-token" || installed.TeamName != "Acme" || installed.BotUserID != "B1" || installed.InstalledBy != "U1" {
+		t.Errorf("stored %+v", installed)
+	}
+	if installed.SigningSecret != "team-secret" {
+		t.Errorf("signing secret = %q, want the team's existing one kept", installed.SigningSecret)
+	}
+	if time.Since(installed.InstalledAt) > time.Minute {
+		t.Errorf("InstalledAt = %v, want now", installed.InstalledAt)
+	}
+
+	// Each state works once
+	if rec := callback(h, url.Values{"state": {state}, "code": {"code-2"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("reused state: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOAuthCallbackRejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		query      func(state string) url.Values
+		wantStatus int
+	}{
+		{"denied", oauthInstalled, func(state string) url.Values { return url.Values{"state": {state}, "error": {"access_denied"}} }, http.StatusBadRequest},
+		{"unknown state", oauthInstalled, func(string) url.Values { return url.Values{"state": {"forged"}, "code": {"code-1"}} }, http.StatusBadRequest},
+		{"missing code", oauthInstalled, func(state string) url.Values { return url.Values{"state": {state}} }, http.StatusBadRequest},
+		{"exchange fails", `{"ok":false,"error":"invalid_code"}`, func(state string) url.Values { return url.Values{"state": {state}, "code": {"code-1"}} }, http.StatusBadGateway},
+		{"no bot token", `{"ok":true,"team":{"id":"T1","name":"Acme"}}`, func(state string) url.Values { return url.Values{"state": {state}, "code": {"code-1"}} }, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := services.NewMemoryTeamConfigStore()
+			h := NewSlackOAuthHandler("client", "secret", "https://bot.test/slack/oauth/callback", "commands", store, &http.Client{Transport: &fakeSlackOAuth{response: tt.response}})
+
+			rec := callback(h, tt.query(startInstall(t, h)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if _, ok := store.Get("T1"); ok {
+				t.Error("a rejected install was stored")
+			}
+		})
+	}
+}
+
+func TestOAuthStateExpires(t *testing.T) {
+	h := NewSlackOAuthHandler("client", "secret", "", "commands", services.NewMemoryTeamConfigStore(), nil)
+	issued := time.Now()
+	state := h.issueState(issued)
+	if h.consumeState(state, issued.Add(oauthStateTTL+time.Second)) {
+		t.Error("consumeState accepted a state past its TTL")
+	}
+	state = h.issueState(issued)
+	if !h.consumeState(state, issued.Add(oauthStateTTL)) {
+		t.Error("consumeState rejected a state within its TTL")
+	}
+}
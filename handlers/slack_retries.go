@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// slackRetryWindow is how long a command or interaction is remembered; Slack gives up
+// retrying well within this
+const slackRetryWindow = 10 * time.Minute
+
+// seenRequests remembers recently handled request IDs (Slack trigger/view IDs, Stripe event
+// IDs) so a delivery that is resent because the first attempt was slow isn't processed twice.
+type seenRequests struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func newSeenRequests(window time.Duration) *seenRequests {
+	return &seenRequests{window: window, seen: make(map[string]time.Time)}
+}
+
+// markSeen records key and reports whether it had already been seen within the window.
+// An empty key is never treated as a duplicate.
+func (c *seenRequests) markSeen(key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, at := range c.seen {
+		if now.Sub(at) > c.window {
+			delete(c.seen, k)
+		}
+	}
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	c.seen[key] = now
+	return false
+}
@@ -1,39 +1,95 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"paymentbot/metrics"
+	"paymentbot/money"
+	"paymentbot/payment"
+	"paymentbot/services"
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/subscription"
 	"github.com/stripe/stripe-go/v82/webhook"
 )
 
+// paymentAnnouncementWindow is how long an announced payment is remembered
+const paymentAnnouncementWindow = 24 * time.Hour
+
 // StripeWebhookHandler handles Stripe webhook events
 type StripeWebhookHandler struct {
 	endpointSecret string
 	stripeAPIKey   string
+	tracker        *services.WebhookEventTracker
+	slackClient    *slack.Client
+	cancelSnap     utils.CancelSnap
+	maxBodyBytes   int64
+	seenEvents     *seenRequests // nil when replay protection is off
+	// Link payments send both a checkout and a payment intent event; only the first is announced
+	announcedPayments *seenRequests
+	// Resolves a workspace's client from the slack_team metadata; nil uses slackClient
+	teamClient func(ctx context.Context, teamID string) *slack.Client
 }
 
-// NewStripeWebhookHandler creates a new Stripe webhook handler
-func NewStripeWebhookHandler(endpointSecret, stripeAPIKey string) *StripeWebhookHandler {
+// NewStripeWebhookHandler creates a new Stripe webhook handler. Bodies over maxBodyBytes are
+// rejected; event IDs already handled within replayWindow are acknowledged without being
+// processed again (0 disables this).
+func NewStripeWebhookHandler(endpointSecret, stripeAPIKey string, tracker *services.WebhookEventTracker, slackClient *slack.Client, cancelSnap utils.CancelSnap, maxBodyBytes int64, replayWindow time.Duration) *StripeWebhookHandler {
+	var seenEvents *seenRequests
+	if replayWindow > 0 {
+		seenEvents = newSeenRequests(replayWindow)
+	}
 	return &StripeWebhookHandler{
-		endpointSecret: endpointSecret,
-		stripeAPIKey:   stripeAPIKey,
+		endpointSecret:    endpointSecret,
+		stripeAPIKey:      stripeAPIKey,
+		tracker:           tracker,
+		slackClient:       slackClient,
+		cancelSnap:        cancelSnap,
+		maxBodyBytes:      maxBodyBytes,
+		seenEvents:        seenEvents,
+		announcedPayments: newSeenRequests(paymentAnnouncementWindow),
+	}
+}
+
+// UseTeamClients posts notifications with the client of the workspace a link was created in
+func (h *StripeWebhookHandler) UseTeamClients(clientForTeam func(ctx context.Context, teamID string) *slack.Client) {
+	h.teamClient = clientForTeam
+}
+
+// clientFor returns the Slack client to post routing's notifications with
+func (h *StripeWebhookHandler) clientFor(ctx context.Context, routing payment.SlackRouting) *slack.Client {
+	if h.teamClient != nil && h.slackClient != nil {
+		return h.teamClient(ctx, routing.TeamID)
 	}
+	return h.slackClient
 }
 
 // HandleWebhook processes incoming Stripe webhook events
 func (h *StripeWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
-	const MaxBodyBytes = int64(65536)
-	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	defer metrics.ObserveSince(metrics.OperationDuration, time.Now(), "stripe_webhook")
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
+		// A truncated body would otherwise surface as a confusing signature failure
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("[Webhook] Rejected webhook body larger than %d bytes; raise STRIPE_WEBHOOK_MAX_BODY_BYTES", tooLarge.Limit)
+			h.tracker.RecordFailure(fmt.Sprintf("payload exceeded %d bytes", tooLarge.Limit))
+			metrics.WebhookEvents.WithLabelValues("stripe", "unknown", "rejected").Inc()
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
 		log.Printf("Error reading webhook payload: %v", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
@@ -43,25 +99,45 @@ func (h *StripeWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Requ
 	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), h.endpointSecret)
 	if err != nil {
 		log.Printf("Error verifying webhook signature: %v", err)
+		h.tracker.RecordFailure(fmt.Sprintf("signature verification failed: %v", err))
+		metrics.WebhookEvents.WithLabelValues("stripe", "unknown", "rejected").Inc()
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	h.tracker.RecordEvent(event.ID, string(event.Type))
+
+	// Stripe redelivers events it thinks failed; don't schedule cancellations twice
+	if h.seenEvents != nil && h.seenEvents.markSeen(event.ID, time.Now()) {
+		log.Printf("[Webhook] Ignoring redelivered event %s (%s)", event.ID, event.Type)
+		metrics.WebhookEvents.WithLabelValues("stripe", string(event.Type), "duplicate").Inc()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 
 	// Handle the event
+	outcome := "handled"
 	switch event.Type {
-	case "checkout.session.completed":
-		h.handleCheckoutSessionCompleted(event)
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		h.handleCheckoutSessionCompleted(r.Context(), event)
+	case "payment_intent.succeeded":
+		h.handlePaymentIntentSucceeded(r.Context(), event)
 	case "customer.subscription.created":
-		h.handleSubscriptionCreated(event)
+		h.handleSubscriptionCreated(r.Context(), event)
+	case "customer.subscription.deleted":
+		h.handleSubscriptionDeleted(r.Context(), event)
 	default:
 		log.Printf("Unhandled event type: %s", event.Type)
+		outcome = "ignored"
 	}
+	metrics.WebhookEvents.WithLabelValues("stripe", string(event.Type), outcome).Inc()
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// handleCheckoutSessionCompleted processes successful checkout sessions
-func (h *StripeWebhookHandler) handleCheckoutSessionCompleted(event stripe.Event) {
+// handleCheckoutSessionCompleted announces paid one-time checkouts in the channel the link was
+// created in. Subscription checkouts are announced by handleSubscriptionCreated, and delayed
+// payment methods arrive later as checkout.session.async_payment_succeeded.
+func (h *StripeWebhookHandler) handleCheckoutSessionCompleted(ctx context.Context, event stripe.Event) {
 	var session stripe.CheckoutSession
 	err := json.Unmarshal(event.Data.Raw, &session)
 	if err != nil {
@@ -70,13 +146,67 @@ func (h *StripeWebhookHandler) handleCheckoutSessionCompleted(event stripe.Event
 	}
 
 	log.Printf("Checkout session completed: %s", session.ID)
+	if session.Mode != stripe.CheckoutSessionModePayment || session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		return
+	}
 
-	// If this was a subscription checkout, the subscription will be created separately
-	// and handled in handleSubscriptionCreated
+	paymentID := session.ID
+	if session.PaymentIntent != nil && session.PaymentIntent.ID != "" {
+		paymentID = session.PaymentIntent.ID
+	}
+	var customerEmail string
+	if session.CustomerDetails != nil {
+		customerEmail = session.CustomerDetails.Email
+	}
+	h.announcePayment(ctx, paymentID, session.Metadata, session.AmountTotal, string(session.Currency), customerEmail)
+}
+
+// handlePaymentIntentSucceeded announces payments whose intent carries the link metadata.
+// Intents from link checkouts are usually announced by the session event first.
+func (h *StripeWebhookHandler) handlePaymentIntentSucceeded(ctx context.Context, event stripe.Event) {
+	var intent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+		log.Printf("[Webhook] Error parsing payment intent: %v", err)
+		return
+	}
+	h.announcePayment(ctx, intent.ID, intent.Metadata, intent.AmountReceived, string(intent.Currency), intent.ReceiptEmail)
+}
+
+// announcePayment posts a payment confirmation to the slack_channel in metadata, once per
+// payment. Payments without the metadata (other integrations, older links) are only logged.
+func (h *StripeWebhookHandler) announcePayment(ctx context.Context, paymentID string, metadata map[string]string, amountMinor int64, currency, customerEmail string) {
+	routing := payment.RoutingFromMetadata(metadata)
+	channelID := routing.ChannelID
+	if h.slackClient == nil || channelID == "" {
+		log.Printf("[Webhook] Payment %s has no Slack channel in metadata, not announcing", paymentID)
+		return
+	}
+	if h.announcedPayments.markSeen(paymentID, time.Now()) {
+		log.Printf("[Webhook] Payment %s was already announced, skipping", paymentID)
+		return
+	}
+
+	currency = strings.ToUpper(currency)
+	amount := utils.FormatMoney(money.Money{Minor: amountMinor, Currency: currency})
+	serviceName := metadata["service_name"]
+	if serviceName == "" {
+		serviceName = "a payment link"
+	}
+	if customerEmail == "" {
+		customerEmail = metadata["customer_email"]
+	}
+
+	blocks := services.BuildPaymentReceivedBlocks(serviceName, amount, metadata["reference_number"], customerEmail, routing.UserID, paymentID)
+	fallback := fmt.Sprintf("Payment received for %s (%s)", serviceName, amount)
+	if _, _, err := h.clientFor(ctx, routing).PostMessageContext(ctx, channelID, slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+		log.Printf("[Webhook] Error posting payment %s to Slack channel %s: %v", paymentID, channelID, err)
+		return
+	}
+	log.Printf("[Webhook] Announced payment %s in channel %s", paymentID, channelID)
 }
 
 // handleSubscriptionCreated processes new subscription events and schedules cancellation if needed
-func (h *StripeWebhookHandler) handleSubscriptionCreated(event stripe.Event) {
+func (h *StripeWebhookHandler) handleSubscriptionCreated(ctx context.Context, event stripe.Event) {
 	var sub stripe.Subscription
 	err := json.Unmarshal(event.Data.Raw, &sub)
 	if err != nil {
@@ -90,17 +220,11 @@ func (h *StripeWebhookHandler) handleSubscriptionCreated(event stripe.Event) {
 	// Check if this subscription has cycle limits in metadata
 	if endCyclesStr, exists := sub.Metadata["end_date_cycles"]; exists {
 		log.Printf("[Webhook] Found EndDateCycles in subscription %s metadata", sub.ID)
-		
-		endTimestampStr, timestampExists := sub.Metadata["end_timestamp"]
-		if !timestampExists {
-			log.Printf("[Webhook] ERROR: Subscription %s has end_date_cycles but no end_timestamp", sub.ID)
-			return
-		}
 
 		interval := sub.Metadata["interval"]
 		intervalCount := sub.Metadata["interval_count"]
 		serviceName := sub.Metadata["service_name"]
-		
+
 		log.Printf("[Webhook] Subscription details - Service: %s, Interval: %s, Count: %s", serviceName, interval, intervalCount)
 
 		endCycles, err := strconv.ParseInt(endCyclesStr, 10, 64)
@@ -109,50 +233,113 @@ func (h *StripeWebhookHandler) handleSubscriptionCreated(event stripe.Event) {
 			return
 		}
 
-		endTimestamp, err := strconv.ParseInt(endTimestampStr, 10, 64)
-		if err != nil {
-			log.Printf("[Webhook] ERROR: Error parsing end_timestamp for subscription %s: %v", sub.ID, err)
+		// Count the cycles from the subscription's billing anchor, not from when the link was made
+		endTime, ok := payment.SubscriptionEndTime(&sub)
+		if !ok {
+			log.Printf("[Webhook] ERROR: Subscription %s has end_date_cycles but no usable billing anchor or end_timestamp", sub.ID)
 			return
 		}
-
-		endTime := time.Unix(endTimestamp, 0)
+		endTimestamp := endTime.Unix()
+		if snapped := h.cancelSnap.Apply(endTime); snapped.After(time.Now()) && !snapped.Equal(endTime) {
+			log.Printf("[Webhook] Snapping cancellation for subscription %s from %s to %s", sub.ID, endTime.UTC().Format(time.RFC3339), snapped.Format(time.RFC3339))
+			endTime = snapped
+			endTimestamp = snapped.Unix()
+		}
 		log.Printf("[Webhook] Scheduling subscription %s to cancel after %d cycles", sub.ID, endCycles)
 		log.Printf("[Webhook] Cancellation scheduled for: %s (timestamp: %d)", endTime.Format("2006-01-02 15:04:05 UTC"), endTimestamp)
 
 		// Schedule the subscription to cancel at the calculated end time
-		err = h.scheduleSubscriptionCancellation(sub.ID, endTimestamp)
+		scheduled, err := h.scheduleSubscriptionCancellation(ctx, sub.ID, endTimestamp)
 		if err != nil {
 			log.Printf("[Webhook] ERROR: Failed to schedule cancellation for subscription %s: %v", sub.ID, err)
 			return
 		}
+		if !scheduled {
+			// A redelivered event, or an admin already changed it; the channel was told the first time
+			return
+		}
 
 		log.Printf("[Webhook] ✅ Successfully scheduled cancellation for subscription %s", sub.ID)
+		h.notifySlack(ctx, sub.Metadata, fmt.Sprintf("Subscription `%s` for *%s* is now active; will cancel after %d cycles on %s.",
+			sub.ID, serviceName, endCycles, endTime.UTC().Format("Jan 2, 2006")))
 	} else {
 		log.Printf("[Webhook] Subscription %s has no EndDateCycles - will run indefinitely", sub.ID)
+		h.notifySlack(ctx, sub.Metadata, fmt.Sprintf("Subscription `%s` for *%s* is now active with no end date.", sub.ID, sub.Metadata["service_name"]))
 	}
 }
 
-// scheduleSubscriptionCancellation sets a subscription to cancel at a specific timestamp
-func (h *StripeWebhookHandler) scheduleSubscriptionCancellation(subscriptionID string, cancelAtTimestamp int64) error {
+// handleSubscriptionDeleted confirms in Slack that a subscription has ended, whether it
+// reached its scheduled cancellation or was cancelled manually
+func (h *StripeWebhookHandler) handleSubscriptionDeleted(ctx context.Context, event stripe.Event) {
+	var sub stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+		log.Printf("[Webhook] Error parsing subscription: %v", err)
+		return
+	}
+
+	log.Printf("[Webhook] Subscription cancelled: %s (Status: %s)", sub.ID, sub.Status)
+	h.notifySlack(ctx, sub.Metadata, fmt.Sprintf("Subscription `%s` for *%s* has been cancelled.", sub.ID, sub.Metadata["service_name"]))
+}
+
+// notifySlack posts text to the channel stored in the subscription metadata. Subscriptions
+// created before the channel was recorded are only logged.
+func (h *StripeWebhookHandler) notifySlack(ctx context.Context, metadata map[string]string, text string) {
+	routing := payment.RoutingFromMetadata(metadata)
+	channelID := routing.ChannelID
+	if h.slackClient == nil || channelID == "" {
+		log.Printf("[Webhook] No Slack channel in metadata, not posting: %s", text)
+		return
+	}
+	if routing.UserID != "" {
+		text = fmt.Sprintf("<@%s> %s", routing.UserID, text)
+	}
+
+	if _, _, err := h.clientFor(ctx, routing).PostMessageContext(ctx, channelID, slack.MsgOptionText(text, false)); err != nil {
+		log.Printf("[Webhook] Error posting to Slack channel %s: %v", channelID, err)
+	}
+}
+
+// scheduleSubscriptionCancellation sets a subscription to cancel at a specific timestamp. Stripe
+// can deliver customer.subscription.created more than once, so it first checks the current
+// subscription and reports false without updating when a cancellation is already scheduled,
+// either by an earlier delivery or by someone changing it by hand.
+func (h *StripeWebhookHandler) scheduleSubscriptionCancellation(ctx context.Context, subscriptionID string, cancelAtTimestamp int64) (bool, error) {
 	log.Printf("[Webhook] Setting Stripe API key and preparing cancellation params for subscription %s", subscriptionID)
 	stripe.Key = h.stripeAPIKey
 
+	getParams := &stripe.SubscriptionParams{}
+	getParams.Context = ctx
+	current, err := subscription.Get(subscriptionID, getParams)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch subscription: %w", err)
+	}
+	switch {
+	case current.CancelAt == cancelAtTimestamp:
+		log.Printf("[Webhook] Subscription %s is already scheduled to cancel at %d, skipping", subscriptionID, cancelAtTimestamp)
+		return false, nil
+	case current.CancelAt != 0 || current.CancelAtPeriodEnd:
+		log.Printf("[Webhook] Subscription %s already has a different cancellation (cancel_at: %d, cancel_at_period_end: %t), leaving it",
+			subscriptionID, current.CancelAt, current.CancelAtPeriodEnd)
+		return false, nil
+	}
+
 	params := &stripe.SubscriptionParams{
 		CancelAt: stripe.Int64(cancelAtTimestamp),
 	}
+	params.Context = ctx
 
 	log.Printf("[Webhook] Calling Stripe API to update subscription %s with cancellation params", subscriptionID)
 	updatedSub, err := subscription.Update(subscriptionID, params)
 	if err != nil {
 		log.Printf("[Webhook] ERROR: Stripe API call failed for subscription %s: %v", subscriptionID, err)
-		return fmt.Errorf("failed to schedule subscription cancellation: %w", err)
+		return false, fmt.Errorf("failed to schedule subscription cancellation: %w", err)
 	}
 
 	cancelTime := time.Unix(cancelAtTimestamp, 0)
-	log.Printf("[Webhook] ✅ Stripe API call successful - subscription %s will cancel at %s", 
+	log.Printf("[Webhook] ✅ Stripe API call successful - subscription %s will cancel at %s",
 		subscriptionID, cancelTime.Format("2006-01-02 15:04:05 UTC"))
-	log.Printf("[Webhook] Updated subscription status: %s, cancel_at_period_end: %t", 
+	log.Printf("[Webhook] Updated subscription status: %s, cancel_at_period_end: %t",
 		updatedSub.Status, updatedSub.CancelAtPeriodEnd)
 
-	return nil
+	return true, nil
 }
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/payment"
+	"paymentbot/services"
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// slackMessage is a chat.postMessage call; Blocks is the text of its section and context blocks
+type slackMessage struct {
+	Channel string
+	Text    string
+	Blocks  string
+}
+
+// blocksText joins the text of the section and context blocks in raw
+func blocksText(raw string) string {
+	var blocks slack.Blocks
+	if raw == "" || json.Unmarshal([]byte(raw), &blocks) != nil {
+		return ""
+	}
+	var texts []string
+	for _, block := range blocks.BlockSet {
+		switch block := block.(type) {
+		case *slack.SectionBlock:
+			texts = append(texts, block.Text.Text)
+		case *slack.ContextBlock:
+			for _, element := range block.ContextElements.Elements {
+				if text, ok := element.(*slack.TextBlockObject); ok {
+					texts = append(texts, text.Text)
+				}
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// fakeSlackChannels records the messages posted through it
+type fakeSlackChannels struct {
+	mu       sync.Mutex
+	messages []slackMessage
+}
+
+func newFakeSlackChannels(t *testing.T) (*slack.Client, *fakeSlackChannels) {
+	t.Helper()
+	f := &fakeSlackChannels{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		f.messages = append(f.messages, slackMessage{Channel: r.Form.Get("channel"), Text: r.Form.Get("text"), Blocks: blocksText(r.Form.Get("blocks"))})
+		f.mu.Unlock()
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0"}`))
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")), f
+}
+
+func (f *fakeSlackChannels) posted() []slackMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slackMessage(nil), f.messages...)
+}
+
+// newTestStripeWebhookHandler builds a handler posting to a fake Slack
+func newTestStripeWebhookHandler(t *testing.T, maxBodyBytes int64, replayWindow time.Duration) (*StripeWebhookHandler, *services.WebhookEventTracker, *fakeSlackChannels) {
+	t.Helper()
+	client, slackAPI := newFakeSlackChannels(t)
+	tracker := services.NewWebhookEventTracker()
+	return NewStripeWebhookHandler(testWebhookSecret, "sk_test", tracker, client, utils.CancelSnap{}, maxBodyBytes, replayWindow), tracker, slackAPI
+}
+
+// stripeEvent builds a webhook event of eventType wrapping object
+func stripeEvent(t *testing.T, id, eventType string, object map[string]interface{}) []byte {
+	t.Helper()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"object":      "event",
+		"type":        eventType,
+		"api_version": stripe.APIVersion,
+		"data":        map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// deliverStripeEvent posts payload to h signed with testWebhookSecret and returns the status
+func deliverStripeEvent(h *StripeWebhookHandler, payload []byte) int {
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: testWebhookSecret})
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signed.Header)
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, req)
+	return rec.Code
+}
+
+func subscriptionDeletedEvent(t *testing.T, eventID string) []byte {
+	return stripeEvent(t, eventID, "customer.subscription.deleted", map[string]interface{}{
+		"id":       "sub_1",
+		"object":   "subscription",
+		"status":   "canceled",
+		"metadata": map[string]string{"service_name": "Hosting", "slack_channel": "C1"},
+	})
+}
+
+func TestStripeWebhookRejectsOversizedBodies(t *testing.T) {
+	payload := subscriptionDeletedEvent(t, "evt_1")
+	h, tracker, slackAPI := newTestStripeWebhookHandler(t, int64(len(payload)-1), 0)
+
+	if status := deliverStripeEvent(h, payload); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", status, http.StatusRequestEntityTooLarge)
+	}
+	if _, reason := tracker.LastFailure(); !strings.Contains(reason, "exceeded") {
+		t.Errorf("recorded failure %q, want the size limit named", reason)
+	}
+	if messages := slackAPI.posted(); len(messages) != 0 {
+		t.Errorf("posted %v for a rejected event", messages)
+	}
+
+	// At the limit the same event goes through
+	h, _, _ = newTestStripeWebhookHandler(t, int64(len(payload)), 0)
+	if status := deliverStripeEvent(h, payload); status != http.StatusOK {
+		t.Errorf("status at the limit = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestStripeWebhookRejectsBadSignatures(t *testing.T) {
+	h, tracker, _ := newTestStripeWebhookHandler(t, 1<<16, 0)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", bytes.NewReader(subscriptionDeletedEvent(t, "evt_1")))
+	req.Header.Set("Stripe-Signature", "t=1,v1=bad")
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if _, reason := tracker.LastFailure(); !strings.Contains(reason, "signature") {
+		t.Errorf("recorded failure %q, want a signature failure", reason)
+	}
+}
+
+func TestStripeWebhookIgnoresRedeliveredEvents(t *testing.T) {
+	tests := []struct {
+		name         string
+		replayWindow time.Duration
+		wantPosts    int
+	}{
+		{"replay protection on", time.Hour, 1},
+		{"replay protection off", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, slackAPI := newTestStripeWebhookHandler(t, 1<<16, tt.replayWindow)
+			payload := subscriptionDeletedEvent(t, "evt_1")
+			for delivery := 1; delivery <= 2; delivery++ {
+				if status := deliverStripeEvent(h, payload); status != http.StatusOK {
+					t.Fatalf("delivery %d: status = %d, want %d", delivery, status, http.StatusOK)
+				}
+			}
+			if messages := slackAPI.posted(); len(messages) != tt.wantPosts {
+				t.Errorf("posted %d messages for one event delivered twice, want %d", len(messages), tt.wantPosts)
+			}
+
+			// A different event is still handled
+			deliverStripeEvent(h, subscriptionDeletedEvent(t, "evt_2"))
+			if messages := slackAPI.posted(); len(messages) != tt.wantPosts+1 {
+				t.Errorf("posted %d messages after a new event, want %d", len(messages), tt.wantPosts+1)
+			}
+		})
+	}
+}
+
+// checkoutCompleted is a checkout.session.completed event for a paid one-time link, trimmed
+// from a real delivery
+const checkoutCompleted = `{
+	"id": "evt_checkout_1",
+	"object": "event",
+	"type": "checkout.session.completed",
+	"api_version": "%s",
+	"data": {
+		"object": {
+			"id": "cs_test_a1",
+			"object": "checkout.session",
+			"mode": "payment",
+			"payment_status": "paid",
+			"status": "complete",
+			"amount_total": 4950,
+			"currency": "hkd",
+			"payment_intent": "pi_1",
+			"payment_link": "plink_1",
+			"customer_details": {"email": "ada@example.com", "name": "Ada Lovelace"},
+			"metadata": {
+				"service_name": "Web Hosting",
+				"reference_number": "INV-123",
+				"slack_channel": "C_SALES",
+				"slack_user": "U1"
+			}
+		}
+	}
+}`
+
+func TestCheckoutCompletedIsAnnouncedInSlack(t *testing.T) {
+	h, _, slackAPI := newTestStripeWebhookHandler(t, 1<<16, 0)
+	payload := []byte(strings.Replace(checkoutCompleted, "%s", stripe.APIVersion, 1))
+
+	if status := deliverStripeEvent(h, payload); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	messages := slackAPI.posted()
+	if len(messages) != 1 {
+		t.Fatalf("posted %d messages, want 1", len(messages))
+	}
+	if messages[0].Channel != "C_SALES" {
+		t.Errorf("posted to %q, want C_SALES", messages[0].Channel)
+	}
+	for _, want := range []string{"<@U1>", "Payment received for *Web Hosting* (HK$49.50)", "ref INV-123", "ada@example.com", "pi_1"} {
+		if !strings.Contains(messages[0].Blocks, want) {
+			t.Errorf("blocks %s are missing %q", messages[0].Blocks, want)
+		}
+	}
+
+	// The payment intent of the same checkout isn't announced again
+	intent := stripeEvent(t, "evt_intent_1", "payment_intent.succeeded", map[string]interface{}{
+		"id":              "pi_1",
+		"object":          "payment_intent",
+		"amount_received": 4950,
+		"currency":        "hkd",
+		"metadata":        map[string]string{"service_name": "Web Hosting", "slack_channel": "C_SALES"},
+	})
+	deliverStripeEvent(h, intent)
+	if messages := slackAPI.posted(); len(messages) != 1 {
+		t.Errorf("posted %d messages after the payment intent event, want 1", len(messages))
+	}
+}
+
+func TestCheckoutCompletedWithoutSlackMetadata(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no channel in metadata": {
+			"id": "cs_1", "object": "checkout.session", "mode": "payment", "payment_status": "paid",
+			"amount_total": 1000, "currency": "usd", "metadata": map[string]string{"service_name": "Hosting"},
+		},
+		"not paid yet": {
+			"id": "cs_2", "object": "checkout.session", "mode": "payment", "payment_status": "unpaid",
+			"amount_total": 1000, "currency": "usd", "metadata": map[string]string{"service_name": "Hosting", "slack_channel": "C1"},
+		},
+		"subscription checkout": {
+			"id": "cs_3", "object": "checkout.session", "mode": "subscription", "payment_status": "paid",
+			"amount_total": 1000, "currency": "usd", "metadata": map[string]string{"service_name": "Hosting", "slack_channel": "C1"},
+		},
+	}
+	for name, session := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, _, slackAPI := newTestStripeWebhookHandler(t, 1<<16, 0)
+			if status := deliverStripeEvent(h, stripeEvent(t, "evt_1", "checkout.session.completed", session)); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if messages := slackAPI.posted(); len(messages) != 0 {
+				t.Errorf("posted %v, want nothing", messages)
+			}
+		})
+	}
+}
+
+// fakeStripeSubscription serves GET and POST /v1/subscriptions/sub_1 from one subscription,
+// counting the updates
+type fakeStripeSubscription struct {
+	mu       sync.Mutex
+	cancelAt int64
+	updates  int
+}
+
+func newFakeStripeSubscription(t *testing.T, cancelAt int64) *fakeStripeSubscription {
+	t.Helper()
+	f := &fakeStripeSubscription{cancelAt: cancelAt}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r.URL.Path != "/v1/subscriptions/sub_1" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPost {
+			f.updates++
+			f.cancelAt, _ = strconv.ParseInt(r.Form.Get("cancel_at"), 10, 64)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "sub_1", "object": "subscription", "status": "active", "cancel_at": f.cancelAt})
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		stripe.SetBackend(stripe.APIBackend, nil)
+	})
+	payment.ConfigureStripeBackend(http.DefaultTransport, 5*time.Second, server.URL)
+	return f
+}
+
+func TestSubscriptionCancellationIsScheduledOnce(t *testing.T) {
+	anchor := time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	wantCancelAt := time.Date(2027, time.February, 1, 0, 0, 0, 0, time.UTC).Unix()
+	created := func(eventID string) []byte {
+		return stripeEvent(t, eventID, "customer.subscription.created", map[string]interface{}{
+			"id":                   "sub_1",
+			"object":               "subscription",
+			"customer":             "cus_1",
+			"status":               "active",
+			"billing_cycle_anchor": anchor.Unix(),
+			"metadata": map[string]string{
+				"service_name":    "Hosting",
+				"slack_channel":   "C1",
+				"end_date_cycles": "3",
+				"interval":        "month",
+				"interval_count":  "1",
+			},
+		})
+	}
+
+	tests := []struct {
+		name        string
+		cancelAt    int64
+		wantUpdates int
+		wantPosts   int
+	}{
+		{"scheduled on the first delivery only", 0, 1, 1},
+		{"already scheduled at the target", wantCancelAt, 0, 0},
+		{"a different cancellation is left alone", wantCancelAt + 86400, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripeAPI := newFakeStripeSubscription(t, tt.cancelAt)
+			// Without replay protection, so each delivery reaches the handler
+			h, _, slackAPI := newTestStripeWebhookHandler(t, 1<<16, 0)
+			for delivery, eventID := range []string{"evt_created_1", "evt_created_2"} {
+				if status := deliverStripeEvent(h, created(eventID)); status != http.StatusOK {
+					t.Fatalf("delivery %d: status = %d, want %d", delivery+1, status, http.StatusOK)
+				}
+			}
+
+			stripeAPI.mu.Lock()
+			defer stripeAPI.mu.Unlock()
+			if stripeAPI.updates != tt.wantUpdates {
+				t.Errorf("updated the subscription %d times over two deliveries, want %d", stripeAPI.updates, tt.wantUpdates)
+			}
+			if tt.cancelAt == 0 && stripeAPI.cancelAt != wantCancelAt {
+				t.Errorf("cancel_at = %d, want %d (3 months after the anchor)", stripeAPI.cancelAt, wantCancelAt)
+			}
+			if messages := slackAPI.posted(); len(messages) != tt.wantPosts {
+				t.Errorf("posted %d messages, want %d", len(messages), tt.wantPosts)
+			}
+		})
+	}
+}
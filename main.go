@@ -1,48 +1,331 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"paymentbot/config"
+	"paymentbot/counter"
 	"paymentbot/handlers"
+	"paymentbot/metrics"
+	"paymentbot/models"
 	"paymentbot/payment"
 	"paymentbot/services"
+	"paymentbot/shortener"
+	"paymentbot/tracing"
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
 )
 
 func main() {
 	appConfig := config.LoadConfig()
+	logger := newLogger(appConfig.LogFormat, appConfig.LogLevel)
+
+	// Initialize tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing := tracing.InitFromEnv()
+	defer shutdownTracing(context.Background())
+
+	// Cancelled on SIGTERM/SIGINT so the server can drain before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 	log.Printf("Starting Slack bot server on :%s", appConfig.Port)
 
-	// Debug: Print the first 8 chars of each token (never print full tokens)
-	log.Printf("Slack Bot Token: %s...", appConfig.SlackBotToken[:8])
-	log.Printf("Slack Signing Secret: %s...", appConfig.SlackSigningSecret[:8])
-	log.Printf("Stripe API Key: %s...", appConfig.StripeAPIKey[:8])
-	log.Printf("Airwallex Client ID: %s...", appConfig.AirwallexClientID[:8])
-	log.Printf("Airwallex API Key: %s...", appConfig.AirwallexAPIKey[:8])
-
-	// Initialize Payment Generators
-	stripeGenerator := payment.NewStripeGenerator(appConfig.StripeAPIKey)
-	airwallexGenerator := payment.NewAirwallexGenerator(
-		appConfig.AirwallexClientID,
-		appConfig.AirwallexAPIKey,
-		appConfig.AirwallexBaseURL,
-	)
+	// Log short prefixes only so misconfiguration is visible without leaking secrets
+	log.Printf("Slack Bot Token: %s", utils.Redact(appConfig.SlackBotToken))
+	log.Printf("Slack Signing Secret: %s", utils.Redact(appConfig.SlackSigningSecret))
+
+	// Extra CA certificates for networks that intercept outbound TLS
+	var rootCAs *x509.CertPool
+	if appConfig.ExtraCABundlePath != "" {
+		pool, err := utils.LoadCertPool(appConfig.ExtraCABundlePath)
+		if err != nil {
+			log.Fatalf("EXTRA_CA_BUNDLE_PATH is invalid: %v", err)
+		}
+		rootCAs = pool
+		log.Printf("Trusting extra CA certificates from %s", appConfig.ExtraCABundlePath)
+	}
+
+	// Provider API calls share one transport so a proxy applies to both
+	providerTransport, err := payment.NewProviderTransport(appConfig.OutboundProxyURL, rootCAs)
+	if err != nil {
+		log.Fatalf("Failed to configure provider transport: %v", err)
+	}
+	if appConfig.OutboundProxyURL != "" {
+		proxyURL, _ := url.Parse(appConfig.OutboundProxyURL)
+		log.Printf("Routing provider API calls through proxy %s", proxyURL.Redacted())
+	}
+
+	// Initialize Payment Generators (each provider is optional)
+	var stripeGenerator, airwallexGenerator payment.PaymentLinkGenerator
+	activeProviders := map[string]payment.PaymentLinkGenerator{}
+	if appConfig.StripeEnabled() {
+		log.Printf("Stripe API Key: %s", utils.Redact(appConfig.StripeAPIKey))
+		payment.ConfigureStripeBackend(providerTransport, appConfig.StripeHTTPTimeout, appConfig.StripeAPIBaseURL)
+		if appConfig.StripeAPIBaseURL != "" {
+			log.Printf("Stripe API base URL: %s", appConfig.StripeAPIBaseURL)
+		}
+		stripeGenerator = payment.NewStripeGenerator(appConfig.StripeAPIKey)
+		activeProviders["Stripe"] = stripeGenerator
+	}
+	if appConfig.AirwallexEnabled() {
+		log.Printf("Airwallex Client ID: %s", utils.Redact(appConfig.AirwallexClientID))
+		log.Printf("Airwallex API Key: %s", utils.Redact(appConfig.AirwallexAPIKey))
+		airwallexGenerator = payment.NewAirwallexGenerator(
+			appConfig.AirwallexClientID,
+			appConfig.AirwallexAPIKey,
+			appConfig.AirwallexBaseURL,
+			payment.AirwallexBranding{
+				MerchantName: appConfig.AirwallexMerchantName,
+				LogoURL:      appConfig.AirwallexLogoURL,
+			},
+			payment.WithRetryPolicy(payment.RetryPolicy{
+				MaxRetries: appConfig.AirwallexMaxRetries,
+				BaseDelay:  appConfig.AirwallexRetryBaseDelay,
+			}),
+			payment.WithTransport(providerTransport),
+			payment.WithTimeout(appConfig.AirwallexHTTPTimeout),
+		)
+		activeProviders["Airwallex"] = airwallexGenerator
+	}
+	if appConfig.DryRun {
+		// Both providers are available, with or without keys, and no links are really created
+		log.Printf("DRY_RUN is set: payment links are fake, and refunds, reconciliation, link listing, link expiry, promotion codes and the Stripe webhook are off")
+		stripeGenerator = payment.NewDryRunGenerator(models.ProviderStripe)
+		airwallexGenerator = payment.NewDryRunGenerator(models.ProviderAirwallex)
+		activeProviders = map[string]payment.PaymentLinkGenerator{}
+	}
+	log.Printf("Stripe enabled: %t, Airwallex enabled: %t", stripeGenerator != nil, airwallexGenerator != nil)
+
+	if appConfig.ValidateProvidersOnStart {
+		// Runs in the background so slow provider APIs don't delay serving Slack requests
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			payment.ValidateProviders(ctx, activeProviders)
+		}()
+	}
+
+	// Initialize URL shortener (no-op unless configured)
+	var urlShortener shortener.URLShortener = shortener.NewNoopShortener()
+	var shortLinkStore shortener.LinkStore
+	switch appConfig.Shortener {
+	case "http":
+		urlShortener = shortener.NewHTTPShortener(appConfig.ShortenerAPIURL, appConfig.ShortenerAPIToken)
+	case "builtin":
+		fileStore, err := shortener.NewFileLinkStore(appConfig.ShortLinkStore)
+		if err != nil {
+			log.Fatalf("Failed to open short link store: %v", err)
+		}
+		shortLinkStore = fileStore
+		urlShortener = shortener.NewRedirectShortener(appConfig.PublicBaseURL, shortLinkStore)
+	}
+
+	// Shared Slack client, using the extra CA certificates when configured
+	newSlackClient := func(token string) *slack.Client {
+		return slack.New(token, slack.OptionHTTPClient(&http.Client{
+			Transport: utils.NewTransport(rootCAs),
+		}))
+	}
+	slackClient := newSlackClient(appConfig.SlackBotToken)
+
+	// Initialize the invoice number counter
+	var invoiceCounters counter.CounterStore
+	switch appConfig.InvoiceCounterStore {
+	case "memory":
+		log.Printf("Invoice counters are kept in memory and will reset on restart")
+		invoiceCounters = counter.NewMemoryCounterStore()
+	case "slack":
+		invoiceCounters = counter.NewSlackCounterStore(slackClient)
+	default:
+		// Channels new to the store carry on from their channel-message counter, so upgrading
+		// from the slack backend doesn't restart numbering
+		seed := counter.WithSeed(counter.NewSlackCounterStore(slackClient).Last)
+		if appConfig.InvoiceCounterStore == "bolt" {
+			boltCounters, err := counter.NewBoltCounterStore(appConfig.InvoiceCounterPath, seed)
+			if err != nil {
+				log.Fatalf("Failed to open invoice counter store: %v", err)
+			}
+			defer boltCounters.Close()
+			invoiceCounters = boltCounters
+		} else {
+			fileCounters, err := counter.NewFileCounterStore(appConfig.InvoiceCounterPath, seed)
+			if err != nil {
+				log.Fatalf("Failed to open invoice counter store: %v", err)
+			}
+			invoiceCounters = fileCounters
+		}
+	}
+
+	// Remember where links were posted so payment webhooks can report back to the channel
+	var linkOrigins services.LinkOriginStore = services.NewMemoryLinkOriginStore()
+	if appConfig.LinkOriginStore != "" {
+		fileOrigins, err := services.NewFileLinkOriginStore(appConfig.LinkOriginStore)
+		if err != nil {
+			log.Fatalf("Failed to open link origin store: %v", err)
+		}
+		linkOrigins = fileOrigins
+	}
 
 	// Initialize Slack Service
-	slackService := services.NewSlackService(appConfig, stripeGenerator, airwallexGenerator)
+	slackService := services.NewSlackService(appConfig, slackClient, stripeGenerator, airwallexGenerator, urlShortener, invoiceCounters, linkOrigins, logger)
 
-	// Initialize Slack Handler
-	slackHandler := handlers.NewSlackHandler(slackService)
+	// Other workspaces use their own credentials; SLACK_BOT_TOKEN serves any team not listed
+	var teamConfigs services.TeamConfigStore
+	if appConfig.TeamConfigPath != "" {
+		fileTeams, err := services.NewFileTeamConfigStore(appConfig.TeamConfigPath)
+		if err != nil {
+			log.Fatalf("Failed to open team config store: %v", err)
+		}
+		teamConfigs = fileTeams
+		log.Printf("Loaded per-workspace Slack credentials from %s", appConfig.TeamConfigPath)
+	} else if appConfig.OAuthEnabled() {
+		log.Printf("TEAM_CONFIG_PATH not set, OAuth installations are kept in memory and lost on restart")
+		teamConfigs = services.NewMemoryTeamConfigStore()
+	}
+	if teamConfigs != nil {
+		slackService.UseTeamConfigs(teamConfigs, newSlackClient)
+	}
 
-	// Initialize Stripe Webhook Handler
-	stripeWebhookHandler := handlers.NewStripeWebhookHandler(appConfig.StripeWebhookSecret, appConfig.StripeAPIKey)
+	// Keep a compliance record of every link and invoice created
+	switch {
+	case appConfig.AuditLogPath != "":
+		auditSink, err := services.NewFileAuditSink(appConfig.AuditLogPath)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditSink.Close()
+		slackService.UseAuditSink(auditSink)
+		log.Printf("Writing audit records to %s", appConfig.AuditLogPath)
+	case appConfig.AuditDBPath != "":
+		auditSink, err := services.NewBoltAuditSink(appConfig.AuditDBPath)
+		if err != nil {
+			log.Fatalf("Failed to open audit database: %v", err)
+		}
+		defer auditSink.Close()
+		slackService.UseAuditSink(auditSink)
+		log.Printf("Writing audit records to the database at %s", appConfig.AuditDBPath)
+	}
+
+	// Deactivate Stripe links that were given an expiry once it passes
+	go slackService.RunLinkExpirySweep(ctx)
+
+	// Initialize Slack Handler
+	slackHandler := handlers.NewSlackHandler(slackService, logger)
 
 	// Register handlers
-	http.HandleFunc("/slack/commands", slackHandler.HandleSlackCommands)
-	http.HandleFunc("/slack/interactions", slackHandler.HandleSlackInteractions)
-	http.HandleFunc("/stripe/webhook", stripeWebhookHandler.HandleWebhook)
+	http.HandleFunc("/slack/commands", tracing.WrapHandler("POST /slack/commands", slackHandler.HandleSlackCommands))
+	http.HandleFunc("/slack/interactions", tracing.WrapHandler("POST /slack/interactions", slackHandler.HandleSlackInteractions))
+	http.HandleFunc("/slack/events", tracing.WrapHandler("POST /slack/events", slackHandler.HandleSlackEvents))
+	// The webhook updates subscriptions, so DRY_RUN leaves it unregistered like the other Stripe features
+	if appConfig.StripeEnabled() && !appConfig.DryRun {
+		stripeWebhookHandler := handlers.NewStripeWebhookHandler(appConfig.StripeWebhookSecret, appConfig.StripeAPIKey, slackService.WebhookTracker(), slackClient, appConfig.CancelSnap, appConfig.StripeWebhookMaxBodyBytes, appConfig.StripeWebhookReplayWindow)
+		stripeWebhookHandler.UseTeamClients(slackService.ClientForTeam)
+		http.HandleFunc("/stripe/webhook", tracing.WrapHandler("POST /stripe/webhook", stripeWebhookHandler.HandleWebhook))
+	}
+	if appConfig.AirwallexEnabled() {
+		if appConfig.AirwallexWebhookSecret == "" {
+			log.Printf("AIRWALLEX_WEBHOOK_SECRET not set, Airwallex webhook deliveries will be rejected")
+		}
+		airwallexWebhookHandler := handlers.NewAirwallexWebhookHandler(appConfig.AirwallexWebhookSecret, slackService)
+		http.HandleFunc("/airwallex/webhook", tracing.WrapHandler("POST /airwallex/webhook", airwallexWebhookHandler.HandleWebhook))
+	}
+	if shortLinkStore != nil {
+		redirectHandler := handlers.NewRedirectHandler(shortLinkStore)
+		http.HandleFunc("/l/", redirectHandler.HandleRedirect)
+	}
 
+	if appConfig.OAuthEnabled() {
+		redirectURL := strings.TrimRight(appConfig.PublicBaseURL, "/") + "/slack/oauth/callback"
+		oauthHandler := handlers.NewSlackOAuthHandler(appConfig.SlackClientID, appConfig.SlackClientSecret, redirectURL, appConfig.SlackOAuthScopes, teamConfigs, &http.Client{
+			Transport: utils.NewTransport(rootCAs),
+		})
+		http.HandleFunc("/slack/oauth/install", oauthHandler.HandleInstall)
+		http.HandleFunc("/slack/oauth/callback", tracing.WrapHandler("GET /slack/oauth/callback", oauthHandler.HandleCallback))
+	}
+
+	// Health checks for load balancers and orchestrators
+	healthHandler := handlers.NewHealthHandler(slackClient, map[string]bool{
+		"stripe":    stripeGenerator != nil,
+		"airwallex": airwallexGenerator != nil,
+	})
+	http.HandleFunc("/healthz", healthHandler.HandleHealth)
+	http.HandleFunc("/readyz", healthHandler.HandleReady)
+	http.HandleFunc("/metrics", metrics.Handler())
+
+	var handler http.Handler = http.DefaultServeMux
+	if appConfig.AccessLog {
+		handler = handlers.LoggingMiddleware(handler, logger, appConfig.AccessLogExcludePaths)
+	}
+	server := &http.Server{
+		Addr:    ":" + appConfig.Port,
+		Handler: handler,
+	}
 	log.Printf("Registered handlers. Ready to receive requests.")
-	log.Fatal(http.ListenAndServe(":"+appConfig.Port, nil))
+	if err := serve(ctx, server, appConfig.ShutdownTimeout); err != nil {
+		log.Printf("Server error: %v", err)
+		shutdownTracing(context.Background())
+		os.Exit(1)
+	}
+
+	// Links already acknowledged in Slack are still created and posted before exiting
+	drainCtx, cancel := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancel()
+	if err := slackService.DrainLinkJobs(drainCtx); err != nil {
+		log.Printf("Error draining background link jobs: %v", err)
+	}
+}
+
+// serve runs server until ctx is cancelled, then stops accepting connections and waits up to
+// timeout for in-flight requests to finish. Webhook handlers schedule subscription
+// cancellations, so they shouldn't be cut off mid-request by a deploy.
+func serve(ctx context.Context, server *http.Server, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutdown signal received, draining in-flight requests (timeout %s)", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown did not complete: %w", err)
+	}
+	log.Printf("All in-flight requests finished, server stopped")
+	return nil
+}
+
+// newLogger returns the structured logger for the configured format. For "text" and "json" it
+// also becomes the slog default, which sends the log package's output through the same
+// handler so older log.Printf calls are formatted consistently. "plain" keeps log's output.
+func newLogger(format string, level slog.Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "json":
+		logger := slog.New(slog.NewJSONHandler(os.Stderr, options))
+		slog.SetDefault(logger)
+		return logger
+	case "text":
+		logger := slog.New(slog.NewTextHandler(os.Stderr, options))
+		slog.SetDefault(logger)
+		return logger
+	default:
+		return slog.Default()
+	}
 }
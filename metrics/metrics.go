@@ -0,0 +1,61 @@
+// Package metrics defines the bot's Prometheus metrics and serves them, along with the Go
+// runtime and process collectors, on /metrics
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric served by Handler. A dedicated registry keeps metrics
+// registered by libraries on the global default out of the bot's endpoint.
+var Registry = prometheus.NewRegistry()
+
+// Metrics exposed on /metrics
+var (
+	LinksCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "paymentbot_payment_links_total",
+		Help: "Payment link creation attempts by provider and outcome (success or error).",
+	}, []string{"provider", "outcome"})
+	InvoiceSubmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "paymentbot_invoice_submissions_total",
+		Help: "Invoice form submissions by outcome (created, previewed, rejected, duplicate or error).",
+	}, []string{"outcome"})
+	WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "paymentbot_webhook_events_total",
+		Help: "Webhook deliveries by provider, event type and outcome (handled, ignored, duplicate or rejected).",
+	}, []string{"provider", "type", "outcome"})
+	OperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "paymentbot_operation_duration_seconds",
+		Help:    "Time taken to create links, process invoice submissions and handle webhooks.",
+		Buckets: DefaultBuckets,
+	}, []string{"operation"})
+)
+
+// DefaultBuckets suit calls to Slack and the payment providers, from 10ms to 30s
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+func init() {
+	Registry.MustRegister(
+		LinksCreated,
+		InvoiceSubmissions,
+		WebhookEvents,
+		OperationDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves every metric in Registry in the Prometheus exposition format
+func Handler() http.HandlerFunc {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}).ServeHTTP
+}
+
+// ObserveSince records the seconds elapsed since start in histogram h, for use with defer
+func ObserveSince(h *prometheus.HistogramVec, start time.Time, labelValues ...string) {
+	h.WithLabelValues(labelValues...).Observe(time.Since(start).Seconds())
+}
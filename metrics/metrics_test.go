@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandlerServesBotMetrics(t *testing.T) {
+	LinksCreated.WithLabelValues("stripe", "success").Inc()
+	InvoiceSubmissions.WithLabelValues("created").Inc()
+	WebhookEvents.WithLabelValues("stripe", "checkout.session.completed", "handled").Inc()
+	ObserveSince(OperationDuration, time.Now().Add(-200*time.Millisecond), "generate_link")
+
+	rec := httptest.NewRecorder()
+	Handler()(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`paymentbot_payment_links_total{outcome="success",provider="stripe"} 1`,
+		`paymentbot_invoice_submissions_total{outcome="created"} 1`,
+		`paymentbot_webhook_events_total{outcome="handled",provider="stripe",type="checkout.session.completed"} 1`,
+		`paymentbot_operation_duration_seconds_bucket{operation="generate_link",le="0.25"} 1`,
+		`paymentbot_operation_duration_seconds_count{operation="generate_link"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
+
+func TestMetricsLint(t *testing.T) {
+	problems, err := testutil.GatherAndLint(Registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		t.Errorf("%s: %s", problem.Metric, problem.Text)
+	}
+}
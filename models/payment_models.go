@@ -1,15 +1,76 @@
 package models
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"paymentbot/money"
+)
+
 // PaymentLinkData represents the data needed to create a payment link
 type PaymentLinkData struct {
-	Amount            float64 `json:"amount"`
-	ServiceName       string  `json:"service_name"`
-	ReferenceNumber   string  `json:"reference_number"`
-	IsSubscription    bool    `json:"is_subscription"`
-	Interval          string  `json:"interval"`           // e.g. "month", "week", "year"
-	IntervalCount     int64   `json:"interval_count"`     // e.g. 1 for every month, 3 for every 3 months
-	EndDateCycles     int64   `json:"end_date_cycles"`    // number of cycles before subscription ends (optional)
-	InternalReference string  `json:"internal_reference"` // Airwallex internal reference (optional)
+	Amount              float64 `json:"amount"`
+	Currency            string  `json:"currency"` // ISO 4217 code, e.g. "USD", "EUR", "HKD"
+	ServiceName         string  `json:"service_name"`
+	ReferenceNumber     string  `json:"reference_number"`
+	IsSubscription      bool    `json:"is_subscription"`
+	Interval            string  `json:"interval"`                 // "day", "week", "month" or "year"
+	IntervalCount       int64   `json:"interval_count"`           // e.g. 1 for every month, 3 for every 3 months
+	EndDateCycles       int64   `json:"end_date_cycles"`          // number of cycles before subscription ends (optional)
+	TrialDays           int64   `json:"trial_days,omitempty"`     // Stripe: free days before the first charge on subscriptions
+	InternalReference   string  `json:"internal_reference"`       // Airwallex internal reference (optional)
+	AllowPromotionCodes bool    `json:"allow_promotion_codes"`    // Stripe: show a promo-code box at checkout
+	SKU                 string  `json:"sku,omitempty"`            // Stripe: product code used to reuse an existing product
+	SkipSaveCard        bool    `json:"skip_save_card"`           // Stripe: don't save the card for future use on one-time payments
+	AutomaticTax        bool    `json:"automatic_tax,omitempty"`  // Stripe: calculate tax at checkout from the customer's location
+	PromotionCode       string  `json:"promotion_code,omitempty"` // Stripe: customer-facing promotion code prefilled at checkout
+	CustomerEmail       string  `json:"customer_email,omitempty"` // Stripe: payer's email, prefilled at checkout
+	RedirectURL         string  `json:"redirect_url,omitempty"`   // https page customers are sent to after paying (optional)
+
+	// Stripe: the customer chooses how many to buy, between QuantityMin and QuantityMax.
+	// One-time, single-item links only; Amount is then the unit price.
+	AdjustableQuantity bool  `json:"adjustable_quantity,omitempty"`
+	QuantityMin        int64 `json:"quantity_min,omitempty"`
+	QuantityMax        int64 `json:"quantity_max,omitempty"`
+
+	// Stripe: donors enter their own amount. Amount is the suggested amount (0 for none) and
+	// DonationMinimum the lowest accepted (0 uses Stripe's minimum).
+	Donation        bool    `json:"donation,omitempty"`
+	DonationMinimum float64 `json:"donation_minimum,omitempty"`
+
+	// When the link stops accepting payments (zero = never). Airwallex expires the link itself;
+	// Stripe links are deactivated by a periodic sweep.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Stripe: when set, each item gets its own product and price and Amount is their total
+	LineItems []PaymentLineItem `json:"line_items,omitempty"`
+
+	// Where the link was requested, stored on the provider side so webhooks can report back
+	SlackChannelID string `json:"slack_channel_id,omitempty"`
+	SlackUserID    string `json:"slack_user_id,omitempty"`
+	SlackTeamID    string `json:"slack_team_id,omitempty"`
+
+	// Slack interaction that requested the link. Stripe derives idempotency keys from it so a
+	// retried interaction returns the objects the first attempt created instead of duplicates.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PaymentLineItem is one product on a multi-item payment link
+type PaymentLineItem struct {
+	Description string  `json:"description"`
+	UnitAmount  float64 `json:"unit_amount"`
+	Quantity    int64   `json:"quantity"`
+	SKU         string  `json:"sku,omitempty"`
+}
+
+// Items returns the link's line items, treating a link without LineItems as a single
+// item built from Amount, ServiceName and SKU
+func (d *PaymentLinkData) Items() []PaymentLineItem {
+	if len(d.LineItems) > 0 {
+		return d.LineItems
+	}
+	return []PaymentLineItem{{Description: d.ServiceName, UnitAmount: d.Amount, Quantity: 1, SKU: d.SKU}}
 }
 
 // PaymentProvider represents the payment service provider
@@ -22,19 +83,107 @@ const (
 
 // InvoiceData represents the data needed to create an invoice
 type InvoiceData struct {
-	InvoiceNumber    string            `json:"invoice_number"`
-	ClientName       string            `json:"client_name"`
-	ClientAddress    string            `json:"client_address"`
-	ClientEmail      string            `json:"client_email"`
-	DateDue          string            `json:"date_due"`
-	Currency         string            `json:"currency"` // e.g., "USD", "EUR", "HKD"
-	LineItems        []InvoiceLineItem `json:"line_items"`
-	Notes            string            `json:"notes"` // Optional notes to display near the bottom of the PDF
+	InvoiceNumber string            `json:"invoice_number"`
+	ClientName    string            `json:"client_name"`
+	ClientAddress string            `json:"client_address"`
+	ClientEmail   string            `json:"client_email"`
+	DateDue       string            `json:"date_due"`
+	Currency      string            `json:"currency"` // e.g., "USD", "EUR", "HKD"
+	LineItems     []InvoiceLineItem `json:"line_items"`
+	Notes         string            `json:"notes"`               // Optional notes to display near the bottom of the PDF
+	TaxRate       float64           `json:"tax_rate,omitempty"`  // Percentage added on top of the subtotal, e.g. 20 for 20%
+	TaxLabel      string            `json:"tax_label,omitempty"` // e.g. "VAT" or "GST" (defaults to "Tax")
+
+	// Optional payment URL, printed with a QR code in the PDF footer
+	PayLink string `json:"pay_link,omitempty"`
+
+	// Optional invoice-level discount, either a percentage of the subtotal or a fixed amount
+	DiscountPercent float64 `json:"discount_percent,omitempty"`
+	DiscountAmount  float64 `json:"discount_amount,omitempty"`
+}
+
+// InvoiceTotals is the money breakdown of an invoice. Discount is taken off before tax.
+type InvoiceTotals struct {
+	Subtotal money.Money
+	Discount money.Money
+	Tax      money.Money
+	Total    money.Money
+}
+
+// ComputeTotals works out the subtotal, discount, tax and total together. Everything that
+// shows invoice amounts reads them from here, so the PDF and Slack messages can't disagree.
+// The sums are done in minor units, and the discount and tax are rounded to the nearest one.
+func (i *InvoiceData) ComputeTotals() InvoiceTotals {
+	totals := InvoiceTotals{Subtotal: money.Money{Currency: i.Currency}}
+	for _, item := range i.LineItems {
+		totals.Subtotal = totals.Subtotal.Add(item.LineTotal(i.Currency))
+	}
+	totals.Discount = money.FromMajor(i.DiscountAmount, i.Currency)
+	if i.DiscountPercent > 0 {
+		totals.Discount = totals.Subtotal.Percent(i.DiscountPercent)
+	}
+	totals.Tax = money.Money{Currency: i.Currency}
+	if i.TaxRate > 0 {
+		totals.Tax = totals.Subtotal.Sub(totals.Discount).Percent(i.TaxRate)
+	}
+	totals.Total = totals.Subtotal.Sub(totals.Discount).Add(totals.Tax)
+	return totals
+}
+
+// Subtotal is the sum of all line items before tax
+func (i *InvoiceData) Subtotal() float64 {
+	return i.ComputeTotals().Subtotal.Major()
+}
+
+// Discount is the amount taken off the subtotal, rounded to the nearest cent
+func (i *InvoiceData) Discount() float64 {
+	return i.ComputeTotals().Discount.Major()
+}
+
+// DiscountDescription labels the discount line, e.g. "Discount (10%)"
+func (i *InvoiceData) DiscountDescription() string {
+	if i.DiscountPercent > 0 {
+		return fmt.Sprintf("Discount (%s%%)", strconv.FormatFloat(i.DiscountPercent, 'f', -1, 64))
+	}
+	return "Discount"
+}
+
+// TaxAmount is the tax on the discounted subtotal, rounded to the nearest cent.
+// Discounts are applied before tax.
+func (i *InvoiceData) TaxAmount() float64 {
+	return i.ComputeTotals().Tax.Major()
+}
+
+// Total is the subtotal less any discount, plus tax
+func (i *InvoiceData) Total() float64 {
+	return i.ComputeTotals().Total.Major()
+}
+
+// TaxDescription labels the tax line, e.g. "VAT (20%)"
+func (i *InvoiceData) TaxDescription() string {
+	label := i.TaxLabel
+	if label == "" {
+		label = "Tax"
+	}
+	return fmt.Sprintf("%s (%s%%)", label, strconv.FormatFloat(i.TaxRate, 'f', -1, 64))
+}
+
+// InvoiceCompany is the issuing company shown in the invoice header
+type InvoiceCompany struct {
+	Name         string   `json:"name"`
+	AddressLines []string `json:"address_lines"`
+	Phone        string   `json:"phone"`
 }
 
 // InvoiceLineItem represents a line item in an invoice
 type InvoiceLineItem struct {
 	ServiceDescription string  `json:"service_description"`
-	UnitPrice         float64 `json:"unit_price"`
-	Quantity          int     `json:"quantity"`
+	UnitPrice          float64 `json:"unit_price"`
+	Quantity           int     `json:"quantity"`
+}
+
+// LineTotal is the item's unit price times its quantity. The unit price is rounded to the
+// currency's minor unit before multiplying, so the line matches the price printed beside it.
+func (item InvoiceLineItem) LineTotal(currency string) money.Money {
+	return money.FromMajor(item.UnitPrice, currency).Times(int64(item.Quantity))
 }
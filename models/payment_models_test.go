@@ -0,0 +1,114 @@
+package models
+
+import "testing"
+
+func TestInvoiceTax(t *testing.T) {
+	tests := []struct {
+		name         string
+		items        []InvoiceLineItem
+		currency     string
+		taxRate      float64
+		wantSubtotal float64
+		wantTax      float64
+		wantTotal    float64
+	}{
+		{"no tax", []InvoiceLineItem{{UnitPrice: 100, Quantity: 1}}, "USD", 0, 100, 0, 100},
+		{"10%", []InvoiceLineItem{{UnitPrice: 50, Quantity: 2}, {UnitPrice: 25, Quantity: 1}}, "USD", 10, 125, 12.5, 137.5},
+		// 7.5% of 19.99 is 1.49925, which rounds to the nearest cent
+		{"rounded to the cent", []InvoiceLineItem{{UnitPrice: 19.99, Quantity: 1}}, "USD", 7.5, 19.99, 1.50, 21.49},
+		// 8% of 1001 yen is 80.08, and yen have no minor unit
+		{"rounded to the yen", []InvoiceLineItem{{UnitPrice: 1001, Quantity: 1}}, "JPY", 8, 1001, 80, 1081},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := &InvoiceData{Currency: tt.currency, LineItems: tt.items, TaxRate: tt.taxRate}
+			if got := invoice.Subtotal(); got != tt.wantSubtotal {
+				t.Errorf("Subtotal() = %v, want %v", got, tt.wantSubtotal)
+			}
+			if got := invoice.TaxAmount(); got != tt.wantTax {
+				t.Errorf("TaxAmount() = %v, want %v", got, tt.wantTax)
+			}
+			if got := invoice.Total(); got != tt.wantTotal {
+				t.Errorf("Total() = %v, want %v", got, tt.wantTotal)
+			}
+			totals := invoice.ComputeTotals()
+			if totals.Total.Minor != totals.Subtotal.Minor+totals.Tax.Minor {
+				t.Errorf("total %d minor units isn't subtotal %d plus tax %d", totals.Total.Minor, totals.Subtotal.Minor, totals.Tax.Minor)
+			}
+		})
+	}
+}
+
+func TestTaxDescription(t *testing.T) {
+	tests := []struct {
+		label string
+		rate  float64
+		want  string
+	}{
+		{"", 10, "Tax (10%)"},
+		{"VAT", 20, "VAT (20%)"},
+		{"GST", 7.5, "GST (7.5%)"},
+	}
+	for _, tt := range tests {
+		invoice := &InvoiceData{TaxLabel: tt.label, TaxRate: tt.rate}
+		if got := invoice.TaxDescription(); got != tt.want {
+			t.Errorf("TaxDescription() with label %q and rate %v = %q, want %q", tt.label, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestInvoiceTotals(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []InvoiceLineItem
+		want  int64
+	}{
+		{"no line items", nil, 0},
+		{"one item", []InvoiceLineItem{{UnitPrice: 250, Quantity: 1}}, 25000},
+		{"varying quantities", []InvoiceLineItem{
+			{UnitPrice: 12.50, Quantity: 3},
+			{UnitPrice: 0.99, Quantity: 10},
+			{UnitPrice: 250, Quantity: 1},
+			{UnitPrice: 19.99, Quantity: 7},
+		}, 43733},
+		{"zero quantity", []InvoiceLineItem{{UnitPrice: 100, Quantity: 0}, {UnitPrice: 5, Quantity: 2}}, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := &InvoiceData{Currency: "USD", LineItems: tt.items}
+			totals := invoice.ComputeTotals()
+			if totals.Subtotal.Minor != tt.want || totals.Total.Minor != tt.want {
+				t.Errorf("ComputeTotals() subtotal %d, total %d minor units, want %d", totals.Subtotal.Minor, totals.Total.Minor, tt.want)
+			}
+			if totals.Tax.Minor != 0 || totals.Discount.Minor != 0 {
+				t.Errorf("ComputeTotals() tax %d, discount %d without a rate or discount, want 0", totals.Tax.Minor, totals.Discount.Minor)
+			}
+			if totals.Total.Currency != "USD" {
+				t.Errorf("total currency = %q, want USD", totals.Total.Currency)
+			}
+			if want := float64(tt.want) / 100; invoice.Subtotal() != want || invoice.Total() != want {
+				t.Errorf("Subtotal() = %v, Total() = %v, want %v", invoice.Subtotal(), invoice.Total(), want)
+			}
+		})
+	}
+}
+
+func TestManyLineItemsDontDrift(t *testing.T) {
+	// Prices like 0.10 and 0.07 can't be stored exactly as floats; summing them in minor units
+	// must land on exactly the cents a person would add up by hand
+	for _, lines := range []int{10, 100, 1000, 10000} {
+		for _, cents := range []int64{1, 7, 10, 33, 1999, 99999} {
+			invoice := &InvoiceData{Currency: "USD"}
+			for i := 0; i < lines; i++ {
+				invoice.LineItems = append(invoice.LineItems, InvoiceLineItem{UnitPrice: float64(cents) / 100, Quantity: i%3 + 1})
+			}
+			var want int64
+			for _, item := range invoice.LineItems {
+				want += cents * int64(item.Quantity)
+			}
+			if got := invoice.ComputeTotals().Total.Minor; got != want {
+				t.Errorf("%d lines at %d cents total %d minor units, want %d", lines, cents, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package money holds amounts as whole minor units (cents, yen, fils) so sums and products
+// never drift the way float64 arithmetic does. Amounts typed by users are converted once, at
+// the boundary, with FromMajor.
+package money
+
+import (
+	"math"
+	"strings"
+)
+
+// Money is an amount in the currency's smallest unit, e.g. {1999, "USD"} is $19.99
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// zeroDecimalCurrencies have no minor unit; Stripe expects the amount as-is (e.g. 1000 JPY = 1000)
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// threeDecimalCurrencies use thousandths as their minor unit
+var threeDecimalCurrencies = map[string]bool{
+	"BHD": true, "JOD": true, "KWD": true, "OMR": true, "TND": true,
+}
+
+// Decimals returns the number of minor-unit digits for a currency (2 for most)
+func Decimals(currency string) int {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	switch {
+	case zeroDecimalCurrencies[currency]:
+		return 0
+	case threeDecimalCurrencies[currency]:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Multiplier returns the factor converting a major-unit amount to minor units
+// (100 for USD, 1 for JPY, 1000 for KWD)
+func Multiplier(currency string) float64 {
+	return math.Pow10(Decimals(currency))
+}
+
+// FromMajor converts a major-unit amount such as 19.99 to Money, rounding to the nearest
+// minor unit so float error (e.g. 19.99*100 = 1998.9999...) doesn't lose a cent
+func FromMajor(amount float64, currency string) Money {
+	return Money{Minor: int64(math.Round(amount * Multiplier(currency))), Currency: currency}
+}
+
+// Major returns the amount in major units, e.g. 19.99 for {1999, "USD"}
+func (m Money) Major() float64 {
+	return float64(m.Minor) / Multiplier(m.Currency)
+}
+
+// Add returns m + other. Both must be in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+// Sub returns m - other. Both must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+// Times returns m multiplied by a whole quantity
+func (m Money) Times(quantity int64) Money {
+	return Money{Minor: m.Minor * quantity, Currency: m.Currency}
+}
+
+// Percent returns percent% of m, rounded to the nearest minor unit
+func (m Money) Percent(percent float64) Money {
+	return Money{Minor: int64(math.Round(float64(m.Minor) * percent / 100)), Currency: m.Currency}
+}
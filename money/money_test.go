@@ -0,0 +1,71 @@
+package money
+
+import "testing"
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{19.99, "USD", 1999},
+		{19.99, "usd", 1999},
+		{0.29, "EUR", 29},
+		{1000, "JPY", 1000},
+		{1000, "KRW", 1000},
+		{1.234, "KWD", 1234},
+		{0.005, "USD", 1},
+		{0.004, "USD", 0},
+		{1.005, "USD", 100}, // 1.005 is stored as 1.00499999...
+		{2.675, "GBP", 268},
+		{999999.99, "USD", 99999999},
+	}
+	for _, tt := range tests {
+		if got := FromMajor(tt.amount, tt.currency); got.Minor != tt.want {
+			t.Errorf("FromMajor(%v, %s) = %d, want %d", tt.amount, tt.currency, got.Minor, tt.want)
+		}
+	}
+}
+
+func TestDecimals(t *testing.T) {
+	for currency, want := range map[string]int{"USD": 2, "jpy": 0, " KRW ": 0, "KWD": 3, "XYZ": 2} {
+		if got := Decimals(currency); got != want {
+			t.Errorf("Decimals(%q) = %d, want %d", currency, got, want)
+		}
+	}
+}
+
+func TestArithmeticStaysInMinorUnits(t *testing.T) {
+	price := FromMajor(0.1, "USD")
+	total := Money{Currency: "USD"}
+	for i := 0; i < 10; i++ {
+		total = total.Add(price)
+	}
+	if total.Minor != 100 || total.Major() != 1 {
+		t.Errorf("ten 0.10 items = %d minor (%v), want exactly 1.00", total.Minor, total.Major())
+	}
+	if got := FromMajor(19.99, "USD").Times(3).Sub(FromMajor(0.97, "USD")); got.Minor != 5900 {
+		t.Errorf("3 x 19.99 - 0.97 = %d minor, want 5900", got.Minor)
+	}
+	if got := FromMajor(1000, "JPY").Percent(7.5); got.Minor != 75 {
+		t.Errorf("7.5%% of 1000 JPY = %d, want 75", got.Minor)
+	}
+	if got := FromMajor(0.33, "USD").Percent(50); got.Minor != 17 {
+		t.Errorf("50%% of 0.33 USD = %d minor, want 17 (rounded)", got.Minor)
+	}
+}
+
+func TestRepeatedAdditionMatchesMultiplication(t *testing.T) {
+	for _, currency := range []string{"USD", "JPY", "KWD"} {
+		for _, amount := range []float64{0.01, 0.07, 0.1, 0.29, 1.005, 19.99, 333.33} {
+			price := FromMajor(amount, currency)
+			sum := Money{Currency: currency}
+			for i := 0; i < 5000; i++ {
+				sum = sum.Add(price)
+			}
+			if want := price.Times(5000); sum.Minor != want.Minor {
+				t.Errorf("5000 x %v %s added up = %d minor, multiplied = %d", amount, currency, sum.Minor, want.Minor)
+			}
+		}
+	}
+}
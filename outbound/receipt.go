@@ -0,0 +1,125 @@
+package outbound
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries the HMAC signature of every receipt, formatted as "t=<unix>,v1=<hex>"
+const SignatureHeader = "X-Paymentbot-Signature"
+
+const receiptQueueSize = 256
+
+// Receipt types
+const (
+	ReceiptPaymentLink = "payment_link"
+	ReceiptInvoice     = "invoice"
+)
+
+// Receipt is the machine-readable record posted when a payment link or invoice is created
+type Receipt struct {
+	Type      string    `json:"type"`
+	Provider  string    `json:"provider,omitempty"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	Link      string    `json:"link,omitempty"`
+	ID        string    `json:"id"`
+	Reference string    `json:"reference,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Channel   string    `json:"channel"`
+	User      string    `json:"user"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReceiptEmitter posts receipts to an outbound webhook in the background. A nil
+// *ReceiptEmitter is a valid no-op, which is what callers get when no URL is configured.
+type ReceiptEmitter struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan Receipt
+}
+
+// NewReceiptEmitter starts a background sender for url. It returns nil when url is empty.
+func NewReceiptEmitter(url, secret string) *ReceiptEmitter {
+	if url == "" {
+		return nil
+	}
+
+	e := &ReceiptEmitter{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Receipt, receiptQueueSize),
+	}
+	go e.run()
+	return e
+}
+
+// Emit queues a receipt for delivery without blocking. Receipts are dropped if the queue is full.
+func (e *ReceiptEmitter) Emit(receipt Receipt) {
+	if e == nil {
+		return
+	}
+	if receipt.Timestamp.IsZero() {
+		receipt.Timestamp = time.Now().UTC()
+	}
+
+	select {
+	case e.queue <- receipt:
+	default:
+		log.Printf("[Outbound] Receipt queue full, dropping %s receipt %s", receipt.Type, receipt.ID)
+	}
+}
+
+func (e *ReceiptEmitter) run() {
+	for receipt := range e.queue {
+		if err := e.send(receipt); err != nil {
+			log.Printf("[Outbound] Failed to deliver %s receipt %s: %v", receipt.Type, receipt.ID, err)
+		}
+	}
+}
+
+func (e *ReceiptEmitter) send(receipt Receipt) error {
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(e.secret, time.Now(), body))
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign computes the signature header value for body. The HMAC-SHA256 covers
+// "<unix timestamp>.<body>" so receivers can reject replayed requests.
+func Sign(secret []byte, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
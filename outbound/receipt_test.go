@@ -0,0 +1,133 @@
+package outbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type delivery struct {
+	body      []byte
+	signature string
+}
+
+func newReceiver(t *testing.T) (string, <-chan delivery) {
+	t.Helper()
+	deliveries := make(chan delivery, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{body: body, signature: r.Header.Get(SignatureHeader)}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, deliveries
+}
+
+// verify checks a signature header the way a receiver would
+func verify(secret, header string, body []byte) bool {
+	timestamp, mac, ok := strings.Cut(header, ",v1=")
+	timestamp, found := strings.CutPrefix(timestamp, "t=")
+	if !ok || !found {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "." + string(body)))
+	return hmac.Equal([]byte(mac), []byte(hex.EncodeToString(h.Sum(nil))))
+}
+
+func TestReceiptPayloadAndSignature(t *testing.T) {
+	url, deliveries := newReceiver(t)
+	emitter := NewReceiptEmitter(url, "s3cret")
+
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	emitter.Emit(Receipt{
+		Type:      ReceiptPaymentLink,
+		Provider:  "stripe",
+		Amount:    49.5,
+		Currency:  "EUR",
+		Link:      "https://buy.stripe.com/test_1",
+		ID:        "plink_1",
+		Reference: "REF-1",
+		Channel:   "C1",
+		User:      "U1",
+		Timestamp: at,
+	})
+
+	var got delivery
+	select {
+	case got = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("receipt was not delivered")
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("payload %s is not JSON: %v", got.body, err)
+	}
+	want := map[string]interface{}{
+		"type": "payment_link", "provider": "stripe", "amount": 49.5, "currency": "EUR",
+		"link": "https://buy.stripe.com/test_1", "id": "plink_1", "reference": "REF-1",
+		"channel": "C1", "user": "U1", "timestamp": "2026-10-16T09:30:00Z",
+	}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("payload[%q] = %v, want %v", key, payload[key], value)
+		}
+	}
+	if _, ok := payload["client"]; ok {
+		t.Error("payload has an empty client field, want it omitted")
+	}
+
+	if !verify("s3cret", got.signature, got.body) {
+		t.Errorf("signature %q doesn't verify with the shared secret", got.signature)
+	}
+	if verify("wrong", got.signature, got.body) {
+		t.Error("signature verifies with the wrong secret")
+	}
+}
+
+func TestEmitFillsTheTimestamp(t *testing.T) {
+	url, deliveries := newReceiver(t)
+	before := time.Now().UTC().Truncate(time.Second)
+	NewReceiptEmitter(url, "s3cret").Emit(Receipt{Type: ReceiptInvoice, ID: "INV-1001"})
+
+	var receipt Receipt
+	select {
+	case got := <-deliveries:
+		json.Unmarshal(got.body, &receipt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("receipt was not delivered")
+	}
+	if receipt.Timestamp.Before(before) {
+		t.Errorf("timestamp = %s, want the time it was emitted", receipt.Timestamp)
+	}
+}
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+	got := Sign([]byte("key"), at, body)
+	if !strings.HasPrefix(got, "t=1700000000,v1=") || !verify("key", got, body) {
+		t.Errorf("Sign = %q, want a verifiable t=1700000000 signature", got)
+	}
+	if Sign([]byte("key"), at, []byte(`{"id":"2"}`)) == got {
+		t.Error("different bodies have the same signature")
+	}
+	if Sign([]byte("key"), at.Add(time.Second), body) == got {
+		t.Error("different timestamps have the same signature")
+	}
+}
+
+func TestNilEmitterIsANoOp(t *testing.T) {
+	emitter := NewReceiptEmitter("", "s3cret")
+	if emitter != nil {
+		t.Fatal("NewReceiptEmitter without a URL returned an emitter")
+	}
+	emitter.Emit(Receipt{ID: "ignored"})
+}
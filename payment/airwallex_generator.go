@@ -2,47 +2,105 @@ package payment
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"paymentbot/models"
+	"paymentbot/tracing"
+	"paymentbot/utils"
 )
 
+// AirwallexBranding holds optional merchant branding shown on Airwallex payment links
+type AirwallexBranding struct {
+	MerchantName string
+	LogoURL      string
+}
+
+// DefaultAirwallexTimeout is the per-request timeout unless WithTimeout overrides it
+const DefaultAirwallexTimeout = 30 * time.Second
+
+// tokenRefreshMargin is how long before expiry a cached token is considered stale
+const tokenRefreshMargin = 60 * time.Second
+
 // AirwallexGenerator implements PaymentLinkGenerator for Airwallex
 type AirwallexGenerator struct {
 	clientID string
 	apiKey   string
 	baseURL  string
+	branding AirwallexBranding
 	client   *http.Client
+	retry    RetryPolicy
+
+	tokenMu        sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
+}
+
+// AirwallexOption customizes an AirwallexGenerator
+type AirwallexOption func(*AirwallexGenerator)
+
+// WithHTTPClient overrides the HTTP client used for Airwallex API calls
+func WithHTTPClient(client *http.Client) AirwallexOption {
+	return func(a *AirwallexGenerator) {
+		a.client = client
+	}
+}
+
+// WithRetryPolicy overrides how failed Airwallex API calls are retried
+func WithRetryPolicy(policy RetryPolicy) AirwallexOption {
+	return func(a *AirwallexGenerator) {
+		a.retry = policy
+	}
 }
 
 // NewAirwallexGenerator creates a new Airwallex payment link generator
-func NewAirwallexGenerator(clientID, apiKey, baseURL string) PaymentLinkGenerator {
-	return &AirwallexGenerator{
+func NewAirwallexGenerator(clientID, apiKey, baseURL string, branding AirwallexBranding, opts ...AirwallexOption) PaymentLinkGenerator {
+	a := &AirwallexGenerator{
 		clientID: clientID,
 		apiKey:   apiKey,
 		baseURL:  baseURL,
-		client:   &http.Client{Timeout: 10 * time.Second},
+		branding: branding,
+		client:   &http.Client{Timeout: DefaultAirwallexTimeout},
+		retry:    RetryPolicy{MaxRetries: DefaultMaxRetries, BaseDelay: DefaultRetryBaseDelay},
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	return a
 }
 
 // GenerateLink creates an Airwallex payment link
-func (a *AirwallexGenerator) GenerateLink(data *models.PaymentLinkData) (string, string, error) {
+func (a *AirwallexGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
 	log.Printf("[Airwallex] GenerateLink called with: %+v", data)
 
-	// Authenticate and get token
-	token, err := a.authenticate()
+	// Authenticate (or reuse a cached token)
+	token, err := a.getToken(ctx)
 	if err != nil {
 		log.Printf("[Airwallex] Auth error: %v", err)
 		return "", "", fmt.Errorf("failed to authenticate with Airwallex: %w", err)
 	}
 
 	// Create payment link
-	link, id, err := a.createPaymentLink(token, data)
+	link, id, err := a.createPaymentLink(ctx, token, data)
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.StatusCode == http.StatusUnauthorized {
+		// The cached token was revoked or rotated before its expiry, so log in again and retry once.
+		// A 401 means nothing was created, so the retry can't duplicate the link.
+		log.Printf("[Airwallex] Token rejected, logging in again")
+		a.invalidateToken(token)
+		if token, err = a.getToken(ctx); err != nil {
+			log.Printf("[Airwallex] Auth error: %v", err)
+			return "", "", fmt.Errorf("failed to authenticate with Airwallex: %w", err)
+		}
+		link, id, err = a.createPaymentLink(ctx, token, data)
+	}
 	if err != nil {
 		log.Printf("[Airwallex] Link creation error: %v", err)
 		return "", "", fmt.Errorf("failed to create Airwallex payment link: %w", err)
@@ -52,39 +110,68 @@ func (a *AirwallexGenerator) GenerateLink(data *models.PaymentLinkData) (string,
 	return link, id, nil
 }
 
-// authenticate authenticates with Airwallex and returns a bearer token
-func (a *AirwallexGenerator) authenticate() (string, error) {
-	log.Printf("[Airwallex] Authenticating with client_id=%s, base_url=%s", a.clientID, a.baseURL)
+// getToken returns a cached bearer token, logging in again when it is missing or close to expiry
+func (a *AirwallexGenerator) getToken(ctx context.Context) (string, error) {
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
 
-	url := a.baseURL + "/api/v1/authentication/login"
-	body := []byte(`{}`)
+	if a.token != "" && time.Now().Add(tokenRefreshMargin).Before(a.tokenExpiresAt) {
+		return a.token, nil
+	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	token, expiresAt, err := a.authenticate(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to create auth request: %w", err)
+		return "", err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-client-id", a.clientID)
-	req.Header.Set("x-api-key", a.apiKey)
+	a.token = token
+	a.tokenExpiresAt = expiresAt
+	return token, nil
+}
 
-	log.Printf("[Airwallex] Sending auth request to %s", url)
-	resp, err := a.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send auth request: %w", err)
+// invalidateToken drops token from the cache, unless another request has already replaced it
+func (a *AirwallexGenerator) invalidateToken(token string) {
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
+
+	if a.token == token {
+		a.token = ""
+		a.tokenExpiresAt = time.Time{}
 	}
-	defer resp.Body.Close()
+}
+
+// authenticate authenticates with Airwallex and returns a bearer token and its expiry
+func (a *AirwallexGenerator) authenticate(ctx context.Context) (string, time.Time, error) {
+	log.Printf("[Airwallex] Authenticating with client_id=%s, base_url=%s", utils.Redact(a.clientID), a.baseURL)
+
+	ctx, span := tracing.StartClientSpan(ctx, "airwallex.authenticate")
+	defer span.End()
 
-	respBody, err := io.ReadAll(resp.Body)
+	url := a.baseURL + "/api/v1/authentication/login"
+
+	log.Printf("[Airwallex] Sending auth request to %s", url)
+	// Logging in has no side effects, so any transient failure is retried
+	resp, respBody, err := doWithRetry(ctx, a.client, a.retry, true, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create auth request: %w", err)
+		}
+		tracing.InjectHeaders(ctx, req.Header)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-client-id", a.clientID)
+		req.Header.Set("x-api-key", a.apiKey)
+		return req, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read auth response: %w", err)
+		span.RecordError(err)
+		return "", time.Time{}, fmt.Errorf("failed to send auth request: %w", err)
 	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	log.Printf("[Airwallex] Auth response status: %s", resp.Status)
-	log.Printf("[Airwallex] Auth response body: %s", string(respBody))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("authentication failed with status %d: %s", resp.StatusCode, string(respBody))
+		return "", time.Time{}, newAirwallexError("authentication", resp, respBody)
 	}
 
 	var result struct {
@@ -93,15 +180,41 @@ func (a *AirwallexGenerator) authenticate() (string, error) {
 	}
 
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("failed to parse auth response: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to parse auth response: %w", err)
+	}
+
+	expiresAt, err := parseAirwallexTime(result.ExpiresAt)
+	if err != nil {
+		// Without a usable expiry the token is used for this request only
+		log.Printf("[Airwallex] Could not parse token expiry %q, token will not be cached: %v", result.ExpiresAt, err)
+		expiresAt = time.Time{}
 	}
 
-	log.Printf("[Airwallex] Received token: %s, expires_at: %s", result.Token, result.ExpiresAt)
-	return result.Token, nil
+	log.Printf("[Airwallex] Received token: %s, expires_at: %s", utils.Redact(result.Token), result.ExpiresAt)
+	return result.Token, expiresAt, nil
+}
+
+// parseAirwallexTime parses the timestamps returned by Airwallex, which use a numeric
+// UTC offset without a colon (e.g. "2024-01-02T15:04:05+0000")
+func parseAirwallexTime(value string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02T15:04:05-0700",
+		time.RFC3339,
+		time.RFC3339Nano,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format")
 }
 
 // createPaymentLink creates a payment link via Airwallex API
-func (a *AirwallexGenerator) createPaymentLink(token string, data *models.PaymentLinkData) (string, string, error) {
+func (a *AirwallexGenerator) createPaymentLink(ctx context.Context, token string, data *models.PaymentLinkData) (string, string, error) {
+	ctx, span := tracing.StartClientSpan(ctx, "airwallex.payment_link.create")
+	defer span.End()
+
 	requestBody := a.buildPaymentLinkRequest(data)
 	bodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
@@ -111,31 +224,30 @@ func (a *AirwallexGenerator) createPaymentLink(token string, data *models.Paymen
 	log.Printf("[Airwallex] Creating payment link with body: %s", string(bodyBytes))
 
 	url := a.baseURL + "/api/v1/pa/payment_links/create"
-	req, err := http.NewRequest("POST", url, bytes.NewReader(bodyBytes))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create payment link request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
 
 	log.Printf("[Airwallex] POST %s", url)
-	resp, err := a.client.Do(req)
+	// Creating a link is not idempotent, so only failures where nothing was created are retried
+	resp, respBody, err := doWithRetry(ctx, a.client, a.retry, false, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create payment link request: %w", err)
+		}
+		tracing.InjectHeaders(ctx, req.Header)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
+		span.RecordError(err)
 		return "", "", fmt.Errorf("failed to send payment link request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read payment link response: %w", err)
-	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
 
 	log.Printf("[Airwallex] Payment link response status: %s", resp.Status)
-	log.Printf("[Airwallex] Payment link response body: %s", string(respBody))
+	log.Printf("[Airwallex] Payment link response body: %s", utils.RedactJSON(respBody))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", "", fmt.Errorf("payment link creation failed with status %d: %s", resp.StatusCode, string(respBody))
+		return "", "", newAirwallexError("payment link creation", resp, respBody)
 	}
 
 	var result struct {
@@ -150,15 +262,24 @@ func (a *AirwallexGenerator) createPaymentLink(token string, data *models.Paymen
 	if result.PaymentLinkUrl == "" {
 		return "", "", fmt.Errorf("payment link URL not found in response")
 	}
+	// The ID is what webhooks and the Slack message refer to, so a missing one is worth flagging
+	if result.ID == "" {
+		log.Printf("[Airwallex] Warning: payment link response has no id, the link can't be matched to webhooks")
+	}
 
 	return result.PaymentLinkUrl, result.ID, nil
 }
 
 // buildPaymentLinkRequest constructs the request body for Airwallex payment link creation
 func (a *AirwallexGenerator) buildPaymentLinkRequest(data *models.PaymentLinkData) map[string]interface{} {
+	currency := strings.ToUpper(data.Currency)
+	if currency == "" {
+		currency = "USD"
+	}
+
 	requestBody := map[string]interface{}{
 		"amount":      data.Amount,
-		"currency":    "USD",
+		"currency":    currency,
 		"title":       data.ServiceName,
 		"description": data.ReferenceNumber,
 		"reference":   data.InternalReference,
@@ -167,6 +288,24 @@ func (a *AirwallexGenerator) buildPaymentLinkRequest(data *models.PaymentLinkDat
 	if data.InternalReference == "" {
 		requestBody["reference"] = fmt.Sprintf("slackbot-%d", time.Now().UnixNano())
 	}
+	if data.RedirectURL != "" {
+		requestBody["return_url"] = data.RedirectURL
+	}
+	if !data.ExpiresAt.IsZero() {
+		requestBody["expires_at"] = data.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	// Only send branding fields that are configured so links fall back to account defaults otherwise
+	branding := map[string]interface{}{}
+	if a.branding.MerchantName != "" {
+		branding["merchant_name"] = a.branding.MerchantName
+	}
+	if a.branding.LogoURL != "" {
+		branding["logo_url"] = a.branding.LogoURL
+	}
+	if len(branding) > 0 {
+		requestBody["branding"] = branding
+	}
 
 	// Note: Airwallex may not support recurring payments in the same way as Stripe
 	// For subscriptions, you might need to handle recurring billing differently
@@ -0,0 +1,219 @@
+package payment
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+)
+
+func TestBuildPaymentLinkRequestBranding(t *testing.T) {
+	tests := []struct {
+		name     string
+		branding AirwallexBranding
+		want     map[string]interface{}
+	}{
+		{"not configured", AirwallexBranding{}, nil},
+		{"name only", AirwallexBranding{MerchantName: "Acme"}, map[string]interface{}{"merchant_name": "Acme"}},
+		{
+			"name and logo",
+			AirwallexBranding{MerchantName: "Acme", LogoURL: "https://acme.test/logo.png"},
+			map[string]interface{}{"merchant_name": "Acme", "logo_url": "https://acme.test/logo.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AirwallexGenerator{branding: tt.branding}
+			body := a.buildPaymentLinkRequest(&models.PaymentLinkData{Amount: 10, Currency: "usd", ServiceName: "Consulting"})
+			got, ok := body["branding"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("branding = %v, want it omitted", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("branding = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPaymentLinkRequestCurrency(t *testing.T) {
+	for currency, want := range map[string]string{"": "USD", "hkd": "HKD", "EUR": "EUR"} {
+		body := (&AirwallexGenerator{}).buildPaymentLinkRequest(&models.PaymentLinkData{Amount: 10, Currency: currency})
+		if body["currency"] != want {
+			t.Errorf("currency %q sent as %v, want %s", currency, body["currency"], want)
+		}
+	}
+}
+
+func TestBuildPaymentLinkRequestExpiry(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 18, 9, 30, 0, 0, time.FixedZone("HKT", 8*60*60))
+	body := (&AirwallexGenerator{}).buildPaymentLinkRequest(&models.PaymentLinkData{Amount: 10, Currency: "USD", ExpiresAt: expiresAt})
+	if got := body["expires_at"]; got != "2026-10-18T01:30:00Z" {
+		t.Errorf("expires_at = %v, want 2026-10-18T01:30:00Z", got)
+	}
+
+	body = (&AirwallexGenerator{}).buildPaymentLinkRequest(&models.PaymentLinkData{Amount: 10, Currency: "USD"})
+	if got, ok := body["expires_at"]; ok {
+		t.Errorf("expires_at = %v for a link without an expiry, want it omitted", got)
+	}
+}
+
+func TestBuildPaymentLinkRequestReturnURL(t *testing.T) {
+	for redirect, want := range map[string]interface{}{"": nil, "https://acme.test/thanks": "https://acme.test/thanks"} {
+		body := (&AirwallexGenerator{}).buildPaymentLinkRequest(&models.PaymentLinkData{Amount: 10, Currency: "USD", RedirectURL: redirect})
+		if got := body["return_url"]; got != want {
+			t.Errorf("redirect %q: return_url = %v, want %v", redirect, got, want)
+		}
+	}
+}
+
+func TestAirwallexReturnsTheLinkID(t *testing.T) {
+	// Trimmed from a real create-link response
+	const response = `{
+		"id": "6a1d5b2e-4c1f-4d3a-9c83-0b5e2f1a7d90",
+		"url": "https://checkout.airwallex.com/pay/6a1d5b2e",
+		"code": "6a1d5b2e",
+		"amount": 49.5,
+		"currency": "HKD",
+		"title": "Hosting",
+		"status": "UNPAID",
+		"reusable": false,
+		"created_at": "2026-10-16T03:20:00+0000"
+	}`
+	tests := []struct {
+		name    string
+		body    string
+		wantURL string
+		wantID  string
+		wantErr bool
+	}{
+		{"URL and ID", response, "https://checkout.airwallex.com/pay/6a1d5b2e", "6a1d5b2e-4c1f-4d3a-9c83-0b5e2f1a7d90", false},
+		{"no ID", `{"url":"https://checkout.airwallex.com/pay/1"}`, "https://checkout.airwallex.com/pay/1", "", false},
+		{"no URL", `{"id":"link_1"}`, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := newTestAirwallex(newFakeTransport(map[string][]fakeResponse{
+				authPath:   {{status: 200, body: authOK}},
+				createPath: {{status: 201, body: tt.body}},
+			}))
+			link, id, err := generator.GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 49.5, Currency: "HKD", ServiceName: "Hosting"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateLink error = %v, want error %v", err, tt.wantErr)
+			}
+			if link != tt.wantURL || id != tt.wantID {
+				t.Errorf("GenerateLink = %q, %q, want %q, %q", link, id, tt.wantURL, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAirwallexReusesTokenUntilNearExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt string
+		wantAuths int
+	}{
+		{"valid for hours", time.Now().Add(2 * time.Hour).Format("2006-01-02T15:04:05-0700"), 1},
+		{"within the refresh margin", time.Now().Add(30 * time.Second).Format("2006-01-02T15:04:05-0700"), 2},
+		{"expiry can't be parsed", "soon", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := fakeResponse{status: 200, body: `{"token":"tok","expires_at":"` + tt.expiresAt + `"}`}
+			transport := newFakeTransport(map[string][]fakeResponse{
+				authPath:   {auth, auth},
+				createPath: {{status: 200, body: createOK}, {status: 200, body: createOK}},
+			})
+			generator := newTestAirwallex(transport)
+
+			for i := 0; i < 2; i++ {
+				if _, _, err := generator.GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"}); err != nil {
+					t.Fatalf("GenerateLink %d error: %v", i+1, err)
+				}
+			}
+			if got := transport.callCount(authPath); got != tt.wantAuths {
+				t.Errorf("auth requests = %d, want %d", got, tt.wantAuths)
+			}
+		})
+	}
+}
+
+func TestAirwallexConcurrentLinksLogInOnce(t *testing.T) {
+	creates := make([]fakeResponse, 10)
+	for i := range creates {
+		creates[i] = fakeResponse{status: 200, body: createOK}
+	}
+	transport := newFakeTransport(map[string][]fakeResponse{
+		authPath:   {{status: 200, body: authOK}},
+		createPath: creates,
+	})
+	generator := newTestAirwallex(transport)
+
+	var wg sync.WaitGroup
+	for range creates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := generator.GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"}); err != nil {
+				t.Errorf("GenerateLink error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := transport.callCount(authPath); got != 1 {
+		t.Errorf("auth requests = %d, want 1", got)
+	}
+}
+
+func TestAirwallexLogsInAgainWhenTheTokenIsRejected(t *testing.T) {
+	unauthorized := fakeResponse{status: 401, body: `{"code":"unauthorized","message":"Access denied"}`}
+	tests := []struct {
+		name        string
+		creates     []fakeResponse
+		wantErr     bool
+		wantAuths   int
+		wantCreates int
+	}{
+		{"retried with a fresh token", []fakeResponse{unauthorized, {status: 200, body: createOK}}, false, 2, 2},
+		{"fresh token rejected too", []fakeResponse{unauthorized, unauthorized}, true, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newFakeTransport(map[string][]fakeResponse{
+				authPath:   {{status: 200, body: authOK}, {status: 200, body: authOK}},
+				createPath: tt.creates,
+			})
+			generator := newTestAirwallex(transport)
+
+			_, _, err := generator.GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateLink error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := transport.callCount(authPath); got != tt.wantAuths {
+				t.Errorf("auth requests = %d, want %d", got, tt.wantAuths)
+			}
+			if got := transport.callCount(createPath); got != tt.wantCreates {
+				t.Errorf("create requests = %d, want %d", got, tt.wantCreates)
+			}
+		})
+	}
+}
+
+func TestParseAirwallexTime(t *testing.T) {
+	want := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, value := range []string{"2024-01-02T15:04:05+0000", "2024-01-02T15:04:05Z", "2024-01-02T23:04:05+08:00"} {
+		if got, err := parseAirwallexTime(value); err != nil || !got.Equal(want) {
+			t.Errorf("parseAirwallexTime(%q) = %s, %v, want %s", value, got, err, want)
+		}
+	}
+	if _, err := parseAirwallexTime("2024-01-02"); err == nil {
+		t.Error("parseAirwallexTime accepted a date without a time")
+	}
+}
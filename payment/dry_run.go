@@ -0,0 +1,49 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"paymentbot/models"
+)
+
+// DryRunGenerator stands in for a provider when DRY_RUN is set. It checks the link data like
+// a provider would and returns a well-formed but fake link and ID without any API calls, so
+// the Slack flow can be tried without live keys.
+type DryRunGenerator struct {
+	provider models.PaymentProvider
+}
+
+// NewDryRunGenerator creates a fake generator for provider
+func NewDryRunGenerator(provider models.PaymentProvider) *DryRunGenerator {
+	return &DryRunGenerator{provider: provider}
+}
+
+var _ PaymentLinkGenerator = (*DryRunGenerator)(nil)
+
+// GenerateLink returns a link under example.com and an ID in the provider's format, prefixed
+// so it's obviously not real
+func (d *DryRunGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
+	if data.Amount <= 0 && !data.Donation {
+		return "", "", fmt.Errorf("amount must be greater than 0")
+	}
+	if data.ServiceName == "" {
+		return "", "", fmt.Errorf("service name cannot be empty")
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", "", fmt.Errorf("failed to generate dry-run ID: %w", err)
+	}
+	paymentID := "dryrun_" + hex.EncodeToString(suffix)
+	if d.provider == models.ProviderStripe {
+		paymentID = "plink_" + paymentID
+	}
+	link := fmt.Sprintf("https://example.com/dry-run/%s/%s", d.provider, paymentID)
+
+	log.Printf("[DryRun] %s link for %q (%.2f %s) not created, returning %s", d.provider, data.ServiceName, data.Amount, data.Currency, paymentID)
+	return link, paymentID, nil
+}
@@ -0,0 +1,80 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"paymentbot/models"
+)
+
+// recordingTransport fails every request, recording where it was going
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.urls = append(r.urls, req.URL.String())
+	return nil, errors.New("outbound HTTP in dry-run")
+}
+
+func TestDryRunMakesNoOutboundRequests(t *testing.T) {
+	transport := &recordingTransport{}
+	original := http.DefaultTransport
+	http.DefaultTransport = transport
+	t.Cleanup(func() { http.DefaultTransport = original })
+
+	tests := []struct {
+		provider   models.PaymentProvider
+		data       *models.PaymentLinkData
+		wantPrefix string
+	}{
+		{models.ProviderStripe, &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}, "plink_dryrun_"},
+		{models.ProviderStripe, &models.PaymentLinkData{Donation: true, Currency: "USD", ServiceName: "Food bank"}, "plink_dryrun_"},
+		{models.ProviderAirwallex, &models.PaymentLinkData{Amount: 10, Currency: "HKD", ServiceName: "Hosting"}, "dryrun_"},
+	}
+	for _, tt := range tests {
+		link, id, err := NewDryRunGenerator(tt.provider).GenerateLink(context.Background(), tt.data)
+		if err != nil {
+			t.Fatalf("%s GenerateLink error: %v", tt.provider, err)
+		}
+		if !strings.HasPrefix(id, tt.wantPrefix) {
+			t.Errorf("%s ID = %q, want the %s prefix", tt.provider, id, tt.wantPrefix)
+		}
+		if want := "https://example.com/dry-run/" + string(tt.provider) + "/" + id; link != want {
+			t.Errorf("%s link = %q, want %q", tt.provider, link, want)
+		}
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.urls) != 0 {
+		t.Errorf("dry-run made outbound requests to %v", transport.urls)
+	}
+}
+
+func TestDryRunValidatesLinkData(t *testing.T) {
+	generator := NewDryRunGenerator(models.ProviderStripe)
+	for _, data := range []*models.PaymentLinkData{
+		{Amount: 0, Currency: "USD", ServiceName: "Hosting"},
+		{Amount: 10, Currency: "USD"},
+	} {
+		if _, _, err := generator.GenerateLink(context.Background(), data); err == nil {
+			t.Errorf("GenerateLink(%+v) succeeded, want an error", data)
+		}
+	}
+
+	// Two links for the same data still get different IDs
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	_, first, _ := generator.GenerateLink(context.Background(), data)
+	_, second, _ := generator.GenerateLink(context.Background(), data)
+	if first == second {
+		t.Errorf("two dry-run links share ID %q", first)
+	}
+}
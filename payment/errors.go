@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"paymentbot/utils"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// ProviderError is a failed provider API response, keeping the details admins need to debug it
+type ProviderError struct {
+	Provider   string
+	Operation  string // e.g. "authentication", "payment link creation"
+	StatusCode int
+	Code       string // provider error code, e.g. "validation_error"
+	Message    string
+	RequestID  string
+	Body       string // redacted response body
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s", e.Operation, e.StatusCode, e.Body)
+}
+
+// newAirwallexError builds a ProviderError from an Airwallex error response
+func newAirwallexError(operation string, resp *http.Response, body []byte) *ProviderError {
+	var parsed struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		TraceID string `json:"trace_id"`
+	}
+	_ = json.Unmarshal(body, &parsed)
+
+	requestID := parsed.TraceID
+	for _, header := range []string{"x-awx-traceid", "x-request-id"} {
+		if requestID == "" {
+			requestID = resp.Header.Get(header)
+		}
+	}
+
+	return &ProviderError{
+		Provider:   "Airwallex",
+		Operation:  operation,
+		StatusCode: resp.StatusCode,
+		Code:       parsed.Code,
+		Message:    parsed.Message,
+		RequestID:  requestID,
+		Body:       utils.RedactJSON(body),
+	}
+}
+
+// ErrorDetail describes err for admins, including the provider error code and request ID
+// when err came from a provider API. Other errors are returned as-is.
+func ErrorDetail(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var fields []string
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+
+	var stripeErr *stripe.Error
+	var providerErr *ProviderError
+	switch {
+	case errors.As(err, &stripeErr):
+		add("Provider", "Stripe")
+		add("Status", fmt.Sprint(stripeErr.HTTPStatusCode))
+		add("Type", string(stripeErr.Type))
+		add("Code", string(stripeErr.Code))
+		add("Param", stripeErr.Param)
+		add("Request ID", stripeErr.RequestID)
+		add("Message", stripeErr.Msg)
+	case errors.As(err, &providerErr):
+		add("Provider", providerErr.Provider)
+		add("Status", fmt.Sprint(providerErr.StatusCode))
+		add("Code", providerErr.Code)
+		add("Request ID", providerErr.RequestID)
+		add("Message", providerErr.Message)
+	default:
+		return err.Error()
+	}
+
+	add("Error", err.Error())
+	return strings.Join(fields, "\n")
+}
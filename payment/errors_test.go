@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+func TestErrorDetail(t *testing.T) {
+	stripeErr := &stripe.Error{
+		HTTPStatusCode: 402,
+		Type:           stripe.ErrorTypeCard,
+		Code:           stripe.ErrorCodeCardDeclined,
+		RequestID:      "req_123",
+		Msg:            "Your card was declined.",
+	}
+	airwallexErr := &ProviderError{Provider: "Airwallex", StatusCode: 400, Code: "validation_error", RequestID: "trace-1", Message: "bad amount"}
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"plain error", errors.New("timeout"), []string{"timeout"}},
+		{"Stripe", fmt.Errorf("failed to create Stripe price: %w", stripeErr), []string{"Provider: Stripe", "Status: 402", "Code: card_declined", "Request ID: req_123", "Message: Your card was declined."}},
+		{"Airwallex", fmt.Errorf("failed to create link: %w", airwallexErr), []string{"Provider: Airwallex", "Status: 400", "Code: validation_error", "Request ID: trace-1", "Message: bad amount"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorDetail(tt.err)
+			if tt.want == nil && got != "" {
+				t.Errorf("ErrorDetail() = %q, want empty", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("ErrorDetail() = %q, missing %q", got, want)
+				}
+			}
+		})
+	}
+}
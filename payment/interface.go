@@ -1,7 +1,27 @@
 package payment
 
-import "paymentbot/models"
+import (
+	"context"
+
+	"paymentbot/models"
+)
 
 type PaymentLinkGenerator interface {
-	GenerateLink(data *models.PaymentLinkData) (link string, paymentID string, err error)
+	GenerateLink(ctx context.Context, data *models.PaymentLinkData) (link string, paymentID string, err error)
+}
+
+// Refunder refunds payments taken through payment links
+type Refunder interface {
+	// PaymentLinkFor returns the payment link the payment behind id was made through
+	PaymentLinkFor(ctx context.Context, id string) (string, error)
+	// PaymentLinkCreator returns the Slack user stamped on a payment link's metadata, or "" if none was
+	PaymentLinkCreator(ctx context.Context, linkID string) (string, error)
+	Refund(ctx context.Context, id string, amount float64) (*RefundResult, error)
 }
+
+// Both providers must keep satisfying the interface; this fails to compile if a signature drifts.
+var (
+	_ PaymentLinkGenerator = (*StripeGenerator)(nil)
+	_ PaymentLinkGenerator = (*AirwallexGenerator)(nil)
+	_ Refunder             = (*StripeRefunder)(nil)
+)
@@ -0,0 +1,74 @@
+package payment
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+)
+
+func TestGeneratorsReturnTheLinkAndItsID(t *testing.T) {
+	data := &models.PaymentLinkData{Amount: 49.5, Currency: "USD", ServiceName: "Hosting", ReferenceNumber: "INV-7"}
+	tests := []struct {
+		name      string
+		generator func(t *testing.T) PaymentLinkGenerator
+		wantURL   string
+		wantID    string
+	}{
+		{
+			name: "Stripe",
+			generator: func(t *testing.T) PaymentLinkGenerator {
+				newFakeStripe(t)
+				return NewStripeGenerator("sk_test")
+			},
+			wantURL: "https://buy.stripe.com/test_",
+			wantID:  "plink_",
+		},
+		{
+			name: "Airwallex",
+			generator: func(t *testing.T) PaymentLinkGenerator {
+				return newTestAirwallex(newFakeTransport(map[string][]fakeResponse{
+					authPath:   {{status: 200, body: authOK}},
+					createPath: {{status: 201, body: createOK}},
+				}))
+			},
+			wantURL: "https://pay.example.com/l/1",
+			wantID:  "link_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, id, err := tt.generator(t).GenerateLink(context.Background(), data)
+			if err != nil {
+				t.Fatalf("GenerateLink error: %v", err)
+			}
+			if !strings.HasPrefix(link, tt.wantURL) {
+				t.Errorf("link = %q, want %s...", link, tt.wantURL)
+			}
+			if !strings.HasPrefix(id, tt.wantID) {
+				t.Errorf("ID = %q, want %s...", id, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAirwallexRequestKeepsTheOriginalFields(t *testing.T) {
+	data := &models.PaymentLinkData{Amount: 49.5, Currency: "hkd", ServiceName: "Hosting", ReferenceNumber: "INV-7"}
+	body := (&AirwallexGenerator{}).buildPaymentLinkRequest(data)
+
+	want := map[string]interface{}{"amount": 49.5, "currency": "HKD", "title": "Hosting", "description": "INV-7", "reusable": false}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+	if reference, _ := body["reference"].(string); !strings.HasPrefix(reference, "slackbot-") {
+		t.Errorf("reference = %v, want a generated slackbot-<nanos> reference", body["reference"])
+	}
+
+	data.InternalReference = "slackbot-42"
+	if body := (&AirwallexGenerator{}).buildPaymentLinkRequest(data); body["reference"] != "slackbot-42" {
+		t.Errorf("reference = %v, want the link's own slackbot-42", body["reference"])
+	}
+}
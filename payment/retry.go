@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default retry policy for provider HTTP calls
+const (
+	DefaultMaxRetries     = 2
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	maxRetryDelay         = 10 * time.Second
+)
+
+// RetryPolicy controls how failed provider requests are retried
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt; 0 disables retrying
+	BaseDelay  time.Duration // delay before the first retry, doubled for each one after
+}
+
+// doWithRetry sends the request built by newRequest and returns the response status and body.
+// Idempotent requests are retried on any connection error or 5xx. Requests that may create
+// something are only retried when the request never reached the server, i.e. the connection
+// couldn't be made. A 502/503/504 can come from a gateway after the upstream already acted, so
+// retrying those could create duplicates. 4xx responses are never retried.
+func doWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, idempotent bool, newRequest func() (*http.Request, error)) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, body, err := sendOnce(client, req)
+		retry := attempt < policy.MaxRetries && shouldRetry(resp, err, idempotent)
+		if !retry {
+			return resp, body, err
+		}
+
+		delay := backoffDelay(policy.BaseDelay, attempt)
+		if err != nil {
+			log.Printf("[Retry] %s %s failed (%v), retrying in %s (attempt %d of %d)", req.Method, req.URL.Path, err, delay, attempt+1, policy.MaxRetries)
+		} else {
+			log.Printf("[Retry] %s %s returned %s, retrying in %s (attempt %d of %d)", req.Method, req.URL.Path, resp.Status, delay, attempt+1, policy.MaxRetries)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// sendOnce performs a single request and reads the whole body so the connection can be reused
+func sendOnce(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, body, nil
+}
+
+func shouldRetry(resp *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		if idempotent {
+			return true
+		}
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	return idempotent && resp.StatusCode >= 500
+}
+
+// backoffDelay returns an exponential delay for the given attempt, randomized between half and the full value
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
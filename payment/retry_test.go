@@ -0,0 +1,153 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+)
+
+// fakeTransport answers requests from a script, one response (or error) per call per path
+type fakeTransport struct {
+	mu      sync.Mutex
+	scripts map[string][]fakeResponse
+	calls   map[string]int
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+	err    error
+}
+
+func newFakeTransport(scripts map[string][]fakeResponse) *fakeTransport {
+	return &fakeTransport{scripts: scripts, calls: map[string]int{}}
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := req.URL.Path
+	script := f.scripts[path]
+	n := f.calls[path]
+	f.calls[path]++
+	if n >= len(script) {
+		return nil, errors.New("unexpected request to " + path)
+	}
+	r := script[n]
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Status:     http.StatusText(r.status),
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Header:     http.Header{},
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeTransport) callCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[path]
+}
+
+const (
+	authPath   = "/api/v1/authentication/login"
+	createPath = "/api/v1/pa/payment_links/create"
+	authOK     = `{"token":"tok","expires_at":"2099-01-01T00:00:00+0000"}`
+	createOK   = `{"url":"https://pay.example.com/l/1","id":"link_1"}`
+)
+
+var dialErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func newTestAirwallex(transport http.RoundTripper) PaymentLinkGenerator {
+	return NewAirwallexGenerator("client", "key", "https://airwallex.test", AirwallexBranding{},
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}))
+}
+
+func TestAirwallexRetriesIdempotentRequestsOn5xx(t *testing.T) {
+	transport := newFakeTransport(map[string][]fakeResponse{
+		authPath:   {{status: 503}, {status: 503}, {status: 200, body: authOK}},
+		createPath: {{status: 200, body: createOK}},
+	})
+
+	link, id, err := newTestAirwallex(transport).GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"})
+	if err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	if link != "https://pay.example.com/l/1" || id != "link_1" {
+		t.Errorf("GenerateLink = %q, %q", link, id)
+	}
+	if got := transport.callCount(authPath); got != 3 {
+		t.Errorf("auth attempts = %d, want 3", got)
+	}
+}
+
+func TestAirwallexDoesNotRetryLinkCreationAfterGatewayErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			transport := newFakeTransport(map[string][]fakeResponse{
+				authPath:   {{status: 200, body: authOK}},
+				createPath: {{status: status}, {status: 200, body: createOK}},
+			})
+
+			if _, _, err := newTestAirwallex(transport).GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"}); err == nil {
+				t.Fatal("GenerateLink succeeded, want the gateway error")
+			}
+			if got := transport.callCount(createPath); got != 1 {
+				t.Errorf("create attempts = %d, want 1 so a link the upstream created isn't duplicated", got)
+			}
+		})
+	}
+}
+
+func TestAirwallexRetriesLinkCreationWhenConnectionFails(t *testing.T) {
+	transport := newFakeTransport(map[string][]fakeResponse{
+		authPath:   {{status: 200, body: authOK}},
+		createPath: {{err: dialErr}, {status: 200, body: createOK}},
+	})
+
+	if _, _, err := newTestAirwallex(transport).GenerateLink(context.Background(), &models.PaymentLinkData{Amount: 10, ServiceName: "Test"}); err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	if got := transport.callCount(createPath); got != 2 {
+		t.Errorf("create attempts = %d, want 2", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	resp := func(status int) *http.Response { return &http.Response{StatusCode: status} }
+	tests := []struct {
+		name       string
+		resp       *http.Response
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{"idempotent 503", resp(503), nil, true, true},
+		{"idempotent 500", resp(500), nil, true, true},
+		{"idempotent 400", resp(400), nil, true, false},
+		{"idempotent read error", nil, errors.New("connection reset"), true, true},
+		{"non-idempotent 503", resp(503), nil, false, false},
+		{"non-idempotent 504", resp(504), nil, false, false},
+		{"non-idempotent read error", nil, errors.New("connection reset"), false, false},
+		{"non-idempotent dial error", nil, dialErr, false, true},
+		{"canceled", nil, context.Canceled, true, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRetry(tt.resp, tt.err, tt.idempotent); got != tt.want {
+			t.Errorf("%s: shouldRetry = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
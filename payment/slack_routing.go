@@ -0,0 +1,42 @@
+package payment
+
+import "paymentbot/models"
+
+// Metadata keys recording where in Slack a Stripe link was requested. Stripe copies the link's
+// metadata onto the payment intents and subscriptions it creates, so webhooks can report back.
+const (
+	SlackChannelMetadataKey = "slack_channel"
+	SlackUserMetadataKey    = "slack_user"
+	SlackTeamMetadataKey    = "slack_team"
+)
+
+// SlackRouting is where a payment's notifications go: the channel the link was requested in,
+// the user who requested it and their workspace
+type SlackRouting struct {
+	ChannelID string
+	UserID    string
+	TeamID    string
+}
+
+// RoutingFromMetadata reads the Slack routing stamped on a Stripe object. Objects created
+// outside the bot, or by older versions of it, have an empty ChannelID.
+func RoutingFromMetadata(metadata map[string]string) SlackRouting {
+	return SlackRouting{
+		ChannelID: metadata[SlackChannelMetadataKey],
+		UserID:    metadata[SlackUserMetadataKey],
+		TeamID:    metadata[SlackTeamMetadataKey],
+	}
+}
+
+// addSlackRouting stamps the Slack routing of data onto metadata, skipping empty values
+func addSlackRouting(metadata map[string]string, data *models.PaymentLinkData) {
+	if data.SlackChannelID != "" {
+		metadata[SlackChannelMetadataKey] = data.SlackChannelID
+	}
+	if data.SlackUserID != "" {
+		metadata[SlackUserMetadataKey] = data.SlackUserID
+	}
+	if data.SlackTeamID != "" {
+		metadata[SlackTeamMetadataKey] = data.SlackTeamID
+	}
+}
@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"paymentbot/models"
+)
+
+func TestSlackRoutingRoundTripsThroughMetadata(t *testing.T) {
+	want := SlackRouting{ChannelID: "C_SALES", UserID: "U1", TeamID: "T1"}
+	base := models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", SlackChannelID: "C_SALES", SlackUserID: "U1", SlackTeamID: "T1"}
+
+	oneTime := base
+	params := (&StripeGenerator{}).buildPaymentLinkParams(&oneTime, nil)
+	if got := RoutingFromMetadata(params.Metadata); got != want {
+		t.Errorf("link routing = %+v, want %+v", got, want)
+	}
+	if params.PaymentIntentData == nil || RoutingFromMetadata(params.PaymentIntentData.Metadata) != want {
+		t.Errorf("payment intent data = %+v, want the routing copied for payment_intent.succeeded", params.PaymentIntentData)
+	}
+
+	subscription := base
+	subscription.IsSubscription, subscription.Interval, subscription.IntervalCount = true, "month", 1
+	params = (&StripeGenerator{}).buildPaymentLinkParams(&subscription, nil)
+	if params.SubscriptionData == nil || RoutingFromMetadata(params.SubscriptionData.Metadata) != want {
+		t.Errorf("subscription data = %+v, want the routing copied onto the subscription", params.SubscriptionData)
+	}
+
+	donation := base
+	donation.Amount, donation.Donation = 0, true
+	params = (&StripeGenerator{}).buildPaymentLinkParams(&donation, nil)
+	if params.PaymentIntentData == nil || RoutingFromMetadata(params.PaymentIntentData.Metadata) != want {
+		t.Errorf("donation payment intent data = %+v, want the routing copied", params.PaymentIntentData)
+	}
+}
+
+func TestSlackRoutingIsSentToStripe(t *testing.T) {
+	fake := newFakeStripe(t)
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", SlackChannelID: "C_SALES", SlackUserID: "U1", SlackTeamID: "T1"}
+	if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	links := fake.calls(http.MethodPost, "/v1/payment_links")
+	if len(links) != 1 {
+		t.Fatalf("%d payment links created, want 1", len(links))
+	}
+	for key, want := range map[string]string{
+		"metadata[slack_channel]":                      "C_SALES",
+		"metadata[slack_user]":                         "U1",
+		"metadata[slack_team]":                         "T1",
+		"payment_intent_data[metadata][slack_channel]": "C_SALES",
+	} {
+		if got := links[0].Form.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestEmptySlackRoutingIsLeftOut(t *testing.T) {
+	params := (&StripeGenerator{}).buildPaymentLinkParams(&models.PaymentLinkData{ServiceName: "Hosting", SlackChannelID: "C1"}, nil)
+	for _, key := range []string{SlackUserMetadataKey, SlackTeamMetadataKey} {
+		if value, ok := params.Metadata[key]; ok {
+			t.Errorf("metadata has %s = %q for an empty value, want it left out", key, value)
+		}
+	}
+	if got := RoutingFromMetadata(nil); got != (SlackRouting{}) {
+		t.Errorf("RoutingFromMetadata(nil) = %+v, want empty", got)
+	}
+}
@@ -0,0 +1,166 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// fakeStripeRequest is a call received by fakeStripe
+type fakeStripeRequest struct {
+	Method         string
+	Path           string
+	Form           url.Values
+	IdempotencyKey string
+}
+
+// fakeStripe serves the parts of the Stripe API the generator and reconciler use. Products
+// are kept so SKU searches find the ones created earlier, and prices so links can be
+// totalled; every other object is returned with a fresh ID.
+type fakeStripe struct {
+	mu            sync.Mutex
+	requests      []fakeStripeRequest
+	products      map[string]string // SKU -> product ID
+	prices        map[string]int64  // price ID -> unit amount
+	subscriptions []map[string]interface{}
+	paymentLinks  []map[string]interface{} // listed by GET /v1/payment_links and found by ID
+	promoCodes    []map[string]interface{} // found by code or ID under /v1/promotion_codes
+	nextID        int
+}
+
+var skuQuery = regexp.MustCompile(`metadata\['sku'\]:'([^']*)'`)
+
+// newFakeStripe points the Stripe SDK at a fake API for the rest of the test
+func newFakeStripe(t *testing.T) *fakeStripe {
+	t.Helper()
+	f := &fakeStripe{products: map[string]string{}, prices: map[string]int64{}}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(func() {
+		server.Close()
+		stripe.SetBackend(stripe.APIBackend, nil)
+	})
+	ConfigureStripeBackend(http.DefaultTransport, 5*time.Second, server.URL)
+	return f
+}
+
+func (f *fakeStripe) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, fakeStripeRequest{Method: r.Method, Path: r.URL.Path, Form: r.Form, IdempotencyKey: r.Header.Get("Idempotency-Key")})
+
+	f.nextID++
+	id := fmt.Sprint(f.nextID)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/products/search":
+		var data []map[string]interface{}
+		if match := skuQuery.FindStringSubmatch(r.Form.Get("query")); match != nil {
+			if productID, ok := f.products[match[1]]; ok {
+				data = append(data, map[string]interface{}{"id": productID, "object": "product"})
+			}
+		}
+		writeJSON(w, map[string]interface{}{"object": "search_result", "data": data, "has_more": false})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/products":
+		if sku := r.Form.Get("metadata[sku]"); sku != "" {
+			f.products[sku] = "prod_" + id
+		}
+		writeJSON(w, map[string]interface{}{"id": "prod_" + id, "object": "product"})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/prices":
+		f.prices["price_"+id], _ = strconv.ParseInt(r.Form.Get("unit_amount"), 10, 64)
+		writeJSON(w, map[string]interface{}{"id": "price_" + id, "object": "price"})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/payment_links":
+		writeJSON(w, map[string]interface{}{"id": "plink_" + id, "object": "payment_link", "url": "https://buy.stripe.com/test_" + id})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/payment_links":
+		writeJSON(w, map[string]interface{}{"object": "list", "url": "/v1/payment_links", "data": f.paymentLinks, "has_more": false})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/payment_links/"):
+		linkID := strings.TrimPrefix(r.URL.Path, "/v1/payment_links/")
+		for _, link := range f.paymentLinks {
+			if link["id"] == linkID {
+				writeJSON(w, link)
+				return
+			}
+		}
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"type": "invalid_request_error", "code": "resource_missing", "message": "No such payment link"}})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/payment_links/"):
+		linkID := strings.TrimPrefix(r.URL.Path, "/v1/payment_links/")
+		for _, link := range f.paymentLinks {
+			if link["id"] == linkID {
+				link["active"] = r.Form.Get("active") != "false"
+				writeJSON(w, link)
+				return
+			}
+		}
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"type": "invalid_request_error", "code": "resource_missing", "message": "No such payment link"}})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/promotion_codes":
+		var data []map[string]interface{}
+		for _, promo := range f.promoCodes {
+			if promo["code"] == r.Form.Get("code") {
+				data = append(data, promo)
+			}
+		}
+		writeJSON(w, map[string]interface{}{"object": "list", "url": "/v1/promotion_codes", "data": data, "has_more": false})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/promotion_codes/"):
+		promoID := strings.TrimPrefix(r.URL.Path, "/v1/promotion_codes/")
+		for _, promo := range f.promoCodes {
+			if promo["id"] == promoID {
+				writeJSON(w, promo)
+				return
+			}
+		}
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"type": "invalid_request_error", "code": "resource_missing", "message": "No such promotion code"}})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/subscriptions":
+		writeJSON(w, map[string]interface{}{"object": "list", "url": "/v1/subscriptions", "data": f.subscriptions, "has_more": false})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/subscriptions/"):
+		writeJSON(w, map[string]interface{}{"id": strings.TrimPrefix(r.URL.Path, "/v1/subscriptions/"), "object": "subscription"})
+	default:
+		writeJSONStatus(w, http.StatusNotFound, map[string]interface{}{"error": map[string]string{"type": "invalid_request_error", "message": "Unrecognized request URL"}})
+	}
+}
+
+// calls returns the requests received for method and path, in order
+func (f *fakeStripe) calls(method, path string) []fakeStripeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []fakeStripeRequest
+	for _, req := range f.requests {
+		if req.Method == method && req.Path == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// linkTotal adds up the line items of a payment link request, in minor units
+func (f *fakeStripe) linkTotal(req fakeStripeRequest) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var total int64
+	for i := 0; ; i++ {
+		priceID := req.Form.Get(fmt.Sprintf("line_items[%d][price]", i))
+		if priceID == "" {
+			return total
+		}
+		quantity, _ := strconv.ParseInt(req.Form.Get(fmt.Sprintf("line_items[%d][quantity]", i)), 10, 64)
+		total += f.prices[priceID] * quantity
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	writeJSONStatus(w, http.StatusOK, body)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -1,8 +1,15 @@
 package payment
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stripe/stripe-go/v82"
@@ -11,6 +18,8 @@ import (
 	"github.com/stripe/stripe-go/v82/product"
 
 	"paymentbot/models"
+	"paymentbot/tracing"
+	"paymentbot/utils"
 )
 
 // StripeGenerator implements PaymentLinkGenerator for Stripe
@@ -26,45 +35,173 @@ func NewStripeGenerator(apiKey string) PaymentLinkGenerator {
 }
 
 // GenerateLink creates a Stripe payment link (one-time or recurring)
-func (s *StripeGenerator) GenerateLink(data *models.PaymentLinkData) (string, string, error) {
+func (s *StripeGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
 	stripe.Key = s.apiKey
 
-	// Create a product
-	productParams := &stripe.ProductParams{
-		Name:        stripe.String(data.ServiceName),
-		Description: stripe.String(data.ReferenceNumber),
-	}
-	product, err := product.New(productParams)
-	if err != nil {
-		log.Printf("Stripe product error: %v", err)
-		return "", "", fmt.Errorf("failed to create Stripe product: %w", err)
-	}
+	// Create a product (or reuse the existing one for its SKU) and a price for every item
+	var lineItems []*stripe.PaymentLinkLineItemParams
+	for i, item := range data.Items() {
+		product, err := s.findOrCreateProduct(ctx, item.Description, data.ReferenceNumber, item.SKU, idempotencyKey(data, fmt.Sprintf("product-%d", i)))
+		if err != nil {
+			log.Printf("Stripe product error: %v", err)
+			return "", "", fmt.Errorf("failed to create Stripe product: %w", err)
+		}
 
-	// Create a price (recurring or one-time)
-	priceParams := s.buildPriceParams(data, product.ID)
-	price, err := price.New(priceParams)
-	if err != nil {
-		log.Printf("Stripe price error: %v", err)
-		return "", "", fmt.Errorf("failed to create Stripe price: %w", err)
+		// Create a price (recurring or one-time)
+		priceParams := s.buildPriceParams(data, product.ID, item.UnitAmount)
+		priceCtx, span := tracing.StartClientSpan(ctx, "stripe.price.create")
+		priceParams.Context = priceCtx
+		setIdempotencyKey(&priceParams.Params, idempotencyKey(data, fmt.Sprintf("price-%d", i)))
+		price, err := price.New(priceParams)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			log.Printf("Stripe price error: %v", err)
+			return "", "", fmt.Errorf("failed to create Stripe price: %w", err)
+		}
+
+		quantity := item.Quantity
+		if quantity <= 0 {
+			quantity = 1
+		}
+		lineItem := &stripe.PaymentLinkLineItemParams{
+			Price:    stripe.String(price.ID),
+			Quantity: stripe.Int64(quantity),
+		}
+		applyAdjustableQuantity(lineItem, data)
+		lineItems = append(lineItems, lineItem)
 	}
 
 	// Create a payment link
-	linkParams := s.buildPaymentLinkParams(data, price.ID)
+	linkParams := s.buildPaymentLinkParams(data, lineItems)
+	linkCtx, span := tracing.StartClientSpan(ctx, "stripe.payment_link.create")
+	linkParams.Context = linkCtx
+	setIdempotencyKey(&linkParams.Params, idempotencyKey(data, "payment-link"))
 	link, err := paymentlink.New(linkParams)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		log.Printf("Stripe payment link error: %v", err)
 		return "", "", fmt.Errorf("failed to create Stripe payment link: %w", err)
 	}
 
 	log.Printf("Successfully created Stripe payment link: %s (ID: %s)", link.URL, link.ID)
-	return link.URL, link.ID, nil
+	return prefillCheckout(link.URL, data), link.ID, nil
+}
+
+// findOrCreateProduct returns the active product tagged with sku, creating one when there
+// is no SKU or no match. Stripe search is eventually consistent, so a product created
+// moments ago may not be found yet and a second one can be created in that window.
+func (s *StripeGenerator) findOrCreateProduct(ctx context.Context, name, description, sku, idempotencyKey string) (*stripe.Product, error) {
+	if sku != "" {
+		searchCtx, span := tracing.StartClientSpan(ctx, "stripe.product.search")
+		params := &stripe.ProductSearchParams{}
+		params.Context = searchCtx
+		// NormalizeSKU only allows characters that need no escaping inside the quoted query
+		params.Query = fmt.Sprintf("active:'true' AND metadata['sku']:'%s'", sku)
+		params.Limit = stripe.Int64(1)
+		iter := product.Search(params)
+		var existing *stripe.Product
+		if iter.Next() {
+			existing = iter.Product()
+		}
+		span.RecordError(iter.Err())
+		span.End()
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("failed to search products by SKU %s: %w", sku, err)
+		}
+		if existing != nil {
+			log.Printf("[Stripe] Reusing product %s for SKU %s", existing.ID, sku)
+			return existing, nil
+		}
+	}
+
+	productParams := &stripe.ProductParams{
+		Name:        stripe.String(name),
+		Description: stripe.String(description),
+	}
+	if sku != "" {
+		productParams.AddMetadata("sku", sku)
+	}
+	productCtx, span := tracing.StartClientSpan(ctx, "stripe.product.create")
+	productParams.Context = productCtx
+	setIdempotencyKey(&productParams.Params, idempotencyKey)
+	created, err := product.New(productParams)
+	span.RecordError(err)
+	span.End()
+	return created, err
+}
+
+// prefillCheckout adds Stripe's prefilled_email and prefilled_promo_code parameters so
+// checkout opens with the customer's email and the promotion code filled in. Payment links
+// can't store either themselves, so they only live in the URL (and the link metadata).
+func prefillCheckout(link string, data *models.PaymentLinkData) string {
+	if data.CustomerEmail == "" && data.PromotionCode == "" {
+		return link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		log.Printf("[Stripe] Could not add prefilled checkout details to %s: %v", link, err)
+		return link
+	}
+	query := parsed.Query()
+	if data.CustomerEmail != "" {
+		query.Set("prefilled_email", data.CustomerEmail)
+	}
+	if data.PromotionCode != "" {
+		query.Set("prefilled_promo_code", data.PromotionCode)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// idempotencyKey derives the Idempotency-Key for one create call of a link request from the
+// Slack request ID and the payment data, so a retried interaction with the same data reuses
+// the first attempt's objects. Without a request ID every call is treated as new.
+func idempotencyKey(data *models.PaymentLinkData, step string) string {
+	if data.RequestID == "" {
+		return ""
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(append(append(payload, 0), step...))
+	return "paymentbot-" + step + "-" + hex.EncodeToString(sum[:16])
+}
+
+func setIdempotencyKey(params *stripe.Params, key string) {
+	if key != "" {
+		params.SetIdempotencyKey(key)
+	}
 }
 
 // buildPriceParams constructs Stripe price parameters based on payment data
-func (s *StripeGenerator) buildPriceParams(data *models.PaymentLinkData, productID string) *stripe.PriceParams {
+func (s *StripeGenerator) buildPriceParams(data *models.PaymentLinkData, productID string, unitAmount float64) *stripe.PriceParams {
+	currency := strings.ToLower(data.Currency)
+	if currency == "" {
+		currency = "usd"
+	}
+
+	// Donations let the customer choose the amount, optionally with a minimum and a suggestion
+	if data.Donation {
+		customAmount := &stripe.PriceCustomUnitAmountParams{Enabled: stripe.Bool(true)}
+		if data.DonationMinimum > 0 {
+			customAmount.Minimum = stripe.Int64(utils.ToMinorUnits(data.DonationMinimum, currency))
+		}
+		if unitAmount > 0 {
+			customAmount.Preset = stripe.Int64(utils.ToMinorUnits(unitAmount, currency))
+		}
+		return &stripe.PriceParams{
+			Currency:         stripe.String(currency),
+			CustomUnitAmount: customAmount,
+			Product:          stripe.String(productID),
+		}
+	}
+
 	priceParams := &stripe.PriceParams{
-		Currency:   stripe.String("usd"),
-		UnitAmount: stripe.Int64(int64(data.Amount * 100)), // Convert to cents
+		Currency:   stripe.String(currency),
+		UnitAmount: stripe.Int64(utils.ToMinorUnits(unitAmount, currency)), // Convert to minor units (cents, or whole yen)
 		Product:    stripe.String(productID),
 	}
 
@@ -88,32 +225,95 @@ func (s *StripeGenerator) buildPriceParams(data *models.PaymentLinkData, product
 	return priceParams
 }
 
+// applyAdjustableQuantity lets the customer change item's quantity at checkout when the link
+// asks for it. Stripe needs the starting quantity inside the range.
+func applyAdjustableQuantity(item *stripe.PaymentLinkLineItemParams, data *models.PaymentLinkData) {
+	if !data.AdjustableQuantity {
+		return
+	}
+	min, max := data.QuantityMin, data.QuantityMax
+	if min <= 0 {
+		min = utils.DefaultMinAdjustableQuantity
+	}
+	if max <= 0 {
+		max = utils.DefaultMaxAdjustableQuantity
+	}
+	item.AdjustableQuantity = &stripe.PaymentLinkLineItemAdjustableQuantityParams{
+		Enabled: stripe.Bool(true),
+		Minimum: stripe.Int64(min),
+		Maximum: stripe.Int64(max),
+	}
+	if quantity := stripe.Int64Value(item.Quantity); quantity < min {
+		item.Quantity = stripe.Int64(min)
+	} else if quantity > max {
+		item.Quantity = stripe.Int64(max)
+	}
+}
+
 // buildPaymentLinkParams constructs Stripe payment link parameters
-func (s *StripeGenerator) buildPaymentLinkParams(data *models.PaymentLinkData, priceID string) *stripe.PaymentLinkParams {
+func (s *StripeGenerator) buildPaymentLinkParams(data *models.PaymentLinkData, lineItems []*stripe.PaymentLinkLineItemParams) *stripe.PaymentLinkParams {
 	params := &stripe.PaymentLinkParams{
-		LineItems: []*stripe.PaymentLinkLineItemParams{
-			{
-				Price:    stripe.String(priceID),
-				Quantity: stripe.Int64(1),
-			},
-		},
+		LineItems: lineItems,
+	}
+
+	// Record what the link is for and who requested it, for webhooks and /list-payments
+	metadata := map[string]string{
+		"service_name":     data.ServiceName,
+		"reference_number": data.ReferenceNumber,
+	}
+	addSlackRouting(metadata, data)
+	if data.CustomerEmail != "" {
+		metadata["customer_email"] = data.CustomerEmail
+	}
+	if data.PromotionCode != "" {
+		metadata["promotion_code"] = data.PromotionCode
+	}
+	if !data.ExpiresAt.IsZero() {
+		metadata[ExpiresAtMetadataKey] = strconv.FormatInt(data.ExpiresAt.Unix(), 10)
+	}
+	params.Metadata = metadata
+
+	if data.AllowPromotionCodes {
+		params.AllowPromotionCodes = stripe.Bool(true)
+	}
+
+	// Stripe Tax works out the rate from the address it collects at checkout
+	if data.AutomaticTax {
+		params.AutomaticTax = &stripe.PaymentLinkAutomaticTaxParams{Enabled: stripe.Bool(true)}
+	}
+
+	// Send customers to the team's own page instead of Stripe's confirmation
+	if data.RedirectURL != "" {
+		params.AfterCompletion = &stripe.PaymentLinkAfterCompletionParams{
+			Type:     stripe.String(string(stripe.PaymentLinkAfterCompletionTypeRedirect)),
+			Redirect: &stripe.PaymentLinkAfterCompletionRedirectParams{URL: stripe.String(data.RedirectURL)},
+		}
 	}
 
-	// For one-time payments, enable customer creation and save card for future use
+	// Donation links stay reusable and never save the donor's card
+	if data.Donation {
+		params.SubmitType = stripe.String(string(stripe.PaymentLinkSubmitTypeDonate))
+		params.PaymentIntentData = &stripe.PaymentLinkPaymentIntentDataParams{Metadata: metadata}
+		return params
+	}
+
+	// For one-time payments, enable customer creation and save card for future use unless disabled.
+	// The payment intent carries the link's metadata so payment_intent.succeeded can be routed.
 	if !data.IsSubscription {
 		params.CustomerCreation = stripe.String("always")
-		params.PaymentIntentData = &stripe.PaymentLinkPaymentIntentDataParams{
-			SetupFutureUsage: stripe.String("off_session"),
+		params.PaymentIntentData = &stripe.PaymentLinkPaymentIntentDataParams{Metadata: metadata}
+		if !data.SkipSaveCard {
+			params.PaymentIntentData.SetupFutureUsage = stripe.String("off_session")
 		}
 	} else {
 		// For subscriptions, add metadata to track cycle limits
 		log.Printf("[Stripe] Creating subscription payment link for service: %s", data.ServiceName)
-		metadata := make(map[string]string)
-		metadata["service_name"] = data.ServiceName
-		metadata["reference_number"] = data.ReferenceNumber
 
+		if data.TrialDays > 0 {
+			metadata["trial_days"] = fmt.Sprintf("%d", data.TrialDays)
+		}
 		if data.EndDateCycles > 0 {
-			endTimestamp := calculateEndTimestamp(data.Interval, data.IntervalCount, data.EndDateCycles)
+			endTimestamp := calculateEndTimestamp(data.Interval, data.IntervalCount, data.EndDateCycles, data.TrialDays)
 			metadata["end_date_cycles"] = fmt.Sprintf("%d", data.EndDateCycles)
 			metadata["end_timestamp"] = fmt.Sprintf("%d", endTimestamp)
 			metadata["interval"] = data.Interval
@@ -128,41 +328,59 @@ func (s *StripeGenerator) buildPaymentLinkParams(data *models.PaymentLinkData, p
 			log.Printf("[Stripe] Creating unlimited subscription (no EndDateCycles specified)")
 		}
 
+		// The subscription gets the same metadata as the link
 		params.SubscriptionData = &stripe.PaymentLinkSubscriptionDataParams{
 			Metadata: metadata,
 		}
-		// Also add metadata to the payment link itself
-		params.Metadata = metadata
+		if data.TrialDays > 0 {
+			params.SubscriptionData.TrialPeriodDays = stripe.Int64(data.TrialDays)
+		}
 	}
 
 	return params
 }
 
-// calculateEndTimestamp calculates the Unix timestamp when subscription should end
-func calculateEndTimestamp(interval string, intervalCount int64, endDateCycles int64) int64 {
+// calculateEndTimestamp estimates the Unix timestamp when subscription should end. Billing
+// starts when a free trial ends, so the cycles are counted from then. The subscription
+// webhook recomputes this from the subscription's real billing anchor (SubscriptionEndTime).
+func calculateEndTimestamp(interval string, intervalCount int64, endDateCycles int64, trialDays int64) int64 {
 	if endDateCycles <= 0 {
 		return 0
 	}
+	start := time.Now().AddDate(0, 0, int(trialDays))
+	return calculateEndTime(start, interval, intervalCount, endDateCycles).Unix()
+}
 
-	now := time.Now()
-	var duration time.Duration
+// calculateEndTime adds intervalCount*endDateCycles intervals to start. Months and years are
+// calendar periods clamped to the end of the month the way Stripe bills them, so Jan 31 + 1
+// month is Feb 28 (29 in leap years) rather than overflowing into March; days and weeks are
+// fixed durations.
+func calculateEndTime(start time.Time, interval string, intervalCount int64, endDateCycles int64) time.Time {
+	periods := int(intervalCount * endDateCycles)
 
 	switch interval {
 	case "day":
-		duration = time.Duration(intervalCount*endDateCycles) * 24 * time.Hour
+		return start.Add(time.Duration(periods) * 24 * time.Hour)
 	case "week":
-		duration = time.Duration(intervalCount*endDateCycles) * 7 * 24 * time.Hour
-	case "month":
-		// Approximate month as 30 days
-		duration = time.Duration(intervalCount*endDateCycles) * 30 * 24 * time.Hour
+		return start.Add(time.Duration(periods) * 7 * 24 * time.Hour)
 	case "year":
-		// Approximate year as 365 days
-		duration = time.Duration(intervalCount*endDateCycles) * 365 * 24 * time.Hour
+		return addMonthsClamped(start, 12*periods)
 	default:
-		// Default to month if interval is unknown
-		duration = time.Duration(intervalCount*endDateCycles) * 30 * 24 * time.Hour
+		// "month", and the fallback for unknown intervals
+		return addMonthsClamped(start, periods)
 	}
+}
 
-	endTime := now.Add(duration)
-	return endTime.Unix()
+// addMonthsClamped adds months to t, keeping t's day unless the target month is shorter, in
+// which case the result is that month's last day
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+
+	// Day 1 never overflows, so this is the right target month
+	first := time.Date(year, month+time.Month(months), 1, hour, min, sec, t.Nanosecond(), t.Location())
+	if lastDay := first.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
 }
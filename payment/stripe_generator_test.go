@@ -0,0 +1,546 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/utils"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+func TestCalculateEndTime(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		start    time.Time
+		interval string
+		count    int64
+		cycles   int64
+		want     time.Time
+	}{
+		{"month from mid-month", date(2026, 3, 15), "month", 1, 3, date(2026, 6, 15)},
+		{"Jan 31 + 1 month clamps to Feb 28", date(2026, 1, 31), "month", 1, 1, date(2026, 2, 28)},
+		{"Jan 31 + 1 month in a leap year", date(2028, 1, 31), "month", 1, 1, date(2028, 2, 29)},
+		{"Jan 31 + 2 months keeps the 31st", date(2026, 1, 31), "month", 1, 2, date(2026, 3, 31)},
+		{"Mar 31 + 1 month clamps to Apr 30", date(2026, 3, 31), "month", 1, 1, date(2026, 4, 30)},
+		{"Aug 31 every 3 months", date(2026, 8, 31), "month", 3, 1, date(2026, 11, 30)},
+		{"months across a year boundary", date(2026, 11, 30), "month", 1, 3, date(2027, 2, 28)},
+		{"Feb 29 + 1 year clamps to Feb 28", date(2028, 2, 29), "year", 1, 1, date(2029, 2, 28)},
+		{"Feb 29 + 4 years keeps Feb 29", date(2028, 2, 29), "year", 1, 4, date(2032, 2, 29)},
+		{"weeks", date(2026, 12, 28), "week", 2, 2, date(2027, 1, 25)},
+		{"days", date(2026, 2, 27), "day", 1, 3, date(2026, 3, 2)},
+		{"unknown interval counts months", date(2026, 1, 31), "", 1, 1, date(2026, 2, 28)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateEndTime(tt.start, tt.interval, tt.count, tt.cycles); !got.Equal(tt.want) {
+				t.Errorf("calculateEndTime(%s, %s, %d, %d) = %s, want %s", tt.start.Format(time.DateOnly), tt.interval, tt.count, tt.cycles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateEndTimestampWithoutCycles(t *testing.T) {
+	if got := calculateEndTimestamp("month", 1, 0, 0); got != 0 {
+		t.Errorf("calculateEndTimestamp with no cycles = %d, want 0", got)
+	}
+}
+
+func TestCalculateEndTimestampWithATrial(t *testing.T) {
+	before := time.Now()
+	got := calculateEndTimestamp("month", 1, 3, 14)
+	after := time.Now()
+
+	// Billing starts when the trial ends, so the three months are counted from then
+	earliest := calculateEndTime(before.AddDate(0, 0, 14), "month", 1, 3).Unix()
+	latest := calculateEndTime(after.AddDate(0, 0, 14), "month", 1, 3).Unix()
+	if got < earliest || got > latest {
+		t.Errorf("calculateEndTimestamp with a 14 day trial = %d, want between %d and %d", got, earliest, latest)
+	}
+	if withoutTrial := calculateEndTimestamp("month", 1, 3, 0); got-withoutTrial < 13*24*60*60 {
+		t.Errorf("end with a 14 day trial = %d, only %ds after the end without one (%d)", got, got-withoutTrial, withoutTrial)
+	}
+}
+
+func TestBuildPaymentLinkParamsTrial(t *testing.T) {
+	subscription := models.PaymentLinkData{IsSubscription: true, Interval: "month", IntervalCount: 1, TrialDays: 14}
+	params := (&StripeGenerator{}).buildPaymentLinkParams(&subscription, nil)
+	if params.SubscriptionData == nil || stripe.Int64Value(params.SubscriptionData.TrialPeriodDays) != 14 {
+		t.Fatalf("SubscriptionData = %+v, want a 14 day trial", params.SubscriptionData)
+	}
+	if got := params.SubscriptionData.Metadata["trial_days"]; got != "14" {
+		t.Errorf("trial_days metadata = %q, want 14", got)
+	}
+
+	subscription.TrialDays = 0
+	params = (&StripeGenerator{}).buildPaymentLinkParams(&subscription, nil)
+	if params.SubscriptionData == nil || params.SubscriptionData.TrialPeriodDays != nil {
+		t.Errorf("SubscriptionData = %+v without a trial, want no trial period", params.SubscriptionData)
+	}
+	if _, ok := params.Metadata["trial_days"]; ok {
+		t.Error("trial_days metadata set without a trial")
+	}
+
+	// Cycle limits count from the end of the trial
+	subscription.TrialDays, subscription.EndDateCycles = 30, 2
+	params = (&StripeGenerator{}).buildPaymentLinkParams(&subscription, nil)
+	end, _ := strconv.ParseInt(params.SubscriptionData.Metadata["end_timestamp"], 10, 64)
+	// Two calendar months are never shorter than 59 days
+	if earliest := time.Now().AddDate(0, 0, 30+58).Unix(); end < earliest {
+		t.Errorf("end_timestamp = %d, want 2 months after the 30 day trial (at least %d)", end, earliest)
+	}
+}
+
+func TestBuildPaymentLinkParamsAllowPromotionCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		data models.PaymentLinkData
+		want bool
+	}{
+		{"off by default", models.PaymentLinkData{}, false},
+		{"allowed", models.PaymentLinkData{AllowPromotionCodes: true}, true},
+		{"allowed on a subscription", models.PaymentLinkData{AllowPromotionCodes: true, IsSubscription: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := (&StripeGenerator{}).buildPaymentLinkParams(&tt.data, nil)
+			if got := params.AllowPromotionCodes != nil && *params.AllowPromotionCodes; got != tt.want {
+				t.Errorf("AllowPromotionCodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPaymentLinkParamsAutomaticTax(t *testing.T) {
+	tests := []struct {
+		name string
+		data models.PaymentLinkData
+		want bool
+	}{
+		{"off by default", models.PaymentLinkData{}, false},
+		{"enabled", models.PaymentLinkData{AutomaticTax: true}, true},
+		{"enabled on a subscription", models.PaymentLinkData{AutomaticTax: true, IsSubscription: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := (&StripeGenerator{}).buildPaymentLinkParams(&tt.data, nil)
+			if !tt.want {
+				// Not sending the param at all leaves the account's own setting alone
+				if params.AutomaticTax != nil {
+					t.Errorf("AutomaticTax = %+v, want it left out", params.AutomaticTax)
+				}
+				return
+			}
+			if params.AutomaticTax == nil || params.AutomaticTax.Enabled == nil || !*params.AutomaticTax.Enabled {
+				t.Errorf("AutomaticTax = %+v, want enabled", params.AutomaticTax)
+			}
+		})
+	}
+}
+
+func TestApplyAdjustableQuantity(t *testing.T) {
+	tests := []struct {
+		name                   string
+		data                   models.PaymentLinkData
+		quantity               int64
+		wantMin, wantMax, want int64
+	}{
+		{"limits from the modal", models.PaymentLinkData{AdjustableQuantity: true, QuantityMin: 2, QuantityMax: 10}, 3, 2, 10, 3},
+		{"default limits", models.PaymentLinkData{AdjustableQuantity: true}, 1, 1, 99, 1},
+		{"starting quantity raised to the minimum", models.PaymentLinkData{AdjustableQuantity: true, QuantityMin: 5, QuantityMax: 10}, 1, 5, 10, 5},
+		{"starting quantity lowered to the maximum", models.PaymentLinkData{AdjustableQuantity: true, QuantityMin: 1, QuantityMax: 3}, 8, 1, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &stripe.PaymentLinkLineItemParams{Quantity: stripe.Int64(tt.quantity)}
+			applyAdjustableQuantity(item, &tt.data)
+			adjustable := item.AdjustableQuantity
+			if adjustable == nil || !stripe.BoolValue(adjustable.Enabled) {
+				t.Fatalf("AdjustableQuantity = %+v, want enabled", adjustable)
+			}
+			if got, gotMax := stripe.Int64Value(adjustable.Minimum), stripe.Int64Value(adjustable.Maximum); got != tt.wantMin || gotMax != tt.wantMax {
+				t.Errorf("range = %d-%d, want %d-%d", got, gotMax, tt.wantMin, tt.wantMax)
+			}
+			if got := stripe.Int64Value(item.Quantity); got != tt.want {
+				t.Errorf("quantity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	item := &stripe.PaymentLinkLineItemParams{Quantity: stripe.Int64(1)}
+	applyAdjustableQuantity(item, &models.PaymentLinkData{QuantityMin: 2, QuantityMax: 10})
+	if item.AdjustableQuantity != nil {
+		t.Errorf("AdjustableQuantity = %+v without the toggle, want it left out", item.AdjustableQuantity)
+	}
+}
+
+func TestBuildPaymentLinkParamsRedirect(t *testing.T) {
+	params := (&StripeGenerator{}).buildPaymentLinkParams(&models.PaymentLinkData{}, nil)
+	if params.AfterCompletion != nil {
+		t.Errorf("AfterCompletion = %+v without a redirect URL, want none", params.AfterCompletion)
+	}
+
+	params = (&StripeGenerator{}).buildPaymentLinkParams(&models.PaymentLinkData{RedirectURL: "https://acme.test/thanks"}, nil)
+	completion := params.AfterCompletion
+	if completion == nil || completion.Type == nil || *completion.Type != "redirect" {
+		t.Fatalf("AfterCompletion = %+v, want a redirect", completion)
+	}
+	if completion.Redirect == nil || *completion.Redirect.URL != "https://acme.test/thanks" {
+		t.Errorf("redirect = %+v, want https://acme.test/thanks", completion.Redirect)
+	}
+}
+
+func TestBuildPaymentLinkParamsSaveCard(t *testing.T) {
+	tests := []struct {
+		name string
+		data models.PaymentLinkData
+		want string
+	}{
+		{"saved by default", models.PaymentLinkData{}, "off_session"},
+		{"disabled", models.PaymentLinkData{SkipSaveCard: true}, ""},
+		{"subscription", models.PaymentLinkData{IsSubscription: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := (&StripeGenerator{}).buildPaymentLinkParams(&tt.data, nil)
+			got := ""
+			if params.PaymentIntentData != nil && params.PaymentIntentData.SetupFutureUsage != nil {
+				got = *params.PaymentIntentData.SetupFutureUsage
+			}
+			if got != tt.want {
+				t.Errorf("SetupFutureUsage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDonationPriceParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        models.PaymentLinkData
+		unitAmount  float64
+		wantMinimum int64
+		wantPreset  int64
+	}{
+		{"donor chooses freely", models.PaymentLinkData{Donation: true, Currency: "USD"}, 0, 0, 0},
+		{"minimum and suggestion", models.PaymentLinkData{Donation: true, Currency: "USD", DonationMinimum: 5}, 25, 500, 2500},
+		{"zero-decimal currency", models.PaymentLinkData{Donation: true, Currency: "JPY", DonationMinimum: 500}, 1000, 500, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := (&StripeGenerator{}).buildPriceParams(&tt.data, "prod_1", tt.unitAmount)
+			if params.UnitAmount != nil || params.Recurring != nil {
+				t.Errorf("donation price has a fixed amount %v or is recurring %v", params.UnitAmount, params.Recurring)
+			}
+			custom := params.CustomUnitAmount
+			if custom == nil || !stripe.BoolValue(custom.Enabled) {
+				t.Fatal("donation price doesn't let the customer choose the amount")
+			}
+			if got := stripe.Int64Value(custom.Minimum); got != tt.wantMinimum {
+				t.Errorf("minimum = %d, want %d", got, tt.wantMinimum)
+			}
+			if got := stripe.Int64Value(custom.Preset); got != tt.wantPreset {
+				t.Errorf("preset = %d, want %d", got, tt.wantPreset)
+			}
+		})
+	}
+}
+
+func TestDonationLinkParams(t *testing.T) {
+	data := &models.PaymentLinkData{Donation: true, SkipSaveCard: true, ServiceName: "Food bank", ReferenceNumber: "DONATION-1"}
+	params := (&StripeGenerator{}).buildPaymentLinkParams(data, nil)
+
+	if got := stripe.StringValue(params.SubmitType); got != string(stripe.PaymentLinkSubmitTypeDonate) {
+		t.Errorf("SubmitType = %q, want donate", got)
+	}
+	if params.PaymentIntentData == nil || params.PaymentIntentData.SetupFutureUsage != nil {
+		t.Error("donation link saves the donor's card")
+	}
+	if params.PaymentIntentData != nil && params.PaymentIntentData.Metadata["service_name"] != "Food bank" {
+		t.Errorf("payment intent metadata = %v, want the link's metadata", params.PaymentIntentData.Metadata)
+	}
+	if params.Restrictions != nil || params.CustomerCreation != nil {
+		t.Error("donation link should stay reusable without creating customers")
+	}
+}
+
+func TestCadencePresetsBuildRecurringPrices(t *testing.T) {
+	want := map[string]struct {
+		interval string
+		count    int64
+	}{
+		"biweekly":     {"week", 2},
+		"quarterly":    {"month", 3},
+		"semiannually": {"month", 6},
+		"annually":     {"year", 1},
+	}
+	if len(utils.CadencePresets) != len(want) {
+		t.Fatalf("%d cadence presets, want %d", len(utils.CadencePresets), len(want))
+	}
+	for _, preset := range utils.CadencePresets {
+		t.Run(preset.Value, func(t *testing.T) {
+			interval, count, ok := utils.ResolveCadencePreset(preset.Value)
+			if !ok {
+				t.Fatalf("ResolveCadencePreset(%q) not found", preset.Value)
+			}
+			data := &models.PaymentLinkData{Currency: "usd", IsSubscription: true, Interval: interval, IntervalCount: count}
+			recurring := (&StripeGenerator{}).buildPriceParams(data, "prod_1", 10).Recurring
+			if recurring == nil {
+				t.Fatal("price has no recurring params")
+			}
+			if got := *recurring.Interval; got != want[preset.Value].interval {
+				t.Errorf("interval = %q, want %q", got, want[preset.Value].interval)
+			}
+			if got := *recurring.IntervalCount; got != want[preset.Value].count {
+				t.Errorf("interval count = %d, want %d", got, want[preset.Value].count)
+			}
+		})
+	}
+}
+
+func TestBuildPriceParamsDailyInterval(t *testing.T) {
+	data := &models.PaymentLinkData{Currency: "usd", IsSubscription: true, Interval: "day", IntervalCount: 2}
+	recurring := (&StripeGenerator{}).buildPriceParams(data, "prod_1", 10).Recurring
+	if recurring == nil {
+		t.Fatal("price has no recurring params")
+	}
+	if *recurring.Interval != "day" || *recurring.IntervalCount != 2 {
+		t.Errorf("recurring every %d %s, want every 2 day", *recurring.IntervalCount, *recurring.Interval)
+	}
+}
+
+func TestBuildPriceParamsUsesTheLinksCurrency(t *testing.T) {
+	tests := []struct {
+		currency   string
+		amount     float64
+		want       string
+		wantAmount int64
+	}{
+		{"", 19.99, "usd", 1999},
+		{"EUR", 19.99, "eur", 1999},
+		{"JPY", 1500, "jpy", 1500},
+	}
+	for _, tt := range tests {
+		params := (&StripeGenerator{}).buildPriceParams(&models.PaymentLinkData{Currency: tt.currency}, "prod_1", tt.amount)
+		if *params.Currency != tt.want || *params.UnitAmount != tt.wantAmount {
+			t.Errorf("currency %q: price %d %s, want %d %s", tt.currency, *params.UnitAmount, *params.Currency, tt.wantAmount, tt.want)
+		}
+	}
+}
+
+func TestGenerateLinkReusesProductsBySKU(t *testing.T) {
+	fake := newFakeStripe(t)
+	generator := NewStripeGenerator("sk_test")
+	data := &models.PaymentLinkData{
+		Amount:      10,
+		Currency:    "USD",
+		ServiceName: "Widget",
+		LineItems: []models.PaymentLineItem{
+			{Description: "Widget", UnitAmount: 10, Quantity: 1, SKU: "WID-1"},
+			{Description: "Gadget", UnitAmount: 5, Quantity: 2, SKU: "GAD-1"},
+			{Description: "Setup fee", UnitAmount: 20, Quantity: 1},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := generator.GenerateLink(context.Background(), data); err != nil {
+			t.Fatalf("GenerateLink %d error: %v", i+1, err)
+		}
+	}
+
+	// Each SKU gets one product; the item without a SKU gets a new product every time
+	created := fake.calls(http.MethodPost, "/v1/products")
+	if len(created) != 4 {
+		t.Fatalf("%d products created, want 4 (one per SKU plus the setup fee twice)", len(created))
+	}
+	skus := map[string]int{}
+	for _, req := range created {
+		skus[req.Form.Get("metadata[sku]")]++
+	}
+	if skus["WID-1"] != 1 || skus["GAD-1"] != 1 || skus[""] != 2 {
+		t.Errorf("products created per SKU = %v", skus)
+	}
+	if searches := fake.calls(http.MethodGet, "/v1/products/search"); len(searches) != 4 {
+		t.Errorf("%d product searches, want one per SKU item per link", len(searches))
+	}
+	if prices := fake.calls(http.MethodPost, "/v1/prices"); len(prices) != 6 {
+		t.Errorf("%d prices created, want one per item per link", len(prices))
+	}
+}
+
+func TestGenerateLinkWithSeveralLineItems(t *testing.T) {
+	fake := newFakeStripe(t)
+	generator := NewStripeGenerator("sk_test")
+	data := &models.PaymentLinkData{
+		Amount:      12.50,
+		Currency:    "USD",
+		ServiceName: "Consulting",
+		LineItems: []models.PaymentLineItem{
+			{Description: "Consulting", UnitAmount: 12.50, Quantity: 1},
+			{Description: "Stickers", UnitAmount: 2.25, Quantity: 4},
+		},
+	}
+
+	url, _, err := generator.GenerateLink(context.Background(), data)
+	if err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	if url == "" {
+		t.Error("GenerateLink returned no URL")
+	}
+
+	products := fake.calls(http.MethodPost, "/v1/products")
+	if len(products) != 2 || products[0].Form.Get("name") != "Consulting" || products[1].Form.Get("name") != "Stickers" {
+		t.Errorf("products created = %v, want Consulting then Stickers", products)
+	}
+	links := fake.calls(http.MethodPost, "/v1/payment_links")
+	if len(links) != 1 {
+		t.Fatalf("%d payment links created, want 1", len(links))
+	}
+	form := links[0].Form
+	if got := form.Get("line_items[1][quantity]"); got != "4" {
+		t.Errorf("second line item quantity = %q, want 4", got)
+	}
+	if form.Get("line_items[2][price]") != "" {
+		t.Errorf("payment link has more than two line items: %v", form)
+	}
+	// 12.50 + 4 x 2.25, in cents
+	if got := fake.linkTotal(links[0]); got != 2150 {
+		t.Errorf("link total = %d cents, want 2150", got)
+	}
+}
+
+func TestGenerateLinkWithoutLineItemsSellsTheAmount(t *testing.T) {
+	fake := newFakeStripe(t)
+	generator := NewStripeGenerator("sk_test")
+	data := &models.PaymentLinkData{Amount: 99, Currency: "USD", ServiceName: "Retainer"}
+
+	if _, _, err := generator.GenerateLink(context.Background(), data); err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	products := fake.calls(http.MethodPost, "/v1/products")
+	if len(products) != 1 || products[0].Form.Get("name") != "Retainer" {
+		t.Errorf("products created = %v, want just Retainer", products)
+	}
+	links := fake.calls(http.MethodPost, "/v1/payment_links")
+	if len(links) != 1 {
+		t.Fatalf("%d payment links created, want 1", len(links))
+	}
+	if got := links[0].Form.Get("line_items[0][quantity]"); got != "1" {
+		t.Errorf("quantity = %q, want 1", got)
+	}
+	if got := fake.linkTotal(links[0]); got != 9900 {
+		t.Errorf("link total = %d cents, want 9900", got)
+	}
+}
+
+func TestGenerateLinkCustomerEmail(t *testing.T) {
+	for _, email := range []string{"ada@example.com", ""} {
+		t.Run(fmt.Sprintf("email %q", email), func(t *testing.T) {
+			fake := newFakeStripe(t)
+			data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", CustomerEmail: email}
+			link, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data)
+			if err != nil {
+				t.Fatalf("GenerateLink error: %v", err)
+			}
+			parsed, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parsing link %q: %v", link, err)
+			}
+			if got := parsed.Query().Get("prefilled_email"); got != email {
+				t.Errorf("link %q prefills email %q, want %q", link, got, email)
+			}
+			links := fake.calls(http.MethodPost, "/v1/payment_links")
+			if len(links) != 1 {
+				t.Fatalf("%d payment links created, want 1", len(links))
+			}
+			if got := links[0].Form.Get("metadata[customer_email]"); got != email {
+				t.Errorf("metadata customer_email = %q, want %q", got, email)
+			}
+		})
+	}
+}
+
+func TestGenerateLinkRecordsTheExpiry(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	for name, tt := range map[string]struct {
+		expiresAt time.Time
+		want      string
+	}{
+		"with an expiry":    {expiresAt, strconv.FormatInt(expiresAt.Unix(), 10)},
+		"without an expiry": {time.Time{}, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeStripe(t)
+			data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", ExpiresAt: tt.expiresAt}
+			if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err != nil {
+				t.Fatalf("GenerateLink error: %v", err)
+			}
+			links := fake.calls(http.MethodPost, "/v1/payment_links")
+			if len(links) != 1 {
+				t.Fatalf("%d payment links created, want 1", len(links))
+			}
+			if got := links[0].Form.Get("metadata[" + ExpiresAtMetadataKey + "]"); got != tt.want {
+				t.Errorf("expires_at metadata = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateLinkIdempotencyKeys(t *testing.T) {
+	// keysFor generates a link for data and returns the Idempotency-Key of each create call
+	keysFor := func(t *testing.T, data *models.PaymentLinkData) []string {
+		t.Helper()
+		fake := newFakeStripe(t)
+		if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err != nil {
+			t.Fatalf("GenerateLink error: %v", err)
+		}
+		var keys []string
+		for _, path := range []string{"/v1/products", "/v1/prices", "/v1/payment_links"} {
+			calls := fake.calls(http.MethodPost, path)
+			if len(calls) != 1 {
+				t.Fatalf("%d calls to %s, want 1", len(calls), path)
+			}
+			keys = append(keys, calls[0].IdempotencyKey)
+		}
+		return keys
+	}
+	newData := func(requestID string) *models.PaymentLinkData {
+		return &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", ReferenceNumber: "INV-1", RequestID: requestID}
+	}
+
+	first := keysFor(t, newData("trigger-1"))
+	retry := keysFor(t, newData("trigger-1"))
+	other := keysFor(t, newData("trigger-2"))
+
+	for i, step := range []string{"product", "price", "payment link"} {
+		if !strings.HasPrefix(first[i], "paymentbot-") {
+			t.Errorf("%s key = %q, want one derived from the request", step, first[i])
+		}
+		if retry[i] != first[i] {
+			t.Errorf("retried %s key = %q, want the first attempt's %q", step, retry[i], first[i])
+		}
+		if other[i] == first[i] {
+			t.Errorf("%s key %q reused for a different Slack request", step, other[i])
+		}
+	}
+	if first[0] == first[1] || first[1] == first[2] {
+		t.Errorf("keys %v are shared between steps", first)
+	}
+
+	changed := newData("trigger-1")
+	changed.Amount = 20
+	if keys := keysFor(t, changed); keys[2] == first[2] {
+		t.Error("payment link key unchanged when the same request carries different data")
+	}
+}
@@ -0,0 +1,228 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/paymentlink"
+
+	"paymentbot/money"
+)
+
+// MaxListedLinkScan bounds how many payment links one listing pages through looking for a
+// user's links. Stripe can't filter links by metadata, so older links may be missed.
+const MaxListedLinkScan = 500
+
+// LinkSummary describes a payment link for listing in Slack
+type LinkSummary struct {
+	ID          string
+	URL         string
+	ServiceName string
+	Amount      float64 // total of the link's line items; 0 when the customer chooses the amount
+	Currency    string
+	Active      bool
+}
+
+// ListLinksResult is a page of a user's most recent links
+type ListLinksResult struct {
+	Links     []LinkSummary
+	Scanned   int
+	Truncated bool // MaxListedLinkScan was reached before enough links were found
+}
+
+// StripeLinkLister finds payment links by the Slack metadata stamped on them at creation
+type StripeLinkLister struct {
+	apiKey string
+}
+
+// NewStripeLinkLister creates a lister for the account behind apiKey
+func NewStripeLinkLister(apiKey string) *StripeLinkLister {
+	return &StripeLinkLister{apiKey: apiKey}
+}
+
+// ListByUser returns up to limit of the most recent links created by the Slack user, newest first
+func (l *StripeLinkLister) ListByUser(ctx context.Context, userID string, limit int) (*ListLinksResult, error) {
+	stripe.Key = l.apiKey
+
+	params := &stripe.PaymentLinkListParams{}
+	params.Context = ctx
+	params.Limit = stripe.Int64(reconcilePageSize)
+	params.AddExpand("data.line_items")
+
+	result := &ListLinksResult{}
+	iter := paymentlink.List(params)
+	for len(result.Links) < limit && iter.Next() {
+		if result.Scanned >= MaxListedLinkScan {
+			result.Truncated = true
+			break
+		}
+		result.Scanned++
+
+		link := iter.PaymentLink()
+		if link.Metadata[SlackUserMetadataKey] != userID {
+			continue
+		}
+		result.Links = append(result.Links, summarizeLink(link))
+	}
+	if err := iter.Err(); err != nil {
+		return result, fmt.Errorf("failed to list payment links: %w", err)
+	}
+	return result, nil
+}
+
+func summarizeLink(link *stripe.PaymentLink) LinkSummary {
+	summary := LinkSummary{
+		ID:          link.ID,
+		URL:         link.URL,
+		ServiceName: link.Metadata["service_name"],
+		Currency:    strings.ToUpper(string(link.Currency)),
+		Active:      link.Active,
+	}
+	if link.LineItems == nil {
+		return summary
+	}
+
+	var total int64
+	for _, item := range link.LineItems.Data {
+		total += item.AmountTotal
+		if summary.ServiceName == "" {
+			summary.ServiceName = item.Description
+		}
+	}
+	summary.Amount = money.Money{Minor: total, Currency: summary.Currency}.Major()
+	return summary
+}
+
+// ExpiresAtMetadataKey holds the Unix time after which a Stripe link should be deactivated.
+// Stripe links have no expiry of their own.
+const ExpiresAtMetadataKey = "expires_at"
+
+// MaxExpiryScan bounds how many active links the startup scan for expiring links pages through
+const MaxExpiryScan = 1000
+
+// StripeLinkExpirer deactivates links once their expires_at metadata has passed. Links created
+// with an expiry are tracked by ID, so sweeps only touch those. Tracking is in memory, so
+// LoadPending finds the links created before a restart.
+type StripeLinkExpirer struct {
+	apiKey string
+
+	mu      sync.Mutex
+	pending map[string]time.Time // link ID -> expiry
+}
+
+// NewStripeLinkExpirer creates an expirer for the account behind apiKey
+func NewStripeLinkExpirer(apiKey string) *StripeLinkExpirer {
+	return &StripeLinkExpirer{apiKey: apiKey, pending: make(map[string]time.Time)}
+}
+
+// Track schedules linkID to be deactivated once expiresAt has passed
+func (e *StripeLinkExpirer) Track(linkID string, expiresAt time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending[linkID] = expiresAt
+}
+
+// Pending returns how many tracked links haven't been deactivated yet
+func (e *StripeLinkExpirer) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.pending)
+}
+
+// LoadPending pages through the active links once and tracks those with an expiry. Stripe
+// can't filter links by metadata, so links beyond the first MaxExpiryScan aren't found.
+func (e *StripeLinkExpirer) LoadPending(ctx context.Context) error {
+	stripe.Key = e.apiKey
+
+	params := &stripe.PaymentLinkListParams{Active: stripe.Bool(true)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(reconcilePageSize)
+
+	scanned, found := 0, 0
+	iter := paymentlink.List(params)
+	for iter.Next() {
+		if scanned >= MaxExpiryScan {
+			log.Printf("[Stripe] Warning: stopped looking for expiring payment links after %d active links; expiring links beyond those won't be deactivated until they're deactivated in the Stripe dashboard", MaxExpiryScan)
+			break
+		}
+		scanned++
+
+		link := iter.PaymentLink()
+		if expiresAt, ok := LinkExpiresAt(link); ok {
+			e.Track(link.ID, expiresAt)
+			found++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to list payment links: %w", err)
+	}
+	log.Printf("[Stripe] Found %d active payment links with an expiry among %d scanned", found, scanned)
+	return nil
+}
+
+// LinkExpiresAt returns when link should expire, if it was created with an expiry
+func LinkExpiresAt(link *stripe.PaymentLink) (time.Time, bool) {
+	raw, ok := link.Metadata[ExpiresAtMetadataKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || unix <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// DeactivateExpired deactivates every tracked link that has expired by now and returns them.
+// Links that fail to update stay tracked and are retried on the next sweep.
+func (e *StripeLinkExpirer) DeactivateExpired(ctx context.Context, now time.Time) ([]*stripe.PaymentLink, error) {
+	stripe.Key = e.apiKey
+
+	e.mu.Lock()
+	due := make(map[string]time.Time)
+	for linkID, expiresAt := range e.pending {
+		if !expiresAt.After(now) {
+			due[linkID] = expiresAt
+		}
+	}
+	e.mu.Unlock()
+
+	var expired []*stripe.PaymentLink
+	var failed int
+	for linkID, expiresAt := range due {
+		params := &stripe.PaymentLinkParams{Active: stripe.Bool(false)}
+		params.Context = ctx
+		updated, err := paymentlink.Update(linkID, params)
+		if err != nil {
+			var stripeErr *stripe.Error
+			if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+				log.Printf("[Stripe] Expired payment link %s no longer exists, no longer tracking it", linkID)
+				e.untrack(linkID)
+				continue
+			}
+			log.Printf("[Stripe] Failed to deactivate expired payment link %s: %v", linkID, err)
+			failed++
+			continue
+		}
+		e.untrack(linkID)
+		log.Printf("[Stripe] Deactivated payment link %s, expired at %s", linkID, expiresAt.UTC().Format(time.RFC3339))
+		expired = append(expired, updated)
+	}
+	if failed > 0 {
+		return expired, fmt.Errorf("failed to deactivate %d expired payment links", failed)
+	}
+	return expired, nil
+}
+
+func (e *StripeLinkExpirer) untrack(linkID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.pending, linkID)
+}
@@ -0,0 +1,160 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDeactivateExpiredLinks(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	link := func(id string, metadata map[string]string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "object": "payment_link", "active": true, "url": "https://buy.stripe.com/" + id, "metadata": metadata}
+	}
+	expiresAt := func(at time.Time) map[string]string {
+		return map[string]string{ExpiresAtMetadataKey: fmt.Sprint(at.Unix()), "service_name": "Hosting"}
+	}
+
+	fake := newFakeStripe(t)
+	fake.paymentLinks = []map[string]interface{}{
+		link("plink_expired", expiresAt(now.Add(-time.Hour))),
+		link("plink_expiring_now", expiresAt(now)),
+		link("plink_later", expiresAt(now.Add(time.Hour))),
+		link("plink_no_expiry", map[string]string{"service_name": "Hosting"}),
+		link("plink_bad_expiry", map[string]string{ExpiresAtMetadataKey: "soon"}),
+	}
+
+	// Links created before a restart are found by scanning the active links once
+	expirer := NewStripeLinkExpirer("sk_test")
+	if err := expirer.LoadPending(context.Background()); err != nil {
+		t.Fatalf("LoadPending error: %v", err)
+	}
+	if lists := fake.calls(http.MethodGet, "/v1/payment_links"); len(lists) != 1 || lists[0].Form.Get("active") != "true" {
+		t.Errorf("listed links with %v, want one list of active links", lists)
+	}
+	if got := expirer.Pending(); got != 3 {
+		t.Errorf("Pending = %d, want the 3 links with an expiry", got)
+	}
+
+	expired, err := expirer.DeactivateExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("DeactivateExpired error: %v", err)
+	}
+	var ids []string
+	for _, link := range expired {
+		ids = append(ids, link.ID)
+		if link.Active {
+			t.Errorf("%s is still active", link.ID)
+		}
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[plink_expired plink_expiring_now]" {
+		t.Errorf("deactivated %v, want [plink_expired plink_expiring_now]", ids)
+	}
+	if got := expirer.Pending(); got != 1 {
+		t.Errorf("Pending = %d after the sweep, want only plink_later", got)
+	}
+	// Sweeps don't list links again
+	if lists := fake.calls(http.MethodGet, "/v1/payment_links"); len(lists) != 1 {
+		t.Errorf("listed links %d times, want only the startup scan", len(lists))
+	}
+}
+
+func TestDeactivateExpiredOnlyTouchesTrackedLinks(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fake := newFakeStripe(t)
+	fake.paymentLinks = []map[string]interface{}{
+		{"id": "plink_tracked", "object": "payment_link", "active": true},
+		{"id": "plink_untracked", "object": "payment_link", "active": true, "metadata": map[string]string{ExpiresAtMetadataKey: fmt.Sprint(now.Add(-time.Hour).Unix())}},
+	}
+
+	expirer := NewStripeLinkExpirer("sk_test")
+	if _, err := expirer.DeactivateExpired(context.Background(), now); err != nil {
+		t.Fatalf("DeactivateExpired with nothing tracked error: %v", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("made %d Stripe requests with nothing tracked, want none", len(fake.requests))
+	}
+
+	expirer.Track("plink_tracked", now.Add(-time.Minute))
+	expirer.Track("plink_deleted", now.Add(-time.Minute))
+	expired, err := expirer.DeactivateExpired(context.Background(), now)
+	if err != nil {
+		t.Fatalf("DeactivateExpired error: %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != "plink_tracked" {
+		t.Errorf("deactivated %v, want only plink_tracked", expired)
+	}
+	// A link deleted in Stripe is dropped rather than retried forever
+	if got := expirer.Pending(); got != 0 {
+		t.Errorf("Pending = %d, want 0", got)
+	}
+	if updates := fake.calls(http.MethodPost, "/v1/payment_links/plink_untracked"); len(updates) != 0 {
+		t.Errorf("updated an untracked link %v", updates)
+	}
+}
+
+func TestListByUser(t *testing.T) {
+	link := func(id, userID string, active bool, lineItems ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "object": "payment_link", "active": active, "currency": "usd", "url": "https://buy.stripe.com/" + id,
+			"metadata":   map[string]string{SlackUserMetadataKey: userID},
+			"line_items": map[string]interface{}{"object": "list", "data": lineItems},
+		}
+	}
+	item := func(description string, total int64) map[string]interface{} {
+		return map[string]interface{}{"object": "item", "description": description, "amount_total": total}
+	}
+
+	fake := newFakeStripe(t)
+	fake.paymentLinks = []map[string]interface{}{
+		link("plink_3", "U1", true, item("Hosting", 4999), item("Setup", 1000)),
+		link("plink_other", "U2", true, item("Other", 100)),
+		link("plink_2", "U1", false),
+		link("plink_1", "U1", true, item("Support", 2500)),
+	}
+	lister := NewStripeLinkLister("sk_test")
+
+	result, err := lister.ListByUser(context.Background(), "U1", 2)
+	if err != nil {
+		t.Fatalf("ListByUser error: %v", err)
+	}
+	want := []LinkSummary{
+		{ID: "plink_3", URL: "https://buy.stripe.com/plink_3", ServiceName: "Hosting", Amount: 59.99, Currency: "USD", Active: true},
+		{ID: "plink_2", URL: "https://buy.stripe.com/plink_2", Currency: "USD"},
+	}
+	if len(result.Links) != len(want) {
+		t.Fatalf("listed %d links, want %d: %+v", len(result.Links), len(want), result.Links)
+	}
+	for i := range want {
+		if result.Links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, result.Links[i], want[i])
+		}
+	}
+	if result.Scanned != 3 || result.Truncated {
+		t.Errorf("Scanned = %d, Truncated = %t, want 3 and false", result.Scanned, result.Truncated)
+	}
+
+	listed := fake.calls(http.MethodGet, "/v1/payment_links")
+	if len(listed) == 0 || listed[0].Form.Get("expand[0]") != "data.line_items" {
+		t.Errorf("links were listed without expanding their line items")
+	}
+}
+
+func TestListByUserStopsAtTheScanLimit(t *testing.T) {
+	fake := newFakeStripe(t)
+	for i := 0; i <= MaxListedLinkScan; i++ {
+		fake.paymentLinks = append(fake.paymentLinks, map[string]interface{}{"id": fmt.Sprintf("plink_%d", i), "object": "payment_link", "metadata": map[string]string{SlackUserMetadataKey: "U2"}})
+	}
+
+	result, err := NewStripeLinkLister("sk_test").ListByUser(context.Background(), "U1", 10)
+	if err != nil {
+		t.Fatalf("ListByUser error: %v", err)
+	}
+	if len(result.Links) != 0 || result.Scanned != MaxListedLinkScan || !result.Truncated {
+		t.Errorf("got %d links after scanning %d (truncated %t), want none after %d, truncated", len(result.Links), result.Scanned, result.Truncated, MaxListedLinkScan)
+	}
+}
@@ -0,0 +1,95 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/promotioncode"
+)
+
+// ErrPromotionCodeUnusable is returned when a promotion code exists but can't be applied to a link
+var ErrPromotionCodeUnusable = errors.New("promotion code can't be used")
+
+// StripePromotionCodes looks up promotion codes so one can be applied to a new payment link
+type StripePromotionCodes struct {
+	apiKey string
+}
+
+// NewStripePromotionCodes creates a promotion code lookup for the account behind apiKey
+func NewStripePromotionCodes(apiKey string) *StripePromotionCodes {
+	return &StripePromotionCodes{apiKey: apiKey}
+}
+
+// Resolve finds the promotion code given either as the code customers type or as its promo_
+// ID, and checks that it's active, not used up and can discount a payment in currency. It
+// returns the customer-facing code, which is what checkout accepts.
+func (p *StripePromotionCodes) Resolve(ctx context.Context, codeOrID, currency string) (string, error) {
+	stripe.Key = p.apiKey
+	codeOrID = strings.TrimSpace(codeOrID)
+
+	var promo *stripe.PromotionCode
+	if strings.HasPrefix(codeOrID, "promo_") {
+		params := &stripe.PromotionCodeParams{}
+		params.Context = ctx
+		found, err := promotioncode.Get(codeOrID, params)
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+			return "", fmt.Errorf("%w: no promotion code has the ID %s", ErrPromotionCodeUnusable, codeOrID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to look up promotion code %s: %w", codeOrID, err)
+		}
+		promo = found
+	} else {
+		params := &stripe.PromotionCodeListParams{Code: stripe.String(codeOrID)}
+		params.Context = ctx
+		params.Limit = stripe.Int64(1)
+		iter := promotioncode.List(params)
+		if iter.Next() {
+			promo = iter.PromotionCode()
+		}
+		if err := iter.Err(); err != nil {
+			return "", fmt.Errorf("failed to look up promotion code %s: %w", codeOrID, err)
+		}
+		if promo == nil {
+			return "", fmt.Errorf("%w: %s isn't a promotion code in this Stripe account", ErrPromotionCodeUnusable, codeOrID)
+		}
+	}
+
+	if err := checkPromotionCode(promo, currency, time.Now()); err != nil {
+		return "", err
+	}
+	return promo.Code, nil
+}
+
+// checkPromotionCode reports why promo can't discount a payment in currency at now, if it can't
+func checkPromotionCode(promo *stripe.PromotionCode, currency string, now time.Time) error {
+	switch {
+	case !promo.Active:
+		return fmt.Errorf("%w: %s is inactive", ErrPromotionCodeUnusable, promo.Code)
+	case promo.ExpiresAt > 0 && now.Unix() >= promo.ExpiresAt:
+		return fmt.Errorf("%w: %s has expired", ErrPromotionCodeUnusable, promo.Code)
+	case promo.MaxRedemptions > 0 && promo.TimesRedeemed >= promo.MaxRedemptions:
+		return fmt.Errorf("%w: %s has been used the maximum number of times", ErrPromotionCodeUnusable, promo.Code)
+	}
+
+	coupon := promo.Coupon
+	if coupon == nil {
+		return nil
+	}
+	if !coupon.Valid {
+		return fmt.Errorf("%w: the coupon behind %s is no longer valid", ErrPromotionCodeUnusable, promo.Code)
+	}
+	// Fixed-amount coupons only apply in their own currency or one they have an amount for
+	if coupon.AmountOff > 0 {
+		cur := strings.ToLower(currency)
+		if _, ok := coupon.CurrencyOptions[cur]; string(coupon.Currency) != cur && !ok {
+			return fmt.Errorf("%w: %s takes a fixed amount off in %s, not %s", ErrPromotionCodeUnusable, promo.Code, strings.ToUpper(string(coupon.Currency)), strings.ToUpper(currency))
+		}
+	}
+	return nil
+}
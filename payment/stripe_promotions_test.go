@@ -0,0 +1,64 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+func TestCheckPromotionCode(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		promo    stripe.PromotionCode
+		currency string
+		wantErr  bool
+	}{
+		{"active percentage coupon", stripe.PromotionCode{Code: "SPRING", Active: true, Coupon: &stripe.Coupon{Valid: true, PercentOff: 10}}, "usd", false},
+		{"no coupon details", stripe.PromotionCode{Code: "SPRING", Active: true}, "usd", false},
+		{"inactive", stripe.PromotionCode{Code: "SPRING"}, "usd", true},
+		{"expired", stripe.PromotionCode{Code: "SPRING", Active: true, ExpiresAt: now.Add(-time.Minute).Unix()}, "usd", true},
+		{"not yet expired", stripe.PromotionCode{Code: "SPRING", Active: true, ExpiresAt: now.Add(time.Hour).Unix()}, "usd", false},
+		{"used up", stripe.PromotionCode{Code: "SPRING", Active: true, MaxRedemptions: 5, TimesRedeemed: 5}, "usd", true},
+		{"uses left", stripe.PromotionCode{Code: "SPRING", Active: true, MaxRedemptions: 5, TimesRedeemed: 4}, "usd", false},
+		{"invalid coupon", stripe.PromotionCode{Code: "SPRING", Active: true, Coupon: &stripe.Coupon{}}, "usd", true},
+		{"fixed amount in the link's currency", stripe.PromotionCode{Code: "FIVE", Active: true, Coupon: &stripe.Coupon{Valid: true, AmountOff: 500, Currency: "usd"}}, "USD", false},
+		{"fixed amount in another currency", stripe.PromotionCode{Code: "FIVE", Active: true, Coupon: &stripe.Coupon{Valid: true, AmountOff: 500, Currency: "usd"}}, "EUR", true},
+		{"fixed amount with a currency option", stripe.PromotionCode{Code: "FIVE", Active: true, Coupon: &stripe.Coupon{Valid: true, AmountOff: 500, Currency: "usd", CurrencyOptions: map[string]*stripe.CouponCurrencyOptions{"eur": {AmountOff: 450}}}}, "EUR", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPromotionCode(&tt.promo, tt.currency, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkPromotionCode error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrPromotionCodeUnusable) {
+				t.Errorf("checkPromotionCode error = %v, want ErrPromotionCodeUnusable", err)
+			}
+		})
+	}
+}
+
+func TestResolvePromotionCode(t *testing.T) {
+	fake := newFakeStripe(t)
+	fake.promoCodes = []map[string]interface{}{
+		{"id": "promo_1", "object": "promotion_code", "code": "SPRING", "active": true, "coupon": map[string]interface{}{"id": "c1", "valid": true, "percent_off": 10}},
+		{"id": "promo_2", "object": "promotion_code", "code": "OLD", "active": false},
+	}
+	promotions := NewStripePromotionCodes("sk_test")
+
+	for _, codeOrID := range []string{"SPRING", " SPRING ", "promo_1"} {
+		code, err := promotions.Resolve(context.Background(), codeOrID, "USD")
+		if err != nil || code != "SPRING" {
+			t.Errorf("Resolve(%q) = %q, %v, want SPRING", codeOrID, code, err)
+		}
+	}
+	for _, codeOrID := range []string{"OLD", "promo_2", "NOPE", "promo_missing"} {
+		if code, err := promotions.Resolve(context.Background(), codeOrID, "USD"); !errors.Is(err, ErrPromotionCodeUnusable) {
+			t.Errorf("Resolve(%q) = %q, %v, want ErrPromotionCodeUnusable", codeOrID, code, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/charge"
+	"github.com/stripe/stripe-go/v82/checkout/session"
+	"github.com/stripe/stripe-go/v82/paymentintent"
+	"github.com/stripe/stripe-go/v82/paymentlink"
+	"github.com/stripe/stripe-go/v82/refund"
+
+	"paymentbot/money"
+	"paymentbot/utils"
+)
+
+var (
+	// ErrPaymentNotFound is returned when the ID doesn't resolve to a refundable payment
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrAlreadyRefunded is returned when the payment has already been fully refunded
+	ErrAlreadyRefunded = errors.New("payment has already been refunded")
+)
+
+// RefundResult describes a refund created through Stripe
+type RefundResult struct {
+	RefundID        string
+	Status          string
+	PaymentIntentID string
+	ChargeID        string
+	Amount          float64
+	Currency        string
+}
+
+// StripeRefunder issues refunds for payments taken through Stripe payment links
+type StripeRefunder struct {
+	apiKey string
+}
+
+// NewStripeRefunder creates a new Stripe refund service
+func NewStripeRefunder(apiKey string) *StripeRefunder {
+	return &StripeRefunder{apiKey: apiKey}
+}
+
+// Refund refunds a payment identified by a PaymentIntent (pi_), Charge (ch_) or payment link (plink_) ID.
+// An amount of 0 refunds the full remaining balance; otherwise a partial refund is issued in the
+// payment's currency.
+func (s *StripeRefunder) Refund(ctx context.Context, id string, amount float64) (*RefundResult, error) {
+	stripe.Key = s.apiKey
+	id = strings.TrimSpace(id)
+
+	params := &stripe.RefundParams{}
+	params.Context = ctx
+
+	var currency string
+	switch {
+	case strings.HasPrefix(id, "ch_"):
+		ch, err := charge.Get(id, &stripe.ChargeParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return nil, mapStripeRefundError(err)
+		}
+		if ch.Refunded {
+			return nil, ErrAlreadyRefunded
+		}
+		params.Charge = stripe.String(ch.ID)
+		currency = string(ch.Currency)
+	default:
+		paymentIntentID := id
+		if strings.HasPrefix(id, "plink_") {
+			resolved, err := s.paymentIntentForLink(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			paymentIntentID = resolved
+		} else if !strings.HasPrefix(id, "pi_") {
+			return nil, fmt.Errorf("%w: '%s' is not a payment intent (pi_), charge (ch_) or payment link (plink_) ID", ErrPaymentNotFound, id)
+		}
+
+		pi, err := paymentintent.Get(paymentIntentID, &stripe.PaymentIntentParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return nil, mapStripeRefundError(err)
+		}
+		if pi.Status != stripe.PaymentIntentStatusSucceeded {
+			return nil, fmt.Errorf("%w: payment %s has status %s", ErrPaymentNotFound, pi.ID, pi.Status)
+		}
+		params.PaymentIntent = stripe.String(pi.ID)
+		currency = string(pi.Currency)
+	}
+
+	if amount > 0 {
+		params.Amount = stripe.Int64(utils.ToMinorUnits(amount, currency))
+	}
+
+	log.Printf("[Stripe] Creating refund for %s (amount: %.2f, full refund: %t)", id, amount, amount <= 0)
+	r, err := refund.New(params)
+	if err != nil {
+		log.Printf("[Stripe] Refund error for %s: %v", id, err)
+		return nil, mapStripeRefundError(err)
+	}
+
+	result := &RefundResult{
+		RefundID: r.ID,
+		Status:   string(r.Status),
+		Amount:   money.Money{Minor: r.Amount, Currency: string(r.Currency)}.Major(),
+		Currency: strings.ToUpper(string(r.Currency)),
+	}
+	if r.PaymentIntent != nil {
+		result.PaymentIntentID = r.PaymentIntent.ID
+	}
+	if r.Charge != nil {
+		result.ChargeID = r.Charge.ID
+	}
+
+	log.Printf("[Stripe] Created refund %s for %s with status %s", r.ID, id, r.Status)
+	return result, nil
+}
+
+// PaymentLinkFor returns the payment link a PaymentIntent (pi_), Charge (ch_) or payment link
+// (plink_) ID was paid through, so callers can check who created it before refunding
+func (s *StripeRefunder) PaymentLinkFor(ctx context.Context, id string) (string, error) {
+	stripe.Key = s.apiKey
+	id = strings.TrimSpace(id)
+
+	paymentIntentID := id
+	switch {
+	case strings.HasPrefix(id, "plink_"):
+		return id, nil
+	case strings.HasPrefix(id, "ch_"):
+		ch, err := charge.Get(id, &stripe.ChargeParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			return "", mapStripeRefundError(err)
+		}
+		if ch.PaymentIntent == nil || ch.PaymentIntent.ID == "" {
+			return "", fmt.Errorf("%w: charge %s wasn't paid through a payment link", ErrPaymentNotFound, id)
+		}
+		paymentIntentID = ch.PaymentIntent.ID
+	case !strings.HasPrefix(id, "pi_"):
+		return "", fmt.Errorf("%w: '%s' is not a payment intent (pi_), charge (ch_) or payment link (plink_) ID", ErrPaymentNotFound, id)
+	}
+
+	params := &stripe.CheckoutSessionListParams{PaymentIntent: stripe.String(paymentIntentID)}
+	params.Context = ctx
+	params.Limit = stripe.Int64(1)
+	params.Single = true
+
+	iter := session.List(params)
+	for iter.Next() {
+		if link := iter.CheckoutSession().PaymentLink; link != nil && link.ID != "" {
+			return link.ID, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return "", mapStripeRefundError(err)
+	}
+	return "", fmt.Errorf("%w: %s wasn't paid through a payment link", ErrPaymentNotFound, id)
+}
+
+// PaymentLinkCreator returns the Slack user who requested linkID, from the metadata stamped on the
+// link when it was created. Links created outside the bot, or by older versions of it, return "".
+func (s *StripeRefunder) PaymentLinkCreator(ctx context.Context, linkID string) (string, error) {
+	stripe.Key = s.apiKey
+
+	link, err := paymentlink.Get(linkID, &stripe.PaymentLinkParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		return "", mapStripeRefundError(err)
+	}
+	return RoutingFromMetadata(link.Metadata).UserID, nil
+}
+
+// paymentIntentForLink finds the PaymentIntent of the most recent completed checkout for a payment link
+func (s *StripeRefunder) paymentIntentForLink(ctx context.Context, linkID string) (string, error) {
+	params := &stripe.CheckoutSessionListParams{
+		PaymentLink: stripe.String(linkID),
+		Status:      stripe.String(string(stripe.CheckoutSessionStatusComplete)),
+	}
+	params.Context = ctx
+	params.Limit = stripe.Int64(1)
+	params.Single = true
+
+	iter := session.List(params)
+	for iter.Next() {
+		sess := iter.CheckoutSession()
+		if sess.PaymentIntent == nil || sess.PaymentIntent.ID == "" {
+			return "", fmt.Errorf("%w: the latest checkout for %s has no one-time payment (subscriptions must be refunded in the Stripe dashboard)", ErrPaymentNotFound, linkID)
+		}
+		return sess.PaymentIntent.ID, nil
+	}
+	if err := iter.Err(); err != nil {
+		return "", mapStripeRefundError(err)
+	}
+	return "", fmt.Errorf("%w: no completed checkout found for payment link %s", ErrPaymentNotFound, linkID)
+}
+
+// mapStripeRefundError translates Stripe API errors into the package's sentinel errors
+func mapStripeRefundError(err error) error {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		switch stripeErr.Code {
+		case stripe.ErrorCodeChargeAlreadyRefunded:
+			return ErrAlreadyRefunded
+		case stripe.ErrorCodeResourceMissing:
+			return fmt.Errorf("%w: %s", ErrPaymentNotFound, stripeErr.Msg)
+		}
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPaymentLinkCreator(t *testing.T) {
+	fake := newFakeStripe(t)
+	fake.paymentLinks = []map[string]interface{}{
+		{"id": "plink_bot", "object": "payment_link", "metadata": map[string]string{SlackUserMetadataKey: "U_OWNER", SlackChannelMetadataKey: "C1"}},
+		{"id": "plink_dashboard", "object": "payment_link", "metadata": map[string]string{}},
+	}
+	refunder := NewStripeRefunder("sk_test")
+
+	tests := []struct {
+		linkID  string
+		want    string
+		wantErr error
+	}{
+		{"plink_bot", "U_OWNER", nil},
+		{"plink_dashboard", "", nil},
+		{"plink_missing", "", ErrPaymentNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.linkID, func(t *testing.T) {
+			got, err := refunder.PaymentLinkCreator(context.Background(), tt.linkID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PaymentLinkCreator(%q) error = %v, want %v", tt.linkID, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PaymentLinkCreator(%q) = %q, want %q", tt.linkID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/subscription"
+
+	"paymentbot/utils"
+)
+
+// MaxReconcileSubscriptions bounds how many subscriptions one reconciliation run pages through
+const MaxReconcileSubscriptions = 1000
+
+// reconcilePageSize is the Stripe list page size (Stripe's maximum)
+const reconcilePageSize = 100
+
+// ReconcileResult summarizes a subscription reconciliation run
+type ReconcileResult struct {
+	Checked   int
+	Truncated bool     // MaxReconcileSubscriptions was reached before the list ended
+	Scheduled []string // subscriptions that now have a cancellation scheduled
+	Overdue   []string // subscriptions whose end time already passed; cancel these manually
+	Failed    []string // subscriptions where the Stripe update failed
+}
+
+// StripeSubscriptionReconciler schedules cancellations the subscription webhook missed
+type StripeSubscriptionReconciler struct {
+	apiKey     string
+	cancelSnap utils.CancelSnap
+}
+
+// NewStripeSubscriptionReconciler creates a reconciler that snaps cancellations like the webhook does
+func NewStripeSubscriptionReconciler(apiKey string, cancelSnap utils.CancelSnap) *StripeSubscriptionReconciler {
+	return &StripeSubscriptionReconciler{apiKey: apiKey, cancelSnap: cancelSnap}
+}
+
+// SubscriptionEndTime returns when sub should be cancelled: end_date_cycles billing periods
+// after its billing cycle anchor, which is when the first paid period started (after any
+// trial). Subscriptions without interval metadata fall back to the end_timestamp estimated
+// when the payment link was created.
+func SubscriptionEndTime(sub *stripe.Subscription) (time.Time, bool) {
+	if sub == nil {
+		return time.Time{}, false
+	}
+	endCycles, err := strconv.ParseInt(sub.Metadata["end_date_cycles"], 10, 64)
+	if err != nil || endCycles <= 0 {
+		return time.Time{}, false
+	}
+
+	anchor := sub.BillingCycleAnchor
+	if anchor == 0 {
+		anchor = sub.StartDate
+	}
+	interval := sub.Metadata["interval"]
+	intervalCount, err := strconv.ParseInt(sub.Metadata["interval_count"], 10, 64)
+	if anchor > 0 && interval != "" && err == nil && intervalCount > 0 {
+		return calculateEndTime(time.Unix(anchor, 0).UTC(), interval, intervalCount, endCycles), true
+	}
+
+	endTimestamp, err := strconv.ParseInt(sub.Metadata["end_timestamp"], 10, 64)
+	if err != nil || endTimestamp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(endTimestamp, 0), true
+}
+
+// MissingCancellation reports whether sub was created with an end_date_cycles limit but has no
+// cancellation scheduled, returning the end timestamp from SubscriptionEndTime
+func MissingCancellation(sub *stripe.Subscription) (int64, bool) {
+	if sub == nil || sub.CancelAt != 0 || sub.CancelAtPeriodEnd {
+		return 0, false
+	}
+	switch sub.Status {
+	case stripe.SubscriptionStatusCanceled, stripe.SubscriptionStatusIncompleteExpired:
+		return 0, false
+	}
+	endTime, ok := SubscriptionEndTime(sub)
+	if !ok {
+		return 0, false
+	}
+	return endTime.Unix(), true
+}
+
+// Reconcile lists subscriptions and schedules cancellation for any MissingCancellation reports.
+// With dryRun set nothing is changed and Scheduled lists what would be scheduled.
+func (r *StripeSubscriptionReconciler) Reconcile(ctx context.Context, dryRun bool) (*ReconcileResult, error) {
+	stripe.Key = r.apiKey
+
+	params := &stripe.SubscriptionListParams{Status: stripe.String("all")}
+	params.Context = ctx
+	params.Limit = stripe.Int64(reconcilePageSize)
+
+	result := &ReconcileResult{}
+	now := time.Now()
+	iter := subscription.List(params)
+	for iter.Next() {
+		if result.Checked >= MaxReconcileSubscriptions {
+			result.Truncated = true
+			break
+		}
+		result.Checked++
+
+		sub := iter.Subscription()
+		endTimestamp, missing := MissingCancellation(sub)
+		if !missing {
+			continue
+		}
+
+		endTime := time.Unix(endTimestamp, 0)
+		if snapped := r.cancelSnap.Apply(endTime); snapped.After(now) {
+			endTime = snapped
+		}
+		if !endTime.After(now) {
+			result.Overdue = append(result.Overdue, sub.ID)
+			continue
+		}
+		if dryRun {
+			result.Scheduled = append(result.Scheduled, sub.ID)
+			continue
+		}
+
+		updateParams := &stripe.SubscriptionParams{CancelAt: stripe.Int64(endTime.Unix())}
+		updateParams.Context = ctx
+		if _, err := subscription.Update(sub.ID, updateParams); err != nil {
+			log.Printf("[Stripe] Failed to schedule cancellation for subscription %s: %v", sub.ID, err)
+			result.Failed = append(result.Failed, sub.ID)
+			continue
+		}
+		log.Printf("[Stripe] Reconciled subscription %s, cancelling at %s", sub.ID, endTime.UTC().Format(time.RFC3339))
+		result.Scheduled = append(result.Scheduled, sub.ID)
+	}
+	if err := iter.Err(); err != nil {
+		return result, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,205 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v82"
+
+	"paymentbot/models"
+	"paymentbot/utils"
+)
+
+func TestSubscriptionEndTime(t *testing.T) {
+	anchor := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	linkEstimate := time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC)
+	metadata := func(pairs ...string) map[string]string {
+		m := map[string]string{"end_timestamp": "1777766400"} // linkEstimate
+		for i := 0; i < len(pairs); i += 2 {
+			m[pairs[i]] = pairs[i+1]
+		}
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		sub    *stripe.Subscription
+		want   time.Time
+		wantOK bool
+	}{
+		{
+			"counts from the billing anchor and clamps",
+			&stripe.Subscription{BillingCycleAnchor: anchor.Unix(), StartDate: anchor.AddDate(0, 0, -14).Unix(),
+				Metadata: metadata("end_date_cycles", "3", "interval", "month", "interval_count", "1")},
+			time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC), true,
+		},
+		{
+			"falls back to the start date without an anchor",
+			&stripe.Subscription{StartDate: anchor.Unix(),
+				Metadata: metadata("end_date_cycles", "1", "interval", "year", "interval_count", "1")},
+			time.Date(2027, 1, 31, 12, 0, 0, 0, time.UTC), true,
+		},
+		{
+			"falls back to the link estimate without interval metadata",
+			&stripe.Subscription{BillingCycleAnchor: anchor.Unix(), Metadata: metadata("end_date_cycles", "3")},
+			linkEstimate, true,
+		},
+		{
+			"no cycle limit",
+			&stripe.Subscription{BillingCycleAnchor: anchor.Unix(), Metadata: metadata("interval", "month", "interval_count", "1")},
+			time.Time{}, false,
+		},
+		{"nil subscription", nil, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SubscriptionEndTime(tt.sub)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("SubscriptionEndTime = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMissingCancellationUsesTheBillingAnchor(t *testing.T) {
+	anchor := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	sub := &stripe.Subscription{
+		Status:             stripe.SubscriptionStatusActive,
+		BillingCycleAnchor: anchor.Unix(),
+		Metadata:           map[string]string{"end_date_cycles": "1", "interval": "month", "interval_count": "1", "end_timestamp": "1"},
+	}
+	endTimestamp, missing := MissingCancellation(sub)
+	if want := time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC).Unix(); !missing || endTimestamp != want {
+		t.Errorf("MissingCancellation = %d, %t, want %d, true", endTimestamp, missing, want)
+	}
+
+	sub.CancelAt = endTimestamp
+	if _, missing := MissingCancellation(sub); missing {
+		t.Error("MissingCancellation with cancel_at set: want false")
+	}
+}
+
+func TestMissingCancellation(t *testing.T) {
+	limited := map[string]string{"end_date_cycles": "3", "interval": "month", "interval_count": "1"}
+	anchor := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC).Unix()
+	tests := []struct {
+		name string
+		sub  *stripe.Subscription
+		want bool
+	}{
+		{"nil", nil, false},
+		{"limited without cancel_at", &stripe.Subscription{Status: stripe.SubscriptionStatusActive, BillingCycleAnchor: anchor, Metadata: limited}, true},
+		{"trialing", &stripe.Subscription{Status: stripe.SubscriptionStatusTrialing, BillingCycleAnchor: anchor, Metadata: limited}, true},
+		{"past due", &stripe.Subscription{Status: stripe.SubscriptionStatusPastDue, BillingCycleAnchor: anchor, Metadata: limited}, true},
+		{"cancel_at already set", &stripe.Subscription{Status: stripe.SubscriptionStatusActive, BillingCycleAnchor: anchor, CancelAt: anchor + 1, Metadata: limited}, false},
+		{"cancelling at period end", &stripe.Subscription{Status: stripe.SubscriptionStatusActive, BillingCycleAnchor: anchor, CancelAtPeriodEnd: true, Metadata: limited}, false},
+		{"already cancelled", &stripe.Subscription{Status: stripe.SubscriptionStatusCanceled, BillingCycleAnchor: anchor, Metadata: limited}, false},
+		{"incomplete expired", &stripe.Subscription{Status: stripe.SubscriptionStatusIncompleteExpired, BillingCycleAnchor: anchor, Metadata: limited}, false},
+		{"unlimited", &stripe.Subscription{Status: stripe.SubscriptionStatusActive, BillingCycleAnchor: anchor, Metadata: map[string]string{"end_date_cycles": "0"}}, false},
+		{"not created by the bot", &stripe.Subscription{Status: stripe.SubscriptionStatusActive, BillingCycleAnchor: anchor}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := MissingCancellation(tt.sub); got != tt.want {
+				t.Errorf("MissingCancellation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileSchedulesMissingCancellations(t *testing.T) {
+	now := time.Now().UTC()
+	missingAnchor := now.AddDate(0, -1, 0)
+	subscription := func(id, status string, anchor time.Time, cycles int, cancelAt int64) map[string]interface{} {
+		sub := map[string]interface{}{
+			"id":                   id,
+			"object":               "subscription",
+			"status":               status,
+			"billing_cycle_anchor": anchor.Unix(),
+			"metadata":             map[string]string{"end_date_cycles": fmt.Sprint(cycles), "interval": "month", "interval_count": "1"},
+		}
+		if cancelAt > 0 {
+			sub["cancel_at"] = cancelAt
+		}
+		return sub
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry run %v", dryRun), func(t *testing.T) {
+			fake := newFakeStripe(t)
+			fake.subscriptions = []map[string]interface{}{
+				subscription("sub_missing", "active", missingAnchor, 12, 0),
+				subscription("sub_overdue", "active", now.AddDate(-2, 0, 0), 1, 0),
+				subscription("sub_scheduled", "active", now.AddDate(0, -1, 0), 12, now.AddDate(1, 0, 0).Unix()),
+				subscription("sub_cancelled", "canceled", now.AddDate(0, -1, 0), 12, 0),
+				{"id": "sub_unlimited", "object": "subscription", "status": "active", "metadata": map[string]string{}},
+			}
+
+			result, err := NewStripeSubscriptionReconciler("sk_test", utils.CancelSnap{}).Reconcile(context.Background(), dryRun)
+			if err != nil {
+				t.Fatalf("Reconcile error: %v", err)
+			}
+			if result.Checked != 5 || result.Truncated {
+				t.Errorf("checked %d (truncated %v), want all 5", result.Checked, result.Truncated)
+			}
+			if len(result.Scheduled) != 1 || result.Scheduled[0] != "sub_missing" {
+				t.Errorf("Scheduled = %v, want [sub_missing]", result.Scheduled)
+			}
+			if len(result.Overdue) != 1 || result.Overdue[0] != "sub_overdue" {
+				t.Errorf("Overdue = %v, want [sub_overdue]", result.Overdue)
+			}
+
+			updates := fake.calls(http.MethodPost, "/v1/subscriptions/sub_missing")
+			if dryRun {
+				if len(updates) != 0 {
+					t.Errorf("dry run updated %d subscriptions", len(updates))
+				}
+				return
+			}
+			if len(updates) != 1 || updates[0].Form.Get("cancel_at") == "" {
+				t.Fatalf("updates to sub_missing = %v, want one setting cancel_at", updates)
+			}
+			want := fmt.Sprint(calculateEndTime(time.Unix(missingAnchor.Unix(), 0).UTC(), "month", 1, 12).Unix())
+			if updates[0].Form.Get("cancel_at") != want {
+				t.Errorf("cancel_at = %s, want %s (12 months after the anchor)", updates[0].Form.Get("cancel_at"), want)
+			}
+		})
+	}
+}
+
+func TestReconcileStopsAtTheLimit(t *testing.T) {
+	fake := newFakeStripe(t)
+	for i := 0; i < MaxReconcileSubscriptions+5; i++ {
+		fake.subscriptions = append(fake.subscriptions, map[string]interface{}{"id": fmt.Sprintf("sub_%d", i), "object": "subscription", "status": "active"})
+	}
+
+	result, err := NewStripeSubscriptionReconciler("sk_test", utils.CancelSnap{}).Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Reconcile error: %v", err)
+	}
+	if result.Checked != MaxReconcileSubscriptions || !result.Truncated {
+		t.Errorf("checked %d (truncated %v), want %d and truncated", result.Checked, result.Truncated, MaxReconcileSubscriptions)
+	}
+	if lists := fake.calls(http.MethodGet, "/v1/subscriptions"); len(lists) != 1 || lists[0].Form.Get("limit") != "100" {
+		t.Errorf("list requests = %v, want one page of 100", lists)
+	}
+}
+
+func TestLinkMetadataSchedulesTheSubscriptionEnd(t *testing.T) {
+	// A link whose end date came from the configured default carries the same metadata as one typed in
+	data := &models.PaymentLinkData{IsSubscription: true, Interval: "month", IntervalCount: 1, EndDateCycles: 12}
+	params := (&StripeGenerator{}).buildPaymentLinkParams(data, nil)
+
+	anchor := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	sub := &stripe.Subscription{BillingCycleAnchor: anchor.Unix(), Metadata: params.SubscriptionData.Metadata}
+	end, ok := SubscriptionEndTime(sub)
+	if want := time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC); !ok || !end.Equal(want) {
+		t.Errorf("SubscriptionEndTime = %s, %v, want %s", end, ok, want)
+	}
+	if at, missing := MissingCancellation(sub); !missing || at != end.Unix() {
+		t.Errorf("MissingCancellation = %d, %v, want the end scheduled at %d", at, missing, end.Unix())
+	}
+}
@@ -0,0 +1,59 @@
+package payment
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"paymentbot/utils"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// NewProviderTransport returns the transport used for outbound provider API calls. An empty
+// proxyURL keeps the standard HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment handling; otherwise
+// every request goes through proxyURL. A non-nil rootCAs replaces the trusted certificates.
+func NewProviderTransport(proxyURL string, rootCAs *x509.CertPool) (*http.Transport, error) {
+	transport := utils.NewTransport(rootCAs)
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	return transport, nil
+}
+
+// WithTransport sends Airwallex API calls through transport (e.g. a proxy), keeping the client timeout
+func WithTransport(transport http.RoundTripper) AirwallexOption {
+	return func(a *AirwallexGenerator) {
+		client := *a.client
+		client.Transport = transport
+		a.client = &client
+	}
+}
+
+// WithTimeout overrides the per-request timeout for Airwallex API calls
+func WithTimeout(timeout time.Duration) AirwallexOption {
+	return func(a *AirwallexGenerator) {
+		client := *a.client
+		client.Timeout = timeout
+		a.client = &client
+	}
+}
+
+// ConfigureStripeBackend routes all Stripe SDK calls through transport with the given timeout,
+// and to baseURL instead of api.stripe.com when set (e.g. stripe-mock). The SDK keeps its
+// backends globally, so this affects every Stripe generator, refunder and validator.
+func ConfigureStripeBackend(transport http.RoundTripper, timeout time.Duration, baseURL string) {
+	backendConfig := &stripe.BackendConfig{
+		HTTPClient: &http.Client{Timeout: timeout, Transport: transport},
+	}
+	if baseURL != "" {
+		backendConfig.URL = stripe.String(baseURL)
+	}
+	stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(stripe.APIBackend, backendConfig))
+}
@@ -0,0 +1,171 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+// fakeProxy is a plain HTTP proxy that answers requests itself, recording the hosts they were for
+type fakeProxy struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func newFakeProxy(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *fakeProxy) {
+	t.Helper()
+	p := &fakeProxy{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.hosts = append(p.hosts, r.URL.Host)
+		p.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, p
+}
+
+func (p *fakeProxy) proxiedHosts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+func TestNewProviderTransport(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://api.airwallex.com/api/v1/authentication/login", nil)
+
+	transport, err := NewProviderTransport("http://proxy.internal:3128", nil)
+	if err != nil {
+		t.Fatalf("NewProviderTransport error: %v", err)
+	}
+	proxy, err := transport.Proxy(req)
+	if err != nil || proxy == nil || proxy.String() != "http://proxy.internal:3128" {
+		t.Errorf("proxy for %s = %v, %v, want http://proxy.internal:3128", req.URL, proxy, err)
+	}
+
+	if transport, err := NewProviderTransport("", nil); err != nil || transport.Proxy == nil {
+		t.Errorf("NewProviderTransport without a proxy = %v, %v, want the environment's proxy settings", transport, err)
+	}
+	for _, raw := range []string{"proxy.internal:3128", "://bad"} {
+		if _, err := NewProviderTransport(raw, nil); err == nil {
+			t.Errorf("NewProviderTransport(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestAirwallexCallsUseTheConfiguredTransport(t *testing.T) {
+	server, proxy := newFakeProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case authPath:
+			w.Write([]byte(authOK))
+		case createPath:
+			w.Write([]byte(createOK))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	transport, err := NewProviderTransport(server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewProviderTransport error: %v", err)
+	}
+	generator := NewAirwallexGenerator("client", "key", "http://airwallex.test", AirwallexBranding{},
+		WithTransport(transport), WithTimeout(5*time.Second))
+
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	if _, _, err := generator.GenerateLink(context.Background(), data); err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	hosts := proxy.proxiedHosts()
+	if len(hosts) != 2 || hosts[0] != "airwallex.test" || hosts[1] != "airwallex.test" {
+		t.Errorf("proxied hosts = %v, want the login and create calls to airwallex.test", hosts)
+	}
+}
+
+func TestStripeCallsUseTheConfiguredTransport(t *testing.T) {
+	fake := &fakeStripe{products: map[string]string{}, prices: map[string]int64{}}
+	server, proxy := newFakeProxy(t, fake.serve)
+	transport, err := NewProviderTransport(server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewProviderTransport error: %v", err)
+	}
+	ConfigureStripeBackend(transport, 5*time.Second, "http://stripe.test")
+	t.Cleanup(func() { stripe.SetBackend(stripe.APIBackend, nil) })
+
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err != nil {
+		t.Fatalf("GenerateLink error: %v", err)
+	}
+	hosts := proxy.proxiedHosts()
+	if len(hosts) == 0 {
+		t.Fatal("no Stripe calls went through the proxy")
+	}
+	for _, host := range hosts {
+		if host != "stripe.test" {
+			t.Errorf("proxied a request for %q, want stripe.test", host)
+		}
+	}
+	if links := fake.calls(http.MethodPost, "/v1/payment_links"); len(links) != 1 {
+		t.Errorf("%d payment links created through the proxy, want 1", len(links))
+	}
+}
+
+// newSlowServer answers every request after delay, or sooner if the client gives up
+func newSlowServer(t *testing.T, delay time.Duration, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			handler(w, r)
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAirwallexTimeout(t *testing.T) {
+	server := newSlowServer(t, 200*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case authPath:
+			w.Write([]byte(authOK))
+		case createPath:
+			w.Write([]byte(createOK))
+		}
+	})
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	newGenerator := func(timeout time.Duration) PaymentLinkGenerator {
+		return NewAirwallexGenerator("client", "key", server.URL, AirwallexBranding{},
+			WithTimeout(timeout), WithRetryPolicy(RetryPolicy{}))
+	}
+
+	if _, _, err := newGenerator(20*time.Millisecond).GenerateLink(context.Background(), data); err == nil {
+		t.Error("GenerateLink against a slow server succeeded with a 20ms timeout, want a timeout error")
+	}
+	if _, _, err := newGenerator(5*time.Second).GenerateLink(context.Background(), data); err != nil {
+		t.Errorf("GenerateLink with a 5s timeout error: %v", err)
+	}
+}
+
+func TestStripeBackendTimeout(t *testing.T) {
+	fake := &fakeStripe{products: map[string]string{}, prices: map[string]int64{}}
+	server := newSlowServer(t, 200*time.Millisecond, fake.serve)
+	t.Cleanup(func() { stripe.SetBackend(stripe.APIBackend, nil) })
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+
+	ConfigureStripeBackend(http.DefaultTransport, 20*time.Millisecond, server.URL)
+	if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err == nil {
+		t.Error("GenerateLink against a slow server succeeded with a 20ms timeout, want a timeout error")
+	}
+
+	ConfigureStripeBackend(http.DefaultTransport, 5*time.Second, server.URL)
+	if _, _, err := NewStripeGenerator("sk_test").GenerateLink(context.Background(), data); err != nil {
+		t.Errorf("GenerateLink with a 5s timeout error: %v", err)
+	}
+}
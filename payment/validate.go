@@ -0,0 +1,60 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/balance"
+
+	"paymentbot/tracing"
+)
+
+// CredentialValidator is implemented by generators that can check their credentials
+// against the provider without creating anything
+type CredentialValidator interface {
+	ValidateCredentials(ctx context.Context) error
+}
+
+// ValidateCredentials checks the API key by fetching the account balance, which any
+// secret or restricted key with read access can do
+func (s *StripeGenerator) ValidateCredentials(ctx context.Context) error {
+	stripe.Key = s.apiKey
+
+	ctx, span := tracing.StartClientSpan(ctx, "stripe.balance.get")
+	defer span.End()
+
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	if _, err := balance.Get(params); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("stripe rejected the API key: %w", err)
+	}
+	return nil
+}
+
+// ValidateCredentials logs in to Airwallex. A successful token is cached for the first payment link.
+func (a *AirwallexGenerator) ValidateCredentials(ctx context.Context) error {
+	if _, err := a.getToken(ctx); err != nil {
+		return fmt.Errorf("airwallex login against %s failed: %w", a.baseURL, err)
+	}
+	return nil
+}
+
+// ValidateProviders checks each provider's credentials and logs the outcome. Failures are
+// only logged so a misconfigured provider doesn't stop the server from starting.
+func ValidateProviders(ctx context.Context, generators map[string]PaymentLinkGenerator) {
+	for name, generator := range generators {
+		validator, ok := generator.(CredentialValidator)
+		if !ok {
+			log.Printf("[Startup] %s: credential check not supported, skipping", name)
+			continue
+		}
+		if err := validator.ValidateCredentials(ctx); err != nil {
+			log.Printf("[Startup] %s: credential check FAILED: %v", name, err)
+			continue
+		}
+		log.Printf("[Startup] %s: credentials OK", name)
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"paymentbot/payment"
+
+	"github.com/slack-go/slack"
+)
+
+// adminAlertTimeout bounds the background post so a slow Slack API can't pile up goroutines
+const adminAlertTimeout = 10 * time.Second
+
+// newErrorReference returns a short ID that links the message a user sees to the admin alert
+func newErrorReference() string {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return "ERR-" + hex.EncodeToString(buf)
+}
+
+// reportErrorToAdmins logs err with full provider detail and, when ADMIN_ALERT_CHANNEL is set,
+// posts it there. It returns a reference the user can quote without seeing the detail.
+func (s *SlackService) reportErrorToAdmins(summary, userID, channelID string, err error) string {
+	reference := newErrorReference()
+	detail := payment.ErrorDetail(err)
+	s.logger.Error(summary, "reference", reference, "user_id", userID, "channel_id", channelID, "detail", detail)
+
+	if s.adminAlertChannel == "" {
+		return reference
+	}
+
+	text := fmt.Sprintf(":rotating_light: *%s* (`%s`)\nRequested by <@%s> in <#%s>\n```%s```", summary, reference, userID, channelID, detail)
+	// Posted in the background so the modal response isn't delayed
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), adminAlertTimeout)
+		defer cancel()
+		if _, _, err := s.client.PostMessageContext(ctx, s.adminAlertChannel, slack.MsgOptionText(text, false)); err != nil {
+			s.logger.Error("Failed to post admin alert", "reference", reference, "admin_channel", s.adminAlertChannel, "error", err)
+		}
+	}()
+	return reference
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+)
+
+// failingGenerator fails every link with err
+type failingGenerator struct{ err error }
+
+func (g failingGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
+	return "", "", g.err
+}
+
+func TestLinkFailureDetailGoesToAdminsOnly(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	providerErr := &payment.ProviderError{
+		Provider:   "Airwallex",
+		Operation:  "payment link creation",
+		StatusCode: 400,
+		Code:       "validation_error",
+		Message:    "amount must be positive",
+		RequestID:  "trace-123",
+		Body:       `{"code":"validation_error"}`,
+	}
+	s := &SlackService{
+		client:             client,
+		airwallexGenerator: failingGenerator{err: providerErr},
+		adminAlertChannel:  "C_ADMIN",
+		linkWorkers:        newLinkWorkers(1),
+		logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	if !s.createLinkInBackground(context.Background(), models.ProviderAirwallex, data, "U1", "C1") {
+		t.Fatal("link job wasn't queued")
+	}
+	if err := s.DrainLinkJobs(context.Background()); err != nil {
+		t.Fatalf("DrainLinkJobs error: %v", err)
+	}
+
+	userMessage := slackAPI.waitForPost(t, "chat.postEphemeral", "C1")
+	adminMessage := slackAPI.waitForPost(t, "chat.postMessage", "C_ADMIN")
+
+	if userMessage.User != "U1" {
+		t.Errorf("failure shown to %q, want U1", userMessage.User)
+	}
+	for _, detail := range []string{"validation_error", "trace-123", "amount must be positive"} {
+		if strings.Contains(userMessage.Text, detail) {
+			t.Errorf("user message %q shows provider detail %q", userMessage.Text, detail)
+		}
+		if !strings.Contains(adminMessage.Text, detail) {
+			t.Errorf("admin alert %q is missing %q", adminMessage.Text, detail)
+		}
+	}
+
+	// Both messages carry the same reference so admins can find the user's failure
+	start := strings.Index(userMessage.Text, "ERR-")
+	if start < 0 {
+		t.Fatalf("user message %q has no error reference", userMessage.Text)
+	}
+	reference := strings.TrimSuffix(strings.Fields(userMessage.Text[start:])[0], ".")
+	if !strings.Contains(adminMessage.Text, reference) {
+		t.Errorf("admin alert %q doesn't mention reference %s", adminMessage.Text, reference)
+	}
+}
+
+func TestReportErrorToAdminsWithoutAnAlertChannel(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	s := &SlackService{client: client, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	if reference := s.reportErrorToAdmins("Failed", "U1", "C1", errors.New("boom")); !strings.HasPrefix(reference, "ERR-") {
+		t.Errorf("reference = %q, want an ERR- reference", reference)
+	}
+	// Give a stray background post the chance to show up
+	time.Sleep(20 * time.Millisecond)
+	if calls := slackAPI.calls(); len(calls) != 0 {
+		t.Errorf("posted %v with no admin channel configured", calls)
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit record kinds
+const (
+	AuditPaymentLink = "payment_link"
+	AuditInvoice     = "invoice"
+)
+
+// AuditRecord is the compliance record kept for every payment link and invoice created
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Kind      string    `json:"kind"`
+	User      string    `json:"user"`
+	Team      string    `json:"team,omitempty"`
+	Channel   string    `json:"channel"`
+	Provider  string    `json:"provider,omitempty"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	Reference string    `json:"reference,omitempty"`
+	ID        string    `json:"id"` // provider link/payment ID, or the invoice number
+	Link      string    `json:"link,omitempty"`
+}
+
+// AuditSink persists audit records
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// FileAuditSink appends audit records to a JSON Lines file, one record per line
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens (or creates) the JSON Lines audit log at path for appending
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// Record appends record to the log and syncs it to disk
+func (f *FileAuditSink) Record(ctx context.Context, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	data = append(data, '\n')
+
+	// One write per record keeps lines whole even if another process appends too
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (f *FileAuditSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// UseAuditSink records every link and invoice created to sink
+func (s *SlackService) UseAuditSink(sink AuditSink) {
+	s.audit = sink
+}
+
+// recordAudit writes record to the audit sink, if any. A failure is logged but never
+// blocks the user, who already has their link or invoice.
+func (s *SlackService) recordAudit(ctx context.Context, record AuditRecord) {
+	if s.audit == nil {
+		return
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+	if record.Team == "" {
+		record.Team = teamIDFrom(ctx)
+	}
+	if err := s.audit.Record(ctx, record); err != nil {
+		s.logger.Error("Error writing audit record", "kind", record.Kind, "id", record.ID, "user_id", record.User, "error", err)
+	}
+}
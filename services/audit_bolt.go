@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var auditBucket = []byte("audit_records")
+
+// BoltAuditSink keeps audit records in a bolt database, keyed by a sequence number so they
+// read back in the order they were written. Every record is committed and synced to disk
+// before Record returns. The database is locked to one process, so replicas can't share it.
+type BoltAuditSink struct {
+	db *bolt.DB
+}
+
+// NewBoltAuditSink opens (or creates) the audit database at path
+func NewBoltAuditSink(path string) (*BoltAuditSink, error) {
+	// Waiting forever for the file lock would hang startup if another process holds it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(auditBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize audit database %s: %w", path, err)
+	}
+	return &BoltAuditSink{db: db}, nil
+}
+
+// Record stores record under the next sequence number
+func (b *BoltAuditSink) Record(ctx context.Context, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	if err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(auditBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		// Big-endian keys sort numerically, so a cursor walks the records in order
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, data)
+	}); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Records returns every stored record, oldest first
+func (b *BoltAuditSink) Records(ctx context.Context) ([]AuditRecord, error) {
+	var records []AuditRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(key, value []byte) error {
+			var record AuditRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("invalid audit record %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+	return records, nil
+}
+
+// Close releases the database and its file lock
+func (b *BoltAuditSink) Close() error {
+	return b.db.Close()
+}
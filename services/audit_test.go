@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/shortener"
+)
+
+// recordingAuditSink keeps the records written to it, or fails with err
+type recordingAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	err     error
+}
+
+func (r *recordingAuditSink) Record(ctx context.Context, record AuditRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return r.err
+}
+
+func TestPaymentLinkIsAudited(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	sink := &recordingAuditSink{}
+	s := &SlackService{
+		client:       client,
+		urlShortener: shortener.NewNoopShortener(),
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	s.UseAuditSink(sink)
+
+	ctx := context.WithValue(context.Background(), teamIDContextKey{}, "T1")
+	data := &models.PaymentLinkData{Amount: 42.5, Currency: "EUR", ServiceName: "Hosting", ReferenceNumber: "REF-7"}
+	before := time.Now().UTC()
+	s.deliverPaymentLink(ctx, models.ProviderStripe, data, "https://buy.stripe.com/test_1", "plink_1", "U1", "C1")
+
+	slackAPI.waitForPost(t, "chat.postMessage", "C1")
+	if len(sink.records) != 1 {
+		t.Fatalf("wrote %d audit records, want 1", len(sink.records))
+	}
+	got := sink.records[0]
+	want := AuditRecord{
+		Timestamp: got.Timestamp,
+		Kind:      AuditPaymentLink,
+		User:      "U1",
+		Team:      "T1",
+		Channel:   "C1",
+		Provider:  "stripe",
+		Amount:    42.5,
+		Currency:  "EUR",
+		Reference: "REF-7",
+		ID:        "plink_1",
+		Link:      "https://buy.stripe.com/test_1",
+	}
+	if got != want {
+		t.Errorf("audit record = %+v, want %+v", got, want)
+	}
+	if got.Timestamp.Before(before) || got.Timestamp.Location() != time.UTC {
+		t.Errorf("audit timestamp = %v, want a UTC time after %v", got.Timestamp, before)
+	}
+}
+
+func TestAuditFailureDoesntBlockTheLink(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	sink := &recordingAuditSink{err: errors.New("disk full")}
+	s := &SlackService{
+		client:       client,
+		urlShortener: shortener.NewNoopShortener(),
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	s.UseAuditSink(sink)
+
+	data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+	s.deliverPaymentLink(context.Background(), models.ProviderAirwallex, data, "https://pay.airwallex.com/link_1", "link_1", "U1", "C1")
+	slackAPI.waitForPost(t, "chat.postMessage", "C1")
+	if len(sink.records) != 1 {
+		t.Errorf("attempted %d audit records, want 1", len(sink.records))
+	}
+}
+
+func TestFileAuditSinkWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	records := []AuditRecord{
+		{Timestamp: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), Kind: AuditPaymentLink, User: "U1", Team: "T1", Channel: "C1", Provider: "stripe", Amount: 10, Currency: "USD", ID: "plink_1", Link: "https://buy.stripe.com/test_1"},
+		{Timestamp: time.Date(2026, 10, 16, 9, 5, 0, 0, time.UTC), Kind: AuditInvoice, User: "U2", Channel: "C2", Amount: 137.5, Currency: "GBP", ID: "1001"},
+	}
+
+	// Records from an earlier run are kept
+	for _, record := range records {
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("NewFileAuditSink error: %v", err)
+		}
+		if err := sink.Record(context.Background(), record); err != nil {
+			t.Fatalf("Record error: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var got []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q isn't a JSON record: %v", scanner.Text(), err)
+		}
+		got = append(got, record)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("read %d records, want %d", len(got), len(records))
+	}
+	for i := range records {
+		if !got[i].Timestamp.Equal(records[i].Timestamp) {
+			t.Errorf("record %d timestamp = %v, want %v", i, got[i].Timestamp, records[i].Timestamp)
+		}
+		got[i].Timestamp = records[i].Timestamp
+		if got[i] != records[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], records[i])
+		}
+	}
+}
+
+func TestBoltAuditSinkKeepsRecordsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	var records []AuditRecord
+	for i := 0; i < 300; i++ {
+		records = append(records, AuditRecord{Timestamp: time.Date(2026, 10, 16, 9, 0, i, 0, time.UTC), Kind: AuditPaymentLink, User: "U1", Channel: "C1", Provider: "stripe", Amount: float64(i + 1), Currency: "USD", ID: fmt.Sprintf("plink_%d", i)})
+	}
+
+	// Records from an earlier run are kept, and later ones are stored after them
+	for _, batch := range [][]AuditRecord{records[:1], records[1:]} {
+		sink, err := NewBoltAuditSink(path)
+		if err != nil {
+			t.Fatalf("NewBoltAuditSink error: %v", err)
+		}
+		for _, record := range batch {
+			if err := sink.Record(context.Background(), record); err != nil {
+				t.Fatalf("Record error: %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+	}
+
+	sink, err := NewBoltAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewBoltAuditSink error: %v", err)
+	}
+	defer sink.Close()
+	got, err := sink.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records error: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("read %d records, want %d", len(got), len(records))
+	}
+	for i := range records {
+		if !got[i].Timestamp.Equal(records[i].Timestamp) {
+			t.Errorf("record %d timestamp = %v, want %v", i, got[i].Timestamp, records[i].Timestamp)
+		}
+		got[i].Timestamp = records[i].Timestamp
+		if got[i] != records[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], records[i])
+		}
+	}
+}
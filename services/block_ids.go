@@ -0,0 +1,114 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxSlackIDLength is Slack's limit for block_id and action_id values
+	maxSlackIDLength = 255
+	// maxModalBlocks is the most blocks Slack accepts in a modal view
+	maxModalBlocks = 100
+)
+
+// blockID builds a block_id or action_id from a base name and optional indexes, e.g.
+// blockID("service_input", 2) returns "service_input_2". IDs over Slack's length limit are
+// truncated and suffixed with a hash of the full ID so distinct inputs stay distinct.
+func blockID(base string, indexes ...int) string {
+	var sb strings.Builder
+	sb.WriteString(base)
+	for _, index := range indexes {
+		sb.WriteByte('_')
+		sb.WriteString(strconv.Itoa(index))
+	}
+	id := sb.String()
+	if len(id) <= maxSlackIDLength {
+		return id
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	suffix := "_" + hex.EncodeToString(sum[:6])
+	return id[:maxSlackIDLength-len(suffix)] + suffix
+}
+
+// validateModalView checks a modal against Slack's limits before it is opened, so an
+// oversized view fails with a clear error instead of Slack's generic invalid_arguments.
+func validateModalView(view slack.ModalViewRequest) error {
+	if count := len(view.Blocks.BlockSet); count > maxModalBlocks {
+		return fmt.Errorf("modal has %d blocks, Slack allows at most %d", count, maxModalBlocks)
+	}
+
+	seen := make(map[string]bool)
+	for _, block := range view.Blocks.BlockSet {
+		id := slackIDs(block).BlockID
+		if id == "" {
+			continue
+		}
+		if len(id) > maxSlackIDLength {
+			return fmt.Errorf("block_id %.40q... is longer than %d characters", id, maxSlackIDLength)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate block_id %q", id)
+		}
+		seen[id] = true
+
+		if err := validateActionIDs(block); err != nil {
+			return fmt.Errorf("block %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// validateActionIDs checks that the action_ids inside one block are unique and within the
+// length limit. Slack only requires uniqueness per block, so ids may repeat across blocks.
+func validateActionIDs(block slack.Block) error {
+	var elements []slack.BlockElement
+	switch b := block.(type) {
+	case *slack.InputBlock:
+		elements = []slack.BlockElement{b.Element}
+	case *slack.ActionBlock:
+		if b.Elements != nil {
+			elements = b.Elements.ElementSet
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, element := range elements {
+		id := slackIDs(element).ActionID
+		if id == "" {
+			continue
+		}
+		if len(id) > maxSlackIDLength {
+			return fmt.Errorf("action_id %.40q... is longer than %d characters", id, maxSlackIDLength)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate action_id %q", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+type blockIDs struct {
+	BlockID  string `json:"block_id"`
+	ActionID string `json:"action_id"`
+}
+
+// slackIDs reads the block_id and action_id of a block or element. slack-go has no common
+// accessor for them, so the value is round-tripped through its JSON form.
+func slackIDs(v interface{}) blockIDs {
+	var ids blockIDs
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return ids
+	}
+	_ = json.Unmarshal(raw, &ids)
+	return ids
+}
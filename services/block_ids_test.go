@@ -0,0 +1,100 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+func TestBlockID(t *testing.T) {
+	tests := []struct {
+		base    string
+		indexes []int
+		want    string
+	}{
+		{"service_block", nil, "service_block"},
+		{"service_input", []int{2}, "service_input_2"},
+		{"line_item", []int{1, 12}, "line_item_1_12"},
+	}
+	for _, tt := range tests {
+		if got := blockID(tt.base, tt.indexes...); got != tt.want {
+			t.Errorf("blockID(%q, %v) = %q, want %q", tt.base, tt.indexes, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("x", 300)
+	first, second := blockID(long, 1), blockID(long, 2)
+	if len(first) != maxSlackIDLength || len(second) != maxSlackIDLength {
+		t.Errorf("long IDs are %d and %d characters, want %d", len(first), len(second), maxSlackIDLength)
+	}
+	if first == second {
+		t.Error("long IDs that differ only after the limit collide")
+	}
+	if blockID(long, 1) != first {
+		t.Error("blockID isn't stable for the same input")
+	}
+}
+
+func inputBlock(blockID, actionID string) *slack.InputBlock {
+	element := slack.NewPlainTextInputBlockElement(nil, actionID)
+	return slack.NewInputBlock(blockID, newPlainTextBlock("Field"), nil, element)
+}
+
+func TestValidateModalView(t *testing.T) {
+	withBlocks := func(blocks ...slack.Block) slack.ModalViewRequest {
+		return slack.ModalViewRequest{Type: slack.VTModal, Blocks: slack.Blocks{BlockSet: blocks}}
+	}
+	tooMany := make([]slack.Block, maxModalBlocks+1)
+	for i := range tooMany {
+		tooMany[i] = slack.NewDividerBlock()
+	}
+	atLimit := tooMany[:maxModalBlocks]
+	action := slack.NewActionBlock("actions",
+		slack.NewButtonBlockElement("add_row", "add", newPlainTextBlock("Add")),
+		slack.NewButtonBlockElement("add_row", "add", newPlainTextBlock("Add again")))
+
+	tests := []struct {
+		name    string
+		view    slack.ModalViewRequest
+		wantErr string
+	}{
+		{"valid", withBlocks(inputBlock("a_block", "input"), inputBlock("b_block", "input")), ""},
+		{"at the block limit", withBlocks(atLimit...), ""},
+		{"too many blocks", withBlocks(tooMany...), "101 blocks"},
+		{"duplicate block_id", withBlocks(inputBlock("a_block", "a"), inputBlock("a_block", "b")), "duplicate block_id"},
+		{"block_id too long", withBlocks(inputBlock(strings.Repeat("b", 256), "a")), "longer than"},
+		{"action_id too long", withBlocks(inputBlock("a_block", strings.Repeat("a", 256))), "longer than"},
+		{"duplicate action_id in a block", withBlocks(action), "duplicate action_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateModalView(tt.view)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateModalView error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateModalView error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltModalsPassValidation(t *testing.T) {
+	views := map[string]slack.ModalViewRequest{
+		"Stripe payment":    BuildPaymentModalView(models.ProviderStripe, "C1", PaymentModalDefaults{}),
+		"Airwallex payment": BuildPaymentModalView(models.ProviderAirwallex, "C1", PaymentModalDefaults{}),
+		"donation":          BuildDonationModalView("C1"),
+		"invoice":           BuildInvoiceModalView("C1", "1001"),
+	}
+	for name, view := range views {
+		if err := validateModalView(view); err != nil {
+			t.Errorf("%s modal: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+// recordingGenerator keeps the link data it was asked for and fails, so nothing is delivered
+type recordingGenerator struct {
+	mu   sync.Mutex
+	data []*models.PaymentLinkData
+}
+
+func (g *recordingGenerator) GenerateLink(ctx context.Context, data *models.PaymentLinkData) (string, string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.data = append(g.data, data)
+	return "", "", errors.New("not creating links in tests")
+}
+
+func TestProcessDonationSubmission(t *testing.T) {
+	tests := []struct {
+		name        string
+		suggested   string
+		minimum     string
+		wantError   string
+		wantAmount  float64
+		wantMinimum float64
+	}{
+		{"donor chooses", "", "", "", 0, 0},
+		{"suggestion and minimum", "25", "5", "", 25, 5},
+		{"suggestion below minimum", "5", "25", "amount_block", 0, 0},
+		{"invalid minimum", "", "-3", "donation_minimum_block", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newFakeSlack(t)
+			generator := &recordingGenerator{}
+			s := &SlackService{
+				client:          client,
+				stripeGenerator: generator,
+				linkWorkers:     newLinkWorkers(1),
+				logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			interaction := &slack.InteractionCallback{
+				User: slack.User{ID: "U1"},
+				View: slack.View{
+					CallbackID:      DonationModalCallbackID,
+					PrivateMetadata: "C1",
+					State: &slack.ViewState{Values: modalValues{
+						"service_block":          {"service_input": {Value: "Food bank"}},
+						"currency_block":         {"currency_select": {SelectedOption: slack.OptionBlockObject{Value: "USD"}}},
+						"amount_block":           {"amount_input": {Value: tt.suggested}},
+						"donation_minimum_block": {"donation_minimum_input": {Value: tt.minimum}},
+					}},
+				},
+			}
+			rec := httptest.NewRecorder()
+			s.ProcessDonationSubmission(context.Background(), rec, interaction)
+			if err := s.DrainLinkJobs(context.Background()); err != nil {
+				t.Fatalf("DrainLinkJobs error: %v", err)
+			}
+
+			if tt.wantError != "" {
+				var resp slack.ViewSubmissionResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Errors[tt.wantError] == "" {
+					t.Errorf("response = %s, want an error on %s", rec.Body.String(), tt.wantError)
+				}
+				if len(generator.data) != 0 {
+					t.Error("created a link for an invalid donation")
+				}
+				return
+			}
+			if len(generator.data) != 1 {
+				t.Fatalf("%d links requested, want 1 (response %s)", len(generator.data), rec.Body.String())
+			}
+			data := generator.data[0]
+			if !data.Donation || !data.SkipSaveCard || data.IsSubscription {
+				t.Errorf("link data = %+v, want a one-time donation that doesn't save the card", data)
+			}
+			if data.Amount != tt.wantAmount || data.DonationMinimum != tt.wantMinimum {
+				t.Errorf("suggested %v minimum %v, want %v and %v", data.Amount, data.DonationMinimum, tt.wantAmount, tt.wantMinimum)
+			}
+			if data.SlackChannelID != "C1" {
+				t.Errorf("channel = %q, want C1 from the modal", data.SlackChannelID)
+			}
+		})
+	}
+}
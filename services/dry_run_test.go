@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"paymentbot/config"
+	"paymentbot/models"
+	"paymentbot/payment"
+	"paymentbot/shortener"
+)
+
+func TestDryRunTurnsOffStripeFeatures(t *testing.T) {
+	const dryRunReply = "This isn't available while DRY_RUN is set, so nothing is read from or changed at Stripe."
+	client, slackAPI := newFakeSlack(t)
+	cfg := &config.Config{StripeAPIKey: "sk_live_123", DryRun: true, AdminUserIDs: []string{"U1"}}
+	s := NewSlackService(cfg, client, payment.NewDryRunGenerator(models.ProviderStripe), nil, shortener.NewNoopShortener(), nil, nil, nil)
+
+	if s.refunder != nil || s.reconciler != nil || s.linkLister != nil || s.linkExpirer != nil || s.promotionCodes != nil {
+		t.Fatal("DRY_RUN left a Stripe feature that calls the real API enabled")
+	}
+
+	ctx := context.Background()
+	replies := map[string]string{
+		"/refund-payment":          s.ProcessRefundCommand(ctx, "U1", "C1", "plink_123"),
+		"/reconcile-subscriptions": s.ProcessReconcileSubscriptionsCommand(ctx, "U1", "C1", ""),
+		"/list-payments":           s.ProcessListPaymentsCommand(ctx, "U1", "C1", ""),
+	}
+	for command, reply := range replies {
+		if reply != dryRunReply {
+			t.Errorf("%s reply = %q, want %q", command, reply, dryRunReply)
+		}
+	}
+
+	// The expiry sweep has nothing to deactivate, so it returns rather than running until ctx is done
+	done := make(chan struct{})
+	go func() {
+		s.RunLinkExpirySweep(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("RunLinkExpirySweep kept running with DRY_RUN set")
+	}
+
+	if calls := slackAPI.calls(); len(calls) != 0 {
+		t.Errorf("made %d Slack calls, want none", len(calls))
+	}
+}
+
+func TestStripeFeaturesNeedStripeWithoutDryRun(t *testing.T) {
+	client, _ := newFakeSlack(t)
+
+	s := NewSlackService(&config.Config{StripeAPIKey: "sk_test_123"}, client, nil, nil, shortener.NewNoopShortener(), nil, nil, nil)
+	if s.refunder == nil || s.reconciler == nil || s.linkLister == nil || s.linkExpirer == nil || s.promotionCodes == nil {
+		t.Error("a Stripe feature is off with Stripe configured and DRY_RUN unset")
+	}
+
+	s = NewSlackService(&config.Config{AirwallexClientID: "client", AirwallexAPIKey: "key"}, client, nil, nil, shortener.NewNoopShortener(), nil, nil, nil)
+	want := "Refunds aren't available because the Stripe provider isn't enabled."
+	if got := s.ProcessRefundCommand(context.Background(), "U1", "C1", "plink_123"); got != want {
+		t.Errorf("refund reply without Stripe = %q, want %q", got, want)
+	}
+}
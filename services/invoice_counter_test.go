@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+
+	"github.com/slack-go/slack"
+)
+
+func TestProcessInvoiceCounterCommand(t *testing.T) {
+	ctx := context.Background()
+	s, counters := newInvoiceTestService(t, slack.New("xoxb-test"), &config.Config{})
+	s.adminUserIDs = map[string]bool{"U_ADMIN": true}
+
+	steps := []struct {
+		user     string
+		text     string
+		wantText string
+		wantLast int
+	}{
+		{"U1", "next", "only admins", counter.DefaultStart},
+		{"U_ADMIN", "next", "next invoice number in this channel is `1001`", counter.DefaultStart},
+		{"U_ADMIN", "set 2000", "Invoice counter updated", 1999},
+		{"U_ADMIN", "next", "`2000`", 1999},
+		{"U_ADMIN", "set 1500", "must be greater than the current counter", 1999},
+		{"U_ADMIN", "set 1999", "must be greater than the current counter", 1999},
+		{"U_ADMIN", "set 1500 force", "Invoice counter updated", 1499},
+		{"U_ADMIN", "set nope", "Error: invalid invoice number", 1499},
+		{"U1", "set 3000", "only admins", 1499},
+	}
+	for _, step := range steps {
+		got := s.ProcessInvoiceCounterCommand(ctx, step.user, "T1", "C1", step.text)
+		if !strings.Contains(got, step.wantText) {
+			t.Errorf("%s runs %q: reply %q, want it to mention %q", step.user, step.text, got, step.wantText)
+		}
+		if last, _ := counters.Last(ctx, "T1", "C1"); last != step.wantLast {
+			t.Errorf("%s runs %q: counter = %d, want %d", step.user, step.text, last, step.wantLast)
+		}
+	}
+
+	// Other channels keep their own counters
+	if last, _ := counters.Last(ctx, "T1", "C2"); last != counter.DefaultStart {
+		t.Errorf("counter in C2 = %d, want %d", last, counter.DefaultStart)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+// pendingInvoiceTTL is how long a submission waits for the user to confirm a near-duplicate
+const pendingInvoiceTTL = 15 * time.Minute
+
+// invoiceSubmission is everything needed to (re)run an invoice modal submission
+type invoiceSubmission struct {
+	UserID    string
+	TeamID    string
+	ChannelID string
+	Values    map[string]map[string]slack.BlockAction
+	// View is the submitted modal, redrawn with an error banner when something other than a
+	// field fails. Confirmed near-duplicates replace the confirmation view instead.
+	View *slack.View
+	// Preview sends the PDF only to the user and leaves the invoice counter alone
+	Preview bool
+}
+
+type recentInvoice struct {
+	Invoice   *models.InvoiceData
+	CreatedAt time.Time
+}
+
+type pendingInvoice struct {
+	Submission *invoiceSubmission
+	CreatedAt  time.Time
+}
+
+// DuplicateInvoiceGuard remembers the last invoice each user created in each channel so a
+// near-identical submission shortly afterwards can be confirmed before it is generated.
+type DuplicateInvoiceGuard struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	recent  map[string]recentInvoice
+	pending map[string]pendingInvoice
+}
+
+// NewDuplicateInvoiceGuard creates a guard with the given cooldown window (0 disables it)
+func NewDuplicateInvoiceGuard(window time.Duration) *DuplicateInvoiceGuard {
+	return &DuplicateInvoiceGuard{
+		window:  window,
+		recent:  make(map[string]recentInvoice),
+		pending: make(map[string]pendingInvoice),
+	}
+}
+
+func guardKey(userID, channelID string) string {
+	return userID + "/" + channelID
+}
+
+// FindRecentDuplicate returns the invoice the user created in the channel within the window
+// if it is a near-duplicate of invoice, or nil otherwise.
+func (g *DuplicateInvoiceGuard) FindRecentDuplicate(userID, channelID string, invoice *models.InvoiceData, now time.Time) *models.InvoiceData {
+	if g == nil || g.window <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	last, ok := g.recent[guardKey(userID, channelID)]
+	if !ok || now.Sub(last.CreatedAt) > g.window {
+		return nil
+	}
+	if !IsNearDuplicateInvoice(last.Invoice, invoice) {
+		return nil
+	}
+	return last.Invoice
+}
+
+// Record remembers an invoice that was just generated
+func (g *DuplicateInvoiceGuard) Record(userID, channelID string, invoice *models.InvoiceData, now time.Time) {
+	if g == nil || g.window <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.recent[guardKey(userID, channelID)] = recentInvoice{Invoice: invoice, CreatedAt: now}
+	for key, entry := range g.recent {
+		if now.Sub(entry.CreatedAt) > g.window {
+			delete(g.recent, key)
+		}
+	}
+}
+
+// HoldPending stores a submission awaiting confirmation and returns the token that identifies it
+func (g *DuplicateInvoiceGuard) HoldPending(submission *invoiceSubmission, now time.Time) string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, entry := range g.pending {
+		if now.Sub(entry.CreatedAt) > pendingInvoiceTTL {
+			delete(g.pending, key)
+		}
+	}
+	g.pending[token] = pendingInvoice{Submission: submission, CreatedAt: now}
+	return token
+}
+
+// TakePending removes and returns the submission held under token
+func (g *DuplicateInvoiceGuard) TakePending(token string, now time.Time) (*invoiceSubmission, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entry, ok := g.pending[token]
+	if !ok {
+		return nil, false
+	}
+	delete(g.pending, token)
+	if now.Sub(entry.CreatedAt) > pendingInvoiceTTL {
+		return nil, false
+	}
+	return entry.Submission, true
+}
+
+// IsNearDuplicateInvoice reports whether two invoices are for the same client with the same
+// currency, total and line items. The invoice number, due date and notes are ignored since
+// those are what typically differ between two accidental submissions.
+func IsNearDuplicateInvoice(a, b *models.InvoiceData) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if !sameText(a.ClientName, b.ClientName) || !sameText(a.ClientEmail, b.ClientEmail) {
+		return false
+	}
+	if !strings.EqualFold(strings.TrimSpace(a.Currency), strings.TrimSpace(b.Currency)) {
+		return false
+	}
+	if a.ComputeTotals().Total.Minor != b.ComputeTotals().Total.Minor {
+		return false
+	}
+	if len(a.LineItems) != len(b.LineItems) {
+		return false
+	}
+	for i := range a.LineItems {
+		if !sameText(a.LineItems[i].ServiceDescription, b.LineItems[i].ServiceDescription) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameText compares two strings ignoring case and surrounding/repeated whitespace
+func sameText(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
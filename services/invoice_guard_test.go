@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"paymentbot/config"
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+func guardInvoice(client string, prices ...float64) *models.InvoiceData {
+	invoice := &models.InvoiceData{InvoiceNumber: "INV-1001", ClientName: client, ClientEmail: "billing@acme.test", Currency: "USD", DateDue: "2026-12-31"}
+	for _, price := range prices {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{ServiceDescription: "Consulting", UnitPrice: price, Quantity: 1})
+	}
+	return invoice
+}
+
+func TestIsNearDuplicateInvoice(t *testing.T) {
+	base := guardInvoice("Acme Ltd", 100)
+	tests := []struct {
+		name   string
+		change func(*models.InvoiceData)
+		want   bool
+	}{
+		{"identical", func(*models.InvoiceData) {}, true},
+		{"different number, due date and notes", func(i *models.InvoiceData) {
+			i.InvoiceNumber, i.DateDue, i.Notes = "INV-1002", "2027-01-31", "Thanks!"
+		}, true},
+		{"client name case and spacing", func(i *models.InvoiceData) { i.ClientName = "  acme   LTD " }, true},
+		{"other client", func(i *models.InvoiceData) { i.ClientName = "Globex" }, false},
+		{"other email", func(i *models.InvoiceData) { i.ClientEmail = "ap@acme.test" }, false},
+		{"other currency", func(i *models.InvoiceData) { i.Currency = "EUR" }, false},
+		{"other total", func(i *models.InvoiceData) { i.LineItems[0].UnitPrice = 101 }, false},
+		{"other description", func(i *models.InvoiceData) { i.LineItems[0].ServiceDescription = "Design" }, false},
+		{"extra item", func(i *models.InvoiceData) {
+			i.LineItems = append(i.LineItems, models.InvoiceLineItem{ServiceDescription: "Hosting"})
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := guardInvoice("Acme Ltd", 100)
+			tt.change(other)
+			if got := IsNearDuplicateInvoice(base, other); got != tt.want {
+				t.Errorf("IsNearDuplicateInvoice = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if IsNearDuplicateInvoice(base, nil) {
+		t.Error("an invoice is a duplicate of nil")
+	}
+}
+
+func TestDuplicateInvoiceGuardWindow(t *testing.T) {
+	now := time.Now()
+	guard := NewDuplicateInvoiceGuard(2 * time.Minute)
+	guard.Record("U1", "C1", guardInvoice("Acme Ltd", 100), now)
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		after   time.Duration
+		want    bool
+	}{
+		{"same user and channel", "U1", "C1", time.Minute, true},
+		{"other user", "U2", "C1", time.Minute, false},
+		{"other channel", "U1", "C2", time.Minute, false},
+		{"after the window", "U1", "C1", 3 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		got := guard.FindRecentDuplicate(tt.user, tt.channel, guardInvoice("Acme Ltd", 100), now.Add(tt.after)) != nil
+		if got != tt.want {
+			t.Errorf("%s: duplicate found = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	disabled := NewDuplicateInvoiceGuard(0)
+	disabled.Record("U1", "C1", guardInvoice("Acme Ltd", 100), now)
+	if disabled.FindRecentDuplicate("U1", "C1", guardInvoice("Acme Ltd", 100), now) != nil {
+		t.Error("a guard with no window found a duplicate")
+	}
+}
+
+func TestDuplicateInvoiceGuardPendingExpires(t *testing.T) {
+	now := time.Now()
+	guard := NewDuplicateInvoiceGuard(time.Minute)
+	submission := &invoiceSubmission{UserID: "U1"}
+
+	token := guard.HoldPending(submission, now)
+	if got, ok := guard.TakePending(token, now.Add(time.Minute)); !ok || got != submission {
+		t.Fatalf("TakePending = %v, %v, want the held submission", got, ok)
+	}
+	if _, ok := guard.TakePending(token, now.Add(time.Minute)); ok {
+		t.Error("a pending submission was taken twice")
+	}
+
+	token = guard.HoldPending(submission, now)
+	if _, ok := guard.TakePending(token, now.Add(pendingInvoiceTTL+time.Second)); ok {
+		t.Error("an expired submission was taken")
+	}
+}
+
+func TestSubmitInvoiceConfirmsNearDuplicates(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+	s.invoiceGuard = NewDuplicateInvoiceGuard(2 * time.Minute)
+	submit := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("USD")}, false)
+		return rec
+	}
+
+	submit()
+	rec := submit()
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if resp.ResponseAction != slack.RAPush || resp.View == nil || resp.View.CallbackID != InvoiceDuplicateConfirmCallbackID {
+		t.Fatalf("second submission response = %s, want the duplicate confirmation pushed", rec.Body.String())
+	}
+	if got := len(files.sharedTo()); got != 1 {
+		t.Fatalf("%d invoices sent before confirming, want 1", got)
+	}
+
+	confirm := &slack.InteractionCallback{User: slack.User{ID: "U1"}, View: slack.View{PrivateMetadata: resp.View.PrivateMetadata}}
+	s.ProcessInvoiceDuplicateConfirmation(context.Background(), httptest.NewRecorder(), confirm)
+	if got := len(files.sharedTo()); got != 2 {
+		t.Errorf("%d invoices sent after confirming, want 2", got)
+	}
+}
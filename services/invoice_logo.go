@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	// invoiceLogoName is the name the logo is registered under in generated PDFs
+	invoiceLogoName = "invoice-logo"
+	// maxInvoiceLogoBytes keeps an oversized logo from bloating every invoice
+	maxInvoiceLogoBytes = 2 << 20
+	// invoiceLogoHeight is the logo height in mm; the width follows its aspect ratio
+	invoiceLogoHeight = 20.0
+)
+
+// loadLogo reads the invoice logo from a file path or http(s) URL once at startup. Only PNG
+// and JPEG are supported; any failure logs a warning and invoices are generated without it.
+func (is *InvoiceService) loadLogo(source string) {
+	if source == "" {
+		return
+	}
+
+	data, err := readLogo(source)
+	if err != nil {
+		log.Printf("[Invoice] Warning: could not load invoice logo %s, generating invoices without it: %v", source, err)
+		return
+	}
+
+	var imageType string
+	switch http.DetectContentType(data) {
+	case "image/png":
+		imageType = "PNG"
+	case "image/jpeg":
+		imageType = "JPG"
+	default:
+		log.Printf("[Invoice] Warning: invoice logo %s is not a PNG or JPEG image, generating invoices without it", source)
+		return
+	}
+
+	// gofpdf only reads the headers, so decode the pixels too to catch a truncated file
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		log.Printf("[Invoice] Warning: invoice logo %s could not be decoded, generating invoices without it: %v", source, err)
+		return
+	}
+
+	// Register once on a scratch document so an image gofpdf can't embed is caught here, not per invoice
+	check := gofpdf.New("P", "mm", "A4", "")
+	check.RegisterImageOptionsReader(invoiceLogoName, gofpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	if err := check.Error(); err != nil {
+		log.Printf("[Invoice] Warning: invoice logo %s could not be decoded, generating invoices without it: %v", source, err)
+		return
+	}
+
+	is.logo = data
+	is.logoType = imageType
+	log.Printf("[Invoice] Using invoice logo %s (%s, %d bytes)", source, imageType, len(data))
+}
+
+func readLogo(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		if err == nil && len(data) > maxInvoiceLogoBytes {
+			return nil, fmt.Errorf("logo is larger than %d bytes", maxInvoiceLogoBytes)
+		}
+		return data, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxInvoiceLogoBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxInvoiceLogoBytes {
+		return nil, fmt.Errorf("logo is larger than %d bytes", maxInvoiceLogoBytes)
+	}
+	return data, nil
+}
+
+// drawLogo places the logo in the top-right corner of the header, if one is configured
+func (is *InvoiceService) drawLogo(pdf *gofpdf.Fpdf) {
+	if is.logo == nil {
+		return
+	}
+
+	opts := gofpdf.ImageOptions{ImageType: is.logoType}
+	info := pdf.RegisterImageOptionsReader(invoiceLogoName, opts, bytes.NewReader(is.logo))
+	if info == nil || pdf.Error() != nil {
+		return
+	}
+
+	pageWidth, _ := pdf.GetPageSize()
+	_, _, rightMargin, _ := pdf.GetMargins()
+	width := invoiceLogoHeight * info.Width() / info.Height()
+	pdf.ImageOptions(invoiceLogoName, pageWidth-rightMargin-width, 10, width, invoiceLogoHeight, false, opts, 0, "")
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+	"paymentbot/models"
+)
+
+// testLogo encodes a small two-colour image as PNG or JPEG
+func testLogo(t *testing.T, format string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 6), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "PNG" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func logoTestInvoice() *models.InvoiceData {
+	return &models.InvoiceData{
+		InvoiceNumber: "1001",
+		ClientName:    "Client Co",
+		DateDue:       "2026-12-31",
+		Currency:      "USD",
+		LineItems:     []models.InvoiceLineItem{{ServiceDescription: "Consulting", UnitPrice: 100, Quantity: 1}},
+	}
+}
+
+func TestInvoiceLogoIsDrawnInThePDF(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testLogo(t, "PNG"))
+	}))
+	defer server.Close()
+
+	tests := map[string]struct {
+		source   string
+		wantType string
+	}{
+		"PNG file":  {writeTestFile(t, "logo.png", testLogo(t, "PNG")), "PNG"},
+		"JPEG file": {writeTestFile(t, "logo.jpg", testLogo(t, "JPG")), "JPG"},
+		"PNG URL":   {server.URL + "/logo.png", "PNG"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := NewInvoiceService(nil, &config.Config{InvoiceLogo: tt.source}, counter.NewMemoryCounterStore())
+			if is.logo == nil || is.logoType != tt.wantType {
+				t.Fatalf("logo loaded as %q (%d bytes), want %s", is.logoType, len(is.logo), tt.wantType)
+			}
+			pdf, err := is.GenerateInvoicePDF(logoTestInvoice())
+			if err != nil {
+				t.Fatalf("GenerateInvoicePDF error: %v", err)
+			}
+			if !bytes.Contains(pdf, []byte("/Subtype /Image")) {
+				t.Error("PDF has no image")
+			}
+		})
+	}
+}
+
+func TestUnreadableInvoiceLogoIsSkipped(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	sources := map[string]string{
+		"missing file":  filepath.Join(t.TempDir(), "missing.png"),
+		"not an image":  writeTestFile(t, "logo.png", []byte("<svg></svg>")),
+		"corrupt PNG":   writeTestFile(t, "broken.png", testLogo(t, "PNG")[:40]),
+		"URL not found": server.URL + "/logo.png",
+	}
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			is := NewInvoiceService(nil, &config.Config{InvoiceLogo: source}, counter.NewMemoryCounterStore())
+			if is.logo != nil {
+				t.Fatalf("loaded an unusable logo (%s)", is.logoType)
+			}
+			pdf, err := is.GenerateInvoicePDF(logoTestInvoice())
+			if err != nil {
+				t.Fatalf("GenerateInvoicePDF error: %v", err)
+			}
+			if bytes.Contains(pdf, []byte("/Subtype /Image")) {
+				t.Error("PDF has an image without a usable logo")
+			}
+		})
+	}
+}
@@ -5,80 +5,422 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"net/url"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"paymentbot/config"
+	"paymentbot/counter"
 	"paymentbot/models"
+	"paymentbot/utils"
 
 	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
 	"github.com/slack-go/slack"
 )
 
+// invoiceFontFamily is the family name UTF-8 fonts are registered under in generated PDFs
+const invoiceFontFamily = "InvoiceFont"
+
+// totalsBoxWidth is the width of the subtotal/total box under the line items in mm
+const totalsBoxWidth = 90.0
+
 type InvoiceService struct {
-	slackClient *slack.Client
+	slackClient  *slack.Client
+	counters     counter.CounterStore
+	numberFormat utils.InvoiceNumberFormat
+	maxLineItems int
+	company      models.InvoiceCompany
+	columns      [4]float64 // Description, Qty, Unit Price and Amount widths in mm
+
+	fontRegular   []byte        // optional UTF-8 font; nil means use the core Arial font
+	fontBold      []byte        // optional bold variant; falls back to fontRegular
+	fontCoverage  map[rune]bool // runes the UTF-8 font has glyphs for
+	transliterate bool
+
+	logo     []byte // optional PNG/JPEG shown in the header
+	logoType string // gofpdf image type, "PNG" or "JPG"
 }
 
-func NewInvoiceService(slackClient *slack.Client) *InvoiceService {
-	return &InvoiceService{
-		slackClient: slackClient,
+func NewInvoiceService(slackClient *slack.Client, cfg *config.Config, counters counter.CounterStore) *InvoiceService {
+	maxLineItems := cfg.InvoiceMaxLineItems
+	if maxLineItems <= 0 {
+		maxLineItems = config.DefaultInvoiceMaxLineItems
+	}
+
+	columns := cfg.InvoiceColumnWidths
+	if columns == ([4]float64{}) {
+		columns = config.DefaultInvoiceColumnWidths
+	}
+
+	is := &InvoiceService{
+		slackClient:   slackClient,
+		counters:      counters,
+		numberFormat:  cfg.InvoiceNumberFormat,
+		maxLineItems:  maxLineItems,
+		company:       cfg.InvoiceCompany,
+		columns:       columns,
+		transliterate: cfg.InvoiceTransliterate,
+	}
+	regularPath, boldPath := cfg.InvoiceFontPath, cfg.InvoiceFontBoldPath
+	if regularPath == "" {
+		regularPath, boldPath = detectSystemFont()
 	}
+	is.loadFonts(regularPath, boldPath)
+	is.loadLogo(cfg.InvoiceLogo)
+	return is
 }
 
-// GetLastInvoiceNumber retrieves the last invoice number from the current channel
-func (is *InvoiceService) GetLastInvoiceNumber(ctx context.Context, teamID, channelID string) (int, error) {
-	// Try to find a message with invoice counter in the current channel
-	// Look for messages that contain only a number (invoice counter)
-	history, err := is.slackClient.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
-		ChannelID: channelID,
-		Limit:     100, // Check last 100 messages for counter
-	})
+// systemFontCandidates are DejaVu install locations on common distros (regular, bold)
+var systemFontCandidates = [][2]string{
+	{"/usr/share/fonts/dejavu/DejaVuSans.ttf", "/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf"},                       // Alpine (font-dejavu)
+	{"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"},     // Debian/Ubuntu
+	{"/usr/share/fonts/dejavu-sans-fonts/DejaVuSans.ttf", "/usr/share/fonts/dejavu-sans-fonts/DejaVuSans-Bold.ttf"}, // Fedora
+}
+
+// detectSystemFont returns the first installed Unicode font, so symbols like € render
+// without configuration. Empty paths mean none was found and the core font is used.
+func detectSystemFont() (string, string) {
+	for _, candidate := range systemFontCandidates {
+		if _, err := os.Stat(candidate[0]); err == nil {
+			return candidate[0], candidate[1]
+		}
+	}
+	return "", ""
+}
+
+// loadFonts reads the configured UTF-8 fonts once. Any failure falls back to the core font.
+func (is *InvoiceService) loadFonts(regularPath, boldPath string) {
+	if regularPath == "" {
+		return
+	}
+
+	regular, err := os.ReadFile(regularPath)
+	if err != nil {
+		log.Printf("[Invoice] Warning: could not read invoice font %s, falling back to Arial: %v", regularPath, err)
+		return
+	}
+	coverage, err := ttfGlyphCoverage(regular)
 	if err != nil {
-		log.Printf("Error getting conversation history for channel %s: %v", channelID, err)
-		return 1000, nil
+		log.Printf("[Invoice] Warning: could not parse invoice font %s, falling back to Arial: %v", regularPath, err)
+		return
 	}
+	is.fontRegular = regular
+	is.fontBold = regular
+	is.fontCoverage = coverage
 
-	// Search backwards through messages to find the last invoice counter
-	for _, message := range history.Messages {
-		text := strings.TrimSpace(message.Text)
-		// Check if message is just a number (potential invoice counter)
-		if lastInvoice, err := strconv.Atoi(text); err == nil {
-			log.Printf("Found last invoice number %d in channel %s", lastInvoice, channelID)
-			return lastInvoice, nil
+	if boldPath != "" {
+		bold, err := os.ReadFile(boldPath)
+		if err != nil {
+			log.Printf("[Invoice] Warning: could not read bold invoice font %s, using regular weight: %v", boldPath, err)
+		} else {
+			is.fontBold = bold
+		}
+	}
+	log.Printf("[Invoice] Using UTF-8 invoice font %s (%d glyphs)", regularPath, len(coverage))
+}
+
+// setupPDFFonts registers the invoice font on pdf and returns the family to use with SetFont
+// and an encoder that makes text safe for that font.
+func (is *InvoiceService) setupPDFFonts(pdf *gofpdf.Fpdf) (string, *pdfTextEncoder) {
+	if is.fontRegular != nil {
+		pdf.AddUTF8FontFromBytes(invoiceFontFamily, "", is.fontRegular)
+		pdf.AddUTF8FontFromBytes(invoiceFontFamily, "B", is.fontBold)
+		return invoiceFontFamily, &pdfTextEncoder{
+			hasGlyph:      func(r rune) bool { return is.fontCoverage[r] },
+			transliterate: is.transliterate,
 		}
 	}
 
-	// No counter found in this channel, start with default
-	log.Printf("No invoice counter found in channel %s, using default starting number 1000", channelID)
-	return 1000, nil
+	return "Arial", &pdfTextEncoder{
+		hasGlyph:      cp1252HasGlyph,
+		translate:     pdf.UnicodeTranslatorFromDescriptor(""),
+		transliterate: is.transliterate,
+	}
 }
 
-// UpdateLastInvoiceNumber updates the last invoice number in the current channel
-func (is *InvoiceService) UpdateLastInvoiceNumber(ctx context.Context, teamID, channelID string, invoiceNumber int) error {
-	// Post the new invoice number to the current channel as a simple message
-	_, _, err := is.slackClient.PostMessageContext(ctx, channelID, slack.MsgOptionText(strconv.Itoa(invoiceNumber), false))
+// payLinkQRSize is the printed width and height of the pay link QR code in mm
+const payLinkQRSize = 30.0
+
+// drawPayLinkQR prints a "Scan to pay" QR code for payLink at the bottom of the last page,
+// starting a new page if the footer would overlap the content
+func (is *InvoiceService) drawPayLinkQR(pdf *gofpdf.Fpdf, fontFamily, payLink string) {
+	if payLink == "" {
+		return
+	}
+	code, err := qrcode.New(payLink, qrcode.Medium)
 	if err != nil {
-		return fmt.Errorf("failed to post invoice number to channel %s: %w", channelID, err)
+		log.Printf("[Invoice] Warning: could not encode pay link as a QR code, leaving it out: %v", err)
+		return
 	}
 
-	log.Printf("Updated invoice counter to %d in channel %s", invoiceNumber, channelID)
+	_, pageHeight := pdf.GetPageSize()
+	_, bottomMargin := pdf.GetAutoPageBreak()
+	leftMargin, _, _, _ := pdf.GetMargins()
+	top := pageHeight - bottomMargin - payLinkQRSize
+	if pdf.GetY() > top-5 {
+		pdf.AddPage()
+	}
+
+	// The page margin around the code is its quiet zone
+	code.DisableBorder = true
+	modules := code.Bitmap()
+	module := payLinkQRSize / float64(len(modules))
+	pdf.SetFillColor(0, 0, 0)
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				pdf.Rect(leftMargin+float64(x)*module, top+float64(y)*module, module, module, "F")
+			}
+		}
+	}
+
+	// Validated URLs are ASCII, so the link needs no font encoding
+	pdf.SetXY(leftMargin+payLinkQRSize+5, top+payLinkQRSize/2-8)
+	pdf.SetFont(fontFamily, "B", 11)
+	pdf.Cell(0, 6, "Scan to pay online")
+	pdf.Ln(6)
+	pdf.SetX(leftMargin + payLinkQRSize + 5)
+	pdf.SetFont(fontFamily, "", 9)
+	pdf.SetTextColor(0, 0, 200)
+	pdf.CellFormat(0, 5, payLink, "", 0, "L", false, 0, payLink)
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// tableWidth is the combined width of the line item columns in mm
+func (is *InvoiceService) tableWidth() float64 {
+	var width float64
+	for _, column := range is.columns {
+		width += column
+	}
+	return width
+}
+
+// wrappedHeight is the height MultiCell will use for text in a column of the given width
+func (is *InvoiceService) wrappedHeight(pdf *gofpdf.Fpdf, text string, width, lineHeight float64) float64 {
+	var lines int
+	if is.fontRegular != nil {
+		lines = len(pdf.SplitText(text, width))
+	} else {
+		lines = len(pdf.SplitLines([]byte(text), width))
+	}
+	if lines < 1 {
+		lines = 1
+	}
+	return float64(lines) * lineHeight
+}
+
+// InvoiceFieldError is a parse error that belongs to a specific invoice modal input block
+type InvoiceFieldError struct {
+	BlockID string
+	Message string
+}
+
+func (e *InvoiceFieldError) Error() string {
+	return e.Message
+}
+
+// ParseDiscount parses an optional discount, either a percentage ("10%") or a fixed amount in
+// currency ("25.00"). Blank means no discount.
+func ParseDiscount(raw, currency string) (percent, amount float64, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, 0, nil
+	}
+	if strings.HasSuffix(raw, "%") {
+		percent, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(raw, "%")), 64)
+		if err != nil || math.IsNaN(percent) || math.IsInf(percent, 0) || percent < 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("discount percentage must be between 0%% and 100%%")
+		}
+		return percent, 0, nil
+	}
+	amount, err = utils.ParseAmountInCurrency(raw, currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("discount must be an amount such as 25.00 or a percentage such as 10%%: %w", err)
+	}
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount < 0 {
+		return 0, 0, fmt.Errorf("discount must be an amount such as 25.00 or a percentage such as 10%%")
+	}
+	return 0, amount, nil
+}
+
+// ParseTaxRate parses an optional tax percentage such as "20" or "7.5%". Blank means no tax.
+func ParseTaxRate(raw string) (float64, error) {
+	raw = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(raw), "%"))
+	if raw == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(rate) || math.IsInf(rate, 0) || rate < 0 || rate > 100 {
+		return 0, fmt.Errorf("tax rate must be a percentage between 0 and 100")
+	}
+	return rate, nil
+}
+
+// parseLineItemRows reads the modal's line item rows in order. Modals opened before line items
+// had rows use a single line_items_block textarea, one item per line.
+func (is *InvoiceService) parseLineItemRows(values map[string]map[string]slack.BlockAction) ([]models.InvoiceLineItem, error) {
+	var items []models.InvoiceLineItem
+	if legacy, ok := getValue(values, "line_items_block", "line_items_input"); ok {
+		for lineNum, line := range strings.Split(legacy, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			item, err := parseInvoiceLine(line)
+			if err != nil {
+				return nil, &InvoiceFieldError{BlockID: "line_items_block", Message: fmt.Sprintf("Line %d: %v", lineNum+1, err)}
+			}
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			return nil, &InvoiceFieldError{BlockID: "line_items_block", Message: "At least one line item is required"}
+		}
+		return items, nil
+	}
+
+	var rows []int
+	for id := range values {
+		suffix, ok := strings.CutPrefix(id, invoiceLineItemBlockPrefix+"_")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(suffix); err == nil {
+			rows = append(rows, n)
+		}
+	}
+	sort.Ints(rows)
+	if len(rows) > is.maxLineItems {
+		return nil, &InvoiceFieldError{BlockID: blockID(invoiceLineItemBlockPrefix, rows[is.maxLineItems]), Message: fmt.Sprintf("Invoices are limited to %d line items", is.maxLineItems)}
+	}
+
+	for _, row := range rows {
+		id := blockID(invoiceLineItemBlockPrefix, row)
+		line, _ := getValue(values, id, invoiceLineItemActionID)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		item, err := parseInvoiceLine(line)
+		if err != nil {
+			return nil, &InvoiceFieldError{BlockID: id, Message: err.Error()}
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, &InvoiceFieldError{BlockID: blockID(invoiceLineItemBlockPrefix, 1), Message: "At least one line item is required"}
+	}
+	return items, nil
+}
+
+// parseInvoiceLine parses "Service Description | Price | Quantity"; quantity defaults to 1
+func parseInvoiceLine(line string) (models.InvoiceLineItem, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) < 2 {
+		return models.InvoiceLineItem{}, fmt.Errorf("expected 'Service | Price | Quantity'")
+	}
+
+	serviceDesc := strings.TrimSpace(parts[0])
+	if serviceDesc == "" {
+		return models.InvoiceLineItem{}, fmt.Errorf("service description cannot be empty")
+	}
+
+	priceStr := strings.TrimSpace(parts[1])
+	unitPrice, err := utils.ParseAmount(priceStr)
+	if err != nil {
+		return models.InvoiceLineItem{}, fmt.Errorf("invalid price: %w", err)
+	}
+
+	quantity := 1
+	if len(parts) >= 3 {
+		if quantityStr := strings.TrimSpace(parts[2]); quantityStr != "" {
+			parsedQuantity, err := strconv.Atoi(quantityStr)
+			if err != nil {
+				return models.InvoiceLineItem{}, fmt.Errorf("invalid quantity '%s'", quantityStr)
+			}
+			if parsedQuantity > 0 {
+				quantity = parsedQuantity
+			}
+		}
+	}
+
+	return models.InvoiceLineItem{
+		ServiceDescription: serviceDesc,
+		UnitPrice:          unitPrice,
+		Quantity:           quantity,
+	}, nil
+}
+
+// ValidateLineItemCount checks the pasted line items against the configured maximum before parsing
+func (is *InvoiceService) ValidateLineItemCount(lineItemsText string) error {
+	count := 0
+	for _, line := range strings.Split(lineItemsText, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	if count > is.maxLineItems {
+		return fmt.Errorf("Invoices are limited to %d line items (you entered %d). Please split this into multiple invoices or use the API/bulk path for larger invoices.", is.maxLineItems, count)
+	}
 	return nil
 }
 
-func getCurrencySymbol(currency string) string {
-	symbols := map[string]string{
-		"USD": "$",
-		"EUR": "€",
-		"GBP": "£",
-		"JPY": "¥",
-		"HKD": "HK$",
-		"CAD": "C$",
-		"AUD": "A$",
+// GetLastInvoiceNumber returns the last invoice number used in the channel
+func (is *InvoiceService) GetLastInvoiceNumber(ctx context.Context, teamID, channelID string) (int, error) {
+	return is.counters.Last(ctx, teamID, channelID)
+}
+
+// FormatInvoiceNumber writes a counter value as an invoice number in the configured format
+func (is *InvoiceService) FormatInvoiceNumber(seq int) string {
+	return is.numberFormat.Render(seq, time.Now())
+}
+
+// ReserveInvoiceNumber atomically claims the next invoice number for the channel
+func (is *InvoiceService) ReserveInvoiceNumber(ctx context.Context, teamID, channelID string) (int, error) {
+	next, err := is.counters.Next(ctx, teamID, channelID)
+	if err != nil {
+		return 0, err
 	}
-	if symbol, exists := symbols[currency]; exists {
-		return symbol
+	log.Printf("Reserved invoice number %d for team %s in channel %s", next, teamID, channelID)
+	return next, nil
+}
+
+// ReleaseInvoiceNumber hands back a reserved number that wasn't used because the invoice
+// failed, so it doesn't leave a gap. Once a later number has been reserved the gap stays.
+func (is *InvoiceService) ReleaseInvoiceNumber(ctx context.Context, teamID, channelID string, invoiceNumber int) {
+	released, err := is.counters.Release(ctx, teamID, channelID, invoiceNumber)
+	switch {
+	case err != nil:
+		log.Printf("Error releasing invoice number %d for team %s in channel %s: %v", invoiceNumber, teamID, channelID, err)
+	case released:
+		log.Printf("Released unused invoice number %d for team %s in channel %s", invoiceNumber, teamID, channelID)
+	default:
+		log.Printf("Invoice number %d for team %s in channel %s was not used, but a later number has been reserved", invoiceNumber, teamID, channelID)
 	}
-	return "$" // Default to USD symbol
+}
+
+// AdvanceInvoiceNumber moves the channel's counter up to invoiceNumber if it's behind, so a
+// manually numbered invoice isn't reused. Numbers reserved concurrently are never rolled back.
+func (is *InvoiceService) AdvanceInvoiceNumber(ctx context.Context, teamID, channelID string, invoiceNumber int) error {
+	advanced, err := is.counters.Advance(ctx, teamID, channelID, invoiceNumber)
+	if err != nil {
+		return err
+	}
+	if advanced {
+		log.Printf("Advanced invoice counter to %d for team %s in channel %s", invoiceNumber, teamID, channelID)
+	}
+	return nil
+}
+
+// UpdateLastInvoiceNumber overwrites the last invoice number used in the channel
+func (is *InvoiceService) UpdateLastInvoiceNumber(ctx context.Context, teamID, channelID string, invoiceNumber int) error {
+	if err := is.counters.Set(ctx, teamID, channelID, invoiceNumber); err != nil {
+		return err
+	}
+	log.Printf("Updated invoice counter to %d for team %s in channel %s", invoiceNumber, teamID, channelID)
+	return nil
 }
 
 func (is *InvoiceService) uploadFileToSlack(ctx context.Context, filename string, fileBytes []byte, channelID string, initialComment string) error {
@@ -92,7 +434,7 @@ func (is *InvoiceService) uploadFileToSlack(ctx context.Context, filename string
 		Channel:        channelID,
 	}
 
-	_, err := is.slackClient.UploadFileV2Context(ctx, params)
+	_, err := slackClientFrom(ctx, is.slackClient).UploadFileV2Context(ctx, params)
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -102,94 +444,121 @@ func (is *InvoiceService) uploadFileToSlack(ctx context.Context, filename string
 
 func (is *InvoiceService) GenerateInvoicePDF(invoice *models.InvoiceData) ([]byte, error) {
 	pdf := gofpdf.New("P", "mm", "A4", "")
+	fontFamily, enc := is.setupPDFFonts(pdf)
 	pdf.AddPage()
+	is.drawLogo(pdf)
 
 	// Set font
-	pdf.SetFont("Arial", "", 10)
+	pdf.SetFont(fontFamily, "", 10)
 
-	// Company Information (left side)
-	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(0, 8, "ZEFI ECOMMERCE LIMITED")
-	pdf.Ln(6)
+	// Company Information (left side), skipped entirely when not configured
+	if is.company.Name != "" {
+		pdf.SetFont(fontFamily, "B", 16)
+		pdf.Cell(0, 8, enc.encode(is.company.Name))
+		pdf.Ln(6)
+	}
 
-	pdf.SetFont("Arial", "", 9)
-	pdf.Cell(0, 5, "Glenealy Central")
-	pdf.Ln(4)
-	pdf.Cell(0, 5, "Unit 2A, 17/F, Glenealy Tower, No.1 Hong Kong")
-	pdf.Ln(4)
-	pdf.Cell(0, 5, "+61 466 598 489")
-	pdf.Ln(15)
+	pdf.SetFont(fontFamily, "", 9)
+	companyLines := is.company.AddressLines
+	if is.company.Phone != "" {
+		companyLines = append(companyLines[:len(companyLines):len(companyLines)], is.company.Phone)
+	}
+	for _, line := range companyLines {
+		pdf.Cell(0, 5, enc.encode(line))
+		pdf.Ln(4)
+	}
+	if is.company.Name != "" || len(companyLines) > 0 {
+		pdf.Ln(11)
+	}
 
 	// Invoice title and number (right side)
-	pdf.SetFont("Arial", "B", 24)
+	pdf.SetFont(fontFamily, "B", 24)
 	pdf.Cell(0, 10, "INVOICE")
 	pdf.Ln(15)
 
 	// Invoice details
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(60, 6, fmt.Sprintf("Invoice Number: %s", invoice.InvoiceNumber))
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.Cell(60, 6, enc.encode(fmt.Sprintf("Invoice Number: %s", invoice.InvoiceNumber)))
 	pdf.Cell(60, 6, fmt.Sprintf("Date: %s", time.Now().Format("January 2, 2006")))
 	pdf.Ln(6)
-	pdf.Cell(60, 6, fmt.Sprintf("Due Date: %s", invoice.DateDue))
+	pdf.Cell(60, 6, enc.encode(fmt.Sprintf("Due Date: %s", invoice.DateDue)))
 	pdf.Cell(60, 6, fmt.Sprintf("Currency: %s", invoice.Currency))
 	pdf.Ln(15)
 
 	// Bill To section
-	pdf.SetFont("Arial", "B", 12)
+	pdf.SetFont(fontFamily, "B", 12)
 	pdf.Cell(0, 8, "Bill To:")
 	pdf.Ln(6)
 
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(0, 5, invoice.ClientName)
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.Cell(0, 5, enc.encode(invoice.ClientName))
 	pdf.Ln(5)
 	if invoice.ClientAddress != "" {
-		pdf.Cell(0, 5, invoice.ClientAddress)
+		pdf.Cell(0, 5, enc.encode(invoice.ClientAddress))
 		pdf.Ln(5)
 	}
 	if invoice.ClientEmail != "" {
-		pdf.Cell(0, 5, invoice.ClientEmail)
+		pdf.Cell(0, 5, enc.encode(invoice.ClientEmail))
 		pdf.Ln(15)
 	} else {
 		pdf.Ln(10)
 	}
 
-	// Table headers
-	pdf.SetFont("Arial", "B", 11)
-	pdf.SetFillColor(240, 240, 240)
-	pdf.Cell(100, 8, "Description")
-	pdf.Cell(25, 8, "Qty")
-	pdf.Cell(35, 8, "Unit Price")
-	pdf.Cell(40, 8, "Amount")
-	pdf.Ln(10)
+	// Table headers, repeated at the top of every page the line items continue on
+	descWidth, qtyWidth, priceWidth, amountWidth := is.columns[0], is.columns[1], is.columns[2], is.columns[3]
+	tableLeft, _, _, _ := pdf.GetMargins()
+	tableRight := tableLeft + is.tableWidth()
+	drawTableHeader := func() {
+		pdf.SetFont(fontFamily, "B", 11)
+		pdf.SetFillColor(240, 240, 240)
+		pdf.Cell(descWidth, 8, "Description")
+		pdf.Cell(qtyWidth, 8, "Qty")
+		pdf.Cell(priceWidth, 8, "Unit Price")
+		pdf.Cell(amountWidth, 8, "Amount")
+		pdf.Ln(10)
 
-	// Table line
-	pdf.SetDrawColor(200, 200, 200)
-	pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(5)
+		// Table line
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.Line(tableLeft, pdf.GetY(), tableRight, pdf.GetY())
+		pdf.Ln(5)
+
+		pdf.SetFont(fontFamily, "", 10)
+	}
+	drawTableHeader()
+
+	// Rows are moved to a new page as a whole rather than letting gofpdf split them
+	_, pageHeight := pdf.GetPageSize()
+	_, bottomMargin := pdf.GetAutoPageBreak()
+	pageBottom := pageHeight - bottomMargin
 
 	// Line items
-	pdf.SetFont("Arial", "", 10)
-	var subtotal float64
 	for i, item := range invoice.LineItems {
-		// Description
-		pdf.Cell(100, 6, item.ServiceDescription)
+		description := enc.encode(item.ServiceDescription)
+		if pdf.GetY()+is.wrappedHeight(pdf, description, descWidth, 6) > pageBottom {
+			pdf.AddPage()
+			drawTableHeader()
+		}
+		rowX, rowY := pdf.GetXY()
+
+		// Description, wrapped onto as many lines as it needs
+		pdf.MultiCell(descWidth, 6, description, "", "L", false)
+		rowBottom := pdf.GetY()
+
+		// The other columns stay aligned with the first line of the description
+		pdf.SetXY(rowX+descWidth, rowY)
 
 		// Quantity
 		quantity := fmt.Sprintf("%d", item.Quantity)
-		pdf.Cell(25, 6, quantity)
+		pdf.Cell(qtyWidth, 6, quantity)
 
 		// Unit Price
-		currencySymbol := getCurrencySymbol(invoice.Currency)
-		unitPriceStr := fmt.Sprintf("%s%.2f", currencySymbol, item.UnitPrice)
-		pdf.Cell(35, 6, unitPriceStr)
+		unitPriceStr := enc.encode(utils.FormatAmount(item.UnitPrice, invoice.Currency))
+		pdf.Cell(priceWidth, 6, unitPriceStr)
 
 		// Amount (qty * unit price)
-		lineTotal := float64(item.Quantity) * item.UnitPrice
-		amountStr := fmt.Sprintf("%s%.2f", currencySymbol, lineTotal)
-		pdf.Cell(40, 6, amountStr)
-		pdf.Ln(6)
-
-		subtotal += lineTotal
+		amountStr := enc.encode(utils.FormatMoney(item.LineTotal(invoice.Currency)))
+		pdf.Cell(amountWidth, 6, amountStr)
+		pdf.SetXY(rowX, rowBottom)
 
 		// Add spacing between items
 		if i < len(invoice.LineItems)-1 {
@@ -200,55 +569,91 @@ func (is *InvoiceService) GenerateInvoicePDF(invoice *models.InvoiceData) ([]byt
 	// Totals section
 	pdf.Ln(15)
 
-	// Create a box for totals
+	// Create a box for totals, with room for the discount and tax lines when there are any
+	totals := invoice.ComputeTotals()
+	hasTax := invoice.TaxRate > 0
+	hasDiscount := totals.Discount.Minor > 0
+	boxHeight := 40.0
+	if hasTax {
+		boxHeight += 12
+	}
+	if hasDiscount {
+		boxHeight += 12
+	}
+	// Keep the totals box and Amount Due together on one page
+	if pdf.GetY()+boxHeight+15 > pageBottom {
+		pdf.AddPage()
+	}
+	// The totals box sits under the right-hand end of the table
+	boxLeft := math.Max(tableRight-totalsBoxWidth, tableLeft)
+	textLeft := boxLeft + 5
 	pdf.SetDrawColor(200, 200, 200)
-	pdf.Rect(110, pdf.GetY(), 90, 40, "D")
+	pdf.Rect(boxLeft, pdf.GetY(), totalsBoxWidth, boxHeight, "D")
 
 	// Subtotal
-	pdf.SetFont("Arial", "", 10)
-	pdf.SetX(115)
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.SetX(textLeft)
 	pdf.Cell(35, 12, "Subtotal:")
-	currencySymbol := getCurrencySymbol(invoice.Currency)
-	pdf.Cell(40, 12, fmt.Sprintf("%s%.2f", currencySymbol, subtotal))
+	subtotalStr := enc.encode(utils.FormatMoney(totals.Subtotal))
+	pdf.Cell(40, 12, subtotalStr)
 	pdf.Ln(12)
 
+	// Discount (before tax)
+	if hasDiscount {
+		pdf.SetX(textLeft)
+		pdf.Cell(35, 12, enc.encode(invoice.DiscountDescription()+":"))
+		pdf.Cell(40, 12, enc.encode("-"+utils.FormatMoney(totals.Discount)))
+		pdf.Ln(12)
+	}
+
+	// Tax
+	if hasTax {
+		pdf.SetX(textLeft)
+		pdf.Cell(35, 12, enc.encode(invoice.TaxDescription()+":"))
+		pdf.Cell(40, 12, enc.encode(utils.FormatMoney(totals.Tax)))
+		pdf.Ln(12)
+	}
+
 	// Add subtle line
 	pdf.SetDrawColor(220, 220, 220)
-	pdf.Line(115, pdf.GetY(), 195, pdf.GetY())
+	pdf.Line(textLeft, pdf.GetY(), boxLeft+totalsBoxWidth-5, pdf.GetY())
 	pdf.Ln(5)
 
 	// Total
-	pdf.SetFont("Arial", "B", 12)
-	pdf.SetX(115)
+	pdf.SetFont(fontFamily, "B", 12)
+	pdf.SetX(textLeft)
 	pdf.Cell(35, 12, "Total:")
-	pdf.Cell(40, 12, fmt.Sprintf("%s%.2f", currencySymbol, subtotal))
+	totalStr := enc.encode(utils.FormatMoney(totals.Total))
+	pdf.Cell(40, 12, totalStr)
 	pdf.Ln(12)
 
 	// Amount Due - make it stand out
 	pdf.SetFillColor(245, 245, 245)
-	pdf.Rect(110, pdf.GetY(), 90, 15, "F")
-	pdf.SetFont("Arial", "B", 14)
-	pdf.SetX(115)
+	pdf.Rect(boxLeft, pdf.GetY(), totalsBoxWidth, 15, "F")
+	pdf.SetFont(fontFamily, "B", 14)
+	pdf.SetX(textLeft)
 	pdf.Cell(35, 15, "Amount Due:")
 	pdf.SetTextColor(0, 100, 0) // Dark green color
-	pdf.Cell(40, 15, fmt.Sprintf("%s%.2f", currencySymbol, subtotal))
+	pdf.Cell(40, 15, totalStr)
 	pdf.SetTextColor(0, 0, 0) // Reset to black
 	pdf.Ln(20)
 
 	// Add notes section if notes are provided
 	if invoice.Notes != "" {
 		pdf.Ln(10)
-		pdf.SetFont("Arial", "B", 11)
+		pdf.SetFont(fontFamily, "B", 11)
 		pdf.Cell(0, 6, "Notes:")
 		pdf.Ln(6)
-		pdf.SetFont("Arial", "", 10)
-		
+		pdf.SetFont(fontFamily, "", 10)
+
 		// Split notes into lines and add them
 		// Use MultiCell for automatic line wrapping
-		pdf.MultiCell(0, 5, invoice.Notes, "", "L", false)
+		pdf.MultiCell(0, 5, enc.encode(invoice.Notes), "", "L", false)
 		pdf.Ln(5)
 	}
 
+	is.drawPayLinkQR(pdf, fontFamily, invoice.PayLink)
+
 	// Generate PDF bytes
 	var buf bytes.Buffer
 	err := pdf.Output(&buf)
@@ -259,22 +664,9 @@ func (is *InvoiceService) GenerateInvoicePDF(invoice *models.InvoiceData) ([]byt
 	return buf.Bytes(), nil
 }
 
-func (is *InvoiceService) SendInvoiceToSlack(userID, channelID string, invoice *models.InvoiceData, pdfBytes []byte) error {
-	// Calculate total
-	var total float64
-	for _, item := range invoice.LineItems {
-		total += float64(item.Quantity) * item.UnitPrice
-	}
-
-	// Create message
-	currencySymbol := getCurrencySymbol(invoice.Currency)
-	message := fmt.Sprintf(
-		"📄 *Invoice #%s* for *%s*\n\n*Amount Due:* %s%.2f\n*Due Date:* %s\n*Email:* %s\n\nPlease find the PDF invoice attached.",
-		invoice.InvoiceNumber, invoice.ClientName, currencySymbol, total, invoice.DateDue, invoice.ClientEmail,
-	)
-
+func (is *InvoiceService) SendInvoiceToSlack(ctx context.Context, userID, channelID string, invoice *models.InvoiceData, pdfBytes []byte) error {
+	message := invoiceMessage(invoice)
 	filename := fmt.Sprintf("Invoice_%s.pdf", invoice.InvoiceNumber)
-	ctx := context.Background()
 
 	// Upload PDF to channel
 	err := is.uploadFileToSlack(ctx, filename, pdfBytes, channelID, message)
@@ -283,114 +675,142 @@ func (is *InvoiceService) SendInvoiceToSlack(userID, channelID string, invoice *
 
 		// Fallback: send to user's DM with debug note
 		debugMessage := message + fmt.Sprintf("\n\n:warning: _This file was not sent to the channel because of: %v. Perhaps add the bot to the channel?_", err)
-
-		// Open DM channel with user
-		dmChannel, _, _, dmErr := is.slackClient.OpenConversationContext(ctx, &slack.OpenConversationParameters{
-			Users: []string{userID},
-		})
-		if dmErr != nil {
-			return fmt.Errorf("failed to open DM channel: %v (original upload error: %v)", dmErr, err)
-		}
-
-		// Upload to DM
-		err = is.uploadFileToSlack(ctx, filename, pdfBytes, dmChannel.ID, debugMessage)
-		if err != nil {
-			return fmt.Errorf("failed to upload invoice to both channel and DM: %v (channel error: %v)", err, err)
+		if dmErr := is.uploadFileToDM(ctx, userID, filename, pdfBytes, debugMessage); dmErr != nil {
+			return fmt.Errorf("%v (channel error: %v)", dmErr, err)
 		}
 	}
 
 	return nil
 }
 
+// SendInvoicePreview uploads the invoice PDF to the user's DM only, marked as a preview
+func (is *InvoiceService) SendInvoicePreview(ctx context.Context, userID string, invoice *models.InvoiceData, pdfBytes []byte) error {
+	message := ":mag: _Preview only, nothing has been posted or numbered. Run `/create-invoice` to send it._\n\n" + invoiceMessage(invoice)
+	filename := fmt.Sprintf("Invoice_%s_preview.pdf", invoice.InvoiceNumber)
+	return is.uploadFileToDM(ctx, userID, filename, pdfBytes, message)
+}
+
+// uploadFileToDM uploads a file to the user's direct messages with the bot
+func (is *InvoiceService) uploadFileToDM(ctx context.Context, userID, filename string, fileBytes []byte, message string) error {
+	dmChannel, _, _, err := slackClientFrom(ctx, is.slackClient).OpenConversationContext(ctx, &slack.OpenConversationParameters{
+		Users: []string{userID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open DM channel: %v", err)
+	}
+	if err := is.uploadFileToSlack(ctx, filename, fileBytes, dmChannel.ID, message); err != nil {
+		return fmt.Errorf("failed to upload invoice to DM: %v", err)
+	}
+	return nil
+}
+
+// invoiceMessage is the text posted with an invoice PDF
+func invoiceMessage(invoice *models.InvoiceData) string {
+	// Mention discount and tax separately so the channel can see how the total was reached
+	totals := invoice.ComputeTotals()
+	amountDue := utils.FormatMoney(totals.Total)
+	var adjustments []string
+	if totals.Discount.Minor > 0 {
+		adjustments = append(adjustments, fmt.Sprintf("%s: -%s", invoice.DiscountDescription(), utils.FormatMoney(totals.Discount)))
+	}
+	if invoice.TaxRate > 0 {
+		adjustments = append(adjustments, fmt.Sprintf("incl. %s: %s", invoice.TaxDescription(), utils.FormatMoney(totals.Tax)))
+	}
+	if len(adjustments) > 0 {
+		amountDue += " (" + strings.Join(adjustments, ", ") + ")"
+	}
+
+	// Create message
+	message := fmt.Sprintf(
+		"📄 *Invoice #%s* for *%s*\n\n*Amount Due:* %s\n*Due Date:* %s\n*Email:* %s\n\nPlease find the PDF invoice attached.",
+		invoice.InvoiceNumber, invoice.ClientName, amountDue, invoice.DateDue, invoice.ClientEmail,
+	)
+	if invoice.PayLink != "" {
+		message += fmt.Sprintf("\n*Pay online:* <%s|Pay now>", invoice.PayLink)
+	}
+	return message
+}
+
 func (is *InvoiceService) ParseInvoiceDataFromModal(values map[string]map[string]slack.BlockAction) (*models.InvoiceData, error) {
 	invoice := &models.InvoiceData{
 		LineItems: []models.InvoiceLineItem{},
 	}
 
 	// Parse invoice number override (can be empty for auto-generation)
-	overrideInvoiceNumber := values["invoice_number_block"]["invoice_number_input"].Value
+	overrideInvoiceNumber, _ := getValue(values, "invoice_number_block", "invoice_number_input")
 	invoice.InvoiceNumber = strings.TrimSpace(overrideInvoiceNumber) // Can be empty, will be handled by caller
 
-	// Parse other basic fields
-	invoice.ClientName = values["client_name_block"]["client_name_input"].Value
-	invoice.ClientAddress = values["client_address_block"]["client_address_input"].Value
-	invoice.ClientEmail = values["client_email_block"]["client_email_input"].Value
-	invoice.DateDue = values["date_due_block"]["date_due_input"].Value
-
-	// Parse currency (default to USD)
-	if currencyBlock, exists := values["currency_block"]; exists {
-		invoice.Currency = strings.ToUpper(strings.TrimSpace(currencyBlock["currency_input"].Value))
+	// Parse other basic fields; the caller reports the required ones when empty
+	required := func(blockID, actionID string) (string, error) {
+		value, ok := getValue(values, blockID, actionID)
+		if !ok {
+			return "", &InvoiceFieldError{BlockID: blockID, Message: missingFieldMessage}
+		}
+		return value, nil
 	}
-	if invoice.Currency == "" {
-		invoice.Currency = "USD"
+	var err error
+	if invoice.ClientName, err = required("client_name_block", "client_name_input"); err != nil {
+		return nil, err
 	}
-
-	// Parse notes (optional)
-	if notesBlock, exists := values["notes_block"]; exists {
-		invoice.Notes = strings.TrimSpace(notesBlock["notes_input"].Value)
+	invoice.ClientAddress, _ = getValue(values, "client_address_block", "client_address_input")
+	if invoice.ClientEmail, err = required("client_email_block", "client_email_input"); err != nil {
+		return nil, err
 	}
-
-	// Parse line items from the new format
-	lineItemsText := values["line_items_block"]["line_items_input"].Value
-	if lineItemsText == "" {
-		return nil, fmt.Errorf("at least one line item is required")
+	invoice.ClientEmail = strings.TrimSpace(invoice.ClientEmail)
+	if invoice.DateDue, err = required("date_due_block", "date_due_input"); err != nil {
+		return nil, err
 	}
 
-	// Split by lines and parse each line item
-	lines := strings.Split(strings.TrimSpace(lineItemsText), "\n")
-	for lineNum, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue // Skip empty lines
-		}
-
-		// Parse line in format: "Service Description | Price | Quantity"
-		parts := strings.Split(line, "|")
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("line %d is not in the correct format. Expected: 'Service | Price | Quantity'", lineNum+1)
-		}
-
-		// Extract service description (everything before the first pipe)
-		serviceDesc := strings.TrimSpace(parts[0])
-		if serviceDesc == "" {
-			return nil, fmt.Errorf("service description on line %d cannot be empty", lineNum+1)
-		}
+	// Parse currency (default to USD). Modals opened before the select was added have a text input.
+	currency, ok := getSelectedOption(values, "currency_block", "currency_select")
+	if !ok {
+		currency, _ = getValue(values, "currency_block", "currency_input")
+	}
+	if invoice.Currency, err = utils.NormalizeCurrency(currency); err != nil {
+		return nil, &InvoiceFieldError{BlockID: "currency_block", Message: err.Error()}
+	}
 
-		// Extract price (second part)
-		var unitPrice float64
-		var err error
-		if len(parts) >= 2 {
-			priceStr := strings.TrimSpace(parts[1])
-			unitPrice, err = strconv.ParseFloat(priceStr, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid price '%s' on line %d: %v", priceStr, lineNum+1, err)
-			}
+	// Parse tax (optional)
+	rawTaxRate, _ := getValue(values, "tax_block", "tax_rate_input")
+	taxRate, err := ParseTaxRate(rawTaxRate)
+	if err != nil {
+		return nil, &InvoiceFieldError{BlockID: "tax_block", Message: err.Error()}
+	}
+	invoice.TaxRate = taxRate
+	taxLabel, _ := getValue(values, "tax_label_block", "tax_label_input")
+	invoice.TaxLabel = strings.TrimSpace(taxLabel)
+
+	// Parse pay link (optional), shown as a QR code on the PDF. Clients pay through it, so
+	// plain http links are rejected.
+	if payLink, _ := getValue(values, "pay_link_block", "pay_link_input"); strings.TrimSpace(payLink) != "" {
+		payLink = strings.TrimSpace(payLink)
+		u, err := url.Parse(payLink)
+		if err != nil || u.Host == "" || u.Scheme != "https" {
+			return nil, &InvoiceFieldError{BlockID: "pay_link_block", Message: "Please enter a full payment URL starting with https://"}
 		}
+		invoice.PayLink = payLink
+	}
 
-		// Extract quantity (third part, optional - defaults to 1)
-		quantity := 1
-		if len(parts) >= 3 {
-			quantityStr := strings.TrimSpace(parts[2])
-			if quantityStr != "" {
-				parsedQuantity, err := strconv.Atoi(quantityStr)
-				if err != nil {
-					return nil, fmt.Errorf("invalid quantity '%s' on line %d: %v", quantityStr, lineNum+1, err)
-				}
-				if parsedQuantity > 0 {
-					quantity = parsedQuantity
-				}
-			}
-		}
+	// Parse notes (optional)
+	notes, _ := getValue(values, "notes_block", "notes_input")
+	invoice.Notes = strings.TrimSpace(notes)
 
-		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{
-			ServiceDescription: serviceDesc,
-			UnitPrice:          unitPrice,
-			Quantity:           quantity,
-		})
+	// Parse line items, one row per item
+	lineItems, err := is.parseLineItemRows(values)
+	if err != nil {
+		return nil, err
 	}
+	invoice.LineItems = lineItems
 
-	if len(invoice.LineItems) == 0 {
-		return nil, fmt.Errorf("at least one valid line item is required")
+	// Parse discount (optional), applied to the subtotal before tax
+	rawDiscount, _ := getValue(values, "discount_block", "discount_input")
+	invoice.DiscountPercent, invoice.DiscountAmount, err = ParseDiscount(rawDiscount, invoice.Currency)
+	if err != nil {
+		return nil, &InvoiceFieldError{BlockID: "discount_block", Message: err.Error()}
+	}
+	// Compared before converting to minor units too, since a huge amount would overflow them
+	if totals := invoice.ComputeTotals(); invoice.DiscountAmount > totals.Subtotal.Major() || totals.Discount.Minor > totals.Subtotal.Minor {
+		return nil, &InvoiceFieldError{BlockID: "discount_block", Message: "Discount can't be more than the invoice subtotal"}
 	}
 
 	return invoice, nil
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+	"paymentbot/models"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/slack-go/slack"
+)
+
+const longDescription = "Monthly retainer covering website hosting, security patching, uptime monitoring, " +
+	"weekly backups, two hours of content updates and priority email support for the marketing site"
+
+// pdfPageCount counts the page objects in a generated PDF
+func pdfPageCount(pdf []byte) int {
+	return bytes.Count(pdf, []byte("/Type /Page\n"))
+}
+
+// pdfStreams inflates a generated PDF's streams in order, so text drawn in a core font can
+// be searched. Each page's content is one stream.
+func pdfStreams(pdf []byte) []string {
+	var streams []string
+	for _, part := range bytes.Split(pdf, []byte(">>\nstream\n"))[1:] {
+		end := bytes.Index(part, []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(part[:end]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(r)
+		streams = append(streams, string(inflated))
+	}
+	return streams
+}
+
+func TestTableWidthFollowsColumns(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{}, counter.NewMemoryCounterStore())
+	if got := is.tableWidth(); got != config.InvoiceTableWidth {
+		t.Errorf("default table width = %g, want %g", got, config.InvoiceTableWidth)
+	}
+
+	is = NewInvoiceService(nil, &config.Config{InvoiceColumnWidths: [4]float64{70, 20, 30, 30}}, counter.NewMemoryCounterStore())
+	if got := is.tableWidth(); got != 150 {
+		t.Errorf("custom table width = %g, want 150", got)
+	}
+}
+
+func TestLongDescriptionsWrap(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{}, counter.NewMemoryCounterStore())
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Arial", "", 10)
+
+	descWidth := is.columns[0]
+	if got := is.wrappedHeight(pdf, "Consulting", descWidth, 6); got != 6 {
+		t.Errorf("short description height = %g, want one 6mm line", got)
+	}
+	if got := is.wrappedHeight(pdf, longDescription, descWidth, 6); got < 12 {
+		t.Errorf("long description height = %g, want it wrapped onto several lines", got)
+	}
+	// A narrower column needs more lines
+	if wide, narrow := is.wrappedHeight(pdf, longDescription, descWidth, 6), is.wrappedHeight(pdf, longDescription, 50, 6); narrow <= wide {
+		t.Errorf("height at 50mm = %g, want more than %g at %gmm", narrow, wide, descWidth)
+	}
+}
+
+func TestGenerateInvoicePDFMovesWrappedRowsToNewPages(t *testing.T) {
+	invoice := func(description string, items int) *models.InvoiceData {
+		data := &models.InvoiceData{InvoiceNumber: "INV-1", ClientName: "Acme Ltd", DateDue: "2026-12-31", Currency: "USD"}
+		for i := 0; i < items; i++ {
+			data.LineItems = append(data.LineItems, models.InvoiceLineItem{ServiceDescription: description, UnitPrice: 100, Quantity: 1})
+		}
+		return data
+	}
+
+	for _, columns := range [][4]float64{config.DefaultInvoiceColumnWidths, {70, 20, 30, 30}} {
+		is := NewInvoiceService(nil, &config.Config{InvoiceColumnWidths: columns}, counter.NewMemoryCounterStore())
+
+		short, err := is.GenerateInvoicePDF(invoice("Consulting", 12))
+		if err != nil {
+			t.Fatalf("GenerateInvoicePDF error: %v", err)
+		}
+		long, err := is.GenerateInvoicePDF(invoice(strings.Repeat(longDescription+" ", 2), 12))
+		if err != nil {
+			t.Fatalf("GenerateInvoicePDF error: %v", err)
+		}
+		if pdfPageCount(short) != 1 {
+			t.Errorf("columns %v: short invoice has %d pages, want 1", columns, pdfPageCount(short))
+		}
+		if pdfPageCount(long) < 2 {
+			t.Errorf("columns %v: wrapped invoice has %d pages, want the rows to continue on a new page", columns, pdfPageCount(long))
+		}
+	}
+}
+
+func TestParseInvoicePayLink(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{}, counter.NewMemoryCounterStore())
+	tests := []struct {
+		payLink string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"  https://buy.stripe.com/test_123  ", "https://buy.stripe.com/test_123", false},
+		{"http://buy.stripe.com/test_123", "", true},
+		{"buy.stripe.com/test_123", "", true},
+		{"https://", "", true},
+		{"javascript:alert(1)", "", true},
+	}
+	for _, tt := range tests {
+		values := invoiceFormValues("USD")
+		values["pay_link_block"] = map[string]slack.BlockAction{"pay_link_input": {Value: tt.payLink}}
+
+		invoice, err := is.ParseInvoiceDataFromModal(values)
+		if tt.wantErr {
+			var fieldErr *InvoiceFieldError
+			if !errors.As(err, &fieldErr) || fieldErr.BlockID != "pay_link_block" || !strings.Contains(fieldErr.Message, "https://") {
+				t.Errorf("pay link %q: error = %v, want an https:// error on pay_link_block", tt.payLink, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("pay link %q: error %v", tt.payLink, err)
+			continue
+		}
+		if invoice.PayLink != tt.want {
+			t.Errorf("pay link %q parsed as %q, want %q", tt.payLink, invoice.PayLink, tt.want)
+		}
+	}
+}
+
+func TestInvoiceModalAtTheLineItemLimitFitsSlack(t *testing.T) {
+	view := BuildInvoiceModalView("C1", "INV-1001")
+	current := slack.View{Title: view.Title, Submit: view.Submit, Close: view.Close, CallbackID: view.CallbackID, Blocks: view.Blocks}
+	for i := 0; i < config.MaxInvoiceLineItemsLimit+5; i++ {
+		next := BuildInvoiceModalWithAnotherLineItem(current, config.MaxInvoiceLineItemsLimit)
+		current.Blocks = next.Blocks
+	}
+
+	rows, hasAddButton := 0, false
+	for _, block := range current.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && strings.HasPrefix(input.BlockID, invoiceLineItemBlockPrefix+"_") {
+			rows++
+		}
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.BlockID == invoiceLineItemActionsBlock {
+			hasAddButton = true
+		}
+	}
+	if rows != config.MaxInvoiceLineItemsLimit || hasAddButton {
+		t.Errorf("%d rows with add button %v, want %d rows and no button", rows, hasAddButton, config.MaxInvoiceLineItemsLimit)
+	}
+	// The error banner is the only block added after the rows
+	if blocks := len(current.Blocks.BlockSet) + 1; blocks > config.SlackMaxModalBlocks {
+		t.Errorf("modal has %d blocks with an error banner, Slack allows %d", blocks, config.SlackMaxModalBlocks)
+	}
+}
+
+func TestLineItemCountLimit(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{InvoiceMaxLineItems: 3}, counter.NewMemoryCounterStore())
+
+	if err := is.ValidateLineItemCount("a | 1\n\nb | 2\nc | 3\n"); err != nil {
+		t.Errorf("3 pasted items rejected: %v", err)
+	}
+	err := is.ValidateLineItemCount("a | 1\nb | 2\nc | 3\nd | 4")
+	if err == nil || !strings.Contains(err.Error(), "limited to 3 line items (you entered 4)") || !strings.Contains(err.Error(), "API/bulk") {
+		t.Errorf("4 pasted items error = %v, want the limit and the bulk path suggested", err)
+	}
+
+	values := map[string]map[string]slack.BlockAction{}
+	for row := 1; row <= 4; row++ {
+		values[blockID(invoiceLineItemBlockPrefix, row)] = map[string]slack.BlockAction{invoiceLineItemActionID: {Value: "Item | 10"}}
+	}
+	_, err = is.parseLineItemRows(values)
+	var fieldErr *InvoiceFieldError
+	if !errors.As(err, &fieldErr) || fieldErr.BlockID != blockID(invoiceLineItemBlockPrefix, 4) {
+		t.Errorf("4 rows error = %v, want it on the fourth row", err)
+	}
+	delete(values, blockID(invoiceLineItemBlockPrefix, 4))
+	if items, err := is.parseLineItemRows(values); err != nil || len(items) != 3 {
+		t.Errorf("3 rows = %d items, %v, want 3", len(items), err)
+	}
+}
+
+func TestParseDiscount(t *testing.T) {
+	tests := []struct {
+		raw         string
+		currency    string
+		wantPercent float64
+		wantAmount  float64
+		wantErr     bool
+	}{
+		{"", "USD", 0, 0, false},
+		{"10%", "USD", 10, 0, false},
+		{" 12.5 % ", "USD", 12.5, 0, false},
+		{"25.00", "USD", 0, 25, false},
+		{"$1,250.50", "USD", 0, 1250.5, false},
+		{"1500", "JPY", 0, 1500, false},
+		{"10.5", "JPY", 0, 0, true},
+		{"10.999", "USD", 0, 0, true},
+		{"-5", "USD", 0, 0, true},
+		{"150%", "USD", 0, 0, true},
+		{"-1%", "USD", 0, 0, true},
+		{"NaN%", "USD", 0, 0, true},
+		{"Inf%", "USD", 0, 0, true},
+		{"NaN", "USD", 0, 0, true},
+		{"Inf", "USD", 0, 0, true},
+		{"1e30", "USD", 0, 0, true},
+		{"1e300", "USD", 0, 0, true},
+		{"ten", "USD", 0, 0, true},
+	}
+	for _, tt := range tests {
+		percent, amount, err := ParseDiscount(tt.raw, tt.currency)
+		if (err != nil) != tt.wantErr || percent != tt.wantPercent || amount != tt.wantAmount {
+			t.Errorf("ParseDiscount(%q, %s) = %v, %v, %v, want %v, %v (error %v)", tt.raw, tt.currency, percent, amount, err, tt.wantPercent, tt.wantAmount, tt.wantErr)
+		}
+	}
+}
+
+func TestInvoiceDiscountCap(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{}, counter.NewMemoryCounterStore())
+	// The line items come to $200.00
+	tests := []struct {
+		discount  string
+		wantTotal int64
+		wantErr   bool
+	}{
+		{"50", 15000, false},
+		{"200.00", 0, false},
+		{"100%", 0, false},
+		{"200.01", 0, true},
+		{"1000000000000000000000000000000", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.discount, func(t *testing.T) {
+			values := invoiceFormValues("USD")
+			values["discount_block"] = map[string]slack.BlockAction{"discount_input": {Value: tt.discount}}
+
+			invoice, err := is.ParseInvoiceDataFromModal(values)
+			if tt.wantErr {
+				var fieldErr *InvoiceFieldError
+				if !errors.As(err, &fieldErr) || fieldErr.BlockID != "discount_block" {
+					t.Fatalf("ParseInvoiceDataFromModal error = %v, want a discount_block error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseInvoiceDataFromModal error: %v", err)
+			}
+			if total := invoice.ComputeTotals().Total; total.Minor != tt.wantTotal {
+				t.Errorf("total = %d cents, want %d", total.Minor, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestParseTaxRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"10", 10, false},
+		{" 7.5% ", 7.5, false},
+		{"0", 0, false},
+		{"-5", 0, true},
+		{"150", 0, true},
+		{"ten", 0, true},
+		{"NaN", 0, true},
+		{"nan%", 0, true},
+		{"Inf", 0, true},
+		{"-Inf", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTaxRate(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTaxRate(%q) = %v, %v, want %v (error %v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestInvoiceMessageShowsTheTaxedTotal(t *testing.T) {
+	invoice := &models.InvoiceData{
+		InvoiceNumber: "1001",
+		Currency:      "USD",
+		LineItems:     []models.InvoiceLineItem{{ServiceDescription: "Hosting", UnitPrice: 19.99, Quantity: 1}},
+		TaxRate:       7.5,
+		TaxLabel:      "VAT",
+	}
+	if got, want := invoiceMessage(invoice), "*Amount Due:* $21.49 (incl. VAT (7.5%): $1.50)"; !strings.Contains(got, want) {
+		t.Errorf("invoiceMessage() = %q, want it to contain %q", got, want)
+	}
+
+	invoice.TaxRate = 0
+	if got, want := invoiceMessage(invoice), "*Amount Due:* $19.99\n"; !strings.Contains(got, want) {
+		t.Errorf("invoiceMessage() without tax = %q, want it to contain %q", got, want)
+	}
+}
+
+func TestGenerateInvoicePDFShowsTheConfiguredCompany(t *testing.T) {
+	invoice := &models.InvoiceData{
+		InvoiceNumber: "1001",
+		ClientName:    "Client Co",
+		DateDue:       "2026-12-31",
+		Currency:      "USD",
+		LineItems:     []models.InvoiceLineItem{{ServiceDescription: "Consulting", UnitPrice: 100, Quantity: 1}},
+	}
+	// The core font keeps the text readable in the content stream
+	cfg := &config.Config{
+		InvoiceFontPath: "/nonexistent/font.ttf",
+		InvoiceCompany: models.InvoiceCompany{
+			Name:         "Acme Trading Ltd",
+			AddressLines: []string{"1 Harbour Road", "Wan Chai"},
+			Phone:        "+852 5555 0100",
+		},
+	}
+
+	pdf, err := NewInvoiceService(nil, cfg, counter.NewMemoryCounterStore()).GenerateInvoicePDF(invoice)
+	if err != nil {
+		t.Fatalf("GenerateInvoicePDF error: %v", err)
+	}
+	content := strings.Join(pdfStreams(pdf), "")
+	for _, want := range []string{"(Acme Trading Ltd)", "(1 Harbour Road)", "(Wan Chai)", "(+852 5555 0100)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("PDF doesn't show %s", want)
+		}
+	}
+
+	cfg.InvoiceCompany = models.InvoiceCompany{}
+	pdf, err = NewInvoiceService(nil, cfg, counter.NewMemoryCounterStore()).GenerateInvoicePDF(invoice)
+	if err != nil {
+		t.Fatalf("GenerateInvoicePDF without a company error: %v", err)
+	}
+	if content := strings.Join(pdfStreams(pdf), ""); strings.Contains(content, "Acme") || !strings.Contains(content, "(INVOICE)") {
+		t.Error("PDF without a configured company should show only the invoice itself")
+	}
+}
+
+func TestGenerateInvoicePDFWithFiftyLineItems(t *testing.T) {
+	invoice := &models.InvoiceData{InvoiceNumber: "1001", ClientName: "Client Co", DateDue: "2026-12-31", Currency: "USD"}
+	for i := 1; i <= 50; i++ {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{ServiceDescription: fmt.Sprintf("Item %d", i), UnitPrice: 10, Quantity: 1})
+	}
+	// The core font keeps the text readable in the content streams
+	is := NewInvoiceService(nil, &config.Config{InvoiceFontPath: "/nonexistent/font.ttf"}, counter.NewMemoryCounterStore())
+
+	pdf, err := is.GenerateInvoicePDF(invoice)
+	if err != nil {
+		t.Fatalf("GenerateInvoicePDF error: %v", err)
+	}
+	pages := pdfStreams(pdf)
+	if pdfPageCount(pdf) < 2 || len(pages) != pdfPageCount(pdf) {
+		t.Fatalf("50-item invoice has %d pages (%d content streams), want more than 1", pdfPageCount(pdf), len(pages))
+	}
+
+	for i, page := range pages {
+		// The totals box may move to a page of its own, which has no rows to head
+		if strings.Contains(page, "(Item ") && !strings.Contains(page, "(Description)") {
+			t.Errorf("page %d has line items but no table header", i+1)
+		}
+		if hasTotals := strings.Contains(page, "(Amount Due:)"); hasTotals != (i == len(pages)-1) {
+			t.Errorf("page %d shows the totals: %v, want them only on the last page", i+1, hasTotals)
+		}
+	}
+	all := strings.Join(pages, "")
+	for _, item := range []string{"(Item 1)", "(Item 25)", "(Item 50)", "($500.00)"} {
+		if !strings.Contains(all, item) {
+			t.Errorf("PDF doesn't show %s", item)
+		}
+	}
+}
+
+func TestGenerateInvoicePDFPrintsThePayLinkQR(t *testing.T) {
+	// The core font keeps the text readable in the content stream
+	is := NewInvoiceService(nil, &config.Config{InvoiceFontPath: "/nonexistent/font.ttf"}, counter.NewMemoryCounterStore())
+	tests := []struct {
+		name    string
+		payLink string
+		wantQR  bool
+	}{
+		{"no pay link", "", false},
+		{"payment link", "https://buy.stripe.com/test_6oE9Bf0Jx2nM", true},
+		{"long link", "https://pay.example.com/checkout?ref=" + strings.Repeat("a", 300), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := &models.InvoiceData{
+				InvoiceNumber: "1001",
+				ClientName:    "Client Co",
+				DateDue:       "2026-12-31",
+				Currency:      "USD",
+				PayLink:       tt.payLink,
+				LineItems:     []models.InvoiceLineItem{{ServiceDescription: "Consulting", UnitPrice: 100, Quantity: 1}},
+			}
+			pdf, err := is.GenerateInvoicePDF(invoice)
+			if err != nil {
+				t.Fatalf("GenerateInvoicePDF error: %v", err)
+			}
+			content := strings.Join(pdfStreams(pdf), "")
+			if got := strings.Contains(content, "(Scan to pay online)"); got != tt.wantQR {
+				t.Errorf("PDF shows the scan caption = %v, want %v", got, tt.wantQR)
+			}
+			// Each dark module is a filled rectangle, and even the smallest code has well over 100
+			if modules := strings.Count(content, " re f"); tt.wantQR && modules < 100 {
+				t.Errorf("PDF has %d filled rectangles, want a QR code", modules)
+			}
+		})
+	}
+}
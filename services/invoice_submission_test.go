@@ -0,0 +1,433 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+	"paymentbot/models"
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
+)
+
+func newInvoiceTestService(t *testing.T, client *slack.Client, cfg *config.Config) (*SlackService, counter.CounterStore) {
+	t.Helper()
+	counters := counter.NewMemoryCounterStore()
+	s := &SlackService{
+		client:         client,
+		invoiceService: NewInvoiceService(client, cfg, counters),
+		invoiceGuard:   NewDuplicateInvoiceGuard(0),
+	}
+	return s, counters
+}
+
+func invoiceFormValues(currency string) map[string]map[string]slack.BlockAction {
+	return map[string]map[string]slack.BlockAction{
+		"client_name_block":  {"client_name_input": {Value: "Acme Ltd"}},
+		"client_email_block": {"client_email_input": {Value: "billing@acme.test"}},
+		"date_due_block":     {"date_due_input": {Value: "2026-12-31"}},
+		"currency_block":     {"currency_select": {SelectedOption: slack.OptionBlockObject{Value: currency}}},
+		"line_items_block":   {"line_items_input": {Value: "Consulting | 100 | 2"}},
+	}
+}
+
+func TestSubmitInvoiceReleasesNumberWhenUploadFails(t *testing.T) {
+	// Neither the channel nor the DM fallback accepts the file
+	client, _ := newFakeSlack(t, "C1", "D_USER")
+	s, counters := newInvoiceTestService(t, client, &config.Config{})
+
+	view := BuildInvoiceModalView("C1", "INV-1001")
+	submitted := &slack.View{Title: view.Title, Submit: view.Submit, Close: view.Close, CallbackID: view.CallbackID, Blocks: view.Blocks}
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("USD"), View: submitted}, false)
+
+	// Not a field error, so the form is redrawn with a banner instead of blaming an input
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %s: %v", rec.Body.String(), err)
+	}
+	if resp.ResponseAction != slack.RAUpdate || resp.View == nil {
+		t.Fatalf("response = %s, want the invoice modal updated", rec.Body.String())
+	}
+	banner, ok := resp.View.Blocks.BlockSet[0].(*slack.SectionBlock)
+	if !ok || banner.BlockID != invoiceErrorBlock || !strings.Contains(banner.Text.Text, "Error sending invoice") {
+		t.Errorf("first block = %+v, want the send error banner", resp.View.Blocks.BlockSet[0])
+	}
+	if len(resp.View.Blocks.BlockSet) != len(submitted.Blocks.BlockSet)+1 {
+		t.Errorf("updated view has %d blocks, want the %d form blocks plus the banner", len(resp.View.Blocks.BlockSet), len(submitted.Blocks.BlockSet))
+	}
+
+	last, _ := counters.Last(context.Background(), "T1", "C1")
+	if last != counter.DefaultStart {
+		t.Errorf("counter = %d after a failed invoice, want %d so the number is reused", last, counter.DefaultStart)
+	}
+}
+
+func TestSubmitInvoiceKeepsNumberWhenSent(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, counters := newInvoiceTestService(t, client, &config.Config{})
+
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("USD")}, false)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("response = %d %s, want an empty 200 closing the modal", rec.Code, rec.Body.String())
+	}
+	if got := files.sharedTo(); len(got) != 1 || got[0] != "C1" {
+		t.Errorf("invoice shared to %v, want [C1]", got)
+	}
+
+	last, _ := counters.Last(context.Background(), "T1", "C1")
+	if last != counter.DefaultStart+1 {
+		t.Errorf("counter = %d, want %d", last, counter.DefaultStart+1)
+	}
+}
+
+func TestInvoicePreviewLeavesTheCounterAlone(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+	}{
+		{"auto-numbered", ""},
+		{"manual number ahead of the counter", "5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, files := newFakeSlack(t)
+			s, counters := newInvoiceTestService(t, client, &config.Config{})
+			values := invoiceFormValues("USD")
+			if tt.number != "" {
+				values["invoice_number_block"] = map[string]slack.BlockAction{"invoice_number_input": {Value: tt.number}}
+			}
+
+			rec := httptest.NewRecorder()
+			s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values, Preview: true}, false)
+			if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+				t.Fatalf("response = %d %s, want an empty 200 closing the modal", rec.Code, rec.Body.String())
+			}
+			if got := files.sharedTo(); len(got) != 1 || got[0] != "D_USER" {
+				t.Errorf("preview shared to %v, want only the user's DM", got)
+			}
+			if last, _ := counters.Last(context.Background(), "T1", "C1"); last != counter.DefaultStart {
+				t.Errorf("counter = %d after a preview, want it untouched at %d", last, counter.DefaultStart)
+			}
+
+			// The real invoice afterwards still gets the next number
+			rec = httptest.NewRecorder()
+			s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("USD")}, false)
+			if last, _ := counters.Last(context.Background(), "T1", "C1"); last != counter.DefaultStart+1 {
+				t.Errorf("counter = %d after the real invoice, want %d", last, counter.DefaultStart+1)
+			}
+		})
+	}
+}
+
+func TestSubmitInvoiceWithANumberFormat(t *testing.T) {
+	format, err := utils.ParseInvoiceNumberFormat("INV-{year}-{seq:04d}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := newFakeSlack(t)
+	s, counters := newInvoiceTestService(t, client, &config.Config{InvoiceNumberFormat: format})
+	if got, want := s.invoiceService.FormatInvoiceNumber(7), fmt.Sprintf("INV-%d-0007", time.Now().Year()); got != want {
+		t.Errorf("FormatInvoiceNumber(7) = %q, want %q", got, want)
+	}
+
+	// A manual number in the configured format moves the counter up to its sequence
+	values := invoiceFormValues("USD")
+	values["invoice_number_block"] = map[string]slack.BlockAction{"invoice_number_input": {Value: "INV-2026-1500"}}
+	s.submitInvoice(context.Background(), httptest.NewRecorder(), &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values}, false)
+	if last, _ := counters.Last(context.Background(), "T1", "C1"); last != 1500 {
+		t.Errorf("counter = %d after INV-2026-1500, want 1500", last)
+	}
+
+	s.submitInvoice(context.Background(), httptest.NewRecorder(), &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("USD")}, false)
+	if last, _ := counters.Last(context.Background(), "T1", "C1"); last != 1501 {
+		t.Errorf("counter = %d after an auto-numbered invoice, want 1501", last)
+	}
+}
+
+// pdfShownText returns the strings shown by the compressed page streams in data, which may be
+// a PDF wrapped in a multipart upload
+func pdfShownText(t *testing.T, data []byte) string {
+	t.Helper()
+	var content strings.Builder
+	for _, match := range regexp.MustCompile(`/Length (\d+)[^>]*>>\s*stream\r?\n`).FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		if match[1]+length > len(data) {
+			continue
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(data[match[1] : match[1]+length]))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(reader)
+		for _, shown := range regexp.MustCompile(`(?s)Td \((.*?)\)Tj`).FindAllSubmatch(inflated, -1) {
+			content.Write(shown[1])
+			content.WriteByte('\n')
+		}
+	}
+	return content.String()
+}
+
+// pdfText encodes text the way the invoice font writes it into a content stream, as UTF-16BE
+func pdfText(text string) string {
+	var encoded strings.Builder
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded.WriteByte(byte(unit >> 8))
+		encoded.WriteByte(byte(unit))
+	}
+	return encoded.String()
+}
+
+func TestSubmitInvoiceInEuros(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	view := BuildInvoiceModalView("C1", "INV-1001")
+	values := modalState(t, view, map[string]string{
+		"client_name_block":  "Acme Ltd",
+		"client_email_block": "billing@acme.test",
+		"date_due_block":     "2026-12-31",
+		"currency_block":     "EUR",
+		"line_item_block_1":  "Consulting | 100 | 2",
+	})
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values}, false)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("response = %d %s, want an empty 200 closing the modal", rec.Code, rec.Body.String())
+	}
+
+	uploads := files.uploaded()
+	if len(uploads) != 1 {
+		t.Fatalf("%d files uploaded, want the invoice PDF", len(uploads))
+	}
+	content := pdfShownText(t, uploads[0])
+	for _, want := range []string{"Currency: EUR", "€100.00", "€200.00"} {
+		if !strings.Contains(content, pdfText(want)) {
+			t.Errorf("PDF doesn't show %q", want)
+		}
+	}
+	if strings.Contains(content, pdfText("$")) {
+		t.Error("PDF shows a dollar sign on a euro invoice")
+	}
+}
+
+func TestInvoiceModalCurrencyDefaultsToUSD(t *testing.T) {
+	if got := selectInitialValue(t, BuildInvoiceModalView("C1", "INV-1001"), "currency_block"); got != "USD" {
+		t.Errorf("invoice modal currency = %q, want USD", got)
+	}
+}
+
+func TestSubmitInvoiceWithAnUnknownCurrency(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: invoiceFormValues("XYZ")}, false)
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %s: %v", rec.Body.String(), err)
+	}
+	if resp.Errors["currency_block"] == "" {
+		t.Errorf("errors = %v, want one on currency_block", resp.Errors)
+	}
+	if got := files.sharedTo(); len(got) != 0 {
+		t.Errorf("invoice shared to %v with an unknown currency", got)
+	}
+}
+
+func TestSubmitInvoiceKeysFieldErrorsToTheirInput(t *testing.T) {
+	client, _ := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	values := invoiceFormValues("USD")
+	values["pay_link_block"] = map[string]slack.BlockAction{"pay_link_input": {Value: "http://example.com/pay"}}
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values}, false)
+
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %s: %v", rec.Body.String(), err)
+	}
+	if resp.ResponseAction != slack.RAErrors || resp.Errors["pay_link_block"] == "" || len(resp.Errors) != 1 {
+		t.Errorf("response = %s, want a single error on pay_link_block", rec.Body.String())
+	}
+}
+
+func TestSubmitInvoiceValidatesClientEmail(t *testing.T) {
+	tests := []struct {
+		email     string
+		wantError bool
+	}{
+		{"", true},
+		{"foo@", true},
+		{"foo@localhost", true},
+		{"Jane Doe <jane@example.com>", false},
+		{"billing@acme.test", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			client, files := newFakeSlack(t)
+			s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+			values := invoiceFormValues("USD")
+			values["client_email_block"] = map[string]slack.BlockAction{"client_email_input": {Value: tt.email}}
+			rec := httptest.NewRecorder()
+			s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values}, false)
+
+			if !tt.wantError {
+				if rec.Body.Len() > 0 {
+					t.Errorf("response = %s, want the invoice accepted", rec.Body.String())
+				}
+				return
+			}
+			var resp slack.ViewSubmissionResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response %s: %v", rec.Body.String(), err)
+			}
+			if resp.Errors["client_email_block"] == "" || len(resp.Errors) != 1 {
+				t.Errorf("response = %s, want a single error on client_email_block", rec.Body.String())
+			}
+			if shared := files.sharedTo(); len(shared) != 0 {
+				t.Errorf("invoice shared to %v despite the bad email", shared)
+			}
+		})
+	}
+}
+
+func TestBuildInvoiceModalWithErrorReplacesTheBanner(t *testing.T) {
+	view := BuildInvoiceModalView("C1", "INV-1001")
+	submitted := slack.View{Title: view.Title, CallbackID: view.CallbackID, PrivateMetadata: "C1", Blocks: view.Blocks}
+
+	first := BuildInvoiceModalWithError(submitted, "first")
+	submitted.Blocks = first.Blocks
+	second := BuildInvoiceModalWithError(submitted, "second")
+
+	banners := 0
+	for _, block := range second.Blocks.BlockSet {
+		if section, ok := block.(*slack.SectionBlock); ok && section.BlockID == invoiceErrorBlock {
+			banners++
+			if !strings.Contains(section.Text.Text, "second") {
+				t.Errorf("banner = %q, want the latest error", section.Text.Text)
+			}
+		}
+	}
+	if banners != 1 {
+		t.Errorf("got %d error banners, want 1", banners)
+	}
+	if second.CallbackID != view.CallbackID || second.PrivateMetadata != "C1" {
+		t.Errorf("callback %q / metadata %q not carried over", second.CallbackID, second.PrivateMetadata)
+	}
+}
+
+// modalState builds the state Slack submits for view when the user types inputs (block ID ->
+// value) into it. Inputs for blocks the view doesn't have fail the test.
+func modalState(t *testing.T, view slack.ModalViewRequest, inputs map[string]string) map[string]map[string]slack.BlockAction {
+	t.Helper()
+	values := map[string]map[string]slack.BlockAction{}
+	for _, block := range view.Blocks.BlockSet {
+		input, ok := block.(*slack.InputBlock)
+		if !ok {
+			continue
+		}
+		value, typed := inputs[input.BlockID]
+		if !typed {
+			continue
+		}
+		switch element := input.Element.(type) {
+		case *slack.PlainTextInputBlockElement:
+			values[input.BlockID] = map[string]slack.BlockAction{element.ActionID: {Value: value}}
+		case *slack.SelectBlockElement:
+			values[input.BlockID] = map[string]slack.BlockAction{element.ActionID: {SelectedOption: slack.OptionBlockObject{Value: value}}}
+		default:
+			t.Fatalf("block %s has an unsupported %T", input.BlockID, element)
+		}
+	}
+	for blockID := range inputs {
+		if _, ok := values[blockID]; !ok {
+			t.Fatalf("the modal has no input block %s", blockID)
+		}
+	}
+	return values
+}
+
+func TestSubmitInvoiceFromTheRealModal(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	view := BuildInvoiceModalView("C1", "INV-1001")
+	opened := slack.View{Blocks: view.Blocks}
+	view = BuildInvoiceModalWithAnotherLineItem(opened, config.DefaultInvoiceMaxLineItems)
+	values := modalState(t, view, map[string]string{
+		"client_name_block":  "Acme Ltd",
+		"client_email_block": "billing@acme.test",
+		"date_due_block":     "2026-12-31",
+		"currency_block":     "EUR",
+		"line_item_block_1":  "Consulting | 100 | 2",
+		"line_item_block_2":  "Support | 50",
+	})
+
+	invoice, err := s.invoiceService.ParseInvoiceDataFromModal(values)
+	if err != nil {
+		t.Fatalf("ParseInvoiceDataFromModal error: %v", err)
+	}
+	want := []models.InvoiceLineItem{
+		{ServiceDescription: "Consulting", UnitPrice: 100, Quantity: 2},
+		{ServiceDescription: "Support", UnitPrice: 50, Quantity: 1},
+	}
+	if len(invoice.LineItems) != len(want) {
+		t.Fatalf("line items = %+v, want %+v", invoice.LineItems, want)
+	}
+	for i := range want {
+		if invoice.LineItems[i] != want[i] {
+			t.Errorf("line item %d = %+v, want %+v", i+1, invoice.LineItems[i], want[i])
+		}
+	}
+	if invoice.ClientName != "Acme Ltd" || invoice.Currency != "EUR" || invoice.DateDue != "2026-12-31" {
+		t.Errorf("invoice = %+v", invoice)
+	}
+
+	rec := httptest.NewRecorder()
+	s.submitInvoice(context.Background(), rec, &invoiceSubmission{UserID: "U1", TeamID: "T1", ChannelID: "C1", Values: values}, false)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("response = %d %s, want an empty 200 closing the modal", rec.Code, rec.Body.String())
+	}
+	if got := files.sharedTo(); len(got) != 1 || got[0] != "C1" {
+		t.Errorf("invoice shared to %v, want [C1]", got)
+	}
+}
+
+func TestProcessInvoiceAddLineItem(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	modal := BuildInvoiceModalView("C1", "INV-1001")
+	interaction := &slack.InteractionCallback{View: slack.View{ID: "V1", Hash: "hash-1", CallbackID: modal.CallbackID, Blocks: modal.Blocks}}
+	if err := s.ProcessInvoiceAddLineItem(context.Background(), interaction); err != nil {
+		t.Fatalf("ProcessInvoiceAddLineItem error: %v", err)
+	}
+
+	var updates int
+	for _, call := range slackAPI.calls() {
+		if call.Method == "views.update" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("made %d views.update calls, want 1", updates)
+	}
+}
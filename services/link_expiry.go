@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+
+	"github.com/slack-go/slack"
+	"github.com/stripe/stripe-go/v82"
+)
+
+// linkExpirySweepInterval is how often Stripe links past their expiry are deactivated
+const linkExpirySweepInterval = 5 * time.Minute
+
+// RunLinkExpirySweep deactivates expired Stripe links until ctx is done and tells the channel
+// each link was posted to. Airwallex expires its links itself. Returns immediately when
+// Stripe isn't enabled.
+func (s *SlackService) RunLinkExpirySweep(ctx context.Context) {
+	if s.linkExpirer == nil {
+		return
+	}
+
+	ticker := time.NewTicker(linkExpirySweepInterval)
+	defer ticker.Stop()
+	loaded := false
+	for {
+		// Links created before a restart are found once; later ones are tracked as they're created
+		if !loaded {
+			if err := s.linkExpirer.LoadPending(ctx); err != nil {
+				log.Printf("Error finding payment links with an expiry, retrying on the next sweep: %v", err)
+			} else {
+				loaded = true
+			}
+		}
+		s.sweepExpiredLinks(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *SlackService) sweepExpiredLinks(ctx context.Context) {
+	// Without expiring links there's nothing to ask Stripe
+	if s.linkExpirer.Pending() == 0 {
+		return
+	}
+	expired, err := s.linkExpirer.DeactivateExpired(ctx, time.Now())
+	if err != nil {
+		log.Printf("Error sweeping expired payment links: %v", err)
+	}
+	for _, link := range expired {
+		s.notifyLinkExpired(ctx, link)
+	}
+}
+
+// trackLinkExpiry schedules a new Stripe link with an expiry for the sweep
+func (s *SlackService) trackLinkExpiry(provider models.PaymentProvider, paymentID string, data *models.PaymentLinkData) {
+	if s.linkExpirer == nil || provider != models.ProviderStripe || paymentID == "" || data.ExpiresAt.IsZero() {
+		return
+	}
+	s.linkExpirer.Track(paymentID, data.ExpiresAt)
+}
+
+// notifyLinkExpired posts to the channel stored in the link's metadata
+func (s *SlackService) notifyLinkExpired(ctx context.Context, link *stripe.PaymentLink) {
+	routing := payment.RoutingFromMetadata(link.Metadata)
+	if routing.ChannelID == "" {
+		return
+	}
+
+	text := fmt.Sprintf("The payment link for *%s* has expired and no longer accepts payments: %s", link.Metadata["service_name"], link.URL)
+	if routing.UserID != "" {
+		text = fmt.Sprintf("<@%s> %s", routing.UserID, text)
+	}
+	if _, _, err := s.ClientForTeam(ctx, routing.TeamID).PostMessageContext(ctx, routing.ChannelID, slack.MsgOptionText(text, false)); err != nil {
+		log.Printf("Error posting link expiry for %s to channel %s: %v", link.ID, routing.ChannelID, err)
+	}
+}
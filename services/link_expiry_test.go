@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+
+	"github.com/stripe/stripe-go/v82"
+)
+
+func TestNotifyLinkExpired(t *testing.T) {
+	client, slackAPI := newFakeSlack(t)
+	s := &SlackService{client: client, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	s.notifyLinkExpired(context.Background(), &stripe.PaymentLink{
+		ID:  "plink_1",
+		URL: "https://buy.stripe.com/test_1",
+		Metadata: map[string]string{
+			"service_name":                  "Hosting",
+			payment.SlackChannelMetadataKey: "C1",
+			payment.SlackUserMetadataKey:    "U1",
+		},
+	})
+	post := slackAPI.waitForPost(t, "chat.postMessage", "C1")
+	for _, want := range []string{"<@U1>", "*Hosting*", "has expired", "https://buy.stripe.com/test_1"} {
+		if !strings.Contains(post.Text, want) {
+			t.Errorf("expiry message %q is missing %q", post.Text, want)
+		}
+	}
+
+	// A link created outside the bot has nowhere to report to
+	s.notifyLinkExpired(context.Background(), &stripe.PaymentLink{ID: "plink_2", Metadata: map[string]string{"service_name": "Other"}})
+	time.Sleep(20 * time.Millisecond)
+	if calls := slackAPI.calls(); len(calls) != 1 {
+		t.Errorf("posted %d messages, want only the routed link's", len(calls))
+	}
+}
+
+func TestTrackLinkExpiry(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		provider    models.PaymentProvider
+		paymentID   string
+		expiresAt   time.Time
+		wantPending int
+	}{
+		{"stripe link with an expiry", models.ProviderStripe, "plink_1", expiresAt, 1},
+		{"stripe link without one", models.ProviderStripe, "plink_1", time.Time{}, 0},
+		{"airwallex expires its own links", models.ProviderAirwallex, "awx_1", expiresAt, 0},
+		{"no link ID", models.ProviderStripe, "", expiresAt, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SlackService{linkExpirer: payment.NewStripeLinkExpirer("sk_test")}
+			s.trackLinkExpiry(tt.provider, tt.paymentID, &models.PaymentLinkData{ExpiresAt: tt.expiresAt})
+			if got := s.linkExpirer.Pending(); got != tt.wantPending {
+				t.Errorf("Pending = %d, want %d", got, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"paymentbot/utils"
+)
+
+// LinkOrigin records where a payment link was created so provider webhooks can report back
+// to the right Slack channel
+type LinkOrigin struct {
+	TeamID      string    `json:"team_id,omitempty"` // workspace the channel belongs to
+	ChannelID   string    `json:"channel_id"`
+	UserID      string    `json:"user_id"`
+	Provider    string    `json:"provider"`
+	ServiceName string    `json:"service_name"`
+	LinkID      string    `json:"link_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Notified    bool      `json:"notified,omitempty"` // a payment confirmation has already been posted
+}
+
+// LinkOriginStore persists link origins keyed by provider link ID or reference
+type LinkOriginStore interface {
+	Save(key string, origin LinkOrigin) error
+	Get(key string) (LinkOrigin, bool)
+}
+
+// MemoryLinkOriginStore keeps link origins in memory. They are lost on restart.
+type MemoryLinkOriginStore struct {
+	mu      sync.RWMutex
+	origins map[string]LinkOrigin
+}
+
+// NewMemoryLinkOriginStore creates an empty in-memory origin store
+func NewMemoryLinkOriginStore() *MemoryLinkOriginStore {
+	return &MemoryLinkOriginStore{origins: make(map[string]LinkOrigin)}
+}
+
+// Save stores origin under key
+func (m *MemoryLinkOriginStore) Save(key string, origin LinkOrigin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.origins[key] = origin
+	return nil
+}
+
+// Get returns the origin stored under key
+func (m *MemoryLinkOriginStore) Get(key string) (LinkOrigin, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	origin, ok := m.origins[key]
+	return origin, ok
+}
+
+// FileLinkOriginStore keeps link origins in memory and mirrors them to a JSON file so
+// payments made after a restart are still routed
+type FileLinkOriginStore struct {
+	mu      sync.RWMutex
+	path    string
+	origins map[string]LinkOrigin
+}
+
+// NewFileLinkOriginStore loads (or creates) a JSON-backed origin store at path
+func NewFileLinkOriginStore(path string) (*FileLinkOriginStore, error) {
+	store := &FileLinkOriginStore{path: path, origins: make(map[string]LinkOrigin)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read link origin store %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.origins); err != nil {
+			return nil, fmt.Errorf("failed to parse link origin store %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// Save stores origin under key and rewrites the backing file
+func (f *FileLinkOriginStore) Save(key string, origin LinkOrigin) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.origins[key] = origin
+	data, err := json.Marshal(f.origins)
+	if err != nil {
+		return fmt.Errorf("failed to encode link origin store: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save link origin store: %w", err)
+	}
+	return nil
+}
+
+// Get returns the origin stored under key
+func (f *FileLinkOriginStore) Get(key string) (LinkOrigin, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	origin, ok := f.origins[key]
+	return origin, ok
+}
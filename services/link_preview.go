@@ -0,0 +1,68 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"paymentbot/models"
+)
+
+// pendingLinkTTL is how long a previewed payment link waits for the user to confirm it
+const pendingLinkTTL = 15 * time.Minute
+
+// pendingLink is a validated payment link request shown in the preview view
+type pendingLink struct {
+	Provider  models.PaymentProvider
+	Data      *models.PaymentLinkData
+	UserID    string
+	ChannelID string
+	CreatedAt time.Time
+}
+
+// pendingLinks holds previewed requests until they're confirmed. The preview view only
+// carries a token in its private metadata, since multi-item requests can exceed Slack's
+// 3000 character metadata limit.
+type pendingLinks struct {
+	mu    sync.Mutex
+	links map[string]pendingLink
+}
+
+func newPendingLinks() *pendingLinks {
+	return &pendingLinks{links: make(map[string]pendingLink)}
+}
+
+// hold stores a request awaiting confirmation and returns the token that identifies it
+func (p *pendingLinks) hold(link pendingLink) string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, entry := range p.links {
+		if link.CreatedAt.Sub(entry.CreatedAt) > pendingLinkTTL {
+			delete(p.links, key)
+		}
+	}
+	p.links[token] = link
+	return token
+}
+
+// take removes and returns the request held under token
+func (p *pendingLinks) take(token string, now time.Time) (pendingLink, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	link, ok := p.links[token]
+	if !ok {
+		return pendingLink{}, false
+	}
+	delete(p.links, token)
+	if now.Sub(link.CreatedAt) > pendingLinkTTL {
+		return pendingLink{}, false
+	}
+	return link, true
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// linkQueueSize bounds how many submitted links can wait for a free worker
+	linkQueueSize = 64
+	// linkJobTimeout caps how long creating and posting a single link may take
+	linkJobTimeout = 2 * time.Minute
+)
+
+// linkWorkers runs payment link creation on a fixed number of goroutines, so modal
+// submissions can be acknowledged within Slack's 3 second deadline
+type linkWorkers struct {
+	mu     sync.Mutex
+	closed bool
+	jobs   chan func()
+	wg     sync.WaitGroup
+}
+
+// newLinkWorkers starts n workers
+func newLinkWorkers(n int) *linkWorkers {
+	if n < 1 {
+		n = 1
+	}
+	w := &linkWorkers{jobs: make(chan func(), linkQueueSize)}
+	w.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer w.wg.Done()
+			for job := range w.jobs {
+				job()
+			}
+		}()
+	}
+	return w
+}
+
+// submit queues job without blocking. It reports false when the queue is full or the
+// workers have been stopped.
+func (w *linkWorkers) submit(job func()) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop refuses new jobs and waits for queued ones to finish or ctx to end
+func (w *linkWorkers) stop(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.jobs)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("payment links still being created: %w", ctx.Err())
+	}
+}
+
+// DrainLinkJobs stops accepting background link jobs and waits up to ctx for the queued
+// ones, so links already acknowledged in Slack aren't lost on shutdown
+func (s *SlackService) DrainLinkJobs(ctx context.Context) error {
+	return s.linkWorkers.stop(ctx)
+}
+
+// createLinkInBackground queues creating and posting a payment link. Failures are reported
+// to the user in the channel, since the modal has already closed. It reports false when
+// too many links are already waiting.
+func (s *SlackService) createLinkInBackground(ctx context.Context, provider models.PaymentProvider, paymentData *models.PaymentLinkData, userID, channelID string) bool {
+	// The request context ends with the response, so keep only its workspace client and team
+	jobCtx := context.WithoutCancel(ctx)
+	return s.linkWorkers.submit(func() {
+		ctx, cancel := context.WithTimeout(jobCtx, linkJobTimeout)
+		defer cancel()
+
+		paymentLink, paymentID, err := s.GenerateLinkForProvider(ctx, paymentData, provider)
+		if err != nil {
+			linkKind := "payment"
+			if paymentData.Donation {
+				linkKind = "donation"
+			}
+			// Provider details go to admins; the user gets a reference they can quote
+			reference := s.reportErrorToAdmins(fmt.Sprintf("Failed to generate %s %s link", provider, linkKind), userID, channelID, err)
+			s.notifyLinkFailure(ctx, userID, channelID, fmt.Sprintf(
+				"Sorry, your %s %s link for *%s* couldn't be created. Please try again. If it keeps failing, give an admin reference %s.",
+				providerDisplayName(provider), linkKind, paymentData.ServiceName, reference))
+			return
+		}
+		s.deliverPaymentLink(ctx, provider, paymentData, paymentLink, paymentID, userID, channelID)
+	})
+}
+
+// notifyLinkFailure tells the user privately in the channel, or by DM when the bot can't
+// post there
+func (s *SlackService) notifyLinkFailure(ctx context.Context, userID, channelID, text string) {
+	client := s.slackClient(ctx)
+	_, err := client.PostEphemeralContext(ctx, channelID, userID, slack.MsgOptionText(text, false))
+	if err == nil {
+		return
+	}
+	s.logger.Warn("Error posting link failure to channel, falling back to DM", "user_id", userID, "channel_id", channelID, "error", err)
+	if _, _, err := client.PostMessageContext(ctx, userID, slack.MsgOptionText(text, false)); err != nil {
+		s.logger.Error("Error sending link failure DM", "user_id", userID, "error", err)
+	}
+}
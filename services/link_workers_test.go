@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLinkWorkersBoundConcurrency(t *testing.T) {
+	workers := newLinkWorkers(2)
+	var mu sync.Mutex
+	running, maxRunning, finished := 0, 0, 0
+	for i := 0; i < 6; i++ {
+		if !workers.submit(func() {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			finished++
+			mu.Unlock()
+		}) {
+			t.Fatalf("job %d wasn't queued", i+1)
+		}
+	}
+	if err := workers.stop(context.Background()); err != nil {
+		t.Fatalf("stop error: %v", err)
+	}
+	if finished != 6 || maxRunning > 2 {
+		t.Errorf("finished %d jobs with up to %d at once, want 6 with at most 2", finished, maxRunning)
+	}
+	if workers.submit(func() {}) {
+		t.Error("submit after stop succeeded, want it refused")
+	}
+}
+
+func TestLinkWorkersRefuseJobsWhenTheQueueIsFull(t *testing.T) {
+	workers := newLinkWorkers(1)
+	release := make(chan struct{})
+	t.Cleanup(func() { workers.stop(context.Background()) })
+	defer close(release)
+
+	// The worker holds one job, so the queue takes linkQueueSize more
+	started := make(chan struct{})
+	workers.submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	for i := 0; i < linkQueueSize; i++ {
+		if !workers.submit(func() {}) {
+			t.Fatalf("job %d refused before the queue was full", i+1)
+		}
+	}
+	if workers.submit(func() {}) {
+		t.Error("submit to a full queue succeeded, want it refused")
+	}
+}
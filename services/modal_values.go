@@ -0,0 +1,44 @@
+package services
+
+import "github.com/slack-go/slack"
+
+// missingFieldMessage is shown on a required input whose value wasn't in the submitted view
+// state, e.g. a partial submission or a change to Slack's payload
+const missingFieldMessage = "This field wasn't received. Please close the form and try again."
+
+// modalValues is the shape of a submitted view's state, keyed by block ID then action ID
+type modalValues = map[string]map[string]slack.BlockAction
+
+// getValue returns the text of actionID in blockID, and whether the input was submitted at all
+func getValue(values modalValues, blockID, actionID string) (string, bool) {
+	action, ok := getAction(values, blockID, actionID)
+	return action.Value, ok
+}
+
+// getSelectedOption returns the value of the option chosen in a select menu
+func getSelectedOption(values modalValues, blockID, actionID string) (string, bool) {
+	action, ok := getAction(values, blockID, actionID)
+	return action.SelectedOption.Value, ok
+}
+
+// getSelectedOptions returns the values of the ticked checkboxes
+func getSelectedOptions(values modalValues, blockID, actionID string) ([]string, bool) {
+	action, ok := getAction(values, blockID, actionID)
+	if !ok {
+		return nil, false
+	}
+	selected := make([]string, 0, len(action.SelectedOptions))
+	for _, option := range action.SelectedOptions {
+		selected = append(selected, option.Value)
+	}
+	return selected, true
+}
+
+func getAction(values modalValues, blockID, actionID string) (slack.BlockAction, bool) {
+	block, ok := values[blockID]
+	if !ok {
+		return slack.BlockAction{}, false
+	}
+	action, ok := block[actionID]
+	return action, ok
+}
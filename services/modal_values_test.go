@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/models"
+
+	"github.com/slack-go/slack"
+)
+
+func TestModalValueAccessors(t *testing.T) {
+	values := modalValues{
+		"amount_block":   {"amount_input": {Value: "10"}},
+		"currency_block": {"currency_select": {SelectedOption: slack.OptionBlockObject{Value: "EUR"}}},
+		"promo_block":    {"promo_checkbox": checkedOptions("allow", "save")},
+	}
+	if got, ok := getValue(values, "amount_block", "amount_input"); !ok || got != "10" {
+		t.Errorf("getValue = %q, %v, want 10, true", got, ok)
+	}
+	if got, ok := getSelectedOption(values, "currency_block", "currency_select"); !ok || got != "EUR" {
+		t.Errorf("getSelectedOption = %q, %v, want EUR, true", got, ok)
+	}
+	if got, ok := getSelectedOptions(values, "promo_block", "promo_checkbox"); !ok || len(got) != 2 || got[0] != "allow" || got[1] != "save" {
+		t.Errorf("getSelectedOptions = %q, %v, want [allow save], true", got, ok)
+	}
+
+	for _, values := range []modalValues{nil, {}, {"amount_block": nil}, {"amount_block": {"other_input": {Value: "10"}}}} {
+		if got, ok := getValue(values, "amount_block", "amount_input"); ok || got != "" {
+			t.Errorf("getValue(%v) = %q, %v, want nothing", values, got, ok)
+		}
+		if got, ok := getSelectedOptions(values, "amount_block", "amount_input"); ok || got != nil {
+			t.Errorf("getSelectedOptions(%v) = %q, %v, want nothing", values, got, ok)
+		}
+	}
+}
+
+func TestPaymentSubmissionWithMissingBlocks(t *testing.T) {
+	for _, missing := range []string{"amount_block", "service_block"} {
+		t.Run(missing, func(t *testing.T) {
+			values := paymentFormValues()
+			delete(values, missing)
+			_, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if errs[missing] == "" {
+				t.Errorf("errors = %v, want one on %s", errs, missing)
+			}
+		})
+	}
+}
+
+func TestDonationSubmissionWithMissingBlocks(t *testing.T) {
+	interaction := &slack.InteractionCallback{
+		User: slack.User{ID: "U1"},
+		View: slack.View{CallbackID: DonationModalCallbackID, PrivateMetadata: "C1", State: &slack.ViewState{Values: modalValues{}}},
+	}
+	rec := httptest.NewRecorder()
+	newPaymentTestService().ProcessDonationSubmission(context.Background(), rec, interaction)
+
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if resp.ResponseAction != slack.RAErrors || resp.Errors["service_block"] == "" {
+		t.Errorf("response = %s, want an error on service_block", rec.Body.String())
+	}
+}
+
+func TestInvoiceSubmissionWithMissingBlocks(t *testing.T) {
+	is := NewInvoiceService(nil, &config.Config{}, nil)
+	for _, missing := range []string{"client_name_block", "client_email_block", "date_due_block", "line_items_block"} {
+		t.Run(missing, func(t *testing.T) {
+			values := invoiceFormValues("USD")
+			delete(values, missing)
+			_, err := is.ParseInvoiceDataFromModal(values)
+			var fieldErr *InvoiceFieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("ParseInvoiceDataFromModal error = %v, want a field error", err)
+			}
+			// Without the legacy textarea the first line item row is the one asked for
+			want := missing
+			if missing == "line_items_block" {
+				want = blockID(invoiceLineItemBlockPrefix, 1)
+			}
+			if fieldErr.BlockID != want {
+				t.Errorf("error on %s, want %s", fieldErr.BlockID, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+
+	"github.com/slack-go/slack"
+)
+
+func TestNotifyPaymentReceivedPostsToTheLinksWorkspace(t *testing.T) {
+	_, defaultWorkspace := newFakeSlack(t)
+	_, teamWorkspace := newFakeSlack(t)
+
+	s := &SlackService{
+		client:      slack.New("xoxb-default", slack.OptionAPIURL(defaultWorkspace.URL)),
+		linkOrigins: NewMemoryLinkOriginStore(),
+	}
+	teams := NewMemoryTeamConfigStore()
+	teams.Save(TeamConfig{TeamID: "T2", BotToken: "xoxb-team2"})
+	s.UseTeamConfigs(teams, func(token string) *slack.Client {
+		return slack.New(token, slack.OptionAPIURL(teamWorkspace.URL))
+	})
+
+	// The link was created from T2, so the webhook (which has no Slack context) must use T2's client
+	ctx := s.ContextForTeam(context.Background(), "T2")
+	s.recordLinkOrigin(ctx, "stripe", "plink_1", &models.PaymentLinkData{ServiceName: "Hosting"}, "C2", "U1")
+	if origin, _ := s.linkOrigins.Get("plink_1"); origin.TeamID != "T2" {
+		t.Fatalf("origin team = %q, want T2", origin.TeamID)
+	}
+
+	if err := s.NotifyPaymentReceived(context.Background(), []string{"plink_1"}, 49, "USD"); err != nil {
+		t.Fatalf("NotifyPaymentReceived error: %v", err)
+	}
+	if got := teamWorkspace.posted(); len(got) != 1 || got[0] != "C2" {
+		t.Errorf("posted to T2 channels %v, want [C2]", got)
+	}
+	if got := defaultWorkspace.posted(); len(got) != 0 {
+		t.Errorf("posted to the default workspace %v, want nothing", got)
+	}
+
+	// Each link is announced once
+	if err := s.NotifyPaymentReceived(context.Background(), []string{"plink_1"}, 49, "USD"); err != nil {
+		t.Fatalf("second NotifyPaymentReceived error: %v", err)
+	}
+	if got := teamWorkspace.posted(); len(got) != 1 {
+		t.Errorf("posted %d confirmations, want 1", len(got))
+	}
+}
+
+func TestNotifyPaymentReceivedFallsBackToDefaultWorkspace(t *testing.T) {
+	_, defaultWorkspace := newFakeSlack(t)
+	s := &SlackService{
+		client:      slack.New("xoxb-default", slack.OptionAPIURL(defaultWorkspace.URL)),
+		linkOrigins: NewMemoryLinkOriginStore(),
+	}
+	// Origins saved before team IDs were recorded have none
+	s.linkOrigins.Save("plink_1", LinkOrigin{ChannelID: "C1", UserID: "U1", LinkID: "plink_1"})
+
+	if err := s.NotifyPaymentReceived(context.Background(), []string{"plink_1"}, 49, "USD"); err != nil {
+		t.Fatalf("NotifyPaymentReceived error: %v", err)
+	}
+	if got := defaultWorkspace.posted(); len(got) != 1 || got[0] != "C1" {
+		t.Errorf("posted to %v, want [C1]", got)
+	}
+}
+
+func TestSendPaymentLinkMessageFormatsTheLinksCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		amount   float64
+		want     string
+		notWant  string
+	}{
+		{"JPY", 1500, "¥1500", "¥1500.00"},
+		{"HKD", 100, "HK$100.00", "(Amount: $100.00)"},
+		{"USD", 19.99, "$19.99", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			client, poster := newFakeSlack(t)
+			s := &SlackService{
+				client: client,
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			data := &models.PaymentLinkData{Amount: tt.amount, Currency: tt.currency, ServiceName: "Hosting"}
+			s.SendPaymentLinkMessage(context.Background(), "U1", "C1", data, "https://pay.test/1", "", models.ProviderAirwallex)
+
+			texts := poster.postedTexts()
+			if len(texts) != 1 {
+				t.Fatalf("posted %d messages, want 1", len(texts))
+			}
+			if !strings.Contains(texts[0], tt.want) {
+				t.Errorf("message %q doesn't show %q", texts[0], tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(texts[0], tt.notWant) {
+				t.Errorf("message %q shows %q", texts[0], tt.notWant)
+			}
+		})
+	}
+}
+
+func TestSendPaymentLinkMessageSendsThePrivateCopy(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		channelID   string
+		wantPrivate bool
+	}{
+		{"enabled", true, "C1", true},
+		{"disabled", false, "C1", false},
+		{"posted to the creator's DM", true, "U1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, slackAPI := newFakeSlack(t)
+			s := &SlackService{
+				client:            client,
+				ephemeralLinkCopy: tt.enabled,
+				logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting"}
+			s.SendPaymentLinkMessage(context.Background(), "U1", tt.channelID, data, "https://buy.stripe.com/test_1", "plink_1", models.ProviderStripe)
+
+			var posted, private []slackPost
+			for _, post := range slackAPI.calls() {
+				switch post.Method {
+				case "chat.postMessage":
+					posted = append(posted, post)
+				case "chat.postEphemeral":
+					private = append(private, post)
+				}
+			}
+			if len(posted) != 1 || posted[0].Channel != tt.channelID {
+				t.Errorf("channel posts = %v, want one to %s", posted, tt.channelID)
+			}
+			if !tt.wantPrivate {
+				if len(private) != 0 {
+					t.Errorf("sent private copies %v, want none", private)
+				}
+				return
+			}
+			if len(private) != 1 {
+				t.Fatalf("sent %d private copies, want 1", len(private))
+			}
+			privateCopy := private[0]
+			if privateCopy.Channel != "C1" || privateCopy.User != "U1" {
+				t.Errorf("private copy sent to %s in %s, want U1 in C1", privateCopy.User, privateCopy.Channel)
+			}
+			for _, want := range []string{"https://buy.stripe.com/test_1", "plink_1", "<#C1>"} {
+				if !strings.Contains(privateCopy.Text, want) {
+					t.Errorf("private copy %q is missing %q", privateCopy.Text, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildAppHomeViewListsRecentLinks(t *testing.T) {
+	recent := &payment.ListLinksResult{Links: []payment.LinkSummary{
+		{ID: "plink_1", URL: "https://buy.stripe.com/test_1", ServiceName: "Hosting", Amount: 49, Currency: "USD", Active: true},
+		{ID: "plink_2", URL: "https://buy.stripe.com/test_2", Currency: "USD"},
+	}}
+	tests := []struct {
+		name   string
+		recent *payment.ListLinksResult
+		note   string
+		want   []string
+	}{
+		{"links", recent, "", []string{"buy.stripe.com/test_1|Hosting", "$49.00", ":large_green_circle: Active", "buy.stripe.com/test_2|plink_2", "Customer chooses", ":white_circle: Inactive"}},
+		{"no links", &payment.ListLinksResult{}, "", []string{"You haven't created any Stripe payment links yet."}},
+		{"note", recent, "Couldn't load", []string{"Couldn't load"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := BuildAppHomeView([]models.PaymentProvider{models.ProviderStripe, models.ProviderAirwallex}, tt.recent, tt.note)
+			if view.Type != slack.VTHomeTab {
+				t.Errorf("view type = %q, want %q", view.Type, slack.VTHomeTab)
+			}
+			actions, ok := view.Blocks.BlockSet[2].(*slack.ActionBlock)
+			if !ok || len(actions.Elements.ElementSet) != 3 {
+				t.Fatalf("third block = %+v, want a button per provider and one for invoices", view.Blocks.BlockSet[2])
+			}
+			blocks, err := json.Marshal(view.Blocks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(blocks), want) {
+					t.Errorf("Home tab is missing %q", want)
+				}
+			}
+			if tt.note != "" && strings.Contains(string(blocks), "plink_1") {
+				t.Error("Home tab lists links alongside the note")
+			}
+		})
+	}
+}
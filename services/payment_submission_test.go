@@ -0,0 +1,769 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
+)
+
+func newPaymentTestService() *SlackService {
+	return &SlackService{
+		previews: newPendingLinks(),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// paymentFormValues fills in the payment modal's required fields
+func paymentFormValues() modalValues {
+	return modalValues{
+		"amount_block":   {"amount_input": {Value: "100"}},
+		"currency_block": {"currency_select": {SelectedOption: slack.OptionBlockObject{Value: "USD"}}},
+		"service_block":  {"service_input": {Value: "Consulting"}},
+	}
+}
+
+// checkedOptions ticks the given checkbox values
+func checkedOptions(values ...string) slack.BlockAction {
+	action := slack.BlockAction{}
+	for _, value := range values {
+		action.SelectedOptions = append(action.SelectedOptions, slack.OptionBlockObject{Value: value})
+	}
+	return action
+}
+
+// submitPaymentModal submits the payment modal for provider and returns the link details
+// held for the preview, or the field errors shown on the form
+func submitPaymentModal(t *testing.T, s *SlackService, provider models.PaymentProvider, values modalValues) (*models.PaymentLinkData, map[string]string) {
+	t.Helper()
+	interaction := &slack.InteractionCallback{
+		User:    slack.User{ID: "U1"},
+		Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}},
+		View: slack.View{
+			CallbackID: "payment_link_modal_" + string(provider),
+			State:      &slack.ViewState{Values: values},
+		},
+	}
+	rec := httptest.NewRecorder()
+	s.ProcessModalSubmission(context.Background(), rec, interaction)
+
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if len(resp.Errors) > 0 {
+		return nil, resp.Errors
+	}
+
+	s.previews.mu.Lock()
+	defer s.previews.mu.Unlock()
+	if len(s.previews.links) != 1 {
+		t.Fatalf("%d links held for preview, want 1 (response %s)", len(s.previews.links), rec.Body.String())
+	}
+	for token, link := range s.previews.links {
+		delete(s.previews.links, token)
+		return link.Data, nil
+	}
+	return nil, nil
+}
+
+func TestStripeModalAllowsPromotionCodesOnlyWhenTicked(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		code    string
+		want    bool
+	}{
+		{"off by default", nil, "", false},
+		{"ticked", []string{"allow_promotion_codes"}, "", true},
+		{"other options ticked", []string{saveCardOptionValue, automaticTaxOptionValue}, "", false},
+		{"specific code without the box", []string{saveCardOptionValue}, "SPRING", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			if tt.options != nil {
+				values["promo_codes_block"] = map[string]slack.BlockAction{"promo_codes_checkbox": checkedOptions(tt.options...)}
+			}
+			if tt.code != "" {
+				values["promotion_code_block"] = map[string]slack.BlockAction{"promotion_code_input": {Value: tt.code}}
+			}
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.AllowPromotionCodes != tt.want {
+				t.Errorf("AllowPromotionCodes = %v, want %v", data.AllowPromotionCodes, tt.want)
+			}
+			if data.PromotionCode != tt.code {
+				t.Errorf("PromotionCode = %q, want %q", data.PromotionCode, tt.code)
+			}
+		})
+	}
+}
+
+func TestStripeModalAutomaticTax(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []string
+		want    bool
+	}{
+		{"off by default", nil, false},
+		{"ticked", []string{automaticTaxOptionValue}, true},
+		{"other options ticked", []string{saveCardOptionValue, "allow_promotion_codes"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			if tt.options != nil {
+				values["promo_codes_block"] = map[string]slack.BlockAction{"promo_codes_checkbox": checkedOptions(tt.options...)}
+			}
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.AutomaticTax != tt.want {
+				t.Errorf("AutomaticTax = %v, want %v", data.AutomaticTax, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeModalTicksAutomaticTaxByDefault(t *testing.T) {
+	for _, configured := range []bool{false, true} {
+		view := BuildPaymentModalView(models.ProviderStripe, "C1", PaymentModalDefaults{AutomaticTax: configured})
+		ticked := false
+		for _, block := range view.Blocks.BlockSet {
+			input, ok := block.(*slack.InputBlock)
+			if !ok || input.BlockID != "promo_codes_block" {
+				continue
+			}
+			for _, option := range input.Element.(*slack.CheckboxGroupsBlockElement).InitialOptions {
+				ticked = ticked || option.Value == automaticTaxOptionValue
+			}
+		}
+		if ticked != configured {
+			t.Errorf("with automatic tax configured %v, the box is ticked = %v", configured, ticked)
+		}
+	}
+}
+
+func TestStripeModalSavesCardUnlessUnticked(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		want    bool
+	}{
+		{"options untouched", nil, false},
+		{"save card ticked", []string{saveCardOptionValue}, false},
+		{"everything unticked", []string{}, true},
+		{"only promotion codes ticked", []string{"allow_promotion_codes"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			if tt.options != nil {
+				values["promo_codes_block"] = map[string]slack.BlockAction{"promo_codes_checkbox": checkedOptions(tt.options...)}
+			}
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.SkipSaveCard != tt.want {
+				t.Errorf("SkipSaveCard = %v, want %v", data.SkipSaveCard, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeModalCadencePresetOverridesRawInterval(t *testing.T) {
+	tests := []struct {
+		cadence   string
+		wantUnit  string
+		wantCount int64
+	}{
+		{"biweekly", "week", 2},
+		{"quarterly", "month", 3},
+		{"semiannually", "month", 6},
+		{"annually", "year", 1},
+		{utils.CadenceCustom, "day", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cadence, func(t *testing.T) {
+			values := paymentFormValues()
+			values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+			values["interval_block"] = map[string]slack.BlockAction{"interval_select": {SelectedOption: slack.OptionBlockObject{Value: "day"}}}
+			values["interval_count_block"] = map[string]slack.BlockAction{"interval_count_select": {SelectedOption: slack.OptionBlockObject{Value: "10"}}}
+			values["cadence_block"] = map[string]slack.BlockAction{"cadence_select": {SelectedOption: slack.OptionBlockObject{Value: tt.cadence}}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if !data.IsSubscription || data.Interval != tt.wantUnit || data.IntervalCount != tt.wantCount {
+				t.Errorf("subscription=%v every %d %s, want every %d %s", data.IsSubscription, data.IntervalCount, data.Interval, tt.wantCount, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestDailySubscriptionFromTheModal(t *testing.T) {
+	view := BuildPaymentModalView(models.ProviderStripe, "C1", PaymentModalDefaults{})
+	offered := false
+	for _, block := range view.Blocks.BlockSet {
+		input, ok := block.(*slack.InputBlock)
+		if !ok || input.BlockID != "interval_block" {
+			continue
+		}
+		for _, option := range input.Element.(*slack.SelectBlockElement).Options {
+			offered = offered || option.Value == "day"
+		}
+	}
+	if !offered {
+		t.Fatal("Stripe modal doesn't offer a daily interval")
+	}
+
+	values := paymentFormValues()
+	values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+	values["interval_block"] = map[string]slack.BlockAction{"interval_select": {SelectedOption: slack.OptionBlockObject{Value: "day"}}}
+	values["interval_count_block"] = map[string]slack.BlockAction{"interval_count_select": {SelectedOption: slack.OptionBlockObject{Value: "2"}}}
+
+	data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+	if errs != nil {
+		t.Fatalf("submission rejected: %v", errs)
+	}
+	if !data.IsSubscription || data.Interval != "day" || data.IntervalCount != 2 {
+		t.Errorf("subscription=%v every %d %s, want every 2 day", data.IsSubscription, data.IntervalCount, data.Interval)
+	}
+}
+
+func TestStripeModalAdjustableQuantity(t *testing.T) {
+	tests := []struct {
+		name             string
+		adjustable       bool
+		subscription     bool
+		min, max         string
+		wantMin, wantMax int64
+		wantErrBlock     string
+	}{
+		{"default limits", true, false, "", "", 1, 99, ""},
+		{"chosen limits", true, false, "2", "10", 2, 10, ""},
+		{"equal limits", true, false, "5", "5", 5, 5, ""},
+		{"minimum above the maximum", true, false, "10", "2", 0, 0, "quantity_max_block"},
+		{"invalid minimum", true, false, "zero", "", 0, 0, "quantity_min_block"},
+		{"invalid maximum", true, false, "", "1000000", 0, 0, "quantity_max_block"},
+		{"limits without the toggle", false, false, "2", "", 0, 0, "quantity_min_block"},
+		{"subscription", true, true, "", "", 0, 0, "promo_codes_block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			if tt.adjustable {
+				values["promo_codes_block"] = map[string]slack.BlockAction{"promo_codes_checkbox": checkedOptions(adjustableQuantityOptionValue)}
+			}
+			if tt.subscription {
+				values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+				values["interval_block"] = map[string]slack.BlockAction{"interval_select": {SelectedOption: slack.OptionBlockObject{Value: "month"}}}
+			}
+			values["quantity_min_block"] = map[string]slack.BlockAction{"quantity_min_input": {Value: tt.min}}
+			values["quantity_max_block"] = map[string]slack.BlockAction{"quantity_max_input": {Value: tt.max}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErrBlock != "" {
+				if errs[tt.wantErrBlock] == "" {
+					t.Errorf("errors = %v, want one on %s", errs, tt.wantErrBlock)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if !data.AdjustableQuantity || data.QuantityMin != tt.wantMin || data.QuantityMax != tt.wantMax {
+				t.Errorf("adjustable=%v %d-%d, want %d-%d", data.AdjustableQuantity, data.QuantityMin, data.QuantityMax, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+// selectInitialValue returns the value of the option initially selected in view's blockID
+func selectInitialValue(t *testing.T, view slack.ModalViewRequest, blockID string) string {
+	t.Helper()
+	for _, block := range view.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && input.BlockID == blockID {
+			element, ok := input.Element.(*slack.SelectBlockElement)
+			if !ok {
+				t.Fatalf("%s has a %T, want a select", blockID, input.Element)
+			}
+			if element.InitialOption == nil {
+				return ""
+			}
+			return element.InitialOption.Value
+		}
+	}
+	t.Fatalf("view has no %s", blockID)
+	return ""
+}
+
+func TestPaymentModalDefaultInterval(t *testing.T) {
+	tests := []struct {
+		name                    string
+		defaults                PaymentModalDefaults
+		wantInterval, wantCount string
+	}{
+		{"unconfigured", PaymentModalDefaults{}, "month", "1"},
+		{"yearly", PaymentModalDefaults{Interval: "year", IntervalCount: 1}, "year", "1"},
+		{"quarterly", PaymentModalDefaults{Interval: "month", IntervalCount: 3}, "month", "3"},
+		{"unusual count", PaymentModalDefaults{Interval: "week", IntervalCount: 4}, "week", "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := BuildPaymentModalView(models.ProviderStripe, "C1", tt.defaults)
+			if got := selectInitialValue(t, view, "interval_block"); got != tt.wantInterval {
+				t.Errorf("selected interval = %q, want %q", got, tt.wantInterval)
+			}
+			if got := selectInitialValue(t, view, "interval_count_block"); got != tt.wantCount {
+				t.Errorf("selected count = %q, want %q", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestSubscriptionFallsBackToTheDefaultInterval(t *testing.T) {
+	s := newPaymentTestService()
+	s.modalDefaults = PaymentModalDefaults{Interval: "year", IntervalCount: 2}
+	values := paymentFormValues()
+	values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+
+	data, errs := submitPaymentModal(t, s, models.ProviderStripe, values)
+	if errs != nil {
+		t.Fatalf("submission rejected: %v", errs)
+	}
+	if data.Interval != "year" || data.IntervalCount != 2 {
+		t.Errorf("subscription every %d %s, want the configured every 2 year", data.IntervalCount, data.Interval)
+	}
+}
+
+func TestStripeModalTrialDays(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscription bool
+		raw          string
+		want         int64
+		wantErr      bool
+	}{
+		{"no trial", true, "", 0, false},
+		{"subscription trial", true, "14", 14, false},
+		{"too long", true, "1000", 0, true},
+		{"one-time payment", false, "14", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			if tt.subscription {
+				values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+			}
+			values["trial_days_block"] = map[string]slack.BlockAction{"trial_days_input": {Value: tt.raw}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["trial_days_block"] == "" {
+					t.Errorf("errors = %v, want one on trial_days_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.TrialDays != tt.want {
+				t.Errorf("TrialDays = %d, want %d", data.TrialDays, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentModalCustomerEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"absent", "", "", false},
+		{"plain address", " ada@example.com ", "ada@example.com", false},
+		{"display name", "Ada Lovelace <ada@example.com>", "ada@example.com", false},
+		{"invalid", "ada at example", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			values["customer_email_block"] = map[string]slack.BlockAction{"customer_email_input": {Value: tt.input}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["customer_email_block"] == "" {
+					t.Errorf("errors = %v, want one on customer_email_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.CustomerEmail != tt.want {
+				t.Errorf("CustomerEmail = %q, want %q", data.CustomerEmail, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentLinkMessageShowsTheCustomerEmail(t *testing.T) {
+	for _, email := range []string{"ada@example.com", ""} {
+		data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", CustomerEmail: email}
+		blocks, err := json.Marshal(BuildPaymentLinkMessageBlocks("U1", "Stripe", data, "https://buy.stripe.com/test_1", "plink_1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shown := strings.Contains(string(blocks), "*Customer*")
+		if shown != (email != "") || !strings.Contains(string(blocks), email) {
+			t.Errorf("email %q: message shows a customer = %v, want %v", email, shown, email != "")
+		}
+	}
+}
+
+func TestPaymentModalExpiry(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"48h", 48 * time.Hour, false},
+		{"7 days", 7 * 24 * time.Hour, false},
+		{"2 weeks", 0, true},
+		{"400d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			values := paymentFormValues()
+			values["expires_block"] = map[string]slack.BlockAction{"expires_input": {Value: tt.input}}
+
+			before := time.Now()
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["expires_block"] == "" {
+					t.Errorf("errors = %v, want one on expires_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if tt.want == 0 {
+				if !data.ExpiresAt.IsZero() {
+					t.Errorf("ExpiresAt = %v, want no expiry", data.ExpiresAt)
+				}
+				return
+			}
+			// The expiry is rounded down to the minute
+			earliest := before.Add(tt.want).Add(-time.Minute)
+			latest := time.Now().Add(tt.want)
+			if data.ExpiresAt.Before(earliest) || data.ExpiresAt.After(latest) {
+				t.Errorf("ExpiresAt = %v, want about %v from now", data.ExpiresAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentModalRedirectURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"absent", "", "", false},
+		{"https", "https://acme.test/thanks", "https://acme.test/thanks", false},
+		{"http", "http://acme.test/thanks", "", true},
+		{"not a URL", "thanks page", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			values["redirect_url_block"] = map[string]slack.BlockAction{"redirect_url_input": {Value: tt.input}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["redirect_url_block"] == "" {
+					t.Errorf("errors = %v, want one on redirect_url_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.RedirectURL != tt.want {
+				t.Errorf("RedirectURL = %q, want %q", data.RedirectURL, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentLinkMessageShowsTheAirwallexPaymentID(t *testing.T) {
+	data := &models.PaymentLinkData{Amount: 10, Currency: "HKD", ServiceName: "Hosting"}
+	blocks, err := json.Marshal(BuildPaymentLinkMessageBlocks("U1", "Airwallex", data, "https://checkout.airwallex.com/pay/1", "6a1d5b2e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(blocks), "*Payment ID*\\n`6a1d5b2e`") {
+		t.Errorf("message %s doesn't show the payment ID", blocks)
+	}
+}
+
+func TestPaymentModalAcceptsFormattedAmounts(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"$19.99", 19.99, false},
+		{"1,234.56", 1234.56, false},
+		{"19,99", 19.99, false},
+		{"1,234", 0, true},
+		{"nineteen", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			values := paymentFormValues()
+			values["amount_block"] = map[string]slack.BlockAction{"amount_input": {Value: tt.input}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["amount_block"] == "" {
+					t.Errorf("errors = %v, want one on amount_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.Amount != tt.want {
+				t.Errorf("Amount = %v, want %v", data.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentModalAmountPrecision(t *testing.T) {
+	tests := []struct {
+		currency string
+		input    string
+		want     float64
+		wantErr  bool
+	}{
+		{"USD", "10.999", 0, true},
+		{"USD", "10.00", 10, false},
+		{"USD", "100", 100, false},
+		{"JPY", "10.999", 0, true},
+		{"JPY", "10.00", 10, false},
+		{"JPY", "100", 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.input, func(t *testing.T) {
+			values := paymentFormValues()
+			values["amount_block"] = map[string]slack.BlockAction{"amount_input": {Value: tt.input}}
+			values["currency_block"] = map[string]slack.BlockAction{"currency_select": {SelectedOption: slack.OptionBlockObject{Value: tt.currency}}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderStripe, values)
+			if tt.wantErr {
+				if errs["amount_block"] == "" {
+					t.Errorf("errors = %v, want one on amount_block", errs)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.Amount != tt.want {
+				t.Errorf("Amount = %v, want %v", data.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentModalCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		amount   string
+		want     string
+		wantErr  string
+	}{
+		{"defaults to USD", "", "100", "USD", ""},
+		{"selected", "EUR", "100", "EUR", ""},
+		{"unsupported", "XYZ", "100", "", "currency_block"},
+		{"too many decimals for JPY", "JPY", "100.50", "", "amount_block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := paymentFormValues()
+			values["amount_block"] = map[string]slack.BlockAction{"amount_input": {Value: tt.amount}}
+			values["currency_block"] = map[string]slack.BlockAction{"currency_select": {SelectedOption: slack.OptionBlockObject{Value: tt.currency}}}
+
+			data, errs := submitPaymentModal(t, newPaymentTestService(), models.ProviderAirwallex, values)
+			if tt.wantErr != "" {
+				if errs[tt.wantErr] == "" {
+					t.Errorf("errors = %v, want one on %s", errs, tt.wantErr)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.Currency != tt.want {
+				t.Errorf("Currency = %q, want %q", data.Currency, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionEndDateDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultEnd int64
+		input      string
+		want       int64
+	}{
+		{"unlimited by default", 0, "", 0},
+		{"configured default applies when blank", 12, "", 12},
+		{"zero overrides the default", 12, "0", 0},
+		{"entered value overrides the default", 12, "6", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newPaymentTestService()
+			s.modalDefaults = PaymentModalDefaults{EndDateCycles: tt.defaultEnd}
+			values := paymentFormValues()
+			values["subscription_block"] = map[string]slack.BlockAction{"subscription_checkbox": checkedOptions("is_subscription")}
+			values["end_date_block"] = map[string]slack.BlockAction{"end_date_input": {Value: tt.input}}
+
+			data, errs := submitPaymentModal(t, s, models.ProviderStripe, values)
+			if errs != nil {
+				t.Fatalf("submission rejected: %v", errs)
+			}
+			if data.EndDateCycles != tt.want {
+				t.Errorf("EndDateCycles = %d, want %d", data.EndDateCycles, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentModalPrefillsDefaultEndDate(t *testing.T) {
+	for defaultEnd, want := range map[int64]string{0: "", 12: "12"} {
+		view := BuildPaymentModalView(models.ProviderStripe, "C1", PaymentModalDefaults{EndDateCycles: defaultEnd})
+		found := false
+		for _, block := range view.Blocks.BlockSet {
+			input, ok := block.(*slack.InputBlock)
+			if !ok || input.BlockID != "end_date_block" {
+				continue
+			}
+			found = true
+			if got := input.Element.(*slack.PlainTextInputBlockElement).InitialValue; got != want {
+				t.Errorf("default %d: end date prefilled with %q, want %q", defaultEnd, got, want)
+			}
+		}
+		if !found {
+			t.Fatal("Stripe modal has no end date field")
+		}
+	}
+}
+
+func TestMessagePrefill(t *testing.T) {
+	tests := []struct {
+		text        string
+		maxLen      int
+		wantService string
+		wantDesc    string
+	}{
+		{"Logo redesign", 100, "Logo redesign", "Logo redesign"},
+		{"\n  \nLogo redesign\nTwo rounds", 100, "Logo redesign", "Logo redesign Two rounds"},
+		{"A very long service name", 10, "A very lo…", "A very lo…"},
+		{"", 100, "", ""},
+	}
+	for _, tt := range tests {
+		service, desc := messagePrefill(tt.text, tt.maxLen)
+		if service != tt.wantService || desc != tt.wantDesc {
+			t.Errorf("messagePrefill(%q, %d) = %q, %q, want %q, %q", tt.text, tt.maxLen, service, desc, tt.wantService, tt.wantDesc)
+		}
+	}
+}
+
+func TestProviderDisplayName(t *testing.T) {
+	tests := []struct {
+		provider models.PaymentProvider
+		want     string
+	}{
+		{models.ProviderStripe, "Stripe"},
+		{models.ProviderAirwallex, "Airwallex"},
+		{"paypal", "Paypal"},
+		{"go-cardless", "Go-cardless"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := providerDisplayName(tt.provider); got != tt.want {
+			t.Errorf("providerDisplayName(%q) = %q, want %q", tt.provider, got, tt.want)
+		}
+	}
+
+	for provider, want := range map[models.PaymentProvider]string{models.ProviderStripe: "Stripe Payment", models.ProviderAirwallex: "Airwallex Payment"} {
+		if got := BuildPaymentModalView(provider, "C1", PaymentModalDefaults{}).Title.Text; got != want {
+			t.Errorf("%s modal title = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+func TestGenerateLinkLogsRequestFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator payment.PaymentLinkGenerator
+		wantLevel string
+		wantMsg   string
+		wantID    string
+	}{
+		{"created", payment.NewDryRunGenerator(models.ProviderStripe), "INFO", "Payment link generated", "plink_dryrun_"},
+		{"failed", failingGenerator{err: errors.New("card_declined")}, "ERROR", "Payment link generation failed", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			s := &SlackService{stripeGenerator: tt.generator, logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+			data := &models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Hosting", SlackChannelID: "C1", SlackUserID: "U1"}
+			s.GenerateLinkForProvider(context.Background(), data, models.ProviderStripe)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log %q isn't one JSON entry: %v", logs.String(), err)
+			}
+			if entry["level"] != tt.wantLevel || entry["msg"] != tt.wantMsg {
+				t.Errorf("logged %v %q, want %s %q", entry["level"], entry["msg"], tt.wantLevel, tt.wantMsg)
+			}
+			for key, want := range map[string]string{"provider": "stripe", "channel_id": "C1", "user_id": "U1"} {
+				if entry[key] != want {
+					t.Errorf("%s = %v, want %q", key, entry[key], want)
+				}
+			}
+			if id, _ := entry["payment_id"].(string); !strings.HasPrefix(id, tt.wantID) || (tt.wantID == "") != (id == "") {
+				t.Errorf("payment_id = %q, want it to start with %q", id, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// cp1252Extras are the printable characters in the 0x80-0x9F range of Windows-1252, which the
+// core PDF fonts (Arial/Helvetica) can render in addition to ASCII and Latin-1.
+const cp1252Extras = "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ"
+
+// cp1252HasGlyph reports whether r can be rendered by a core font using the cp1252 encoding
+func cp1252HasGlyph(r rune) bool {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return true
+	}
+	return strings.ContainsRune(cp1252Extras, r)
+}
+
+// transliterations maps common non-Latin-1 characters to Latin approximations. Used when the
+// active font has no glyph for a character, so names render as readable text instead of boxes.
+var transliterations = map[rune]string{
+	// Cyrillic
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "Yo", 'Ж': "Zh", 'З': "Z", 'И': "I",
+	'Й': "Y", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+	'У': "U", 'Ф': "F", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ъ': "", 'Ы': "Y", 'Ь': "",
+	'Э': "E", 'Ю': "Yu", 'Я': "Ya", 'Є': "Ye", 'І': "I", 'Ї': "Yi", 'Ґ': "G",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g",
+	// Greek
+	'Α': "A", 'Β': "V", 'Γ': "G", 'Δ': "D", 'Ε': "E", 'Ζ': "Z", 'Η': "I", 'Θ': "Th", 'Ι': "I", 'Κ': "K",
+	'Λ': "L", 'Μ': "M", 'Ν': "N", 'Ξ': "X", 'Ο': "O", 'Π': "P", 'Ρ': "R", 'Σ': "S", 'Τ': "T", 'Υ': "Y",
+	'Φ': "F", 'Χ': "Ch", 'Ψ': "Ps", 'Ω': "O",
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+	'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	// Latin Extended-A (Central/Eastern European)
+	'Ą': "A", 'ą': "a", 'Ć': "C", 'ć': "c", 'Č': "C", 'č': "c", 'Ď': "D", 'ď': "d", 'Ę': "E", 'ę': "e",
+	'Ě': "E", 'ě': "e", 'Ğ': "G", 'ğ': "g", 'İ': "I", 'ı': "i", 'Ł': "L", 'ł': "l", 'Ń': "N", 'ń': "n",
+	'Ň': "N", 'ň': "n", 'Ő': "O", 'ő': "o", 'Ř': "R", 'ř': "r", 'Ś': "S", 'ś': "s", 'Ş': "S", 'ş': "s",
+	'Ș': "S", 'ș': "s", 'Ť': "T", 'ť': "t", 'Ț': "T", 'ț': "t", 'Ů': "U", 'ů': "u", 'Ű': "U", 'ű': "u",
+	'Ź': "Z", 'ź': "z", 'Ż': "Z", 'ż': "z", 'Ā': "A", 'ā': "a", 'Ē': "E", 'ē': "e", 'Ī': "I", 'ī': "i",
+	'Ū': "U", 'ū': "u",
+	// Currency symbols missing from many fonts
+	'₽': "RUB", '₴': "UAH", '₹': "INR", '₩': "KRW", '₪': "ILS", '₫': "VND", '₱': "PHP", '₺': "TRY",
+}
+
+// pdfTextEncoder prepares strings for the active PDF font: characters without a glyph are
+// transliterated (or replaced with '?'), then the text is converted to the font's encoding.
+type pdfTextEncoder struct {
+	hasGlyph      func(rune) bool
+	translate     func(string) string
+	transliterate bool
+}
+
+// encode returns text that the font can render without missing-glyph boxes
+func (e *pdfTextEncoder) encode(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if e.hasGlyph(r) {
+			sb.WriteRune(r)
+			continue
+		}
+		if replacement, ok := transliterations[r]; ok && e.transliterate && e.allHaveGlyphs(replacement) {
+			sb.WriteString(replacement)
+			continue
+		}
+		sb.WriteRune('?')
+	}
+
+	if e.translate != nil {
+		return e.translate(sb.String())
+	}
+	return sb.String()
+}
+
+func (e *pdfTextEncoder) allHaveGlyphs(text string) bool {
+	for _, r := range text {
+		if !e.hasGlyph(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ttfGlyphCoverage parses the cmap table of a TrueType font and returns the set of runes it maps to a glyph
+func ttfGlyphCoverage(font []byte) (map[rune]bool, error) {
+	if len(font) < 12 {
+		return nil, fmt.Errorf("font file too short")
+	}
+
+	numTables := int(binary.BigEndian.Uint16(font[4:6]))
+	var cmap []byte
+	for i := 0; i < numTables; i++ {
+		rec := 12 + i*16
+		if rec+16 > len(font) {
+			return nil, fmt.Errorf("truncated table directory")
+		}
+		if string(font[rec:rec+4]) == "cmap" {
+			offset := int(binary.BigEndian.Uint32(font[rec+8 : rec+12]))
+			length := int(binary.BigEndian.Uint32(font[rec+12 : rec+16]))
+			if offset+length > len(font) {
+				return nil, fmt.Errorf("truncated cmap table")
+			}
+			cmap = font[offset : offset+length]
+			break
+		}
+	}
+	if len(cmap) < 4 {
+		return nil, fmt.Errorf("font has no cmap table")
+	}
+
+	// Prefer the full Unicode (format 12) subtable, then the BMP (format 4) one
+	var format4, format12 []byte
+	numSubtables := int(binary.BigEndian.Uint16(cmap[2:4]))
+	for i := 0; i < numSubtables; i++ {
+		rec := 4 + i*8
+		if rec+8 > len(cmap) {
+			break
+		}
+		platformID := binary.BigEndian.Uint16(cmap[rec : rec+2])
+		encodingID := binary.BigEndian.Uint16(cmap[rec+2 : rec+4])
+		offset := int(binary.BigEndian.Uint32(cmap[rec+4 : rec+8]))
+		if offset+2 > len(cmap) || (platformID != 0 && platformID != 3) {
+			continue
+		}
+		switch binary.BigEndian.Uint16(cmap[offset : offset+2]) {
+		case 4:
+			if platformID == 0 || encodingID == 1 {
+				format4 = cmap[offset:]
+			}
+		case 12:
+			format12 = cmap[offset:]
+		}
+	}
+
+	switch {
+	case format12 != nil:
+		return parseCmapFormat12(format12)
+	case format4 != nil:
+		return parseCmapFormat4(format4)
+	default:
+		return nil, fmt.Errorf("font has no supported Unicode cmap subtable")
+	}
+}
+
+func parseCmapFormat4(table []byte) (map[rune]bool, error) {
+	if len(table) < 14 {
+		return nil, fmt.Errorf("truncated cmap format 4 subtable")
+	}
+	segCount := int(binary.BigEndian.Uint16(table[6:8])) / 2
+	endCodes := 14
+	startCodes := endCodes + segCount*2 + 2
+	idDeltas := startCodes + segCount*2
+	idRangeOffsets := idDeltas + segCount*2
+	if idRangeOffsets+segCount*2 > len(table) {
+		return nil, fmt.Errorf("truncated cmap format 4 segments")
+	}
+
+	coverage := make(map[rune]bool)
+	for i := 0; i < segCount; i++ {
+		end := int(binary.BigEndian.Uint16(table[endCodes+i*2:]))
+		start := int(binary.BigEndian.Uint16(table[startCodes+i*2:]))
+		delta := int(binary.BigEndian.Uint16(table[idDeltas+i*2:]))
+		rangeOffsetPos := idRangeOffsets + i*2
+		rangeOffset := int(binary.BigEndian.Uint16(table[rangeOffsetPos:]))
+
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			glyph := 0
+			if rangeOffset == 0 {
+				glyph = (c + delta) & 0xFFFF
+			} else {
+				pos := rangeOffsetPos + rangeOffset + (c-start)*2
+				if pos+2 > len(table) {
+					continue
+				}
+				if glyph = int(binary.BigEndian.Uint16(table[pos:])); glyph != 0 {
+					glyph = (glyph + delta) & 0xFFFF
+				}
+			}
+			if glyph != 0 {
+				coverage[rune(c)] = true
+			}
+		}
+	}
+	return coverage, nil
+}
+
+func parseCmapFormat12(table []byte) (map[rune]bool, error) {
+	if len(table) < 16 {
+		return nil, fmt.Errorf("truncated cmap format 12 subtable")
+	}
+	numGroups := int(binary.BigEndian.Uint32(table[12:16]))
+	if 16+numGroups*12 > len(table) {
+		return nil, fmt.Errorf("truncated cmap format 12 groups")
+	}
+
+	coverage := make(map[rune]bool)
+	for i := 0; i < numGroups; i++ {
+		group := table[16+i*12:]
+		start := binary.BigEndian.Uint32(group[0:4])
+		end := binary.BigEndian.Uint32(group[4:8])
+		for c := start; c <= end && c <= 0x10FFFF; c++ {
+			coverage[rune(c)] = true
+		}
+	}
+	return coverage, nil
+}
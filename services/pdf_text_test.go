@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+	"paymentbot/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func TestPDFTextEncoderForCoreFont(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		transliterate bool
+		want          string
+	}{
+		{"Latin-1", "Café Zürich €5", true, "Café Zürich €5"},
+		{"Cyrillic", "Иван Петров", true, "Ivan Petrov"},
+		{"Greek", "Αθήνα", true, "Ath?na"},
+		{"Polish", "Łódź", true, "Lódz"},
+		{"CJK has no transliteration", "東京 Ltd", true, "?? Ltd"},
+		{"transliteration off", "Иван", false, "????"},
+		{"currency symbol", "₹500", true, "INR500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := &pdfTextEncoder{hasGlyph: cp1252HasGlyph, transliterate: tt.transliterate}
+			if got := enc.encode(tt.text); got != tt.want {
+				t.Errorf("encode(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoreFontEncodesCurrencySymbolsAsCP1252(t *testing.T) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	enc := &pdfTextEncoder{hasGlyph: cp1252HasGlyph, translate: pdf.UnicodeTranslatorFromDescriptor("")}
+	// The core fonts use cp1252, where € is 0x80 and £ and ¥ keep their Latin-1 codes
+	if got, want := enc.encode("€10 £5 ¥3"), "\x8010 \xa35 \xa53"; got != want {
+		t.Errorf("encode = %q, want %q", got, want)
+	}
+}
+
+func TestPDFTextEncoderKeepsGlyphsTheFontHas(t *testing.T) {
+	coverage := map[rune]bool{}
+	for _, r := range "Acme Иван Петров" {
+		coverage[r] = true
+	}
+	enc := &pdfTextEncoder{hasGlyph: func(r rune) bool { return coverage[r] }, transliterate: true}
+	if got := enc.encode("Иван Петров 東京"); got != "Иван Петров ??" {
+		t.Errorf("encode = %q, want the Cyrillic kept and the CJK replaced", got)
+	}
+}
+
+func TestGenerateInvoicePDFWithNonLatinClient(t *testing.T) {
+	invoice := &models.InvoiceData{
+		InvoiceNumber: "INV-1",
+		ClientName:    "ООО «Ромашка» 東京支社",
+		ClientAddress: "ул. Ленина, 1\nМосква",
+		DateDue:       "2026-12-31",
+		Currency:      "EUR",
+		LineItems:     []models.InvoiceLineItem{{ServiceDescription: "Консультация", UnitPrice: 100, Quantity: 1}},
+	}
+
+	tests := map[string]*config.Config{
+		"system font": {},
+		"core font":   {InvoiceFontPath: "/nonexistent/font.ttf", InvoiceTransliterate: true},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := NewInvoiceService(nil, cfg, counter.NewMemoryCounterStore())
+			if name == "system font" && is.fontRegular == nil {
+				t.Skip("no Unicode system font installed")
+			}
+			if name == "system font" && !is.fontCoverage['Ж'] {
+				t.Error("system font coverage is missing Cyrillic")
+			}
+			pdf, err := is.GenerateInvoicePDF(invoice)
+			if err != nil {
+				t.Fatalf("GenerateInvoicePDF error: %v", err)
+			}
+			if pdfPageCount(pdf) != 1 {
+				t.Errorf("invoice has %d pages, want 1", pdfPageCount(pdf))
+			}
+		})
+	}
+}
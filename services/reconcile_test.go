@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"paymentbot/payment"
+	"paymentbot/utils"
+)
+
+func TestProcessReconcileSubscriptionsCommandChecks(t *testing.T) {
+	reconciler := payment.NewStripeSubscriptionReconciler("sk_test", utils.CancelSnap{})
+	tests := []struct {
+		name       string
+		userID     string
+		reconciler *payment.StripeSubscriptionReconciler
+		text       string
+		want       string
+	}{
+		{"not an admin", "U_OTHER", reconciler, "", "Sorry, only admins can reconcile subscriptions."},
+		{"Stripe disabled", "U_ADMIN", nil, "", "The Stripe provider isn't enabled, so there are no subscriptions to reconcile."},
+		{"unknown argument", "U_ADMIN", reconciler, "everything", "Usage: `/reconcile-subscriptions [dry-run]`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SlackService{adminUserIDs: map[string]bool{"U_ADMIN": true}, reconciler: tt.reconciler}
+			if got := s.ProcessReconcileSubscriptionsCommand(context.Background(), tt.userID, "C1", tt.text); got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"paymentbot/payment"
+
+	"github.com/slack-go/slack"
+)
+
+type fakeRefunder struct {
+	linkID   string
+	creators map[string]string // link ID -> slack_user metadata
+	refunded []string
+}
+
+func (f *fakeRefunder) PaymentLinkFor(ctx context.Context, id string) (string, error) {
+	return f.linkID, nil
+}
+
+func (f *fakeRefunder) PaymentLinkCreator(ctx context.Context, linkID string) (string, error) {
+	return f.creators[linkID], nil
+}
+
+func (f *fakeRefunder) Refund(ctx context.Context, id string, amount float64) (*payment.RefundResult, error) {
+	f.refunded = append(f.refunded, id)
+	return &payment.RefundResult{RefundID: "re_1", Status: "succeeded", Amount: 10, Currency: "USD"}, nil
+}
+
+// newRefundTestService returns a service whose only link, plink_1, was created by U_OWNER
+func newRefundTestService(t *testing.T) (*SlackService, *fakeRefunder) {
+	t.Helper()
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0"}`))
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	origins := NewMemoryLinkOriginStore()
+	if err := origins.Save("plink_1", LinkOrigin{ChannelID: "C1", UserID: "U_OWNER", LinkID: "plink_1"}); err != nil {
+		t.Fatal(err)
+	}
+	refunder := &fakeRefunder{linkID: "plink_1"}
+	s := &SlackService{
+		client:       slack.New("xoxb-test", slack.OptionAPIURL(slackAPI.URL+"/")),
+		refunder:     refunder,
+		linkOrigins:  origins,
+		adminUserIDs: map[string]bool{"U_ADMIN": true},
+	}
+	return s, refunder
+}
+
+func TestProcessRefundCommandRejectsOtherUsersPayments(t *testing.T) {
+	s, refunder := newRefundTestService(t)
+
+	reply := s.ProcessRefundCommand(context.Background(), "U_OTHER", "C1", "pi_123")
+	if !strings.Contains(reply, "only refund payments for links you created") {
+		t.Errorf("reply = %q, want an ownership error", reply)
+	}
+	if len(refunder.refunded) != 0 {
+		t.Errorf("refunded %v for a user who didn't create the link", refunder.refunded)
+	}
+}
+
+func TestProcessRefundCommandRejectsUnknownLinks(t *testing.T) {
+	s, refunder := newRefundTestService(t)
+	refunder.linkID = "plink_unknown"
+
+	reply := s.ProcessRefundCommand(context.Background(), "U_OWNER", "C1", "pi_123")
+	if !strings.Contains(reply, "only refund payments for links you created") {
+		t.Errorf("reply = %q, want an ownership error", reply)
+	}
+	if len(refunder.refunded) != 0 {
+		t.Errorf("refunded %v for a link with no recorded creator", refunder.refunded)
+	}
+}
+
+func TestProcessRefundCommandAllowsCreatorAndAdmins(t *testing.T) {
+	for _, userID := range []string{"U_OWNER", "U_ADMIN"} {
+		t.Run(userID, func(t *testing.T) {
+			s, refunder := newRefundTestService(t)
+
+			if reply := s.ProcessRefundCommand(context.Background(), userID, "C1", "pi_123"); reply != "" {
+				t.Errorf("reply = %q, want the confirmation posted to the channel", reply)
+			}
+			if len(refunder.refunded) != 1 || refunder.refunded[0] != "pi_123" {
+				t.Errorf("refunded = %v, want [pi_123]", refunder.refunded)
+			}
+		})
+	}
+}
+
+func TestProcessRefundCommandFallsBackToLinkMetadata(t *testing.T) {
+	// The origin store was in memory and lost on restart, but the link records its creator
+	s, refunder := newRefundTestService(t)
+	s.linkOrigins = NewMemoryLinkOriginStore()
+	refunder.creators = map[string]string{"plink_1": "U_OWNER"}
+
+	if reply := s.ProcessRefundCommand(context.Background(), "U_OTHER", "C1", "pi_123"); !strings.Contains(reply, "only refund payments for links you created") {
+		t.Errorf("reply to another user = %q, want an ownership error", reply)
+	}
+	if reply := s.ProcessRefundCommand(context.Background(), "U_OWNER", "C1", "pi_123"); reply != "" {
+		t.Errorf("reply to the creator = %q, want the confirmation posted to the channel", reply)
+	}
+	if len(refunder.refunded) != 1 || refunder.refunded[0] != "pi_123" {
+		t.Errorf("refunded = %v, want [pi_123]", refunder.refunded)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// slackPost is a Slack API call, e.g. chat.postMessage or chat.postEphemeral
+type slackPost struct {
+	Method  string
+	Channel string
+	User    string
+	Text    string
+	Blocks  string
+}
+
+// fakeSlack serves the Slack API calls the services make and records them. File uploads to
+// channels in failChannels are rejected, and the uploaded bodies and the channels files were
+// shared to are recorded.
+type fakeSlack struct {
+	URL string // API URL for clients with other tokens, e.g. another workspace's
+
+	mu           sync.Mutex
+	failChannels map[string]bool
+	posts        []slackPost
+	shared       []string
+	uploads      [][]byte
+}
+
+func newFakeSlack(t *testing.T, failChannels ...string) (*slack.Client, *fakeSlack) {
+	t.Helper()
+	f := &fakeSlack{failChannels: map[string]bool{}}
+	for _, channel := range failChannels {
+		f.failChannels[channel] = true
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+	f.URL = server.URL + "/"
+	return slack.New("xoxb-test", slack.OptionAPIURL(f.URL)), f
+}
+
+func (f *fakeSlack) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	switch method {
+	case "conversations.open":
+		w.Write([]byte(`{"ok":true,"channel":{"id":"D_USER"}}`))
+	case "files.getUploadURLExternal":
+		w.Write([]byte(`{"ok":true,"upload_url":"` + strings.TrimSuffix(f.URL, "/") + `/upload","file_id":"F1"}`))
+	case "upload":
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.uploads = append(f.uploads, body)
+		f.mu.Unlock()
+		w.Write([]byte(`OK`))
+	case "files.completeUploadExternal":
+		channel := r.Form.Get("channel_id")
+		if f.failChannels[channel] {
+			w.Write([]byte(`{"ok":false,"error":"not_in_channel"}`))
+			return
+		}
+		f.mu.Lock()
+		f.shared = append(f.shared, channel)
+		f.mu.Unlock()
+		w.Write([]byte(`{"ok":true,"files":[{"id":"F1"}]}`))
+	default:
+		f.mu.Lock()
+		f.posts = append(f.posts, slackPost{Method: method, Channel: r.Form.Get("channel"), User: r.Form.Get("user"), Text: r.Form.Get("text"), Blocks: r.Form.Get("blocks")})
+		f.mu.Unlock()
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0","message_ts":"1.0"}`))
+	}
+}
+
+// calls returns every recorded call other than file uploads
+func (f *fakeSlack) calls() []slackPost {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slackPost(nil), f.posts...)
+}
+
+// posted returns the channels chat.postMessage was called with
+func (f *fakeSlack) posted() []string {
+	var channels []string
+	for _, post := range f.calls() {
+		if post.Method == "chat.postMessage" {
+			channels = append(channels, post.Channel)
+		}
+	}
+	return channels
+}
+
+// postedTexts returns the text and blocks of each chat.postMessage call
+func (f *fakeSlack) postedTexts() []string {
+	var texts []string
+	for _, post := range f.calls() {
+		if post.Method == "chat.postMessage" {
+			texts = append(texts, post.Text+"\n"+post.Blocks)
+		}
+	}
+	return texts
+}
+
+// waitForPost waits for a message to channel, since some are posted in the background
+func (f *fakeSlack) waitForPost(t *testing.T, method, channel string) slackPost {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, post := range f.calls() {
+			if post.Method == method && post.Channel == channel {
+				return post
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no %s to %s", method, channel)
+	return slackPost{}
+}
+
+// sharedTo returns the channels files were shared to
+func (f *fakeSlack) sharedTo() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.shared...)
+}
+
+// uploaded returns the bodies of the uploaded files
+func (f *fakeSlack) uploaded() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte(nil), f.uploads...)
+}
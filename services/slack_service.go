@@ -2,17 +2,26 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"paymentbot/config"
+	"paymentbot/counter"
+	"paymentbot/metrics"
 	"paymentbot/models"
+	"paymentbot/money"
+	"paymentbot/outbound"
 	"paymentbot/payment"
+	"paymentbot/shortener"
+	"paymentbot/slackresp"
+	"paymentbot/tracing"
+	"paymentbot/utils"
 
 	"github.com/slack-go/slack"
 )
@@ -23,11 +32,57 @@ type SlackService struct {
 	stripeGenerator    payment.PaymentLinkGenerator
 	airwallexGenerator payment.PaymentLinkGenerator
 	invoiceService     *InvoiceService
+	adminUserIDs       map[string]bool
+	urlShortener       shortener.URLShortener
+	webhookTracker     *WebhookEventTracker
+	webhookSecretSet   bool
+	publicBaseURL      string
+	modalDefaults      PaymentModalDefaults
+	refunder           payment.Refunder
+	reconciler         *payment.StripeSubscriptionReconciler
+	linkLister         *payment.StripeLinkLister
+	linkExpirer        *payment.StripeLinkExpirer
+	promotionCodes     *payment.StripePromotionCodes
+	stripeDryRun       bool // DRY_RUN is set, so the Stripe features above are off
+	previews           *pendingLinks
+	invoiceGuard       *DuplicateInvoiceGuard
+	receipts           *outbound.ReceiptEmitter
+	linkQueryParams    []utils.QueryParam
+	linkOrigins        LinkOriginStore
+	adminAlertChannel  string
+	ephemeralLinkCopy  bool
+	linkWorkers        *linkWorkers
+	teams              *teamClients // nil unless per-workspace configs are in use
+	audit              AuditSink    // nil unless an audit log is configured
+	logger             *slog.Logger
 }
 
-func NewSlackService(cfg *config.Config, stripeGen payment.PaymentLinkGenerator, airwallexGen payment.PaymentLinkGenerator) *SlackService {
-	client := slack.New(cfg.SlackBotToken)
-	invoiceService := NewInvoiceService(client)
+// NewSlackService wires the Slack-facing features together. A nil logger uses slog's default.
+func NewSlackService(cfg *config.Config, client *slack.Client, stripeGen payment.PaymentLinkGenerator, airwallexGen payment.PaymentLinkGenerator, urlShortener shortener.URLShortener, counters counter.CounterStore, linkOrigins LinkOriginStore, logger *slog.Logger) *SlackService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	invoiceService := NewInvoiceService(client, cfg, counters)
+
+	// Refunds go through Stripe, so they're only available when Stripe is configured. DRY_RUN
+	// turns them off too, since they'd act on real payments.
+	var refunder payment.Refunder
+	var reconciler *payment.StripeSubscriptionReconciler
+	var linkLister *payment.StripeLinkLister
+	var linkExpirer *payment.StripeLinkExpirer
+	var promotionCodes *payment.StripePromotionCodes
+	if cfg.StripeEnabled() && !cfg.DryRun {
+		refunder = payment.NewStripeRefunder(cfg.StripeAPIKey)
+		reconciler = payment.NewStripeSubscriptionReconciler(cfg.StripeAPIKey, cfg.CancelSnap)
+		linkLister = payment.NewStripeLinkLister(cfg.StripeAPIKey)
+		linkExpirer = payment.NewStripeLinkExpirer(cfg.StripeAPIKey)
+		promotionCodes = payment.NewStripePromotionCodes(cfg.StripeAPIKey)
+	}
+
+	adminUserIDs := make(map[string]bool)
+	for _, id := range cfg.AdminUserIDs {
+		adminUserIDs[id] = true
+	}
 
 	return &SlackService{
 		client:             client,
@@ -35,6 +90,32 @@ func NewSlackService(cfg *config.Config, stripeGen payment.PaymentLinkGenerator,
 		stripeGenerator:    stripeGen,
 		airwallexGenerator: airwallexGen,
 		invoiceService:     invoiceService,
+		adminUserIDs:       adminUserIDs,
+		urlShortener:       urlShortener,
+		webhookTracker:     NewWebhookEventTracker(),
+		webhookSecretSet:   cfg.StripeWebhookSecret != "",
+		publicBaseURL:      strings.TrimRight(cfg.PublicBaseURL, "/"),
+		modalDefaults: PaymentModalDefaults{
+			EndDateCycles: cfg.DefaultEndDateCycles,
+			Interval:      cfg.DefaultInterval,
+			IntervalCount: cfg.DefaultIntervalCount,
+			AutomaticTax:  cfg.StripeAutomaticTax,
+		},
+		refunder:          refunder,
+		reconciler:        reconciler,
+		linkLister:        linkLister,
+		linkExpirer:       linkExpirer,
+		promotionCodes:    promotionCodes,
+		stripeDryRun:      cfg.DryRun,
+		previews:          newPendingLinks(),
+		invoiceGuard:      NewDuplicateInvoiceGuard(cfg.InvoiceDuplicateWindow),
+		receipts:          outbound.NewReceiptEmitter(cfg.OutboundWebhookURL, cfg.OutboundWebhookSecret),
+		linkQueryParams:   cfg.LinkQueryParams,
+		linkOrigins:       linkOrigins,
+		adminAlertChannel: cfg.AdminAlertChannel,
+		ephemeralLinkCopy: cfg.EphemeralLinkCopy,
+		linkWorkers:       newLinkWorkers(cfg.LinkWorkers),
+		logger:            logger,
 	}
 }
 
@@ -42,11 +123,447 @@ func (s *SlackService) GetSigningSecret() string {
 	return s.signingSecret
 }
 
-func (s *SlackService) OpenPaymentLinkModal(triggerID string, provider models.PaymentProvider, channelID string) error {
+// IsAdmin reports whether the user is on the configured admin allow-list
+func (s *SlackService) IsAdmin(userID string) bool {
+	return s.adminUserIDs[userID]
+}
+
+// ProviderEnabled reports whether the provider has credentials configured on this server
+func (s *SlackService) ProviderEnabled(provider models.PaymentProvider) bool {
+	switch provider {
+	case models.ProviderStripe:
+		return s.stripeGenerator != nil
+	case models.ProviderAirwallex:
+		return s.airwallexGenerator != nil
+	}
+	return false
+}
+
+// WebhookTracker returns the tracker the webhook handler records deliveries into
+func (s *SlackService) WebhookTracker() *WebhookEventTracker {
+	return s.webhookTracker
+}
+
+// ProcessWebhookCheckCommand handles /webhook-check and returns an ephemeral status report
+func (s *SlackService) ProcessWebhookCheckCommand(userID string) string {
+	if !s.IsAdmin(userID) {
+		log.Printf("User %s attempted /webhook-check without admin rights", userID)
+		return "Sorry, only admins can check the webhook configuration."
+	}
+	if !s.ProviderEnabled(models.ProviderStripe) {
+		return "The Stripe provider isn't enabled, so no webhook endpoint is registered."
+	}
+
+	const webhookPath = "/stripe/webhook"
+	var sb strings.Builder
+	sb.WriteString("*Stripe webhook status*\n")
+	if s.publicBaseURL != "" {
+		sb.WriteString(fmt.Sprintf("• Endpoint: `%s%s`\n", s.publicBaseURL, webhookPath))
+	} else {
+		sb.WriteString(fmt.Sprintf("• Endpoint path: `%s` (set `PUBLIC_BASE_URL` to show the full URL)\n", webhookPath))
+	}
+	if s.webhookSecretSet {
+		sb.WriteString("• Signing secret: :white_check_mark: configured\n")
+	} else {
+		sb.WriteString("• Signing secret: :x: `STRIPE_WEBHOOK_SECRET` is not set, all deliveries will be rejected\n")
+	}
+
+	if event := s.webhookTracker.LastEvent(); event != nil {
+		sb.WriteString(fmt.Sprintf("• Last event: `%s` (`%s`) at %s\n", event.Type, event.ID, event.ReceivedAt.UTC().Format("2006-01-02 15:04:05 UTC")))
+	} else {
+		sb.WriteString("• Last event: none received since the server started\n")
+	}
+	if failedAt, reason := s.webhookTracker.LastFailure(); !failedAt.IsZero() {
+		sb.WriteString(fmt.Sprintf("• Last rejected delivery: %s (%s)\n", failedAt.UTC().Format("2006-01-02 15:04:05 UTC"), reason))
+	}
+
+	return sb.String()
+}
+
+// stripeUnavailable is the reply for a Stripe feature that's off: notEnabled, unless DRY_RUN
+// is what's keeping the bot from calling Stripe
+func (s *SlackService) stripeUnavailable(notEnabled string) string {
+	if s.stripeDryRun {
+		return "This isn't available while DRY_RUN is set, so nothing is read from or changed at Stripe."
+	}
+	return notEnabled
+}
+
+// ProcessRefundCommand handles /refund-payment. On success the confirmation is posted to the
+// channel and an empty string is returned; otherwise the returned text is an ephemeral error.
+func (s *SlackService) ProcessRefundCommand(ctx context.Context, userID, channelID, text string) string {
+	if s.refunder == nil {
+		return s.stripeUnavailable("Refunds aren't available because the Stripe provider isn't enabled.")
+	}
+
+	id, amount, err := utils.ParseRefundArguments(text)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+
+	// Users can only refund payments for links they created; admins can refund anything
+	if !s.IsAdmin(userID) {
+		if reply := s.checkRefundOwner(ctx, userID, id); reply != "" {
+			return reply
+		}
+	}
+
+	result, err := s.refunder.Refund(ctx, id, amount)
+	if err != nil {
+		log.Printf("Error refunding %s for user %s: %v", id, userID, err)
+		switch {
+		case errors.Is(err, payment.ErrAlreadyRefunded):
+			return fmt.Sprintf("`%s` has already been refunded.", id)
+		case errors.Is(err, payment.ErrPaymentNotFound):
+			return fmt.Sprintf("Couldn't find a refundable payment for `%s`. %v", id, err)
+		default:
+			return fmt.Sprintf("Error creating refund for `%s`: %v", id, err)
+		}
+	}
+
+	refundKind := "Full"
+	if amount > 0 {
+		refundKind = "Partial"
+	}
+	msg := fmt.Sprintf(
+		"<@%s> %s refund issued for `%s`\nRefund ID: `%s`\nAmount: %s\nStatus: %s",
+		userID, refundKind, id, result.RefundID, utils.FormatAmount(result.Amount, result.Currency), result.Status,
+	)
+	if _, _, err := s.slackClient(ctx).PostMessageContext(ctx, channelID, slack.MsgOptionText(msg, false)); err != nil {
+		log.Printf("Error posting refund confirmation to channel %s: %v", channelID, err)
+		// The refund went through, so return the confirmation to the user instead
+		return msg
+	}
+	return ""
+}
+
+// checkRefundOwner returns why userID can't refund id, or "" if they created its payment link
+func (s *SlackService) checkRefundOwner(ctx context.Context, userID, id string) string {
+	linkID, err := s.refunder.PaymentLinkFor(ctx, id)
+	if err != nil {
+		log.Printf("Error finding the payment link for %s for user %s: %v", id, userID, err)
+		if errors.Is(err, payment.ErrPaymentNotFound) {
+			return fmt.Sprintf("Couldn't find a refundable payment for `%s`. %v", id, err)
+		}
+		return fmt.Sprintf("Error looking up `%s`: %v", id, err)
+	}
+
+	var creator string
+	if s.linkOrigins != nil {
+		if origin, ok := s.linkOrigins.Get(linkID); ok {
+			creator = origin.UserID
+		}
+	}
+	if creator == "" {
+		// The origin store may be in memory and lost on restart, so fall back to the Slack user
+		// stamped on the link itself
+		if creator, err = s.refunder.PaymentLinkCreator(ctx, linkID); err != nil {
+			log.Printf("Error finding who created payment link %s for user %s: %v", linkID, userID, err)
+			return fmt.Sprintf("Error looking up `%s`: %v", id, err)
+		}
+	}
+	if creator != userID {
+		log.Printf("User %s attempted to refund %s (link %s) they didn't create", userID, id, linkID)
+		return fmt.Sprintf("Sorry, you can only refund payments for links you created. Ask an admin to refund `%s`.", id)
+	}
+	return ""
+}
+
+// reconcileTimeout bounds a background /reconcile-subscriptions run
+const reconcileTimeout = 5 * time.Minute
+
+// ProcessReconcileSubscriptionsCommand handles /reconcile-subscriptions. Reconciliation pages
+// through Stripe, so it runs in the background and the summary is sent as an ephemeral message.
+// "dry-run" only reports what would be scheduled.
+func (s *SlackService) ProcessReconcileSubscriptionsCommand(ctx context.Context, userID, channelID, text string) string {
+	if !s.IsAdmin(userID) {
+		log.Printf("User %s attempted /reconcile-subscriptions without admin rights", userID)
+		return "Sorry, only admins can reconcile subscriptions."
+	}
+	if s.reconciler == nil {
+		return s.stripeUnavailable("The Stripe provider isn't enabled, so there are no subscriptions to reconcile.")
+	}
+
+	var dryRun bool
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "":
+	case "dry-run":
+		dryRun = true
+	default:
+		return "Usage: `/reconcile-subscriptions [dry-run]`"
+	}
+
+	// The request context ends with the response, so keep only its workspace client
+	client := s.slackClient(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+		defer cancel()
+
+		log.Printf("User %s started subscription reconciliation (dry run: %t)", userID, dryRun)
+		result, err := s.reconciler.Reconcile(ctx, dryRun)
+		msg := formatReconcileResult(result, dryRun)
+		if err != nil {
+			log.Printf("Error reconciling subscriptions: %v", err)
+			msg = fmt.Sprintf("Reconciliation stopped early: %v\n%s", err, msg)
+		}
+		if _, err := client.PostEphemeralContext(ctx, channelID, userID, slack.MsgOptionText(msg, false)); err != nil {
+			log.Printf("Error posting reconciliation result to %s: %v", userID, err)
+		}
+	}()
+
+	if dryRun {
+		return "Checking subscriptions (dry run)... I'll reply here when done."
+	}
+	return "Reconciling subscriptions... I'll reply here when done."
+}
+
+// Limits for /list-payments
+const (
+	defaultListPaymentsLimit = 10
+	maxListPaymentsLimit     = 20
+	listPaymentsTimeout      = time.Minute
+)
+
+// ProcessListPaymentsCommand handles /list-payments [limit]: it looks up the user's most
+// recent Stripe links in the background and replies with an ephemeral list
+func (s *SlackService) ProcessListPaymentsCommand(ctx context.Context, userID, channelID, text string) string {
+	if s.linkLister == nil {
+		return s.stripeUnavailable("The Stripe provider isn't enabled, so there are no payment links to list.")
+	}
+
+	limit := defaultListPaymentsLimit
+	if arg := strings.TrimSpace(text); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > maxListPaymentsLimit {
+			return fmt.Sprintf("Usage: `/list-payments [limit]` where limit is 1-%d (default %d)", maxListPaymentsLimit, defaultListPaymentsLimit)
+		}
+		limit = n
+	}
+
+	client := s.slackClient(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), listPaymentsTimeout)
+		defer cancel()
+
+		result, err := s.linkLister.ListByUser(ctx, userID, limit)
+		var options []slack.MsgOption
+		switch {
+		case err != nil:
+			log.Printf("Error listing payment links for user %s: %v", userID, err)
+			options = []slack.MsgOption{slack.MsgOptionText("Sorry, your payment links couldn't be loaded from Stripe. Please try again later.", false)}
+		case len(result.Links) == 0:
+			options = []slack.MsgOption{slack.MsgOptionText(fmt.Sprintf("You haven't created any Stripe payment links yet (checked the %d most recent links).", result.Scanned), false)}
+		default:
+			options = []slack.MsgOption{
+				slack.MsgOptionText(fmt.Sprintf("Your %d most recent payment links", len(result.Links)), false),
+				slack.MsgOptionBlocks(BuildPaymentListBlocks(result)...),
+			}
+		}
+		if _, err := client.PostEphemeralContext(ctx, channelID, userID, options...); err != nil {
+			log.Printf("Error posting payment list to %s: %v", userID, err)
+		}
+	}()
+
+	return "Looking up your recent payment links..."
+}
+
+// appHomeRecentLinks is how many of the user's links the Home tab lists
+const appHomeRecentLinks = 5
+
+// PublishAppHome refreshes the user's Home tab in the background, so the app_home_opened event
+// can be acknowledged within Slack's 3 seconds while Stripe is searched
+func (s *SlackService) PublishAppHome(ctx context.Context, userID string) {
+	var providers []models.PaymentProvider
+	for _, provider := range []models.PaymentProvider{models.ProviderStripe, models.ProviderAirwallex} {
+		if s.ProviderEnabled(provider) {
+			providers = append(providers, provider)
+		}
+	}
+
+	client := s.slackClient(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), listPaymentsTimeout)
+		defer cancel()
+
+		var recent *payment.ListLinksResult
+		recentNote := ""
+		if s.linkLister == nil {
+			recentNote = s.stripeUnavailable("Recent links are listed when the Stripe provider is enabled.")
+		} else {
+			var err error
+			if recent, err = s.linkLister.ListByUser(ctx, userID, appHomeRecentLinks); err != nil {
+				log.Printf("Error listing payment links for %s's Home tab: %v", userID, err)
+				recentNote = "Your recent links couldn't be loaded from Stripe. Reopen this tab to try again."
+			}
+		}
+
+		view := BuildAppHomeView(providers, recent, recentNote)
+		if _, err := client.PublishViewContext(ctx, userID, view, ""); err != nil {
+			log.Printf("Error publishing Home tab for %s: %v", userID, err)
+		}
+	}()
+}
+
+// OpenModalFromAppHome opens the form behind one of the Home tab's buttons. The Home tab has
+// no channel, so the result is posted to the user's messages with the app.
+func (s *SlackService) OpenModalFromAppHome(ctx context.Context, actionID, triggerID, userID, teamID string) error {
+	switch actionID {
+	case HomeCreateStripeLinkActionID:
+		return s.OpenPaymentLinkModal(ctx, triggerID, models.ProviderStripe, userID)
+	case HomeCreateAirwallexLinkActionID:
+		return s.OpenPaymentLinkModal(ctx, triggerID, models.ProviderAirwallex, userID)
+	case HomeCreateInvoiceActionID:
+		return s.OpenInvoiceModal(ctx, triggerID, userID, teamID)
+	default:
+		return fmt.Errorf("unknown Home tab action: %s", actionID)
+	}
+}
+
+func formatReconcileResult(result *payment.ReconcileResult, dryRun bool) string {
+	if result == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	scheduledVerb := "Scheduled cancellation for"
+	if dryRun {
+		scheduledVerb = "Would schedule cancellation for"
+	}
+	fmt.Fprintf(&sb, "*Subscription reconciliation*\nChecked %d subscriptions.\n", result.Checked)
+	fmt.Fprintf(&sb, "%s %d: %s\n", scheduledVerb, len(result.Scheduled), formatIDList(result.Scheduled))
+	if len(result.Overdue) > 0 {
+		fmt.Fprintf(&sb, "Past their end date, cancel manually (%d): %s\n", len(result.Overdue), formatIDList(result.Overdue))
+	}
+	if len(result.Failed) > 0 {
+		fmt.Fprintf(&sb, "Failed to update (%d): %s\n", len(result.Failed), formatIDList(result.Failed))
+	}
+	if result.Truncated {
+		fmt.Fprintf(&sb, "Stopped after %d subscriptions; older subscriptions were not checked.\n", payment.MaxReconcileSubscriptions)
+	}
+	return sb.String()
+}
+
+// formatIDList renders IDs as inline code, or "none"
+func formatIDList(ids []string) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	return "`" + strings.Join(ids, "`, `") + "`"
+}
+
+// ProcessInvoiceCounterCommand handles /invoice-counter and returns the ephemeral reply text.
+// "next" reports the next invoice number for the channel; "set N" makes N the next number.
+func (s *SlackService) ProcessInvoiceCounterCommand(ctx context.Context, userID, teamID, channelID, text string) string {
+	if !s.IsAdmin(userID) {
+		log.Printf("User %s attempted /invoice-counter without admin rights", userID)
+		return "Sorry, only admins can manage the invoice counter."
+	}
+
+	cmd, err := utils.ParseInvoiceCounterArguments(text)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+
+	lastInvoiceNumber, err := s.invoiceService.GetLastInvoiceNumber(ctx, teamID, channelID)
+	if err != nil {
+		log.Printf("Error getting last invoice number: %v", err)
+		return "Error reading the invoice counter. Please try again."
+	}
+
+	if cmd.Action == "next" {
+		return fmt.Sprintf("The next invoice number in this channel is `%s`.", s.invoiceService.FormatInvoiceNumber(lastInvoiceNumber+1))
+	}
+
+	if cmd.Value <= lastInvoiceNumber && !cmd.Force {
+		return fmt.Sprintf("The next invoice number must be greater than the current counter (`%d`). Use `/invoice-counter set %d force` to go lower.", lastInvoiceNumber, cmd.Value)
+	}
+
+	// The counter stores the last used number, so the requested next number is stored minus one
+	if err := s.invoiceService.UpdateLastInvoiceNumber(ctx, teamID, channelID, cmd.Value-1); err != nil {
+		log.Printf("Error updating invoice counter: %v", err)
+		return "Error updating the invoice counter. Please try again."
+	}
+
+	log.Printf("User %s set next invoice number to %d for team %s in channel %s (was %d)", userID, cmd.Value, teamID, channelID, lastInvoiceNumber+1)
+	return fmt.Sprintf("Invoice counter updated. The next invoice number in this channel is `%s` (was `%s`).",
+		s.invoiceService.FormatInvoiceNumber(cmd.Value), s.invoiceService.FormatInvoiceNumber(lastInvoiceNumber+1))
+}
+
+func (s *SlackService) OpenPaymentLinkModal(ctx context.Context, triggerID string, provider models.PaymentProvider, channelID string) error {
 	log.Printf("Opening payment link modal for provider: %s, channel: %s", provider, channelID)
-	modalView := BuildPaymentModalView(provider, channelID)
+	return s.openPaymentModal(ctx, triggerID, provider, channelID, s.modalDefaults)
+}
+
+// OpenPaymentLinkModalWithArguments opens the payment modal prefilled from the arguments of
+// /create-stripe-link or /create-airwallex-link, so the user can check them before creating the link
+func (s *SlackService) OpenPaymentLinkModalWithArguments(ctx context.Context, triggerID string, provider models.PaymentProvider, channelID string, args *models.PaymentLinkData) error {
+	log.Printf("Opening payment link modal with command arguments for provider: %s, channel: %s", provider, channelID)
+
+	defaults := s.modalDefaults
+	defaults.Amount = strconv.FormatFloat(args.Amount, 'f', -1, 64)
+	defaults.ServiceName = args.ServiceName
+	defaults.Description = args.ReferenceNumber
+	if args.IsSubscription {
+		defaults.Subscription = true
+		defaults.Interval = args.Interval
+		defaults.IntervalCount = args.IntervalCount
+		if args.EndDateCycles > 0 {
+			defaults.EndDateCycles = args.EndDateCycles
+		}
+	}
+	return s.openPaymentModal(ctx, triggerID, provider, channelID, defaults)
+}
+
+// PaymentLinkShortcutCallbackID is the callback ID of the "Create payment link from this"
+// message shortcut configured in the Slack app
+const PaymentLinkShortcutCallbackID = "create_payment_link_from_message"
+
+// OpenPaymentLinkModalFromMessage opens the payment modal from the message shortcut, with the
+// message's first line as the service name and the whole message as the description. Stripe
+// is used when enabled, since it's the provider with the most options.
+func (s *SlackService) OpenPaymentLinkModalFromMessage(ctx context.Context, triggerID, channelID, messageText string) error {
+	provider := models.ProviderStripe
+	if !s.ProviderEnabled(provider) {
+		provider = models.ProviderAirwallex
+	}
+	if !s.ProviderEnabled(provider) {
+		return fmt.Errorf("no payment provider is enabled")
+	}
+	log.Printf("Opening payment link modal from a message shortcut for provider: %s, channel: %s", provider, channelID)
+
+	defaults := s.modalDefaults
+	defaults.ServiceName, defaults.Description = messagePrefill(messageText, utils.MaxDescriptionLength(provider))
+	return s.openPaymentModal(ctx, triggerID, provider, channelID, defaults)
+}
 
-	_, err := s.client.OpenView(triggerID, modalView)
+// messagePrefill splits a Slack message into a service name (its first non-empty line) and a
+// description (the whole message), both normalized and cut to maxLen characters
+func messagePrefill(text string, maxLen int) (serviceName, description string) {
+	truncate := func(s string) string {
+		if runes := []rune(s); len(runes) > maxLen {
+			return strings.TrimSpace(string(runes[:maxLen-1])) + "…"
+		}
+		return s
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if serviceName = utils.NormalizeDescription(line); serviceName != "" {
+			break
+		}
+	}
+	return truncate(serviceName), truncate(utils.NormalizeDescription(text))
+}
+
+func (s *SlackService) openPaymentModal(ctx context.Context, triggerID string, provider models.PaymentProvider, channelID string, defaults PaymentModalDefaults) error {
+	modalView := BuildPaymentModalView(provider, channelID, defaults)
+	if err := validateModalView(modalView); err != nil {
+		log.Printf("Error building payment link modal: %v", err)
+		return fmt.Errorf("invalid modal: %w", err)
+	}
+
+	ctx, span := tracing.StartClientSpan(ctx, "slack.views.open")
+	defer span.End()
+	_, err := s.slackClient(ctx).OpenViewContext(ctx, triggerID, modalView)
+	span.RecordError(err)
 	if err != nil {
 		log.Printf("Error opening modal: %v", err)
 		return fmt.Errorf("failed to open modal: %w", err)
@@ -54,139 +571,331 @@ func (s *SlackService) OpenPaymentLinkModal(triggerID string, provider models.Pa
 	return nil
 }
 
-func (s *SlackService) GenerateLinkForProvider(data *models.PaymentLinkData, provider models.PaymentProvider) (string, string, error) {
+func (s *SlackService) GenerateLinkForProvider(ctx context.Context, data *models.PaymentLinkData, provider models.PaymentProvider) (string, string, error) {
+	ctx, span := tracing.StartSpan(ctx, "GenerateLinkForProvider")
+	defer span.End()
+	defer metrics.ObserveSince(metrics.OperationDuration, time.Now(), "generate_link")
+	span.SetAttribute("provider", string(provider))
+	span.SetAttribute("is_subscription", data.IsSubscription)
+	logger := s.linkLogger(provider, data)
+
 	var paymentLink, paymentID string
 	var generationErr error
 
+	if !s.ProviderEnabled(provider) {
+		generationErr = fmt.Errorf("the %s provider isn't enabled", provider)
+		span.RecordError(generationErr)
+		return "", "", generationErr
+	}
+
 	switch provider {
 	case models.ProviderStripe:
-		paymentLink, paymentID, generationErr = s.stripeGenerator.GenerateLink(data)
+		paymentLink, paymentID, generationErr = s.stripeGenerator.GenerateLink(ctx, data)
 	case models.ProviderAirwallex:
-		paymentLink, paymentID, generationErr = s.airwallexGenerator.GenerateLink(data)
+		paymentLink, paymentID, generationErr = s.airwallexGenerator.GenerateLink(ctx, data)
 	default:
-		return "", "", fmt.Errorf("unknown provider: %s", provider)
+		generationErr = fmt.Errorf("unknown provider: %s", provider)
+	}
+	span.RecordError(generationErr)
+	if generationErr != nil {
+		logger.Error("Payment link generation failed", "error", generationErr)
+		metrics.LinksCreated.WithLabelValues(string(provider), "error").Inc()
+	} else {
+		logger.Info("Payment link generated", "payment_id", paymentID)
+		metrics.LinksCreated.WithLabelValues(string(provider), "success").Inc()
 	}
 	return paymentLink, paymentID, generationErr
 }
 
-func (s *SlackService) SendPaymentLinkMessage(userID, channelID string, data *models.PaymentLinkData, link, paymentID string, provider models.PaymentProvider) {
-	providerStr := string(provider)
-	if providerStr == "stripe" {
-		providerStr = "Stripe"
-	} else if providerStr == "airwallex" {
-		providerStr = "Airwallex"
+// linkLogger returns a logger carrying the request-scoped fields of a payment link
+func (s *SlackService) linkLogger(provider models.PaymentProvider, data *models.PaymentLinkData) *slog.Logger {
+	return s.logger.With("provider", provider, "channel_id", data.SlackChannelID, "user_id", data.SlackUserID)
+}
+
+func (s *SlackService) SendPaymentLinkMessage(ctx context.Context, userID, channelID string, data *models.PaymentLinkData, link, paymentID string, provider models.PaymentProvider) {
+	providerStr := providerDisplayName(provider)
+	logger := s.linkLogger(provider, data)
+	// Plain text is still sent for notifications and clients that can't render blocks
+	linkKind := "payment"
+	if data.Donation {
+		linkKind = "donation"
 	}
-	msg := fmt.Sprintf(
-		"<@%s> Here is your %s payment link for *%s* (Amount: $%.2f):\n%s",
-		userID, providerStr, data.ServiceName, data.Amount, link,
+	fallback := fmt.Sprintf(
+		"<@%s> Here is your %s %s link for *%s* (Amount: %s):\n%s",
+		userID, providerStr, linkKind, data.ServiceName, PaymentAmountText(data), link,
 	)
-	if paymentID != "" {
-		msg += fmt.Sprintf("\nPayment ID: `%s`", paymentID)
-	}
-	if data.IsSubscription && data.EndDateCycles > 0 {
-		msg += fmt.Sprintf("\nEnd Date: %d cycles (%d %s payments)", data.EndDateCycles, data.EndDateCycles, data.Interval)
-	}
-	_, _, err := s.client.PostMessage(channelID, slack.MsgOptionText(msg, false))
+	blocks := BuildPaymentLinkMessageBlocks(userID, providerStr, data, link, paymentID)
+
+	ctx, span := tracing.StartClientSpan(ctx, "slack.chat.postMessage")
+	defer span.End()
+	_, _, err := s.slackClient(ctx).PostMessageContext(ctx, channelID, slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(blocks...))
 	if err != nil {
-		log.Printf("Error sending payment link message to channel %s: %v", channelID, err)
+		span.RecordError(err)
+		logger.Warn("Error sending payment link message to channel, falling back to DM", "error", err)
 		// Fallback: send to user's DM with debug note
-		debugMsg := msg + fmt.Sprintf("\n\n:warning: _This message was not sent to the channel because of: %v. Perhaps add the bot to the channel?_", err)
-		_, _, dmErr := s.client.PostMessage(userID, slack.MsgOptionText(debugMsg, false))
+		warning := fmt.Sprintf(":warning: _This message was not sent to the channel because of: %v. Perhaps add the bot to the channel?_", err)
+		dmBlocks := append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, warning, false, false)))
+		_, _, dmErr := s.slackClient(ctx).PostMessageContext(ctx, userID, slack.MsgOptionText(fallback+"\n\n"+warning, false), slack.MsgOptionBlocks(dmBlocks...))
 		if dmErr != nil {
-			log.Printf("Error sending fallback DM to user %s: %v", userID, dmErr)
+			logger.Error("Error sending fallback DM", "error", dmErr)
+		}
+		return
+	}
+
+	// Give the creator a private copy so their link is easy to find in a busy channel
+	if s.ephemeralLinkCopy && channelID != userID {
+		copyText := fmt.Sprintf("Your %s %s link for *%s* was posted in <#%s>:\n<%s>", providerStr, linkKind, data.ServiceName, channelID, link)
+		if paymentID != "" {
+			copyText += fmt.Sprintf("\nPayment ID: `%s`", paymentID)
+		}
+		if _, err := s.slackClient(ctx).PostEphemeralContext(ctx, channelID, userID, slack.MsgOptionText(copyText, false)); err != nil {
+			logger.Warn("Error sending private link copy", "error", err)
 		}
 	}
 }
 
-func (s *SlackService) ProcessModalSubmission(w http.ResponseWriter, interaction *slack.InteractionCallback) {
-	log.Printf("Handling modal submission for callback ID: %s", interaction.View.CallbackID)
+func (s *SlackService) ProcessModalSubmission(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	s.logger.Info("Handling payment modal submission", "callback_id", interaction.View.CallbackID, "team_id", interaction.Team.ID, "user_id", interaction.User.ID)
 
 	// Extract provider from callback ID
 	callbackParts := strings.Split(interaction.View.CallbackID, "_")
 	provider := models.PaymentProvider(callbackParts[len(callbackParts)-1])
 
 	values := interaction.View.State.Values
-	amountStr := values["amount_block"]["amount_input"].Value
-	amount, err := strconv.ParseFloat(amountStr, 64)
-	if err != nil || amount <= 0 {
-		respondWithError(w, "amount_block", "Please enter a valid positive amount")
+	amountStr, ok := getValue(values, "amount_block", "amount_input")
+	if !ok {
+		slackresp.Error(w, "amount_block", missingFieldMessage)
 		return
 	}
-	serviceName := values["service_block"]["service_input"].Value
+	currency, _ := getSelectedOption(values, "currency_block", "currency_select")
+	currency, err := utils.NormalizeCurrency(currency)
+	if err != nil {
+		slackresp.Error(w, "currency_block", err.Error())
+		return
+	}
+	amount, err := utils.ParseAmountInCurrency(amountStr, currency)
+	if err != nil {
+		slackresp.Error(w, "amount_block", err.Error())
+		return
+	}
+	if amount <= 0 {
+		slackresp.Error(w, "amount_block", "Please enter a valid positive amount")
+		return
+	}
+	rawServiceName, ok := getValue(values, "service_block", "service_input")
+	if !ok {
+		slackresp.Error(w, "service_block", missingFieldMessage)
+		return
+	}
+	serviceName := utils.NormalizeDescription(rawServiceName)
 	if serviceName == "" {
-		respondWithError(w, "service_block", "Service name cannot be empty")
+		slackresp.Error(w, "service_block", "Service name cannot be empty")
+		return
+	}
+	rawReference, _ := getValue(values, "reference_block", "reference_input")
+	referenceNumber, err := utils.SanitizeDescription(rawReference, utils.MaxDescriptionLength(provider))
+	if err != nil {
+		slackresp.Error(w, "reference_block", fmt.Sprintf("Invalid description: %v", err))
 		return
 	}
-	referenceNumber := values["reference_block"]["reference_input"].Value
 	if referenceNumber == "" {
 		referenceNumber = fmt.Sprintf("REF-%d", time.Now().Unix())
 	}
 
+	var expiresAt time.Time
+	rawExpiry, _ := getValue(values, "expires_block", "expires_input")
+	expiry, err := utils.ParseLinkExpiry(rawExpiry)
+	if err != nil {
+		slackresp.Error(w, "expires_block", err.Error())
+		return
+	}
+	if expiry > 0 {
+		expiresAt = time.Now().Add(expiry).Truncate(time.Minute)
+	}
+
+	redirectURL := ""
+	if raw, _ := getValue(values, "redirect_url_block", "redirect_url_input"); strings.TrimSpace(raw) != "" {
+		redirectURL, err = utils.NormalizeRedirectURL(strings.TrimSpace(raw))
+		if err != nil {
+			slackresp.Error(w, "redirect_url_block", err.Error())
+			return
+		}
+	}
+
 	isSubscription := false
-	interval := "month"
-	intervalCount := int64(1)
+	interval := s.modalDefaults.Interval
+	if interval == "" {
+		interval = "month"
+	}
+	intervalCount := s.modalDefaults.IntervalCount
+	if intervalCount < 1 {
+		intervalCount = 1
+	}
 	endDateCycles := int64(0)
+	allowPromotionCodes := false
+	skipSaveCard := false
+	automaticTax := false
+	promotionCode := ""
+	trialDays := int64(0)
+	adjustableQuantity := false
+	quantityMin, quantityMax := int64(0), int64(0)
+	sku := ""
+	customerEmail := ""
+	var lineItems []models.PaymentLineItem
 
 	if provider == models.ProviderStripe {
-		// Check for subscription checkbox
-		if subBlock, ok := values["subscription_block"]; ok {
-			if subElem, ok := subBlock["subscription_checkbox"]; ok && len(subElem.SelectedOptions) > 0 {
-				isSubscription = true
+		var err error
+		rawSKU, _ := getValue(values, "sku_block", "sku_input")
+		sku, err = utils.NormalizeSKU(rawSKU)
+		if err != nil {
+			slackresp.Error(w, "sku_block", err.Error())
+			return
+		}
+		// Extra items are sold alongside the main amount/service item
+		rawItems, _ := getValue(values, "additional_items_block", "additional_items_input")
+		extraItems, err := utils.ParsePaymentLineItems(rawItems)
+		if err != nil {
+			slackresp.Error(w, "additional_items_block", err.Error())
+			return
+		}
+		if len(extraItems)+1 > utils.StripeMaxLineItems {
+			slackresp.Error(w, "additional_items_block", fmt.Sprintf("Stripe links are limited to %d line items in total", utils.StripeMaxLineItems))
+			return
+		}
+		if raw, _ := getValue(values, "customer_email_block", "customer_email_input"); strings.TrimSpace(raw) != "" {
+			customerEmail, err = utils.NormalizeEmail(strings.TrimSpace(raw))
+			if err != nil {
+				slackresp.Error(w, "customer_email_block", err.Error())
+				return
 			}
 		}
+		if len(extraItems) > 0 {
+			lineItems = append([]models.PaymentLineItem{{Description: serviceName, UnitAmount: amount, Quantity: 1, SKU: sku}}, extraItems...)
+		}
+
+		// Check for subscription checkbox
+		subscriptionOptions, _ := getSelectedOptions(values, "subscription_block", "subscription_checkbox")
+		isSubscription = len(subscriptionOptions) > 0
 		// Interval select
-		if intervalBlock, ok := values["interval_block"]; ok {
-			if intervalElem, ok := intervalBlock["interval_select"]; ok && intervalElem.SelectedOption.Value != "" {
-				interval = intervalElem.SelectedOption.Value
-			}
+		if selected, _ := getSelectedOption(values, "interval_block", "interval_select"); selected != "" {
+			interval = selected
 		}
 		// Interval count select
-		if countBlock, ok := values["interval_count_block"]; ok {
-			if countElem, ok := countBlock["interval_count_select"]; ok && countElem.SelectedOption.Value != "" {
-				parsed, err := strconv.ParseInt(countElem.SelectedOption.Value, 10, 64)
-				if err == nil && parsed > 0 {
-					intervalCount = parsed
+		if selected, _ := getSelectedOption(values, "interval_count_block", "interval_count_select"); selected != "" {
+			parsed, err := strconv.ParseInt(selected, 10, 64)
+			if err == nil && parsed > 0 {
+				intervalCount = parsed
+			}
+		}
+		// Named cadence presets override the raw interval/frequency fields
+		if selected, _ := getSelectedOption(values, "cadence_block", "cadence_select"); selected != "" {
+			if presetInterval, presetCount, ok := utils.ResolveCadencePreset(selected); ok {
+				interval = presetInterval
+				intervalCount = presetCount
+			}
+		}
+		if !utils.IsValidInterval(interval) {
+			slackresp.Error(w, "interval_block", "Please choose a daily, weekly, monthly or yearly billing interval")
+			return
+		}
+		// End date cycles input (blank uses the configured default, 0 means no end date)
+		endDateCycles = s.modalDefaults.EndDateCycles
+		if raw, _ := getValue(values, "end_date_block", "end_date_input"); strings.TrimSpace(raw) != "" {
+			parsed, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				slackresp.Error(w, "end_date_block", "Please enter a valid number for end date cycles")
+				return
+			}
+			if parsed < 0 {
+				slackresp.Error(w, "end_date_block", "End date cycles cannot be negative")
+				return
+			}
+			endDateCycles = parsed
+		}
+		// Free trial (subscriptions only)
+		rawTrial, _ := getValue(values, "trial_days_block", "trial_days_input")
+		trialDays, err = utils.ParseTrialDays(rawTrial)
+		if err != nil {
+			slackresp.Error(w, "trial_days_block", err.Error())
+			return
+		}
+		if trialDays > 0 && !isSubscription {
+			slackresp.Error(w, "trial_days_block", "Free trials are only available on subscriptions")
+			return
+		}
+		// Checkout options checkboxes (saving the card is ticked by default)
+		if selected, ok := getSelectedOptions(values, "promo_codes_block", "promo_codes_checkbox"); ok {
+			skipSaveCard = true
+			for _, value := range selected {
+				switch value {
+				case "allow_promotion_codes":
+					allowPromotionCodes = true
+				case saveCardOptionValue:
+					skipSaveCard = false
+				case automaticTaxOptionValue:
+					automaticTax = true
+				case adjustableQuantityOptionValue:
+					adjustableQuantity = true
 				}
 			}
 		}
-		// End date cycles input
-		if endDateBlock, ok := values["end_date_block"]; ok {
-			if endDateElem, ok := endDateBlock["end_date_input"]; ok && endDateElem.Value != "" {
-				parsed, err := strconv.ParseInt(strings.TrimSpace(endDateElem.Value), 10, 64)
-				if err != nil {
-					respondWithError(w, "end_date_block", "Please enter a valid number for end date cycles")
+		// Quantity limits only mean something when the customer chooses the quantity
+		rawMin, _ := getValue(values, "quantity_min_block", "quantity_min_input")
+		rawMax, _ := getValue(values, "quantity_max_block", "quantity_max_input")
+		if !adjustableQuantity && strings.TrimSpace(rawMin+rawMax) != "" {
+			slackresp.Error(w, "quantity_min_block", "Tick \"Let the customer choose the quantity\" to use quantity limits, or clear them")
+			return
+		}
+		if adjustableQuantity {
+			switch {
+			case isSubscription:
+				slackresp.Error(w, "promo_codes_block", "The customer can only choose the quantity on one-time payments")
+				return
+			case len(lineItems) > 0:
+				slackresp.Error(w, "promo_codes_block", "The customer can only choose the quantity on links with a single item")
+				return
+			}
+			if quantityMin, err = utils.ParseQuantityLimit(rawMin, utils.DefaultMinAdjustableQuantity); err != nil {
+				slackresp.Error(w, "quantity_min_block", err.Error())
+				return
+			}
+			if quantityMax, err = utils.ParseQuantityLimit(rawMax, utils.DefaultMaxAdjustableQuantity); err != nil {
+				slackresp.Error(w, "quantity_max_block", err.Error())
+				return
+			}
+			if err := utils.ValidateQuantityRange(quantityMin, quantityMax); err != nil {
+				slackresp.Error(w, "quantity_max_block", err.Error())
+				return
+			}
+		}
+		// A specific promotion code is checked now so problems show on the form
+		if raw, _ := getValue(values, "promotion_code_block", "promotion_code_input"); strings.TrimSpace(raw) != "" {
+			promotionCode = strings.TrimSpace(raw)
+			if s.promotionCodes != nil {
+				resolved, err := s.promotionCodes.Resolve(ctx, promotionCode, currency)
+				if errors.Is(err, payment.ErrPromotionCodeUnusable) {
+					slackresp.Error(w, "promotion_code_block", err.Error())
 					return
 				}
-				if parsed <= 0 {
-					respondWithError(w, "end_date_block", "End date cycles must be a positive number")
+				if err != nil {
+					s.logger.Error("Error checking promotion code", "code", promotionCode, "error", err)
+					slackresp.Error(w, "promotion_code_block", "The promotion code couldn't be checked with Stripe. Please try again.")
 					return
 				}
-				endDateCycles = parsed
+				promotionCode = resolved
 			}
+			// Checkout only applies a prefilled code when the link accepts codes
+			allowPromotionCodes = true
 		}
 	}
 
 	internalReference := ""
 	if provider == models.ProviderAirwallex {
-		internalReference = values["internal_reference_block"]["internal_reference_input"].Value
-	}
-
-	paymentData := &models.PaymentLinkData{
-		Amount:            amount,
-		ServiceName:       serviceName,
-		ReferenceNumber:   referenceNumber,
-		IsSubscription:    isSubscription,
-		Interval:          interval,
-		IntervalCount:     intervalCount,
-		EndDateCycles:     endDateCycles,
-		InternalReference: internalReference,
-	}
-
-	paymentLink, paymentID, generationErr := s.GenerateLinkForProvider(paymentData, provider)
-	if generationErr != nil {
-		log.Printf("Error generating %s payment link: %v", provider, generationErr)
-		respondWithError(w, "", fmt.Sprintf("Error generating payment link: %v", generationErr))
-		return
+		internalReference, _ = getValue(values, "internal_reference_block", "internal_reference_input")
+		if strings.TrimSpace(internalReference) == "" {
+			// Generated here rather than in the generator so webhooks can be routed by it
+			internalReference = fmt.Sprintf("slackbot-%d", time.Now().UnixNano())
+		}
 	}
 
 	channelID := interaction.Channel.ID
@@ -200,26 +909,266 @@ func (s *SlackService) ProcessModalSubmission(w http.ResponseWriter, interaction
 		}
 	}
 
-	log.Printf("Sending payment link message to user: %s, channel: %s, payment link: %s, payment ID: %s, provider: %s", interaction.User.ID, channelID, paymentLink, paymentID, provider)
-	s.SendPaymentLinkMessage(interaction.User.ID, channelID, paymentData, paymentLink, paymentID, provider)
+	paymentData := &models.PaymentLinkData{
+		Amount:              amount,
+		Currency:            currency,
+		ServiceName:         serviceName,
+		ReferenceNumber:     referenceNumber,
+		IsSubscription:      isSubscription,
+		Interval:            interval,
+		IntervalCount:       intervalCount,
+		EndDateCycles:       endDateCycles,
+		TrialDays:           trialDays,
+		InternalReference:   internalReference,
+		AllowPromotionCodes: allowPromotionCodes,
+		SkipSaveCard:        skipSaveCard,
+		AutomaticTax:        automaticTax,
+		PromotionCode:       promotionCode,
+		AdjustableQuantity:  adjustableQuantity,
+		QuantityMin:         quantityMin,
+		QuantityMax:         quantityMax,
+		SKU:                 sku,
+		CustomerEmail:       customerEmail,
+		ExpiresAt:           expiresAt,
+		RedirectURL:         redirectURL,
+		LineItems:           lineItems,
+		SlackChannelID:      channelID,
+		SlackUserID:         interaction.User.ID,
+		SlackTeamID:         ResolveTeamKey(interaction),
+	}
+	// The posted amount is what the customer pays in total
+	if len(lineItems) > 0 {
+		total := money.Money{Currency: currency}
+		for _, item := range lineItems {
+			total = total.Add(money.FromMajor(item.UnitAmount, currency).Times(item.Quantity))
+		}
+		paymentData.Amount = total.Major()
+	}
+
+	// Nothing is created until the user confirms the summary pushed on top of the form
+	token := s.previews.hold(pendingLink{
+		Provider:  provider,
+		Data:      paymentData,
+		UserID:    interaction.User.ID,
+		ChannelID: channelID,
+		CreatedAt: time.Now(),
+	})
+	slackresp.Push(w, BuildPaymentPreviewView(token, providerDisplayName(provider), paymentData))
+}
+
+// ProcessPaymentPreviewConfirmation creates the link when "Confirm & Create" is pressed on the preview
+func (s *SlackService) ProcessPaymentPreviewConfirmation(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	pending, ok := s.previews.take(interaction.View.PrivateMetadata, time.Now())
+	if !ok || pending.UserID != interaction.User.ID {
+		slackresp.Update(w, BuildPaymentErrorView("This preview has expired. Go back and submit the form again."))
+		return
+	}
+
+	paymentData := pending.Data
+	paymentData.RequestID = interaction.TriggerID
+	// Provider calls can outlast Slack's 3 second deadline, so the link is posted when ready
+	if !s.createLinkInBackground(ctx, pending.Provider, paymentData, pending.UserID, pending.ChannelID) {
+		slackresp.Update(w, BuildPaymentErrorView("Too many payment links are being created right now. Go back to try again in a moment, your details are kept."))
+		return
+	}
+	slackresp.Clear(w)
+}
+
+// providerDisplayName returns the provider's name as shown to users
+func providerDisplayName(provider models.PaymentProvider) string {
+	switch provider {
+	case models.ProviderStripe:
+		return "Stripe"
+	case models.ProviderAirwallex:
+		return "Airwallex"
+	default:
+		// Unknown providers get their first letter capitalized rather than strings.Title,
+		// which is deprecated and capitalizes after every non-letter
+		name := string(provider)
+		if name == "" {
+			return name
+		}
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+}
+
+// deliverPaymentLink tags and shortens a newly created link, posts it to the channel and
+// records it for payment notifications, outbound receipts and the audit log
+func (s *SlackService) deliverPaymentLink(ctx context.Context, provider models.PaymentProvider, paymentData *models.PaymentLinkData, paymentLink, paymentID, userID, channelID string) {
+	logger := s.linkLogger(provider, paymentData).With("payment_id", paymentID)
+	// Append configured tracking parameters; a failure keeps the provider's link as-is
+	if taggedLink, err := utils.AppendQueryParams(paymentLink, s.linkQueryParams, map[string]string{
+		"reference": paymentData.ReferenceNumber,
+		"provider":  string(provider),
+	}); err != nil {
+		logger.Warn("Error appending query parameters to payment link, using original URL", "error", err)
+	} else {
+		paymentLink = taggedLink
+	}
+
+	// Shorten the link for display; fall back to the original URL if the shortener fails
+	if shortLink, err := s.urlShortener.Shorten(ctx, paymentLink); err != nil {
+		logger.Warn("Error shortening payment link, using original URL", "error", err)
+	} else {
+		paymentLink = shortLink
+	}
+
+	logger.Info("Sending payment link message", "link", paymentLink)
+	s.SendPaymentLinkMessage(ctx, userID, channelID, paymentData, paymentLink, paymentID, provider)
+	s.recordLinkOrigin(ctx, provider, paymentID, paymentData, channelID, userID)
+	s.trackLinkExpiry(provider, paymentID, paymentData)
+	s.receipts.Emit(outbound.Receipt{
+		Type:      outbound.ReceiptPaymentLink,
+		Provider:  string(provider),
+		Amount:    paymentData.Amount,
+		Currency:  paymentData.Currency,
+		Link:      paymentLink,
+		ID:        paymentID,
+		Reference: paymentData.ReferenceNumber,
+		Channel:   channelID,
+		User:      userID,
+	})
+	s.recordAudit(ctx, AuditRecord{
+		Kind:      AuditPaymentLink,
+		User:      userID,
+		Channel:   channelID,
+		Provider:  string(provider),
+		Amount:    paymentData.Amount,
+		Currency:  paymentData.Currency,
+		Reference: paymentData.ReferenceNumber,
+		ID:        paymentID,
+		Link:      paymentLink,
+	})
+}
+
+// OpenDonationModal opens the /create-donation-link modal
+func (s *SlackService) OpenDonationModal(ctx context.Context, triggerID, channelID string) error {
+	log.Printf("Opening donation link modal for channel: %s", channelID)
+	modalView := BuildDonationModalView(channelID)
+	if err := validateModalView(modalView); err != nil {
+		log.Printf("Error building donation modal: %v", err)
+		return fmt.Errorf("invalid donation modal: %w", err)
+	}
+	if _, err := s.slackClient(ctx).OpenViewContext(ctx, triggerID, modalView); err != nil {
+		log.Printf("Error opening donation modal: %v", err)
+		return fmt.Errorf("failed to open donation modal: %w", err)
+	}
+	return nil
+}
+
+// ProcessDonationSubmission creates a reusable Stripe link where donors choose the amount
+func (s *SlackService) ProcessDonationSubmission(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	values := interaction.View.State.Values
+
+	rawCause, ok := getValue(values, "service_block", "service_input")
+	if !ok {
+		slackresp.Error(w, "service_block", missingFieldMessage)
+		return
+	}
+	serviceName := utils.NormalizeDescription(rawCause)
+	if serviceName == "" {
+		slackresp.Error(w, "service_block", "Cause cannot be empty")
+		return
+	}
+	rawCurrency, _ := getSelectedOption(values, "currency_block", "currency_select")
+	currency, err := utils.NormalizeCurrency(rawCurrency)
+	if err != nil {
+		slackresp.Error(w, "currency_block", err.Error())
+		return
+	}
+
+	// Both amounts are optional, so blank means "not set" rather than invalid
+	parseOptionalAmount := func(raw string) (float64, bool) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			return 0, true
+		}
+		amount, err := utils.ParseAmountInCurrency(raw, currency)
+		return amount, err == nil && amount > 0
+	}
+	rawSuggested, _ := getValue(values, "amount_block", "amount_input")
+	suggested, ok := parseOptionalAmount(rawSuggested)
+	if !ok {
+		slackresp.Error(w, "amount_block", "Please enter a valid positive amount, or leave it blank")
+		return
+	}
+	rawMinimum, _ := getValue(values, "donation_minimum_block", "donation_minimum_input")
+	minimum, ok := parseOptionalAmount(rawMinimum)
+	if !ok {
+		slackresp.Error(w, "donation_minimum_block", "Please enter a valid positive amount, or leave it blank")
+		return
+	}
+	if suggested > 0 && minimum > 0 && suggested < minimum {
+		slackresp.Error(w, "amount_block", "The suggested amount can't be below the minimum")
+		return
+	}
+
+	rawReference, _ := getValue(values, "reference_block", "reference_input")
+	referenceNumber, err := utils.SanitizeDescription(rawReference, utils.MaxDescriptionLength(models.ProviderStripe))
+	if err != nil {
+		slackresp.Error(w, "reference_block", fmt.Sprintf("Invalid description: %v", err))
+		return
+	}
+	if referenceNumber == "" {
+		referenceNumber = fmt.Sprintf("DONATION-%d", time.Now().Unix())
+	}
+
+	channelID := interaction.Channel.ID
+	if channelID == "" {
+		channelID = interaction.View.PrivateMetadata
+	}
+	if channelID == "" {
+		channelID = interaction.User.ID
+	}
+
+	paymentData := &models.PaymentLinkData{
+		Amount:          suggested,
+		Currency:        currency,
+		ServiceName:     serviceName,
+		ReferenceNumber: referenceNumber,
+		Donation:        true,
+		DonationMinimum: minimum,
+		SkipSaveCard:    true,
+		SlackChannelID:  channelID,
+		SlackUserID:     interaction.User.ID,
+		SlackTeamID:     ResolveTeamKey(interaction),
+		RequestID:       interaction.TriggerID,
+	}
+
+	if !s.createLinkInBackground(ctx, models.ProviderStripe, paymentData, interaction.User.ID, channelID) {
+		slackresp.Error(w, "service_block", "Too many payment links are being created right now. Your details are kept, please try again in a moment.")
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *SlackService) OpenInvoiceModal(triggerID, channelID, teamID string) error {
+func (s *SlackService) OpenInvoiceModal(ctx context.Context, triggerID, channelID, teamID string) error {
+	return s.openInvoiceModal(ctx, triggerID, channelID, teamID, BuildInvoiceModalView)
+}
+
+// OpenInvoicePreviewModal opens the invoice form for /invoice-preview
+func (s *SlackService) OpenInvoicePreviewModal(ctx context.Context, triggerID, channelID, teamID string) error {
+	return s.openInvoiceModal(ctx, triggerID, channelID, teamID, BuildInvoicePreviewModalView)
+}
+
+func (s *SlackService) openInvoiceModal(ctx context.Context, triggerID, channelID, teamID string, build func(string, string) slack.ModalViewRequest) error {
 	log.Printf("Opening invoice modal for channel: %s", channelID)
 
 	// Get the next invoice number using the current channel
-	ctx := context.Background()
 	lastInvoiceNumber, err := s.invoiceService.GetLastInvoiceNumber(ctx, teamID, channelID)
 	if err != nil {
 		log.Printf("Error getting last invoice number: %v", err)
-		lastInvoiceNumber = 1000 // fallback
+		lastInvoiceNumber = counter.DefaultStart // fallback
 	}
 	nextInvoiceNumber := lastInvoiceNumber + 1
 
-	modalView := BuildInvoiceModalView(channelID, nextInvoiceNumber)
+	modalView := build(channelID, s.invoiceService.FormatInvoiceNumber(nextInvoiceNumber))
+	if err := validateModalView(modalView); err != nil {
+		log.Printf("Error building invoice modal: %v", err)
+		return fmt.Errorf("invalid invoice modal: %w", err)
+	}
 
-	_, err = s.client.OpenView(triggerID, modalView)
+	_, err = s.slackClient(ctx).OpenViewContext(ctx, triggerID, modalView)
 	if err != nil {
 		log.Printf("Error opening invoice modal: %v", err)
 		return fmt.Errorf("failed to open invoice modal: %w", err)
@@ -227,10 +1176,23 @@ func (s *SlackService) OpenInvoiceModal(triggerID, channelID, teamID string) err
 	return nil
 }
 
-func (s *SlackService) ProcessInvoiceSubmission(w http.ResponseWriter, interaction *slack.InteractionCallback) {
-	log.Printf("Handling invoice modal submission")
+// ProcessInvoiceAddLineItem handles the invoice modal's "Add line item" button by updating the
+// open view with another row
+func (s *SlackService) ProcessInvoiceAddLineItem(ctx context.Context, interaction *slack.InteractionCallback) error {
+	view := BuildInvoiceModalWithAnotherLineItem(interaction.View, s.invoiceService.maxLineItems)
+	if err := validateModalView(view); err != nil {
+		return fmt.Errorf("invalid invoice modal: %w", err)
+	}
+	// The hash makes Slack reject the update if the view changed since this click
+	if _, err := s.slackClient(ctx).UpdateViewContext(ctx, view, "", interaction.View.Hash, interaction.View.ID); err != nil {
+		return fmt.Errorf("failed to add invoice line item: %w", err)
+	}
+	return nil
+}
 
-	values := interaction.View.State.Values
+func (s *SlackService) ProcessInvoiceSubmission(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	log.Printf("Handling invoice modal submission")
+	defer metrics.ObserveSince(metrics.OperationDuration, time.Now(), "invoice_submission")
 
 	// Get channel ID early since we need it for invoice number generation
 	channelID := interaction.Channel.ID
@@ -244,89 +1206,325 @@ func (s *SlackService) ProcessInvoiceSubmission(w http.ResponseWriter, interacti
 		}
 	}
 
+	// Resolve a stable team key for the invoice counter (Team.ID can be empty in Grid/app contexts)
+	teamID := ResolveTeamKey(interaction)
+	if teamID == "" {
+		log.Printf("Unable to determine team for invoice submission from user %s", interaction.User.ID)
+		slackresp.Error(w, "invoice_number_block", "Could not determine your workspace. Please specify an invoice number manually or try again.")
+		return
+	}
+
+	submission := &invoiceSubmission{
+		UserID:    interaction.User.ID,
+		TeamID:    teamID,
+		ChannelID: channelID,
+		Values:    interaction.View.State.Values,
+		View:      &interaction.View,
+		Preview:   interaction.View.CallbackID == InvoicePreviewCallbackID,
+	}
+	s.submitInvoice(ctx, w, submission, false)
+}
+
+// ProcessInvoiceDuplicateConfirmation handles the "Create Another" button on the near-duplicate prompt
+func (s *SlackService) ProcessInvoiceDuplicateConfirmation(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	submission, ok := s.invoiceGuard.TakePending(interaction.View.PrivateMetadata, time.Now())
+	if !ok || submission.UserID != interaction.User.ID {
+		slackresp.Update(w, BuildInvoiceErrorView("This confirmation has expired. Please run `/create-invoice` again."))
+		return
+	}
+
+	log.Printf("User %s confirmed a near-duplicate invoice in channel %s", submission.UserID, submission.ChannelID)
+	s.submitInvoice(ctx, w, submission, true)
+}
+
+// submitInvoice validates, generates and sends an invoice. Unless the user has already confirmed,
+// a near-duplicate of an invoice they just created pushes a confirmation view instead.
+func (s *SlackService) submitInvoice(ctx context.Context, w http.ResponseWriter, sub *invoiceSubmission, confirmed bool) {
+	values := sub.Values
+	userID, teamID, channelID := sub.UserID, sub.TeamID, sub.ChannelID
+
+	// Anything that returns without setting an outcome was turned back with a field error
+	outcome := "rejected"
+	defer func() { metrics.InvoiceSubmissions.WithLabelValues(outcome).Inc() }()
+
+	// The confirmation view has no input blocks, so errors there replace the view instead
+	fail := func(blockID, message string) {
+		if confirmed {
+			slackresp.Update(w, BuildInvoiceErrorView(message))
+			return
+		}
+		slackresp.Error(w, blockID, message)
+	}
+	// Errors that aren't about one field are shown above the form rather than under an input
+	failInvoice := func(message string) {
+		if confirmed || sub.View == nil {
+			slackresp.Update(w, BuildInvoiceErrorView(message))
+			return
+		}
+		slackresp.Update(w, BuildInvoiceModalWithError(*sub.View, message))
+	}
+
+	// Check the line item count before parsing so oversized invoices get a clear error. Only
+	// modals opened before line item rows have the pasted textarea.
+	if lineItemsText, ok := getValue(values, "line_items_block", "line_items_input"); ok {
+		if err := s.invoiceService.ValidateLineItemCount(lineItemsText); err != nil {
+			fail("line_items_block", err.Error())
+			return
+		}
+	}
+
 	// Parse invoice data from modal
 	invoice, err := s.invoiceService.ParseInvoiceDataFromModal(values)
+	var fieldErr *InvoiceFieldError
+	if errors.As(err, &fieldErr) {
+		fail(fieldErr.BlockID, fieldErr.Message)
+		return
+	}
 	if err != nil {
 		log.Printf("Error parsing invoice data: %v", err)
-		respondWithError(w, "", fmt.Sprintf("Error parsing invoice data: %v", err))
+		failInvoice(fmt.Sprintf("Error parsing invoice data: %v", err))
 		return
 	}
 
-	// Handle the case where override field is empty - we need to use the auto-generated number
-	overrideInvoiceNumber := values["invoice_number_block"]["invoice_number_input"].Value
-	if strings.TrimSpace(overrideInvoiceNumber) == "" {
-		// No override provided, we need to get the next invoice number using current channel
-		ctx := context.Background()
-		lastInvoiceNumber, err := s.invoiceService.GetLastInvoiceNumber(ctx, interaction.Team.ID, channelID)
-		if err != nil {
-			log.Printf("Error getting last invoice number: %v", err)
-			respondWithError(w, "", "Error generating invoice number. Please try again or specify a number manually.")
-			return
-		}
-		invoice.InvoiceNumber = strconv.Itoa(lastInvoiceNumber + 1)
-		log.Printf("Using auto-generated invoice number: %s", invoice.InvoiceNumber)
-	}
 	if invoice.ClientName == "" {
-		respondWithError(w, "client_name_block", "Client name is required")
+		fail("client_name_block", "Client name is required")
 		return
 	}
 	if invoice.ClientEmail == "" {
-		respondWithError(w, "client_email_block", "Client email is required")
+		fail("client_email_block", "Client email is required")
 		return
 	}
+	email, err := utils.NormalizeEmail(invoice.ClientEmail)
+	if err != nil {
+		fail("client_email_block", "Please enter a valid email address, e.g. name@example.com")
+		return
+	}
+	invoice.ClientEmail = email
 	if invoice.DateDue == "" {
-		respondWithError(w, "date_due_block", "Due date is required")
+		fail("date_due_block", "Due date is required")
 		return
 	}
 	if invoice.Currency == "" {
-		respondWithError(w, "currency_block", "Currency is required")
+		fail("currency_block", "Currency is required")
 		return
 	}
 
+	// Ask before generating an invoice that looks like one the user just created
+	if !confirmed && !sub.Preview {
+		if previous := s.invoiceGuard.FindRecentDuplicate(userID, channelID, invoice, time.Now()); previous != nil {
+			log.Printf("Invoice from user %s in channel %s looks like a duplicate of #%s, asking for confirmation",
+				userID, channelID, previous.InvoiceNumber)
+			outcome = "duplicate"
+			token := s.invoiceGuard.HoldPending(sub, time.Now())
+			slackresp.Push(w, BuildDuplicateInvoiceConfirmView(token, previous))
+			return
+		}
+	}
+
+	// Without an override, reserve the next number so concurrent submissions never share one
+	overrideInvoiceNumber, _ := getValue(values, "invoice_number_block", "invoice_number_input")
+	autoNumbered := strings.TrimSpace(overrideInvoiceNumber) == ""
+	// A reserved number is handed back if the invoice then fails, so failures don't leave gaps
+	reserved := 0
+	if autoNumbered && sub.Preview {
+		// A preview shows the number the next invoice would get without using it up
+		lastInvoiceNumber, err := s.invoiceService.GetLastInvoiceNumber(ctx, teamID, channelID)
+		if err != nil {
+			log.Printf("Error getting last invoice number for preview: %v", err)
+			lastInvoiceNumber = counter.DefaultStart
+		}
+		invoice.InvoiceNumber = s.invoiceService.FormatInvoiceNumber(lastInvoiceNumber + 1)
+	} else if autoNumbered {
+		nextInvoiceNumber, err := s.invoiceService.ReserveInvoiceNumber(ctx, teamID, channelID)
+		if err != nil {
+			log.Printf("Error reserving invoice number: %v", err)
+			outcome = "error"
+			fail("invoice_number_block", "Error generating invoice number. Please try again or specify a number manually.")
+			return
+		}
+		reserved = nextInvoiceNumber
+		invoice.InvoiceNumber = s.invoiceService.FormatInvoiceNumber(nextInvoiceNumber)
+		log.Printf("Using auto-generated invoice number: %s", invoice.InvoiceNumber)
+	}
+	releaseReserved := func() {
+		if reserved > 0 {
+			s.invoiceService.ReleaseInvoiceNumber(ctx, teamID, channelID, reserved)
+		}
+	}
+
 	// Generate PDF
 	pdfBytes, err := s.invoiceService.GenerateInvoicePDF(invoice)
 	if err != nil {
 		log.Printf("Error generating invoice PDF: %v", err)
-		respondWithError(w, "", fmt.Sprintf("Error generating invoice PDF: %v", err))
+		releaseReserved()
+		outcome = "error"
+		failInvoice(fmt.Sprintf("Error generating invoice PDF: %v. Your details are kept, please try again.", err))
+		return
+	}
+
+	if sub.Preview {
+		if err := s.invoiceService.SendInvoicePreview(ctx, userID, invoice, pdfBytes); err != nil {
+			log.Printf("Error sending invoice preview: %v", err)
+			outcome = "error"
+			failInvoice(fmt.Sprintf("Error sending invoice preview: %v. Your details are kept, please try again.", err))
+			return
+		}
+		outcome = "previewed"
+		log.Printf("Sent preview of invoice #%s to user %s", invoice.InvoiceNumber, userID)
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
 	// Send invoice to Slack
-	err = s.invoiceService.SendInvoiceToSlack(interaction.User.ID, channelID, invoice, pdfBytes)
+	err = s.invoiceService.SendInvoiceToSlack(ctx, userID, channelID, invoice, pdfBytes)
 	if err != nil {
 		log.Printf("Error sending invoice to Slack: %v", err)
-		respondWithError(w, "", fmt.Sprintf("Error sending invoice: %v", err))
+		releaseReserved()
+		outcome = "error"
+		failInvoice(fmt.Sprintf("Error sending invoice: %v. Your details are kept, please try again.", err))
 		return
 	}
+	outcome = "created"
+	s.invoiceGuard.Record(userID, channelID, invoice, time.Now())
+	s.receipts.Emit(outbound.Receipt{
+		Type:     outbound.ReceiptInvoice,
+		Amount:   invoice.Total(),
+		Currency: invoice.Currency,
+		ID:       invoice.InvoiceNumber,
+		Client:   invoice.ClientName,
+		Channel:  channelID,
+		User:     userID,
+	})
+	s.recordAudit(ctx, AuditRecord{
+		Kind:     AuditInvoice,
+		User:     userID,
+		Team:     teamID,
+		Channel:  channelID,
+		Amount:   invoice.Total(),
+		Currency: invoice.Currency,
+		ID:       invoice.InvoiceNumber,
+	})
 
-	// Update the invoice number counter after successful generation
-	ctx := context.Background()
-	invoiceNumInt, err := strconv.Atoi(invoice.InvoiceNumber)
-	if err != nil {
-		log.Printf("Error converting invoice number to int: %v", err)
-	} else {
-		err = s.invoiceService.UpdateLastInvoiceNumber(ctx, interaction.Team.ID, channelID, invoiceNumInt)
-		if err != nil {
-			log.Printf("Error updating last invoice number: %v", err)
-			// Don't fail the request if the counter update fails, just log it
-		} else {
-			log.Printf("Successfully updated invoice counter to %d for team %s in channel %s", invoiceNumInt, interaction.Team.ID, channelID)
-		}
+	// A manual number ahead of the counter moves the counter forward so it isn't reused
+	if !autoNumbered {
+		s.advanceInvoiceCounter(ctx, teamID, channelID, invoice.InvoiceNumber)
 	}
 
 	log.Printf("Successfully generated and sent invoice #%s to user %s in channel %s",
-		invoice.InvoiceNumber, interaction.User.ID, channelID)
+		invoice.InvoiceNumber, userID, channelID)
 
+	if confirmed {
+		// Close both the confirmation view and the invoice modal underneath it
+		slackresp.Clear(w)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
-func respondWithError(w http.ResponseWriter, blockID, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{
-		"response_action": "errors",
-		"errors": map[string]string{
-			blockID: message,
-		},
+// ResolveTeamKey derives a stable team identifier from an interaction. Team.ID can be empty for
+// org-wide (Enterprise Grid) installs, so fall back to the view's team, the user's team, then the enterprise ID.
+func ResolveTeamKey(interaction *slack.InteractionCallback) string {
+	candidates := []string{
+		interaction.Team.ID,
+		interaction.View.TeamID,
+		interaction.User.TeamID,
+		interaction.Enterprise.ID,
+	}
+	for _, candidate := range candidates {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// recordLinkOrigin remembers which channel a link was posted to, keyed by the provider's link
+// ID and (for Airwallex) our reference, so payment webhooks can be routed back to the right
+// workspace and channel
+func (s *SlackService) recordLinkOrigin(ctx context.Context, provider models.PaymentProvider, paymentID string, data *models.PaymentLinkData, channelID, userID string) {
+	if s.linkOrigins == nil || paymentID == "" {
+		return
+	}
+
+	teamID := data.SlackTeamID
+	if teamID == "" {
+		teamID = teamIDFrom(ctx)
+	}
+	origin := LinkOrigin{
+		TeamID:      teamID,
+		ChannelID:   channelID,
+		UserID:      userID,
+		Provider:    string(provider),
+		ServiceName: data.ServiceName,
+		LinkID:      paymentID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := s.linkOrigins.Save(paymentID, origin); err != nil {
+		log.Printf("Error saving link origin for %s: %v", paymentID, err)
+	}
+	if data.InternalReference != "" {
+		if err := s.linkOrigins.Save(data.InternalReference, origin); err != nil {
+			log.Printf("Error saving link origin for reference %s: %v", data.InternalReference, err)
+		}
+	}
+}
+
+// NotifyPaymentReceived posts a payment confirmation to the channel the link was created in.
+// keys are tried in order (link ID, reference, ...). Each link is only announced once, and
+// payments for links we don't know about are ignored.
+func (s *SlackService) NotifyPaymentReceived(ctx context.Context, keys []string, amount float64, currency string) error {
+	if s.linkOrigins == nil {
+		return nil
+	}
+
+	var origin LinkOrigin
+	found := false
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if origin, found = s.linkOrigins.Get(key); found {
+			break
+		}
+	}
+	if !found {
+		log.Printf("No link origin found for payment (keys %v), not notifying Slack", keys)
+		return nil
+	}
+	// The link ID entry is the canonical one that tracks whether we've already notified
+	if canonical, ok := s.linkOrigins.Get(origin.LinkID); ok {
+		origin = canonical
+	}
+	if origin.Notified {
+		log.Printf("Payment for link %s was already announced, skipping", origin.LinkID)
+		return nil
+	}
+
+	msg := fmt.Sprintf(":white_check_mark: <@%s> Payment received for *%s*: %s (link `%s`)",
+		origin.UserID, origin.ServiceName, utils.FormatAmount(amount, currency), origin.LinkID)
+	// Webhooks carry no Slack context, so post with the client of the workspace the link came from
+	client := s.ClientForTeam(ctx, origin.TeamID)
+	if _, _, err := client.PostMessageContext(ctx, origin.ChannelID, slack.MsgOptionText(msg, false)); err != nil {
+		return fmt.Errorf("failed to post payment confirmation to channel %s: %w", origin.ChannelID, err)
+	}
+
+	origin.Notified = true
+	if err := s.linkOrigins.Save(origin.LinkID, origin); err != nil {
+		log.Printf("Error marking link %s as notified: %v", origin.LinkID, err)
+	}
+	return nil
+}
+
+// advanceInvoiceCounter moves the channel counter up to a manually entered invoice number
+func (s *SlackService) advanceInvoiceCounter(ctx context.Context, teamID, channelID, invoiceNumber string) {
+	invoiceNumInt, ok := s.invoiceService.numberFormat.Sequence(invoiceNumber)
+	if !ok {
+		log.Printf("Manual invoice number %q doesn't match the invoice number format, leaving counter unchanged", invoiceNumber)
+		return
+	}
+
+	// Don't fail the request if the counter update fails, just log it
+	if err := s.invoiceService.AdvanceInvoiceNumber(ctx, teamID, channelID, invoiceNumInt); err != nil {
+		log.Printf("Error updating last invoice number: %v", err)
 	}
-	json.NewEncoder(w).Encode(response)
 }
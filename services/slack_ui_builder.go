@@ -2,9 +2,14 @@ package services
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"paymentbot/models"
+	"paymentbot/money"
+	"paymentbot/payment"
+	"paymentbot/utils"
 
 	"github.com/slack-go/slack"
 )
@@ -13,20 +18,61 @@ func newPlainTextBlock(text string) *slack.TextBlockObject {
 	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
 }
 
-func BuildPaymentModalView(provider models.PaymentProvider, privateMetadata string) slack.ModalViewRequest {
-	modalTitle := newPlainTextBlock(fmt.Sprintf("%s Payment", strings.Title(string(provider))))
+// PaymentModalDefaults holds configured defaults used to prefill the payment modal
+type PaymentModalDefaults struct {
+	EndDateCycles int64  // 0 = unlimited
+	Interval      string // preselected billing interval; "" = month
+	IntervalCount int64  // preselected billing frequency; 0 = every 1
+	AutomaticTax  bool   // tick "Calculate tax automatically" on Stripe links
+
+	// Prefilled from the message when the modal is opened from a message shortcut, or from
+	// the arguments of a link command
+	ServiceName string
+	Description string
+
+	// Prefilled from the arguments of a link command
+	Amount       string
+	Subscription bool
+}
+
+// newCurrencySelectBlock is the currency picker shared by the payment, donation and invoice modals
+func newCurrencySelectBlock() *slack.InputBlock {
+	currencyLabel := newPlainTextBlock("Currency")
+	currencyPlaceholder := newPlainTextBlock("Select currency")
+	var currencyOpts []*slack.OptionBlockObject
+	var defaultCurrencyOption *slack.OptionBlockObject
+	for _, code := range utils.CommonCurrencies {
+		option := slack.NewOptionBlockObject(code, newPlainTextBlock(code), nil)
+		if code == utils.DefaultCurrency {
+			defaultCurrencyOption = option
+		}
+		currencyOpts = append(currencyOpts, option)
+	}
+	currencyElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, currencyPlaceholder, "currency_select", currencyOpts...)
+	currencyElement.InitialOption = defaultCurrencyOption
+	currencyBlock := slack.NewInputBlock("currency_block", currencyLabel, nil, currencyElement)
+	currencyBlock.Optional = false
+	return currencyBlock
+}
+
+func BuildPaymentModalView(provider models.PaymentProvider, privateMetadata string, defaults PaymentModalDefaults) slack.ModalViewRequest {
+	modalTitle := newPlainTextBlock(fmt.Sprintf("%s Payment", providerDisplayName(provider)))
 	submitText := newPlainTextBlock("Create Link")
 	closeText := newPlainTextBlock("Cancel")
 
-	amountLabel := newPlainTextBlock("Amount (USD)")
+	amountLabel := newPlainTextBlock("Amount")
 	amountPlaceholder := newPlainTextBlock("e.g., 19.99")
 	amountElement := slack.NewPlainTextInputBlockElement(amountPlaceholder, "amount_input")
+	amountElement.InitialValue = defaults.Amount
 	amountBlock := slack.NewInputBlock("amount_block", amountLabel, nil, amountElement)
 	amountBlock.Optional = false
 
+	currencyBlock := newCurrencySelectBlock()
+
 	serviceLabel := newPlainTextBlock("Service/Product Name")
 	servicePlaceholder := newPlainTextBlock("e.g., Web Hosting")
 	serviceElement := slack.NewPlainTextInputBlockElement(servicePlaceholder, "service_input")
+	serviceElement.InitialValue = defaults.ServiceName
 	serviceBlock := slack.NewInputBlock("service_block", serviceLabel, nil, serviceElement)
 	serviceBlock.Optional = false
 
@@ -34,51 +80,174 @@ func BuildPaymentModalView(provider models.PaymentProvider, privateMetadata stri
 	referencePlaceholder := newPlainTextBlock("Enter your description here")
 	referenceHint := newPlainTextBlock("Appears at checkout.")
 	referenceElement := slack.NewPlainTextInputBlockElement(referencePlaceholder, "reference_input")
+	referenceElement.InitialValue = defaults.Description
 	referenceBlock := slack.NewInputBlock("reference_block", referenceLabel, referenceHint, referenceElement)
 	referenceBlock.Optional = true
 
-	allBlocks := []slack.Block{amountBlock, serviceBlock, referenceBlock}
+	expiresLabel := newPlainTextBlock("Expires In")
+	expiresPlaceholder := newPlainTextBlock("e.g., 48h or 7d")
+	expiresHint := newPlainTextBlock("Optional. Hours or days until the link stops accepting payments. Leave empty for no expiry.")
+	expiresElement := slack.NewPlainTextInputBlockElement(expiresPlaceholder, "expires_input")
+	expiresBlock := slack.NewInputBlock("expires_block", expiresLabel, expiresHint, expiresElement)
+	expiresBlock.Optional = true
+
+	redirectLabel := newPlainTextBlock("Redirect URL")
+	redirectPlaceholder := newPlainTextBlock("https://example.com/thank-you")
+	redirectHint := newPlainTextBlock("Optional. Customers are sent to this https page after paying.")
+	redirectElement := slack.NewPlainTextInputBlockElement(redirectPlaceholder, "redirect_url_input")
+	redirectBlock := slack.NewInputBlock("redirect_url_block", redirectLabel, redirectHint, redirectElement)
+	redirectBlock.Optional = true
+
+	allBlocks := []slack.Block{amountBlock, currencyBlock, serviceBlock, referenceBlock, expiresBlock, redirectBlock}
 
 	if provider == models.ProviderStripe {
+		skuLabel := newPlainTextBlock("SKU / Product Code")
+		skuPlaceholder := newPlainTextBlock("e.g., HOSTING-PRO")
+		skuHint := newPlainTextBlock("Optional. Links with the same SKU reuse the same Stripe product.")
+		skuElement := slack.NewPlainTextInputBlockElement(skuPlaceholder, "sku_input")
+		skuBlock := slack.NewInputBlock("sku_block", skuLabel, skuHint, skuElement)
+		skuBlock.Optional = true
+
+		itemsLabel := newPlainTextBlock("Additional Line Items")
+		itemsPlaceholder := newPlainTextBlock("Setup Fee | 50.00 | 1 | SETUP-FEE")
+		itemsHint := newPlainTextBlock(fmt.Sprintf("Optional. One item per line: Description | Price | Quantity | SKU (quantity and SKU optional). Sold together with the item above, up to %d items in total.", utils.StripeMaxLineItems))
+		itemsElement := slack.NewPlainTextInputBlockElement(itemsPlaceholder, "additional_items_input")
+		itemsElement.Multiline = true
+		itemsBlock := slack.NewInputBlock("additional_items_block", itemsLabel, itemsHint, itemsElement)
+		itemsBlock.Optional = true
+
+		customerEmailLabel := newPlainTextBlock("Customer Email")
+		customerEmailPlaceholder := newPlainTextBlock("e.g., billing@client.com")
+		customerEmailHint := newPlainTextBlock("Optional. Prefilled at checkout and saved on the link for reconciliation.")
+		customerEmailElement := slack.NewPlainTextInputBlockElement(customerEmailPlaceholder, "customer_email_input")
+		customerEmailBlock := slack.NewInputBlock("customer_email_block", customerEmailLabel, customerEmailHint, customerEmailElement)
+		customerEmailBlock.Optional = true
+
+		allBlocks = append(allBlocks, skuBlock, itemsBlock, customerEmailBlock)
+
 		subscriptionLabel := newPlainTextBlock("Subscription Options")
 		subOptionText := newPlainTextBlock("This is a recurring subscription")
 		subOption := slack.NewOptionBlockObject("is_subscription", subOptionText, nil)
 		subscriptionElement := slack.NewCheckboxGroupsBlockElement("subscription_checkbox", subOption)
+		if defaults.Subscription {
+			subscriptionElement.InitialOptions = []*slack.OptionBlockObject{subOption}
+		}
 		subscriptionBlock := slack.NewInputBlock("subscription_block", subscriptionLabel, nil, subscriptionElement)
 		subscriptionBlock.Optional = true
 
+		cadenceLabel := newPlainTextBlock("Billing Cadence")
+		cadencePlaceholder := newPlainTextBlock("Select a cadence")
+		cadenceHint := newPlainTextBlock("Pick a preset, or choose Custom to use the interval and frequency below.")
+		customCadenceOption := slack.NewOptionBlockObject(utils.CadenceCustom, newPlainTextBlock("Custom (use interval & frequency below)"), nil)
+		cadenceOpts := []*slack.OptionBlockObject{customCadenceOption}
+		for _, preset := range utils.CadencePresets {
+			cadenceOpts = append(cadenceOpts, slack.NewOptionBlockObject(preset.Value, newPlainTextBlock(preset.Label), nil))
+		}
+		cadenceElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, cadencePlaceholder, "cadence_select", cadenceOpts...)
+		cadenceElement.InitialOption = customCadenceOption
+		cadenceBlock := slack.NewInputBlock("cadence_block", cadenceLabel, cadenceHint, cadenceElement)
+		cadenceBlock.Optional = true
+
 		intervalLabel := newPlainTextBlock("Billing Interval")
 		intervalPlaceholder := newPlainTextBlock("Select billing period")
 		monthOption := slack.NewOptionBlockObject("month", newPlainTextBlock("Monthly"), nil)
+		dayOption := slack.NewOptionBlockObject("day", newPlainTextBlock("Daily"), nil)
 		weekOption := slack.NewOptionBlockObject("week", newPlainTextBlock("Weekly"), nil)
 		yearOption := slack.NewOptionBlockObject("year", newPlainTextBlock("Yearly"), nil)
-		intervalElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, intervalPlaceholder, "interval_select", monthOption, weekOption, yearOption)
+		intervalOpts := []*slack.OptionBlockObject{dayOption, weekOption, monthOption, yearOption}
+		intervalElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, intervalPlaceholder, "interval_select", intervalOpts...)
 		intervalElement.InitialOption = monthOption
+		for _, option := range intervalOpts {
+			if option.Value == defaults.Interval {
+				intervalElement.InitialOption = option
+			}
+		}
 		intervalBlock := slack.NewInputBlock("interval_block", intervalLabel, nil, intervalElement)
 		intervalBlock.Optional = true
 
 		countLabel := newPlainTextBlock("Billing Frequency")
 		countPlaceholder := newPlainTextBlock("Every X periods")
-		countOpts := []*slack.OptionBlockObject{
-			slack.NewOptionBlockObject("1", newPlainTextBlock("Every 1"), nil),
-			slack.NewOptionBlockObject("2", newPlainTextBlock("Every 2"), nil),
-			slack.NewOptionBlockObject("3", newPlainTextBlock("Every 3"), nil),
-			slack.NewOptionBlockObject("6", newPlainTextBlock("Every 6"), nil),
-			slack.NewOptionBlockObject("12", newPlainTextBlock("Every 12"), nil),
+		// A configured default that isn't one of the usual frequencies gets its own option
+		defaultCount := defaults.IntervalCount
+		if defaultCount < 1 {
+			defaultCount = 1
+		}
+		counts := []int64{1, 2, 3, 6, 12}
+		if !slices.Contains(counts, defaultCount) {
+			counts = append(counts, defaultCount)
+			slices.Sort(counts)
+		}
+		var countOpts []*slack.OptionBlockObject
+		var initialCount *slack.OptionBlockObject
+		for _, count := range counts {
+			option := slack.NewOptionBlockObject(fmt.Sprintf("%d", count), newPlainTextBlock(fmt.Sprintf("Every %d", count)), nil)
+			countOpts = append(countOpts, option)
+			if count == defaultCount {
+				initialCount = option
+			}
 		}
 		countElement := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, countPlaceholder, "interval_count_select", countOpts...)
-		countElement.InitialOption = countOpts[0]
+		countElement.InitialOption = initialCount
 		countBlock := slack.NewInputBlock("interval_count_block", countLabel, nil, countElement)
 		countBlock.Optional = true
 
 		endDateLabel := newPlainTextBlock("End Date (optional)")
 		endDatePlaceholder := newPlainTextBlock("Enter number of cycles (e.g., 6)")
 		endDateHint := newPlainTextBlock("Leave empty for no end date. Enter a number to limit subscription to that many billing cycles.")
+		if defaults.EndDateCycles > 0 {
+			endDateHint = newPlainTextBlock(fmt.Sprintf("Defaults to %d cycles. Enter 0 for no end date, or another number to limit the subscription to that many billing cycles.", defaults.EndDateCycles))
+		}
 		endDateElement := slack.NewPlainTextInputBlockElement(endDatePlaceholder, "end_date_input")
+		if defaults.EndDateCycles > 0 {
+			endDateElement.InitialValue = fmt.Sprintf("%d", defaults.EndDateCycles)
+		}
 		endDateBlock := slack.NewInputBlock("end_date_block", endDateLabel, endDateHint, endDateElement)
 		endDateBlock.Optional = true
 
-		allBlocks = append(allBlocks, subscriptionBlock, intervalBlock, countBlock, endDateBlock)
+		trialLabel := newPlainTextBlock("Free Trial (days)")
+		trialPlaceholder := newPlainTextBlock("e.g., 14")
+		trialHint := newPlainTextBlock(fmt.Sprintf("Optional, subscriptions only. The first charge is taken when the trial ends, up to %d days. The end date counts cycles from then.", utils.StripeMaxTrialDays))
+		trialElement := slack.NewPlainTextInputBlockElement(trialPlaceholder, "trial_days_input")
+		trialBlock := slack.NewInputBlock("trial_days_block", trialLabel, trialHint, trialElement)
+		trialBlock.Optional = true
+
+		promoLabel := newPlainTextBlock("Checkout Options")
+		promoOptionText := newPlainTextBlock("Allow promotion codes at checkout")
+		promoOption := slack.NewOptionBlockObject("allow_promotion_codes", promoOptionText, nil)
+		saveCardOptionText := newPlainTextBlock("Save card for future payments")
+		saveCardDescription := newPlainTextBlock("One-time payments only. Untick for a simple one-off link without extra card authentication.")
+		saveCardOption := slack.NewOptionBlockObject(saveCardOptionValue, saveCardOptionText, saveCardDescription)
+		taxOptionText := newPlainTextBlock("Calculate tax automatically")
+		taxDescription := newPlainTextBlock("Stripe Tax adds tax at checkout based on the customer's address.")
+		taxOption := slack.NewOptionBlockObject(automaticTaxOptionValue, taxOptionText, taxDescription)
+		quantityOptionText := newPlainTextBlock("Let the customer choose the quantity")
+		quantityDescription := newPlainTextBlock("One-time, single-item links only. The amount is then the price of each unit.")
+		quantityOption := slack.NewOptionBlockObject(adjustableQuantityOptionValue, quantityOptionText, quantityDescription)
+		promoElement := slack.NewCheckboxGroupsBlockElement("promo_codes_checkbox", promoOption, saveCardOption, taxOption, quantityOption)
+		promoElement.InitialOptions = []*slack.OptionBlockObject{saveCardOption}
+		if defaults.AutomaticTax {
+			promoElement.InitialOptions = append(promoElement.InitialOptions, taxOption)
+		}
+		promoBlock := slack.NewInputBlock("promo_codes_block", promoLabel, nil, promoElement)
+		promoBlock.Optional = true
+
+		quantityMinElement := slack.NewPlainTextInputBlockElement(newPlainTextBlock(fmt.Sprintf("%d", utils.DefaultMinAdjustableQuantity)), "quantity_min_input")
+		quantityMinHint := newPlainTextBlock(fmt.Sprintf("Only used when the customer chooses the quantity. Defaults to %d.", utils.DefaultMinAdjustableQuantity))
+		quantityMinBlock := slack.NewInputBlock("quantity_min_block", newPlainTextBlock("Minimum Quantity"), quantityMinHint, quantityMinElement)
+		quantityMinBlock.Optional = true
+		quantityMaxElement := slack.NewPlainTextInputBlockElement(newPlainTextBlock(fmt.Sprintf("%d", utils.DefaultMaxAdjustableQuantity)), "quantity_max_input")
+		quantityMaxHint := newPlainTextBlock(fmt.Sprintf("Only used when the customer chooses the quantity. Defaults to %d.", utils.DefaultMaxAdjustableQuantity))
+		quantityMaxBlock := slack.NewInputBlock("quantity_max_block", newPlainTextBlock("Maximum Quantity"), quantityMaxHint, quantityMaxElement)
+		quantityMaxBlock.Optional = true
+
+		promotionCodeLabel := newPlainTextBlock("Promotion Code")
+		promotionCodePlaceholder := newPlainTextBlock("e.g., SUMMER20 or promo_...")
+		promotionCodeHint := newPlainTextBlock("Optional. An existing Stripe promotion code, by code or ID, applied at checkout. The customer can remove it.")
+		promotionCodeElement := slack.NewPlainTextInputBlockElement(promotionCodePlaceholder, "promotion_code_input")
+		promotionCodeBlock := slack.NewInputBlock("promotion_code_block", promotionCodeLabel, promotionCodeHint, promotionCodeElement)
+		promotionCodeBlock.Optional = true
+
+		allBlocks = append(allBlocks, subscriptionBlock, cadenceBlock, intervalBlock, countBlock, endDateBlock, trialBlock, promoBlock, quantityMinBlock, quantityMaxBlock, promotionCodeBlock)
 	}
 
 	if provider == models.ProviderAirwallex {
@@ -104,14 +273,14 @@ func BuildPaymentModalView(provider models.PaymentProvider, privateMetadata stri
 	}
 }
 
-func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber int) slack.ModalViewRequest {
+func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber string) slack.ModalViewRequest {
 	modalTitle := newPlainTextBlock("Create Invoice")
 	submitText := newPlainTextBlock("Generate Invoice")
 	closeText := newPlainTextBlock("Cancel")
 
 	// Basic invoice fields - show invoice number as display-only with override option
 	invoiceNumberDisplay := slack.NewSectionBlock(
-		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Invoice Number:* `%d`", nextInvoiceNumber), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Invoice Number:* `%s`", nextInvoiceNumber), false, false),
 		[]*slack.TextBlockObject{
 			slack.NewTextBlockObject(slack.MarkdownType, "_Auto-assigned invoice number. To override, use the field below._", false, false),
 		},
@@ -149,11 +318,7 @@ func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber int) slack.
 	dateDueBlock := slack.NewInputBlock("date_due_block", dateDueLabel, nil, dateDueElement)
 	dateDueBlock.Optional = false
 
-	currencyLabel := newPlainTextBlock("Currency")
-	currencyPlaceholder := newPlainTextBlock("e.g., USD, EUR, HKD")
-	currencyElement := slack.NewPlainTextInputBlockElement(currencyPlaceholder, "currency_input")
-	currencyBlock := slack.NewInputBlock("currency_block", currencyLabel, nil, currencyElement)
-	currencyBlock.Optional = false
+	currencyBlock := newCurrencySelectBlock()
 
 	// Line items section with better format
 	lineItemsHeader := slack.NewSectionBlock(
@@ -166,18 +331,38 @@ func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber int) slack.
 	lineItemsInstructions := slack.NewSectionBlock(
 		nil,
 		[]*slack.TextBlockObject{
-			slack.NewTextBlockObject(slack.MarkdownType, "*Enter each line item on a new line in this format:*\n`Service Description | Price | Quantity`\n\n*Examples:*\n• `Web Development Services | 150.00 | 10`\n• `Design Services | 75.50 | 5`\n• `Consulting | 200.00 | 2`", false, false),
+			slack.NewTextBlockObject(slack.MarkdownType, "*Enter each line item in this format:*\n`Service Description | Price | Quantity`\nQuantity is optional and defaults to 1. Use *Add line item* for more rows.", false, false),
 		},
 		nil,
 	)
 
-	// Multi-line text input for line items
-	lineItemsLabel := newPlainTextBlock("Line Items")
-	lineItemsPlaceholder := newPlainTextBlock("Web Development Services | 150.00 | 10\nDesign Services | 75.50 | 5")
-	lineItemsElement := slack.NewPlainTextInputBlockElement(lineItemsPlaceholder, "line_items_input")
-	lineItemsElement.Multiline = true
-	lineItemsBlock := slack.NewInputBlock("line_items_block", lineItemsLabel, nil, lineItemsElement)
-	lineItemsBlock.Optional = false
+	// Optional discount and tax (discount is applied first)
+	discountLabel := newPlainTextBlock("Discount (Optional)")
+	discountPlaceholder := newPlainTextBlock("e.g., 10% or 25.00")
+	discountHint := newPlainTextBlock("A percentage or fixed amount off the subtotal, applied before tax.")
+	discountElement := slack.NewPlainTextInputBlockElement(discountPlaceholder, "discount_input")
+	discountBlock := slack.NewInputBlock("discount_block", discountLabel, discountHint, discountElement)
+	discountBlock.Optional = true
+
+	taxRateLabel := newPlainTextBlock("Tax Rate % (Optional)")
+	taxRatePlaceholder := newPlainTextBlock("e.g., 20")
+	taxRateElement := slack.NewPlainTextInputBlockElement(taxRatePlaceholder, "tax_rate_input")
+	taxRateBlock := slack.NewInputBlock("tax_block", taxRateLabel, nil, taxRateElement)
+	taxRateBlock.Optional = true
+
+	taxLabelLabel := newPlainTextBlock("Tax Label (Optional)")
+	taxLabelPlaceholder := newPlainTextBlock("e.g., VAT or GST (defaults to Tax)")
+	taxLabelElement := slack.NewPlainTextInputBlockElement(taxLabelPlaceholder, "tax_label_input")
+	taxLabelBlock := slack.NewInputBlock("tax_label_block", taxLabelLabel, nil, taxLabelElement)
+	taxLabelBlock.Optional = true
+
+	// Optional payment link, printed as a QR code on the invoice
+	payLinkLabel := newPlainTextBlock("Payment Link (Optional)")
+	payLinkPlaceholder := newPlainTextBlock("https://buy.stripe.com/...")
+	payLinkHint := newPlainTextBlock("Printed with a QR code on the invoice so clients can pay from their phone.")
+	payLinkElement := slack.NewPlainTextInputBlockElement(payLinkPlaceholder, "pay_link_input")
+	payLinkBlock := slack.NewInputBlock("pay_link_block", payLinkLabel, payLinkHint, payLinkElement)
+	payLinkBlock.Optional = true
 
 	// Notes section
 	notesLabel := newPlainTextBlock("Notes (Optional)")
@@ -199,8 +384,13 @@ func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber int) slack.
 		slack.NewDividerBlock(),
 		lineItemsHeader,
 		lineItemsInstructions,
-		lineItemsBlock,
+		newInvoiceLineItemBlock(1),
+		newAddLineItemActionsBlock(),
+		discountBlock,
+		taxRateBlock,
+		taxLabelBlock,
 		slack.NewDividerBlock(),
+		payLinkBlock,
 		notesBlock,
 	}
 
@@ -216,3 +406,475 @@ func BuildInvoiceModalView(privateMetadata string, nextInvoiceNumber int) slack.
 		PrivateMetadata: privateMetadata,
 	}
 }
+
+// InvoicePreviewCallbackID identifies the /invoice-preview modal, whose PDF only goes to the user
+const InvoicePreviewCallbackID = "invoice_preview_modal"
+
+// BuildInvoicePreviewModalView is the invoice modal for /invoice-preview. Previews don't use up
+// the invoice number shown.
+func BuildInvoicePreviewModalView(privateMetadata string, nextInvoiceNumber string) slack.ModalViewRequest {
+	view := BuildInvoiceModalView(privateMetadata, nextInvoiceNumber)
+	view.Title = newPlainTextBlock("Preview Invoice")
+	view.Submit = newPlainTextBlock("Preview")
+	view.CallbackID = InvoicePreviewCallbackID
+	return view
+}
+
+// Invoice line items are one "Description | Price | Quantity" input per row. The button under
+// the rows appends another one with views.update.
+const (
+	invoiceLineItemBlockPrefix  = "line_item_block"
+	invoiceLineItemActionID     = "line_item_input"
+	invoiceLineItemActionsBlock = "line_item_actions"
+	// InvoiceAddLineItemActionID is the block action of the "Add line item" button
+	InvoiceAddLineItemActionID = "add_invoice_line_item"
+)
+
+func newInvoiceLineItemBlock(row int) *slack.InputBlock {
+	label := newPlainTextBlock(fmt.Sprintf("Line Item %d", row))
+	placeholder := newPlainTextBlock("Web Development Services | 150.00 | 10")
+	element := slack.NewPlainTextInputBlockElement(placeholder, invoiceLineItemActionID)
+	block := slack.NewInputBlock(blockID(invoiceLineItemBlockPrefix, row), label, nil, element)
+	block.Optional = row > 1
+	return block
+}
+
+func newAddLineItemActionsBlock() *slack.ActionBlock {
+	button := slack.NewButtonBlockElement(InvoiceAddLineItemActionID, "add", newPlainTextBlock("➕ Add line item"))
+	return slack.NewActionBlock(invoiceLineItemActionsBlock, button)
+}
+
+// BuildInvoiceModalWithAnotherLineItem copies an open invoice modal with one more line item
+// row. Block and action IDs are unchanged, so Slack keeps what the user has typed. The button
+// is dropped once maxRows rows are shown.
+func BuildInvoiceModalWithAnotherLineItem(view slack.View, maxRows int) slack.ModalViewRequest {
+	rows := 0
+	for _, block := range view.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && strings.HasPrefix(input.BlockID, invoiceLineItemBlockPrefix+"_") {
+			rows++
+		}
+	}
+
+	blocks := make([]slack.Block, 0, len(view.Blocks.BlockSet)+1)
+	for _, block := range view.Blocks.BlockSet {
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.BlockID == invoiceLineItemActionsBlock {
+			if rows < maxRows {
+				rows++
+				blocks = append(blocks, newInvoiceLineItemBlock(rows))
+			}
+			if rows < maxRows {
+				blocks = append(blocks, actions)
+			}
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           view.Title,
+		Submit:          view.Submit,
+		Close:           view.Close,
+		CallbackID:      view.CallbackID,
+		ClearOnClose:    view.ClearOnClose,
+		NotifyOnClose:   view.NotifyOnClose,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: view.PrivateMetadata,
+	}
+}
+
+// invoiceErrorBlock is the section shown at the top of the invoice modal for errors that don't
+// belong to a single field
+const invoiceErrorBlock = "invoice_error_block"
+
+// BuildInvoiceModalWithError copies an open invoice modal with message in a warning section at
+// the top, replacing any earlier one. Input block and action IDs are unchanged, so Slack keeps
+// what the user has typed.
+func BuildInvoiceModalWithError(view slack.View, message string) slack.ModalViewRequest {
+	text := slack.NewTextBlockObject(slack.MarkdownType, ":warning: "+message, false, false)
+	blocks := []slack.Block{slack.NewSectionBlock(text, nil, nil, slack.SectionBlockOptionBlockID(invoiceErrorBlock))}
+	for _, block := range view.Blocks.BlockSet {
+		if section, ok := block.(*slack.SectionBlock); ok && section.BlockID == invoiceErrorBlock {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           view.Title,
+		Submit:          view.Submit,
+		Close:           view.Close,
+		CallbackID:      view.CallbackID,
+		ClearOnClose:    view.ClearOnClose,
+		NotifyOnClose:   view.NotifyOnClose,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: view.PrivateMetadata,
+	}
+}
+
+// DonationModalCallbackID identifies the /create-donation-link modal
+const DonationModalCallbackID = "donation_link_modal"
+
+// BuildDonationModalView builds the modal for a reusable Stripe donation link where donors
+// choose their own amount
+func BuildDonationModalView(privateMetadata string) slack.ModalViewRequest {
+	causeLabel := newPlainTextBlock("Cause / Campaign")
+	causePlaceholder := newPlainTextBlock("e.g., Winter Appeal 2025")
+	causeElement := slack.NewPlainTextInputBlockElement(causePlaceholder, "service_input")
+	causeBlock := slack.NewInputBlock("service_block", causeLabel, nil, causeElement)
+
+	suggestedLabel := newPlainTextBlock("Suggested Amount")
+	suggestedPlaceholder := newPlainTextBlock("e.g., 25.00")
+	suggestedHint := newPlainTextBlock("Optional. Prefilled at checkout; donors can change it.")
+	suggestedElement := slack.NewPlainTextInputBlockElement(suggestedPlaceholder, "amount_input")
+	suggestedBlock := slack.NewInputBlock("amount_block", suggestedLabel, suggestedHint, suggestedElement)
+	suggestedBlock.Optional = true
+
+	minimumLabel := newPlainTextBlock("Minimum Amount")
+	minimumPlaceholder := newPlainTextBlock("e.g., 5.00")
+	minimumHint := newPlainTextBlock("Optional. Leave blank to accept any amount Stripe allows.")
+	minimumElement := slack.NewPlainTextInputBlockElement(minimumPlaceholder, "donation_minimum_input")
+	minimumBlock := slack.NewInputBlock("donation_minimum_block", minimumLabel, minimumHint, minimumElement)
+	minimumBlock.Optional = true
+
+	referenceLabel := newPlainTextBlock("Description")
+	referencePlaceholder := newPlainTextBlock("Enter your description here")
+	referenceHint := newPlainTextBlock("Appears at checkout.")
+	referenceElement := slack.NewPlainTextInputBlockElement(referencePlaceholder, "reference_input")
+	referenceBlock := slack.NewInputBlock("reference_block", referenceLabel, referenceHint, referenceElement)
+	referenceBlock.Optional = true
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           newPlainTextBlock("Donation Link"),
+		Submit:          newPlainTextBlock("Create Link"),
+		Close:           newPlainTextBlock("Cancel"),
+		CallbackID:      DonationModalCallbackID,
+		ClearOnClose:    true,
+		Blocks:          slack.Blocks{BlockSet: []slack.Block{causeBlock, newCurrencySelectBlock(), suggestedBlock, minimumBlock, referenceBlock}},
+		PrivateMetadata: privateMetadata,
+	}
+}
+
+// saveCardOptionValue is the checkout option that keeps one-time Stripe links saving the card
+const saveCardOptionValue = "save_card"
+
+// automaticTaxOptionValue is the checkout option that turns on Stripe Tax for the link
+const automaticTaxOptionValue = "automatic_tax"
+
+// adjustableQuantityOptionValue is the checkout option that lets the customer choose the quantity
+const adjustableQuantityOptionValue = "adjustable_quantity"
+
+// InvoiceDuplicateConfirmCallbackID identifies the view pushed when an invoice looks like a recent duplicate
+const InvoiceDuplicateConfirmCallbackID = "invoice_duplicate_confirm"
+
+// BuildDuplicateInvoiceConfirmView asks the user to confirm creating an invoice that closely
+// matches one they just created. The pending submission is referenced by token.
+func BuildDuplicateInvoiceConfirmView(token string, previous *models.InvoiceData) slack.ModalViewRequest {
+	text := fmt.Sprintf("You just created a similar invoice (*#%s* for *%s*) — create another?",
+		previous.InvoiceNumber, previous.ClientName)
+
+	return slack.ModalViewRequest{
+		Type:          slack.VTModal,
+		Title:         newPlainTextBlock("Similar Invoice"),
+		Submit:        newPlainTextBlock("Create Another"),
+		Close:         newPlainTextBlock("Go Back"),
+		CallbackID:    InvoiceDuplicateConfirmCallbackID,
+		NotifyOnClose: false,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		}},
+		PrivateMetadata: token,
+	}
+}
+
+// BuildInvoiceErrorView replaces a view that has no input blocks to attach an error to
+func BuildInvoiceErrorView(message string) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:  slack.VTModal,
+		Title: newPlainTextBlock("Invoice Not Created"),
+		Close: newPlainTextBlock("Close"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, message, false, false), nil, nil),
+		}},
+	}
+}
+
+// PaymentAmountText describes what the customer pays, e.g. "$19.99", or for donations
+// "Donor chooses (suggested $25.00, minimum $5.00)"
+func PaymentAmountText(data *models.PaymentLinkData) string {
+	if data.AdjustableQuantity {
+		return fmt.Sprintf("%s each, customer chooses %d-%d", utils.FormatAmount(data.Amount, data.Currency), data.QuantityMin, data.QuantityMax)
+	}
+	if !data.Donation {
+		return utils.FormatAmount(data.Amount, data.Currency)
+	}
+
+	var limits []string
+	if data.Amount > 0 {
+		limits = append(limits, "suggested "+utils.FormatAmount(data.Amount, data.Currency))
+	}
+	if data.DonationMinimum > 0 {
+		limits = append(limits, "minimum "+utils.FormatAmount(data.DonationMinimum, data.Currency))
+	}
+	if len(limits) == 0 {
+		return fmt.Sprintf("Donor chooses (%s)", data.Currency)
+	}
+	return fmt.Sprintf("Donor chooses (%s)", strings.Join(limits, ", "))
+}
+
+// BuildPaymentLinkMessageBlocks renders the message posted after a payment link is created:
+// a header, a "Pay now" button, detail fields and, for subscriptions, a billing context line.
+func BuildPaymentLinkMessageBlocks(userID, providerName string, data *models.PaymentLinkData, link, paymentID string) []slack.Block {
+	linkKind, buttonText := "payment", "Pay now"
+	if data.Donation {
+		linkKind, buttonText = "donation", "Donate"
+	}
+	header := slack.NewHeaderBlock(newPlainTextBlock(fmt.Sprintf("%s %s link", providerName, linkKind)))
+
+	payButton := slack.NewButtonBlockElement("pay_now", "pay_now", newPlainTextBlock(buttonText))
+	payButton.URL = link
+	payButton.Style = slack.StylePrimary
+	intro := slack.NewSectionBlock(
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("<@%s> Here is your %s link for *%s*:\n<%s>", userID, linkKind, data.ServiceName, link), false, false),
+		nil,
+		slack.NewAccessory(payButton),
+	)
+
+	fields := []*slack.TextBlockObject{
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Amount*\n%s", PaymentAmountText(data)), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Provider*\n%s", providerName), false, false),
+	}
+	if data.ReferenceNumber != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Reference*\n%s", data.ReferenceNumber), false, false))
+	}
+	if data.CustomerEmail != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Customer*\n%s", data.CustomerEmail), false, false))
+	}
+	if !data.ExpiresAt.IsZero() {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Expires*\n%s", formatExpiry(data.ExpiresAt)), false, false))
+	}
+	if paymentID != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Payment ID*\n`%s`", paymentID), false, false))
+	}
+	details := slack.NewSectionBlock(nil, fields, nil)
+
+	blocks := []slack.Block{header, intro, details}
+
+	if len(data.LineItems) > 0 {
+		var sb strings.Builder
+		sb.WriteString("*Items*")
+		for _, item := range data.LineItems {
+			sb.WriteString(fmt.Sprintf("\n• %s × %d: %s", item.Description, item.Quantity, utils.FormatMoney(money.FromMajor(item.UnitAmount, data.Currency).Times(item.Quantity))))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, sb.String(), false, false), nil, nil))
+	}
+
+	if data.IsSubscription {
+		billing := ":repeat: " + subscriptionTermsText(data)
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, billing, false, false)))
+	}
+
+	return blocks
+}
+
+// formatExpiry shows a link expiry in the reader's own timezone via Slack date formatting
+func formatExpiry(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", t.Unix(), t.UTC().Format("Jan 2, 2006 15:04 UTC"))
+}
+
+// subscriptionTermsText describes how often a subscription bills and when it ends
+func subscriptionTermsText(data *models.PaymentLinkData) string {
+	terms := fmt.Sprintf("Billed every %d %s(s)", data.IntervalCount, data.Interval)
+	if data.TrialDays > 0 {
+		terms += fmt.Sprintf(" after a %d-day free trial", data.TrialDays)
+	}
+	if data.EndDateCycles > 0 {
+		return terms + fmt.Sprintf(" · ends after %d cycles (%d %s payments)", data.EndDateCycles, data.EndDateCycles, data.Interval)
+	}
+	return terms + " · no end date"
+}
+
+// PaymentPreviewCallbackID identifies the read-only summary pushed before a payment link is created
+const PaymentPreviewCallbackID = "payment_link_preview"
+
+// BuildPaymentPreviewView summarizes a payment link request for the user to confirm. "Back"
+// pops it, returning to the form with everything they entered. The pending request is
+// referenced by token.
+func BuildPaymentPreviewView(token, providerName string, data *models.PaymentLinkData) slack.ModalViewRequest {
+	fields := []*slack.TextBlockObject{
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Amount*\n%s", PaymentAmountText(data)), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Currency*\n%s", data.Currency), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Service*\n%s", data.ServiceName), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Provider*\n%s", providerName), false, false),
+	}
+	if data.ReferenceNumber != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Reference*\n%s", data.ReferenceNumber), false, false))
+	}
+	if data.SKU != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*SKU*\n`%s`", data.SKU), false, false))
+	}
+	if data.CustomerEmail != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Customer*\n%s", data.CustomerEmail), false, false))
+	}
+	if !data.ExpiresAt.IsZero() {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Expires*\n%s", formatExpiry(data.ExpiresAt)), false, false))
+	}
+	if data.RedirectURL != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*After payment*\n%s", data.RedirectURL), false, false))
+	}
+
+	intro := slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "Check the details below. The link is only created when you confirm.", false, false), nil, nil)
+	blocks := []slack.Block{intro, slack.NewSectionBlock(nil, fields, nil)}
+
+	if len(data.LineItems) > 0 {
+		var sb strings.Builder
+		sb.WriteString("*Items*")
+		for _, item := range data.LineItems {
+			sb.WriteString(fmt.Sprintf("\n• %s × %d: %s", item.Description, item.Quantity, utils.FormatMoney(money.FromMajor(item.UnitAmount, data.Currency).Times(item.Quantity))))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, sb.String(), false, false), nil, nil))
+	}
+
+	var terms []string
+	if data.IsSubscription {
+		terms = append(terms, ":repeat: "+subscriptionTermsText(data))
+	} else {
+		terms = append(terms, "One-time payment")
+	}
+	switch {
+	case data.PromotionCode != "":
+		terms = append(terms, fmt.Sprintf("promotion code `%s` applied at checkout", data.PromotionCode))
+	case data.AllowPromotionCodes:
+		terms = append(terms, "promotion codes allowed")
+	}
+	if data.AutomaticTax {
+		terms = append(terms, "tax calculated at checkout")
+	}
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(terms, " · "), false, false)))
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		Title:           newPlainTextBlock("Review Payment Link"),
+		Submit:          newPlainTextBlock("Confirm & Create"),
+		Close:           newPlainTextBlock("Back"),
+		CallbackID:      PaymentPreviewCallbackID,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		PrivateMetadata: token,
+	}
+}
+
+// BuildPaymentErrorView replaces the preview when the link can't be created; closing it
+// returns to the form
+func BuildPaymentErrorView(message string) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:  slack.VTModal,
+		Title: newPlainTextBlock("Link Not Created"),
+		Close: newPlainTextBlock("Back"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, message, false, false), nil, nil),
+		}},
+	}
+}
+
+// BuildPaymentListBlocks renders /list-payments results, one section per link
+func BuildPaymentListBlocks(result *payment.ListLinksResult) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(newPlainTextBlock("Your recent payment links")),
+	}
+	for _, link := range result.Links {
+		blocks = append(blocks, newPaymentLinkSummaryBlock(link))
+	}
+	if result.Truncated {
+		note := fmt.Sprintf("Only the %d most recent links in the Stripe account were checked.", payment.MaxListedLinkScan)
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+	}
+	return blocks
+}
+
+func newPaymentLinkSummaryBlock(link payment.LinkSummary) *slack.SectionBlock {
+	amount := "Customer chooses"
+	if link.Amount > 0 {
+		amount = utils.FormatAmount(link.Amount, link.Currency)
+	}
+	status := ":large_green_circle: Active"
+	if !link.Active {
+		status = ":white_circle: Inactive"
+	}
+	serviceName := link.ServiceName
+	if serviceName == "" {
+		serviceName = link.ID
+	}
+	text := fmt.Sprintf("*<%s|%s>*\n%s · %s · `%s`", link.URL, serviceName, amount, status, link.ID)
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// Action IDs of the App Home quick action buttons
+const (
+	HomeCreateStripeLinkActionID    = "home_create_stripe_link"
+	HomeCreateAirwallexLinkActionID = "home_create_airwallex_link"
+	HomeCreateInvoiceActionID       = "home_create_invoice"
+)
+
+// BuildAppHomeView renders the Home tab: a button per enabled provider plus one for invoices,
+// then the user's recent Stripe links. recentNote replaces the list when it couldn't be loaded.
+func BuildAppHomeView(providers []models.PaymentProvider, recent *payment.ListLinksResult, recentNote string) slack.HomeTabViewRequest {
+	var buttons []slack.BlockElement
+	for _, provider := range providers {
+		actionID := HomeCreateStripeLinkActionID
+		if provider == models.ProviderAirwallex {
+			actionID = HomeCreateAirwallexLinkActionID
+		}
+		label := newPlainTextBlock(fmt.Sprintf("New %s link", providerDisplayName(provider)))
+		buttons = append(buttons, slack.NewButtonBlockElement(actionID, string(provider), label))
+	}
+	buttons = append(buttons, slack.NewButtonBlockElement(HomeCreateInvoiceActionID, "invoice", newPlainTextBlock("New invoice")))
+	buttons[0].(*slack.ButtonBlockElement).Style = slack.StylePrimary
+
+	intro := "Create payment links and invoices here, or with the slash commands in any channel. " +
+		"Links created from this tab are sent to you in the Messages tab."
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(newPlainTextBlock("Payments")),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, intro, false, false), nil, nil),
+		slack.NewActionBlock("home_actions", buttons...),
+		slack.NewDividerBlock(),
+		slack.NewHeaderBlock(newPlainTextBlock("Your recent payment links")),
+	}
+	switch {
+	case recentNote != "":
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, recentNote, false, false)))
+	case recent == nil || len(recent.Links) == 0:
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "You haven't created any Stripe payment links yet.", false, false)))
+	default:
+		for _, link := range recent.Links {
+			blocks = append(blocks, newPaymentLinkSummaryBlock(link))
+		}
+	}
+
+	return slack.HomeTabViewRequest{
+		Type:   slack.VTHomeTab,
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// BuildPaymentReceivedBlocks renders the confirmation posted when a Stripe payment completes.
+// reference, customerEmail and userID are optional.
+func BuildPaymentReceivedBlocks(serviceName, amount, reference, customerEmail, userID, paymentID string) []slack.Block {
+	text := fmt.Sprintf(":white_check_mark: Payment received for *%s* (%s)", serviceName, amount)
+	if reference != "" {
+		text += " — ref " + reference
+	}
+	if userID != "" {
+		text = fmt.Sprintf("<@%s> %s", userID, text)
+	}
+
+	details := fmt.Sprintf("Payment `%s`", paymentID)
+	if customerEmail != "" {
+		details = fmt.Sprintf("Paid by %s · %s", customerEmail, details)
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, details, false, false)),
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+	"paymentbot/payment"
+
+	"github.com/slack-go/slack"
+)
+
+func TestBuildPaymentLinkMessageBlocks(t *testing.T) {
+	const link = "https://buy.stripe.com/test_1"
+	tests := []struct {
+		name       string
+		data       models.PaymentLinkData
+		wantHeader string
+		wantButton string
+		wantText   []string // in the detail fields or any later block
+		wantBlocks int
+	}{
+		{
+			name:       "one-time payment",
+			data:       models.PaymentLinkData{Amount: 49.99, Currency: "USD", ServiceName: "Web Hosting", ReferenceNumber: "Order 1234"},
+			wantHeader: "Stripe payment link",
+			wantButton: "Pay now",
+			wantText:   []string{"*Amount*\n$49.99", "*Provider*\nStripe", "*Reference*\nOrder 1234", "*Payment ID*\n`plink_1`"},
+			wantBlocks: 3,
+		},
+		{
+			name:       "donation",
+			data:       models.PaymentLinkData{Donation: true, Amount: 25, DonationMinimum: 5, Currency: "USD", ServiceName: "Food bank"},
+			wantHeader: "Stripe donation link",
+			wantButton: "Donate",
+			wantText:   []string{"Donor chooses (suggested $25.00, minimum $5.00)"},
+			wantBlocks: 3,
+		},
+		{
+			name:       "subscription",
+			data:       models.PaymentLinkData{Amount: 10, Currency: "USD", ServiceName: "Support", IsSubscription: true, Interval: "month", IntervalCount: 1, EndDateCycles: 12},
+			wantHeader: "Stripe payment link",
+			wantButton: "Pay now",
+			wantText:   []string{":repeat: Billed every 1 month(s) · ends after 12 cycles (12 month payments)"},
+			wantBlocks: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := BuildPaymentLinkMessageBlocks("U1", "Stripe", &tt.data, link, "plink_1")
+			if len(blocks) != tt.wantBlocks {
+				t.Fatalf("got %d blocks, want %d", len(blocks), tt.wantBlocks)
+			}
+
+			header, ok := blocks[0].(*slack.HeaderBlock)
+			if !ok || header.Text.Text != tt.wantHeader {
+				t.Errorf("first block = %#v, want a %q header", blocks[0], tt.wantHeader)
+			}
+
+			intro, ok := blocks[1].(*slack.SectionBlock)
+			if !ok || intro.Accessory == nil || intro.Accessory.ButtonElement == nil {
+				t.Fatalf("second block = %#v, want a section with a button", blocks[1])
+			}
+			if !strings.Contains(intro.Text.Text, "<@U1>") || !strings.Contains(intro.Text.Text, "*"+tt.data.ServiceName+"*") || !strings.Contains(intro.Text.Text, "<"+link+">") {
+				t.Errorf("intro %q should mention the user, the service and the link", intro.Text.Text)
+			}
+			button := intro.Accessory.ButtonElement
+			if button.Text.Text != tt.wantButton || button.URL != link || button.Style != slack.StylePrimary {
+				t.Errorf("button = %q to %q (style %q), want a primary %q button to %q", button.Text.Text, button.URL, button.Style, tt.wantButton, link)
+			}
+
+			var text []string
+			for _, field := range blocks[2].(*slack.SectionBlock).Fields {
+				text = append(text, field.Text)
+			}
+			for _, block := range blocks[3:] {
+				if context, ok := block.(*slack.ContextBlock); ok {
+					for _, element := range context.ContextElements.Elements {
+						text = append(text, element.(*slack.TextBlockObject).Text)
+					}
+				}
+			}
+			joined := strings.Join(text, "\n")
+			for _, want := range tt.wantText {
+				if !strings.Contains(joined, want) {
+					t.Errorf("message text %q is missing %q", joined, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPaymentListBlocks(t *testing.T) {
+	result := &payment.ListLinksResult{
+		Links: []payment.LinkSummary{
+			{ID: "plink_1", URL: "https://buy.stripe.com/test_1", ServiceName: "Hosting", Amount: 59.99, Currency: "USD", Active: true},
+			{ID: "plink_2", URL: "https://buy.stripe.com/test_2", Currency: "USD"},
+		},
+		Truncated: true,
+	}
+	blocks := BuildPaymentListBlocks(result)
+	if len(blocks) != 4 {
+		t.Fatalf("got %d blocks, want a header, 2 links and the truncation note", len(blocks))
+	}
+
+	wantLinks := []string{
+		"*<https://buy.stripe.com/test_1|Hosting>*\n$59.99 · :large_green_circle: Active · `plink_1`",
+		"*<https://buy.stripe.com/test_2|plink_2>*\nCustomer chooses · :white_circle: Inactive · `plink_2`",
+	}
+	for i, want := range wantLinks {
+		if got := blocks[i+1].(*slack.SectionBlock).Text.Text; got != want {
+			t.Errorf("link %d = %q, want %q", i, got, want)
+		}
+	}
+	note := blocks[3].(*slack.ContextBlock).ContextElements.Elements[0].(*slack.TextBlockObject).Text
+	if !strings.Contains(note, fmt.Sprint(payment.MaxListedLinkScan)) {
+		t.Errorf("truncation note %q doesn't say how many links were checked", note)
+	}
+}
+
+func TestBuildInvoiceModalWithAnotherLineItem(t *testing.T) {
+	modal := BuildInvoiceModalView("C1", "INV-1001")
+	view := slack.View{Title: modal.Title, Submit: modal.Submit, Close: modal.Close, CallbackID: modal.CallbackID, Blocks: modal.Blocks, PrivateMetadata: modal.PrivateMetadata}
+
+	next := BuildInvoiceModalWithAnotherLineItem(view, 3)
+	if len(next.Blocks.BlockSet) != len(view.Blocks.BlockSet)+1 {
+		t.Fatalf("got %d blocks, want %d", len(next.Blocks.BlockSet), len(view.Blocks.BlockSet)+1)
+	}
+	if next.CallbackID != view.CallbackID || next.PrivateMetadata != view.PrivateMetadata {
+		t.Errorf("callback %q, metadata %q, want the open view's", next.CallbackID, next.PrivateMetadata)
+	}
+
+	// The new row goes straight after the existing one, so the button stays under the rows
+	var rows []*slack.InputBlock
+	buttonAfterRows := false
+	for _, block := range next.Blocks.BlockSet {
+		if input, ok := block.(*slack.InputBlock); ok && strings.HasPrefix(input.BlockID, invoiceLineItemBlockPrefix+"_") {
+			rows = append(rows, input)
+			buttonAfterRows = false
+		}
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.BlockID == invoiceLineItemActionsBlock {
+			buttonAfterRows = len(rows) == 2
+		}
+	}
+	if len(rows) != 2 || !buttonAfterRows {
+		t.Fatalf("got %d rows (button after them: %t), want 2 rows then the button", len(rows), buttonAfterRows)
+	}
+	for i, row := range rows {
+		if want := blockID(invoiceLineItemBlockPrefix, i+1); row.BlockID != want {
+			t.Errorf("row %d block ID = %q, want %q", i+1, row.BlockID, want)
+		}
+		if want := fmt.Sprintf("Line Item %d", i+1); row.Label.Text != want {
+			t.Errorf("row %d label = %q, want %q", i+1, row.Label.Text, want)
+		}
+		// Only the first row is required, so blank extra rows don't block submission
+		if row.Optional != (i > 0) {
+			t.Errorf("row %d optional = %t, want %t", i+1, row.Optional, i > 0)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"paymentbot/utils"
+
+	"github.com/slack-go/slack"
+)
+
+// TeamConfig holds the Slack credentials for one workspace
+type TeamConfig struct {
+	TeamID        string `json:"team_id"`
+	BotToken      string `json:"bot_token"`
+	SigningSecret string `json:"signing_secret,omitempty"` // falls back to SLACK_SIGNING_SECRET when empty
+
+	// Installation details, set when the team installed the app through OAuth
+	TeamName    string    `json:"team_name,omitempty"`
+	BotUserID   string    `json:"bot_user_id,omitempty"`
+	InstalledBy string    `json:"installed_by,omitempty"`
+	InstalledAt time.Time `json:"installed_at,omitempty"`
+}
+
+// TeamConfigStore looks up per-workspace credentials by team (or enterprise) ID
+type TeamConfigStore interface {
+	Get(teamID string) (TeamConfig, bool)
+	Save(cfg TeamConfig) error
+}
+
+// MemoryTeamConfigStore keeps team configs in memory. They are lost on restart.
+type MemoryTeamConfigStore struct {
+	mu    sync.RWMutex
+	teams map[string]TeamConfig
+}
+
+// NewMemoryTeamConfigStore creates an empty in-memory team config store
+func NewMemoryTeamConfigStore() *MemoryTeamConfigStore {
+	return &MemoryTeamConfigStore{teams: make(map[string]TeamConfig)}
+}
+
+// Save stores cfg under its team ID
+func (m *MemoryTeamConfigStore) Save(cfg TeamConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.teams[cfg.TeamID] = cfg
+	return nil
+}
+
+// Get returns the config stored for teamID
+func (m *MemoryTeamConfigStore) Get(teamID string) (TeamConfig, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cfg, ok := m.teams[teamID]
+	return cfg, ok
+}
+
+// FileTeamConfigStore keeps team configs in memory and mirrors them to a JSON file keyed by
+// team ID. The file holds bot tokens, so it is written with 0600 permissions.
+type FileTeamConfigStore struct {
+	mu    sync.RWMutex
+	path  string
+	teams map[string]TeamConfig
+}
+
+// NewFileTeamConfigStore loads (or creates) a JSON-backed team config store at path
+func NewFileTeamConfigStore(path string) (*FileTeamConfigStore, error) {
+	store := &FileTeamConfigStore{path: path, teams: make(map[string]TeamConfig)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read team config store %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.teams); err != nil {
+			return nil, fmt.Errorf("failed to parse team config store %s: %w", path, err)
+		}
+	}
+	for teamID, cfg := range store.teams {
+		if cfg.BotToken == "" {
+			return nil, fmt.Errorf("team config store %s: team %s has no bot_token", path, teamID)
+		}
+		cfg.TeamID = teamID
+		store.teams[teamID] = cfg
+	}
+	return store, nil
+}
+
+// Save stores cfg under its team ID and rewrites the backing file
+func (f *FileTeamConfigStore) Save(cfg TeamConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.teams[cfg.TeamID] = cfg
+	data, err := json.MarshalIndent(f.teams, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode team config store: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save team config store: %w", err)
+	}
+	return nil
+}
+
+// Get returns the config stored for teamID
+func (f *FileTeamConfigStore) Get(teamID string) (TeamConfig, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	cfg, ok := f.teams[teamID]
+	return cfg, ok
+}
+
+type slackClientContextKey struct{}
+
+type teamIDContextKey struct{}
+
+// teamIDFrom returns the team ID ContextForTeam attached to ctx, or "" when there is none
+func teamIDFrom(ctx context.Context) string {
+	teamID, _ := ctx.Value(teamIDContextKey{}).(string)
+	return teamID
+}
+
+// withSlackClient returns a context whose Slack calls go to client's workspace
+func withSlackClient(ctx context.Context, client *slack.Client) context.Context {
+	return context.WithValue(ctx, slackClientContextKey{}, client)
+}
+
+// slackClientFrom returns the workspace client attached to ctx, or fallback when there is none
+func slackClientFrom(ctx context.Context, fallback *slack.Client) *slack.Client {
+	if client, ok := ctx.Value(slackClientContextKey{}).(*slack.Client); ok && client != nil {
+		return client
+	}
+	return fallback
+}
+
+// teamClients resolves and caches a Slack client per workspace
+type teamClients struct {
+	store     TeamConfigStore
+	newClient func(token string) *slack.Client
+
+	mu      sync.Mutex
+	clients map[string]*slack.Client
+	tokens  map[string]string // token each cached client was built with
+}
+
+// client returns the cached client for cfg, rebuilding it when the token has changed
+func (t *teamClients) client(cfg TeamConfig) *slack.Client {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if client, ok := t.clients[cfg.TeamID]; ok && t.tokens[cfg.TeamID] == cfg.BotToken {
+		return client
+	}
+	client := t.newClient(cfg.BotToken)
+	t.clients[cfg.TeamID] = client
+	t.tokens[cfg.TeamID] = cfg.BotToken
+	return client
+}
+
+// UseTeamConfigs serves workspaces found in store with their own bot token and signing
+// secret. newClient builds a client for a token so every workspace shares the same HTTP
+// settings. Teams missing from the store use the SLACK_BOT_TOKEN/SLACK_SIGNING_SECRET pair.
+func (s *SlackService) UseTeamConfigs(store TeamConfigStore, newClient func(token string) *slack.Client) {
+	s.teams = &teamClients{
+		store:     store,
+		newClient: newClient,
+		clients:   make(map[string]*slack.Client),
+		tokens:    make(map[string]string),
+	}
+}
+
+// SigningSecretForTeam returns the secret Slack signs teamID's requests with
+func (s *SlackService) SigningSecretForTeam(teamID string) string {
+	if s.teams != nil && teamID != "" {
+		if cfg, ok := s.teams.store.Get(teamID); ok && cfg.SigningSecret != "" {
+			return cfg.SigningSecret
+		}
+	}
+	return s.signingSecret
+}
+
+// ContextForTeam returns ctx with teamID and its Slack client attached, so modals and
+// messages for the request go to the workspace it came from
+func (s *SlackService) ContextForTeam(ctx context.Context, teamID string) context.Context {
+	if teamID == "" {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, teamIDContextKey{}, teamID)
+	if s.teams == nil {
+		return ctx
+	}
+	cfg, ok := s.teams.store.Get(teamID)
+	if !ok {
+		return ctx
+	}
+	return withSlackClient(ctx, s.teams.client(cfg))
+}
+
+// ClientForTeam returns the Slack client for teamID's workspace, or the default client for
+// teams without their own credentials
+func (s *SlackService) ClientForTeam(ctx context.Context, teamID string) *slack.Client {
+	return s.slackClient(s.ContextForTeam(ctx, teamID))
+}
+
+// slackClient returns the Slack client for the workspace the request in ctx came from
+func (s *SlackService) slackClient(ctx context.Context) *slack.Client {
+	return slackClientFrom(ctx, s.client)
+}
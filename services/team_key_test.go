@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"paymentbot/config"
+	"paymentbot/counter"
+
+	"github.com/slack-go/slack"
+)
+
+func TestResolveTeamKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction slack.InteractionCallback
+		want        string
+	}{
+		{"team ID", slack.InteractionCallback{Team: slack.Team{ID: "T1"}, Enterprise: slack.Enterprise{ID: "E1"}}, "T1"},
+		{"view team", slack.InteractionCallback{View: slack.View{TeamID: "T2"}, User: slack.User{TeamID: "T3"}}, "T2"},
+		{"user team", slack.InteractionCallback{User: slack.User{TeamID: "T3"}, Enterprise: slack.Enterprise{ID: "E1"}}, "T3"},
+		{"enterprise only", slack.InteractionCallback{Team: slack.Team{ID: "  "}, Enterprise: slack.Enterprise{ID: "E1"}}, "E1"},
+		{"nothing", slack.InteractionCallback{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveTeamKey(&tt.interaction); got != tt.want {
+				t.Errorf("ResolveTeamKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func invoiceInteraction(values map[string]map[string]slack.BlockAction) *slack.InteractionCallback {
+	view := BuildInvoiceModalView("C1", "")
+	return &slack.InteractionCallback{
+		User:    slack.User{ID: "U1"},
+		Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}},
+		View: slack.View{
+			CallbackID: view.CallbackID,
+			Blocks:     view.Blocks,
+			State:      &slack.ViewState{Values: values},
+		},
+	}
+}
+
+func TestProcessInvoiceSubmissionKeysCounterWithoutTeamID(t *testing.T) {
+	client, _ := newFakeSlack(t)
+	s, counters := newInvoiceTestService(t, client, &config.Config{})
+
+	// Enterprise Grid installs can send an empty Team.ID
+	interaction := invoiceInteraction(invoiceFormValues("USD"))
+	interaction.Enterprise = slack.Enterprise{ID: "E1"}
+	s.ProcessInvoiceSubmission(context.Background(), httptest.NewRecorder(), interaction)
+
+	if last, _ := counters.Last(context.Background(), "E1", "C1"); last != counter.DefaultStart+1 {
+		t.Errorf("counter for E1 = %d, want %d", last, counter.DefaultStart+1)
+	}
+}
+
+func TestProcessInvoiceSubmissionRejectsMissingTeam(t *testing.T) {
+	client, files := newFakeSlack(t)
+	s, _ := newInvoiceTestService(t, client, &config.Config{})
+
+	rec := httptest.NewRecorder()
+	s.ProcessInvoiceSubmission(context.Background(), rec, invoiceInteraction(invoiceFormValues("USD")))
+
+	var resp slack.ViewSubmissionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if resp.Errors["invoice_number_block"] == "" {
+		t.Errorf("response = %s, want an error on the invoice number", rec.Body.String())
+	}
+	if shared := files.sharedTo(); len(shared) != 0 {
+		t.Errorf("invoice shared to %v without a team to number it against", shared)
+	}
+}
+
+func TestSigningSecretForTeam(t *testing.T) {
+	teams := NewMemoryTeamConfigStore()
+	teams.Save(TeamConfig{TeamID: "T2", BotToken: "xoxb-two", SigningSecret: "team-two-secret"})
+	teams.Save(TeamConfig{TeamID: "T3", BotToken: "xoxb-three"})
+
+	s := &SlackService{signingSecret: "default-secret"}
+	if got := s.SigningSecretForTeam("T2"); got != "default-secret" {
+		t.Errorf("without team configs SigningSecretForTeam(T2) = %q, want the default", got)
+	}
+
+	s.UseTeamConfigs(teams, func(token string) *slack.Client { return slack.New(token) })
+	tests := []struct {
+		teamID string
+		want   string
+	}{
+		{"T2", "team-two-secret"},
+		{"T3", "default-secret"},
+		{"T9", "default-secret"},
+		{"", "default-secret"},
+	}
+	for _, tt := range tests {
+		if got := s.SigningSecretForTeam(tt.teamID); got != tt.want {
+			t.Errorf("SigningSecretForTeam(%q) = %q, want %q", tt.teamID, got, tt.want)
+		}
+	}
+}
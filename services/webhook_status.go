@@ -0,0 +1,60 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// WebhookEvent describes a webhook delivery seen by the server
+type WebhookEvent struct {
+	ID         string
+	Type       string
+	ReceivedAt time.Time
+}
+
+// WebhookEventTracker remembers the most recent webhook deliveries in memory so admins can
+// diagnose webhook configuration from Slack. State is lost on restart.
+type WebhookEventTracker struct {
+	mu          sync.RWMutex
+	lastEvent   *WebhookEvent
+	lastFailure time.Time
+	failureMsg  string
+}
+
+// NewWebhookEventTracker creates an empty tracker
+func NewWebhookEventTracker() *WebhookEventTracker {
+	return &WebhookEventTracker{}
+}
+
+// RecordEvent stores a successfully verified webhook event
+func (t *WebhookEventTracker) RecordEvent(id, eventType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastEvent = &WebhookEvent{ID: id, Type: eventType, ReceivedAt: time.Now()}
+}
+
+// RecordFailure stores the time and reason of the latest rejected delivery
+func (t *WebhookEventTracker) RecordFailure(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastFailure = time.Now()
+	t.failureMsg = reason
+}
+
+// LastEvent returns the most recent verified event, or nil if none has been received
+func (t *WebhookEventTracker) LastEvent() *WebhookEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.lastEvent == nil {
+		return nil
+	}
+	event := *t.lastEvent
+	return &event
+}
+
+// LastFailure returns when the most recent delivery was rejected and why (zero time if never)
+func (t *WebhookEventTracker) LastFailure() (time.Time, string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastFailure, t.failureMsg
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"paymentbot/payment"
+)
+
+func TestWebhookEventTrackerKeepsTheLatestEvent(t *testing.T) {
+	tracker := NewWebhookEventTracker()
+	if tracker.LastEvent() != nil {
+		t.Fatal("new tracker has a last event")
+	}
+	if failedAt, _ := tracker.LastFailure(); !failedAt.IsZero() {
+		t.Fatal("new tracker has a last failure")
+	}
+
+	before := time.Now()
+	tracker.RecordEvent("evt_1", "checkout.session.completed")
+	tracker.RecordEvent("evt_2", "payment_intent.succeeded")
+	tracker.RecordFailure("invalid signature")
+
+	event := tracker.LastEvent()
+	if event == nil || event.ID != "evt_2" || event.Type != "payment_intent.succeeded" || event.ReceivedAt.Before(before) {
+		t.Errorf("LastEvent = %+v, want evt_2 received after %s", event, before)
+	}
+	// Callers get a copy, so they can't change what the tracker reports
+	event.ID = "changed"
+	if tracker.LastEvent().ID != "evt_2" {
+		t.Error("changing the returned event changed the tracker")
+	}
+	if failedAt, reason := tracker.LastFailure(); failedAt.Before(before) || reason != "invalid signature" {
+		t.Errorf("LastFailure = %s %q, want the invalid signature", failedAt, reason)
+	}
+}
+
+func TestProcessWebhookCheckCommand(t *testing.T) {
+	s := &SlackService{
+		stripeGenerator:  payment.NewStripeGenerator("sk_test"),
+		webhookTracker:   NewWebhookEventTracker(),
+		webhookSecretSet: true,
+		publicBaseURL:    "https://pay.example.test",
+		adminUserIDs:     map[string]bool{"U_ADMIN": true},
+	}
+
+	if got := s.ProcessWebhookCheckCommand("U1"); !strings.Contains(got, "only admins") {
+		t.Errorf("non-admin reply = %q, want it refused", got)
+	}
+
+	got := s.ProcessWebhookCheckCommand("U_ADMIN")
+	for _, want := range []string{"`https://pay.example.test/stripe/webhook`", "configured", "none received"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reply %q doesn't mention %q", got, want)
+		}
+	}
+
+	s.webhookTracker.RecordEvent("evt_1", "checkout.session.completed")
+	s.webhookTracker.RecordFailure("invalid signature")
+	got = s.ProcessWebhookCheckCommand("U_ADMIN")
+	for _, want := range []string{"`checkout.session.completed` (`evt_1`)", "Last rejected delivery", "invalid signature"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reply %q doesn't mention %q", got, want)
+		}
+	}
+}
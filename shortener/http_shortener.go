@@ -0,0 +1,77 @@
+package shortener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPShortener calls an external shortening service. It POSTs {"url": "<long url>"} to the
+// configured endpoint and expects a JSON response containing "short_url" (or "link").
+type HTTPShortener struct {
+	endpoint string
+	apiToken string
+	client   *http.Client
+}
+
+// NewHTTPShortener creates a shortener backed by an external HTTP API
+func NewHTTPShortener(endpoint, apiToken string) URLShortener {
+	return &HTTPShortener{
+		endpoint: endpoint,
+		apiToken: apiToken,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Shorten requests a short URL for longURL from the external service
+func (h *HTTPShortener) Shorten(ctx context.Context, longURL string) (string, error) {
+	body, err := json.Marshal(map[string]string{"url": longURL})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal shortener request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create shortener request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiToken)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send shortener request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read shortener response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("shortener returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		ShortURL string `json:"short_url"`
+		Link     string `json:"link"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse shortener response: %w", err)
+	}
+
+	shortURL := result.ShortURL
+	if shortURL == "" {
+		shortURL = result.Link
+	}
+	if u, err := url.Parse(shortURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("shortener returned an invalid URL %q", shortURL)
+	}
+	return shortURL, nil
+}
@@ -0,0 +1,21 @@
+package shortener
+
+import "context"
+
+// URLShortener turns a long payment URL into a shorter, client-friendly one
+type URLShortener interface {
+	Shorten(ctx context.Context, longURL string) (string, error)
+}
+
+// NoopShortener returns URLs unchanged. It is the default when no shortener is configured.
+type NoopShortener struct{}
+
+// NewNoopShortener creates a shortener that leaves URLs untouched
+func NewNoopShortener() URLShortener {
+	return NoopShortener{}
+}
+
+// Shorten returns longURL as-is
+func (NoopShortener) Shorten(ctx context.Context, longURL string) (string, error) {
+	return longURL, nil
+}
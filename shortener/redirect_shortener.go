@@ -0,0 +1,48 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// shortIDBytes gives 96 bits of randomness, so IDs can't be enumerated or guessed
+const shortIDBytes = 12
+
+// RedirectShortener is a self-hosted shortener: it stores the long URL under a random ID and
+// returns <baseURL>/l/<id>, which the bot's redirect endpoint resolves with a 302.
+type RedirectShortener struct {
+	baseURL string
+	store   LinkStore
+}
+
+// NewRedirectShortener creates a self-hosted shortener serving links from baseURL
+func NewRedirectShortener(baseURL string, store LinkStore) URLShortener {
+	return &RedirectShortener{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		store:   store,
+	}
+}
+
+// Shorten stores longURL under a fresh random ID and returns the short link
+func (r *RedirectShortener) Shorten(ctx context.Context, longURL string) (string, error) {
+	id, err := NewShortID()
+	if err != nil {
+		return "", err
+	}
+	if err := r.store.Save(id, longURL); err != nil {
+		return "", fmt.Errorf("failed to store short link: %w", err)
+	}
+	return fmt.Sprintf("%s/l/%s", r.baseURL, id), nil
+}
+
+// NewShortID returns a random, URL-safe short link ID
+func NewShortID() (string, error) {
+	b := make([]byte, shortIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate short ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,65 @@
+package shortener
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedirectShortenerStoresLinks(t *testing.T) {
+	store := NewMemoryLinkStore()
+	s := NewRedirectShortener("https://pay.example.test/", store)
+
+	short, err := s.Shorten(context.Background(), "https://buy.stripe.com/test_abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := strings.CutPrefix(short, "https://pay.example.test/l/")
+	if !ok {
+		t.Fatalf("short link = %q, want it under the base URL's /l/", short)
+	}
+	if got, ok := store.Get(id); !ok || got != "https://buy.stripe.com/test_abc123" {
+		t.Errorf("store[%q] = %q, %v, want the long URL", id, got, ok)
+	}
+}
+
+func TestNewShortIDIsRandomAndURLSafe(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id, err := NewShortID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 96 random bits, base64 encoded
+		if len(id) != 16 || strings.ContainsAny(id, "+/=") {
+			t.Fatalf("short ID %q, want 16 URL-safe characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("short ID %q generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestFileLinkStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	store, err := NewFileLinkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("abc123", "https://buy.stripe.com/test_abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileLinkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reloaded.Get("abc123"); !ok || got != "https://buy.stripe.com/test_abc123" {
+		t.Errorf("Get after reload = %q, %v, want the saved URL", got, ok)
+	}
+	if _, ok := reloaded.Get("other"); ok {
+		t.Error("Get found an ID that was never saved")
+	}
+}
@@ -0,0 +1,54 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNoopShortenerReturnsURLUnchanged(t *testing.T) {
+	const longURL = "https://buy.stripe.com/test_abc123?prefilled_email=a%40b.test"
+	got, err := NewNoopShortener().Shorten(context.Background(), longURL)
+	if err != nil || got != longURL {
+		t.Errorf("Shorten = %q, %v, want %q unchanged", got, err, longURL)
+	}
+}
+
+func TestHTTPShortener(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{"short_url", http.StatusOK, `{"short_url":"https://sho.rt/a1"}`, "https://sho.rt/a1", false},
+		{"link", http.StatusCreated, `{"link":"https://sho.rt/b2"}`, "https://sho.rt/b2", false},
+		{"error status", http.StatusBadGateway, `{"short_url":"https://sho.rt/a1"}`, "", true},
+		{"not JSON", http.StatusOK, `<html>`, "", true},
+		{"relative URL", http.StatusOK, `{"short_url":"/a1"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]string
+			var auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			got, err := NewHTTPShortener(server.URL, "token").Shorten(context.Background(), "https://example.test/long")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Shorten = %q, %v, want %q (error %v)", got, err, tt.want, tt.wantErr)
+			}
+			if sent["url"] != "https://example.test/long" || auth != "Bearer token" {
+				t.Errorf("request body %v with Authorization %q, want the long URL and bearer token", sent, auth)
+			}
+		})
+	}
+}
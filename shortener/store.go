@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"paymentbot/utils"
+)
+
+// LinkStore persists the mapping from short IDs to long URLs
+type LinkStore interface {
+	Save(id, longURL string) error
+	Get(id string) (string, bool)
+}
+
+// MemoryLinkStore keeps short links in memory. Links are lost on restart.
+type MemoryLinkStore struct {
+	mu    sync.RWMutex
+	links map[string]string
+}
+
+// NewMemoryLinkStore creates an empty in-memory link store
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{links: make(map[string]string)}
+}
+
+// Save stores longURL under id
+func (m *MemoryLinkStore) Save(id, longURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.links[id] = longURL
+	return nil
+}
+
+// Get returns the long URL stored under id
+func (m *MemoryLinkStore) Get(id string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	longURL, ok := m.links[id]
+	return longURL, ok
+}
+
+// FileLinkStore keeps short links in memory and mirrors them to a JSON file so they survive restarts
+type FileLinkStore struct {
+	mu    sync.RWMutex
+	path  string
+	links map[string]string
+}
+
+// NewFileLinkStore loads (or creates) a JSON-backed link store at path
+func NewFileLinkStore(path string) (*FileLinkStore, error) {
+	store := &FileLinkStore{path: path, links: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read link store %s: %w", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.links); err != nil {
+			return nil, fmt.Errorf("failed to parse link store %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// Save stores longURL under id and rewrites the backing file
+func (f *FileLinkStore) Save(id, longURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.links[id] = longURL
+	data, err := json.Marshal(f.links)
+	if err != nil {
+		return fmt.Errorf("failed to encode link store: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save link store: %w", err)
+	}
+	return nil
+}
+
+// Get returns the long URL stored under id
+func (f *FileLinkStore) Get(id string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	longURL, ok := f.links[id]
+	return longURL, ok
+}
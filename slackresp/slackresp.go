@@ -0,0 +1,56 @@
+// Package slackresp writes the synchronous HTTP responses Slack accepts from slash commands and
+// view submissions
+package slackresp
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/slack-go/slack"
+)
+
+// message is a slash command reply. slack.Msg isn't used since it also sends fields such as
+// replace_original that only apply to response_url messages.
+type message struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// Ephemeral replies to a slash command with text only the invoking user sees
+func Ephemeral(w http.ResponseWriter, text string) {
+	write(w, message{ResponseType: slack.ResponseTypeEphemeral, Text: text})
+}
+
+// Error shows message under blockID and keeps the modal open with the user's input.
+// blockID must be an input block in the submitted view.
+func Error(w http.ResponseWriter, blockID, message string) {
+	Errors(w, map[string]string{blockID: message})
+}
+
+// Errors shows several field errors at once, keyed by input block ID
+func Errors(w http.ResponseWriter, errors map[string]string) {
+	write(w, slack.NewErrorsViewSubmissionResponse(errors))
+}
+
+// Push opens view on top of the submitted one, so closing it returns to the form
+func Push(w http.ResponseWriter, view slack.ModalViewRequest) {
+	write(w, slack.NewPushViewSubmissionResponse(&view))
+}
+
+// Update replaces the submitted view with view
+func Update(w http.ResponseWriter, view slack.ModalViewRequest) {
+	write(w, slack.NewUpdateViewSubmissionResponse(&view))
+}
+
+// Clear closes every view in the modal stack
+func Clear(w http.ResponseWriter) {
+	write(w, slack.NewClearViewSubmissionResponse())
+}
+
+func write(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("[Slack] Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package slackresp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestResponseJSON(t *testing.T) {
+	view := slack.ModalViewRequest{
+		Type:   slack.VTModal,
+		Title:  slack.NewTextBlockObject(slack.PlainTextType, "Preview", false, false),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{slack.NewDividerBlock()}},
+	}
+	viewJSON := `{"type":"modal","title":{"type":"plain_text","text":"Preview"},"blocks":[{"type":"divider"}]}`
+
+	tests := []struct {
+		name  string
+		write func(http.ResponseWriter)
+		want  string
+	}{
+		{"ephemeral", func(w http.ResponseWriter) { Ephemeral(w, "Link created") }, `{"response_type":"ephemeral","text":"Link created"}`},
+		{"ephemeral escapes markup", func(w http.ResponseWriter) { Ephemeral(w, "<@U1> & co") }, `{"response_type":"ephemeral","text":"\u003c@U1\u003e \u0026 co"}`},
+		{"error", func(w http.ResponseWriter) { Error(w, "amount_block", "Enter an amount") }, `{"response_action":"errors","errors":{"amount_block":"Enter an amount"}}`},
+		{"errors", func(w http.ResponseWriter) { Errors(w, map[string]string{"b": "2", "a": "1"}) }, `{"response_action":"errors","errors":{"a":"1","b":"2"}}`},
+		{"push", func(w http.ResponseWriter) { Push(w, view) }, `{"response_action":"push","view":` + viewJSON + `}`},
+		{"update", func(w http.ResponseWriter) { Update(w, view) }, `{"response_action":"update","view":` + viewJSON + `}`},
+		{"clear", func(w http.ResponseWriter) { Clear(w) }, `{"response_action":"clear"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.write(rec)
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := rec.Body.String(); got != tt.want+"\n" {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
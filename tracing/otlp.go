@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultServiceName is reported when OTEL_SERVICE_NAME is not set
+const defaultServiceName = "slack-payment-bot"
+
+// InitFromEnv configures tracing with the OpenTelemetry SDK and its OTLP/HTTP exporter, which
+// read the standard environment variables:
+//
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT (required to enable tracing)
+//	OTEL_EXPORTER_OTLP_HEADERS / OTEL_EXPORTER_OTLP_TRACES_HEADERS (comma-separated key=value pairs)
+//	OTEL_SERVICE_NAME (defaults to "slack-payment-bot") and OTEL_RESOURCE_ATTRIBUTES
+//	OTEL_TRACES_SAMPLER / OTEL_TRACES_SAMPLER_ARG and the OTEL_BSP_* batching settings
+//	OTEL_SDK_DISABLED / OTEL_TRACES_EXPORTER=none (force tracing off)
+//
+// When no endpoint is configured tracing is a no-op. The returned function flushes
+// pending spans and should be called on shutdown.
+func InitFromEnv() func(ctx context.Context) error {
+	noop := func(ctx context.Context) error { return nil }
+
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		log.Printf("[Tracing] Disabled via environment")
+		return noop
+	}
+
+	// The exporter would fall back to localhost:4318, so only trace when an endpoint is set
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		log.Printf("[Tracing] No OTLP endpoint configured, tracing disabled")
+		return noop
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Printf("[Tracing] Failed to create OTLP exporter, tracing disabled: %v", err)
+		return noop
+	}
+
+	// Later detectors win, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", defaultServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		log.Printf("[Tracing] Failed to read resource attributes: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	activeProvider.Store(provider)
+
+	log.Printf("[Tracing] Exporting spans to %s", endpoint)
+	return func(ctx context.Context) error {
+		// New spans become no-ops straight away; ones already started still end and export
+		activeProvider.CompareAndSwap(provider, nil)
+		return provider.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the bot's spans among any recorded by libraries
+const instrumentationName = "paymentbot"
+
+// Span represents a single timed operation. A nil *Span is a valid no-op span,
+// which is what StartSpan returns when tracing is disabled.
+type Span struct {
+	span trace.Span
+}
+
+// activeProvider is nil when no exporter has been configured, making every span a no-op.
+// InitFromEnv and shutdown swap it while requests are running, so load it once per use.
+var activeProvider atomic.Pointer[sdktrace.TracerProvider]
+
+// propagator reads and writes W3C traceparent headers
+var propagator = propagation.TraceContext{}
+
+// Enabled reports whether spans are being recorded and exported
+func Enabled() bool {
+	return activeProvider.Load() != nil
+}
+
+// StartSpan starts a child span of the span stored in ctx (or a new trace if there is none)
+// and returns a context carrying the new span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startSpan(ctx, name, trace.SpanKindInternal)
+}
+
+// StartClientSpan starts a span for an outbound call to a remote service
+func StartClientSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startSpan(ctx, name, trace.SpanKindClient)
+}
+
+func startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, *Span) {
+	provider := activeProvider.Load()
+	if provider == nil {
+		return ctx, nil
+	}
+	ctx, span := provider.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+// FromContext returns the current span stored in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// SetAttribute records a key/value pair on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(toAttribute(key, value))
+}
+
+// toAttribute converts a plain value into an OpenTelemetry attribute, falling back to its
+// string form for types OpenTelemetry has no attribute for
+func toAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprintf("%v", v))
+	}
+}
+
+// RecordError marks the span as failed with the given error
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and hands it to the exporter. Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// TraceParent returns the W3C traceparent header value for the span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	header := http.Header{}
+	propagator.Inject(trace.ContextWithSpan(context.Background(), s.span), propagation.HeaderCarrier(header))
+	return header.Get("traceparent")
+}
+
+// InjectHeaders propagates the span in ctx to an outbound HTTP request
+func InjectHeaders(ctx context.Context, header http.Header) {
+	if activeProvider.Load() == nil {
+		return
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// WrapHandler starts a server span for every request handled by h. If the caller sent a
+// W3C traceparent header, the span joins that trace.
+func WrapHandler(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if activeProvider.Load() == nil {
+			h(w, r)
+			return
+		}
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := startSpan(ctx, name, trace.SpanKindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		defer span.End()
+
+		h(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useTestProvider records spans in memory for the rest of the test
+func useTestProvider(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	activeProvider.Store(provider)
+	t.Cleanup(func() {
+		activeProvider.Store(nil)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestDisabledTracingIsANoOp(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "noop")
+	if span != nil || ctx != context.Background() {
+		t.Fatalf("StartSpan with tracing disabled = %v, want a nil span and the same context", span)
+	}
+	span.SetAttribute("key", "value")
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	header := http.Header{}
+	InjectHeaders(ctx, header)
+	if len(header) != 0 {
+		t.Errorf("InjectHeaders with tracing disabled set %v", header)
+	}
+}
+
+func TestWrapHandlerJoinsTheCallersTrace(t *testing.T) {
+	exporter := useTestProvider(t)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	var outbound http.Header
+	handler := WrapHandler("POST /test", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := StartClientSpan(r.Context(), "provider.call")
+		defer span.End()
+		span.RecordError(errors.New("provider unavailable"))
+
+		outbound = http.Header{}
+		InjectHeaders(ctx, outbound)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the server and client spans", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if server.Name != "POST /test" || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span %q has parent %s, want the caller's span", server.Name, server.Parent.SpanID())
+	}
+	if client.SpanContext.TraceID().String() != traceID || client.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("client span is not a child of the server span in trace %s", traceID)
+	}
+	if client.Status.Code != codes.Error || client.Status.Description != "provider unavailable" {
+		t.Errorf("client span status = %+v, want the recorded error", client.Status)
+	}
+	if got, want := outbound.Get("traceparent"), "00-"+traceID+"-"+client.SpanContext.SpanID().String()+"-01"; got != want {
+		t.Errorf("outbound traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestSpansSurviveShutdownWhileInFlight(t *testing.T) {
+	useTestProvider(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ctx, span := StartSpan(context.Background(), "work")
+				span.SetAttribute("iteration", j)
+				InjectHeaders(ctx, http.Header{})
+				span.End()
+			}
+		}()
+	}
+	// Tracing being switched off mid-request must not panic in the spans already running
+	activeProvider.Store(nil)
+	wg.Wait()
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseAmount parses an amount the way people type it: currency symbols and codes are ignored
+// ("$19.99", "HK$ 100", "100 EUR"), and thousands separators and a decimal comma are accepted
+// ("1,234.56", "1 299,00", "19,99"). A single separator followed by exactly three digits, as
+// in "1,234" or "1.234", could be either and is rejected.
+func ParseAmount(raw string) (float64, error) {
+	canonical, err := normalizeAmount(raw, "")
+	if err != nil {
+		return 0, err
+	}
+	amount, err := strconv.ParseFloat(canonical, 64)
+	if err != nil {
+		return 0, invalidAmountError(raw)
+	}
+	return amount, nil
+}
+
+// ParseAmountInCurrency is ParseAmount, also rejecting more decimal places than the currency's
+// minor unit allows ("10.999" USD, "1500.5" JPY) rather than losing them when converting to
+// minor units. Trailing zeros don't count, so "1500.00" JPY is fine.
+func ParseAmountInCurrency(raw, currency string) (float64, error) {
+	canonical, err := normalizeAmount(raw, currency)
+	if err != nil {
+		return 0, err
+	}
+	if _, fraction, ok := strings.Cut(canonical, "."); ok {
+		if digits := len(strings.TrimRight(fraction, "0")); digits > CurrencyDecimals(currency) {
+			return 0, tooManyDecimalsError(currency)
+		}
+	}
+	amount, err := strconv.ParseFloat(canonical, 64)
+	if err != nil {
+		return 0, invalidAmountError(raw)
+	}
+	return amount, nil
+}
+
+func tooManyDecimalsError(currency string) error {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if decimals := CurrencyDecimals(code); decimals > 0 {
+		return fmt.Errorf("%s amounts can have at most %d decimal places", code, decimals)
+	}
+	return fmt.Errorf("%s amounts can't have decimals", code)
+}
+
+func invalidAmountError(raw string) error {
+	return fmt.Errorf("%q isn't a valid amount, e.g. 1299.00", strings.TrimSpace(raw))
+}
+
+// groupSeparator stands in for spaces and apostrophes, which only ever group thousands
+const groupSeparator = '_'
+
+// normalizeAmount strips symbols and separators from raw and returns a plain decimal such as
+// "1234.56" for strconv to parse. With a currency, "10.999" is read as a decimal, so it's
+// either valid (KWD) or reported as too precise rather than as ambiguous.
+func normalizeAmount(raw, currency string) (string, error) {
+	input := strings.TrimSpace(raw)
+
+	// Currency codes and symbols may lead or trail the number ("HK$", "USD", "kr")
+	s := strings.TrimFunc(input, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.Is(unicode.Sc, r) || unicode.IsSpace(r)
+	})
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = strings.TrimFunc(s[1:], func(r rune) bool {
+			return unicode.Is(unicode.Sc, r) || unicode.IsSpace(r)
+		})
+	}
+	if s == "" {
+		return "", invalidAmountError(raw)
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',':
+			b.WriteRune(r)
+		case unicode.IsSpace(r), r == '\'', r == '’':
+			b.WriteRune(groupSeparator)
+		default:
+			return "", invalidAmountError(raw)
+		}
+	}
+	s = b.String()
+
+	dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+	decimalAt := -1
+	switch {
+	case dots > 0 && commas > 0:
+		// With both present, whichever comes last is the decimal separator
+		decimalAt = strings.LastIndexAny(s, ".,")
+	case dots+commas == 1:
+		decimalAt = strings.IndexAny(s, ".,")
+		whole, fraction := s[:decimalAt], s[decimalAt+1:]
+		grouped := strings.ContainsRune(whole, groupSeparator)
+		ambiguous := len(fraction) == 3 && strings.Trim(whole, "0") != "" && !grouped
+		switch {
+		case ambiguous && currency == "":
+			return "", fmt.Errorf("%q is ambiguous: write %s%s.00 for a whole amount", input, whole, fraction)
+		case ambiguous && CurrencyDecimals(currency) < 3:
+			return "", fmt.Errorf("%w; write %s%s for a whole amount", tooManyDecimalsError(currency), whole, fraction)
+		}
+	}
+
+	whole, fraction := s, ""
+	if decimalAt >= 0 {
+		whole, fraction = s[:decimalAt], s[decimalAt+1:]
+		if fraction == "" || strings.ContainsAny(fraction, ".,_") {
+			return "", invalidAmountError(raw)
+		}
+	}
+	if (whole != "" || fraction == "") && !validThousandsGroups(whole) {
+		return "", invalidAmountError(raw)
+	}
+
+	canonical := strings.NewReplacer(",", "", ".", "", string(groupSeparator), "").Replace(whole)
+	if fraction != "" {
+		canonical += "." + fraction
+	}
+	if negative {
+		canonical = "-" + canonical
+	}
+	return canonical, nil
+}
+
+// validThousandsGroups checks the digit groups of a whole number such as "1,234,567" or the
+// Indian "1,23,45,678": one kind of separator, a first group of 1-3 digits, a last group of
+// 3 and any others of 2 or 3. A number with no separators is always valid.
+func validThousandsGroups(whole string) bool {
+	if whole == "" {
+		return false
+	}
+	sep := strings.IndexAny(whole, ".,_")
+	if sep < 0 {
+		return true
+	}
+	groups := strings.Split(whole, whole[sep:sep+1])
+	for i, group := range groups {
+		if strings.ContainsAny(group, ".,_") {
+			return false
+		}
+		switch {
+		case i == 0 && (len(group) < 1 || len(group) > 3):
+			return false
+		case i == len(groups)-1 && len(group) != 3:
+			return false
+		case i > 0 && i < len(groups)-1 && len(group) != 2 && len(group) != 3:
+			return false
+		}
+	}
+	return true
+}
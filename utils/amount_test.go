@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr string
+	}{
+		{"19.99", 19.99, ""},
+		{"$19.99", 19.99, ""},
+		{"HK$ 100", 100, ""},
+		{"100 EUR", 100, ""},
+		{"€19,99", 19.99, ""},
+		{"19,99", 19.99, ""},
+		{"1,234.56", 1234.56, ""},
+		{"1.234,56", 1234.56, ""},
+		{"$1,299.00", 1299, ""},
+		{"1 299,00", 1299, ""},
+		{"1'299.50", 1299.5, ""},
+		{"1,23,45,678", 12345678, ""},
+		{"1,234,567", 1234567, ""},
+		{"0.500", 0.5, ""},
+		{"-5", -5, ""},
+		{"1,234", 0, "ambiguous"},
+		{"1.234", 0, "ambiguous"},
+		{"12,34,5", 0, "isn't a valid amount"},
+		{"1,2345.00", 0, "isn't a valid amount"},
+		{"1.2.3", 0, "isn't a valid amount"},
+		{"19.", 0, "isn't a valid amount"},
+		{"abc", 0, "isn't a valid amount"},
+		{"$", 0, "isn't a valid amount"},
+		{"", 0, "isn't a valid amount"},
+		{"12abc34", 0, "isn't a valid amount"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAmount(%q) = %v, %v, want an error mentioning %q", tt.input, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseAmountInCurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		want     float64
+		wantErr  string
+	}{
+		{"10.999", "USD", 0, "at most 2 decimal places"},
+		{"10.00", "USD", 10, ""},
+		{"100", "USD", 100, ""},
+		{"10.9900", "USD", 10.99, ""},
+		{"10.990", "USD", 0, "write 10990 for a whole amount"},
+		{"1,234", "USD", 0, "write 1234 for a whole amount"},
+		{"10.999", "JPY", 0, "can't have decimals"},
+		{"10.00", "JPY", 10, ""},
+		{"100", "JPY", 100, ""},
+		{"1500.5", "JPY", 0, "can't have decimals"},
+		{"10.999", "KWD", 10.999, ""},
+		{"10.9999", "KWD", 0, "at most 3 decimal places"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmountInCurrency(tt.input, tt.currency)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAmountInCurrency(%q, %s) = %v, %v, want an error mentioning %q", tt.input, tt.currency, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAmountInCurrency(%q, %s) = %v, %v, want %v", tt.input, tt.currency, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+// CadencePreset maps a friendly billing cadence to a Stripe interval and interval count
+type CadencePreset struct {
+	Value         string // option value used in the Slack modal
+	Label         string // human readable label
+	Interval      string
+	IntervalCount int64
+}
+
+// CadenceCustom is the modal option meaning "use the raw interval and frequency fields"
+const CadenceCustom = "custom"
+
+// CadencePresets lists the named billing cadences offered in the subscription modal
+var CadencePresets = []CadencePreset{
+	{Value: "biweekly", Label: "Bi-weekly (every 2 weeks)", Interval: "week", IntervalCount: 2},
+	{Value: "quarterly", Label: "Quarterly (every 3 months)", Interval: "month", IntervalCount: 3},
+	{Value: "semiannually", Label: "Semi-annually (every 6 months)", Interval: "month", IntervalCount: 6},
+	{Value: "annually", Label: "Annually (every year)", Interval: "year", IntervalCount: 1},
+}
+
+// ResolveCadencePreset returns the interval and interval count for a named preset.
+// ok is false for unknown values and for CadenceCustom.
+func ResolveCadencePreset(value string) (interval string, intervalCount int64, ok bool) {
+	for _, preset := range CadencePresets {
+		if preset.Value == value {
+			return preset.Interval, preset.IntervalCount, true
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,11 @@
+package utils
+
+import "testing"
+
+func TestResolveCadencePresetRejectsCustomAndUnknown(t *testing.T) {
+	for _, value := range []string{CadenceCustom, "", "fortnightly"} {
+		if interval, count, ok := ResolveCadencePreset(value); ok {
+			t.Errorf("ResolveCadencePreset(%q) = %s x%d, want no preset", value, interval, count)
+		}
+	}
+}
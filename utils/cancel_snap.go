@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CancelSnap moves computed subscription cancellation times to a predictable time of day,
+// optionally on a business day. The zero value leaves times unchanged.
+type CancelSnap struct {
+	Enabled      bool
+	Hour         int
+	Minute       int
+	Location     *time.Location
+	BusinessDays bool            // skip Saturdays, Sundays and Holidays
+	Holidays     map[string]bool // dates as YYYY-MM-DD in Location
+}
+
+// ParseCancelSnap builds a CancelSnap from "HH:MM", an IANA time zone (default UTC) and a
+// comma-separated list of YYYY-MM-DD holidays. An empty timeOfDay disables snapping.
+func ParseCancelSnap(timeOfDay, timezone string, businessDays bool, holidays string) (CancelSnap, error) {
+	if strings.TrimSpace(timeOfDay) == "" {
+		return CancelSnap{}, nil
+	}
+
+	clock, err := time.Parse("15:04", strings.TrimSpace(timeOfDay))
+	if err != nil {
+		return CancelSnap{}, fmt.Errorf("invalid time of day %q, expected HH:MM", timeOfDay)
+	}
+
+	location := time.UTC
+	if timezone != "" {
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return CancelSnap{}, fmt.Errorf("invalid time zone %q: %w", timezone, err)
+		}
+	}
+
+	holidaySet := make(map[string]bool)
+	for _, day := range strings.Split(holidays, ",") {
+		day = strings.TrimSpace(day)
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return CancelSnap{}, fmt.Errorf("invalid holiday %q, expected YYYY-MM-DD", day)
+		}
+		holidaySet[day] = true
+	}
+
+	return CancelSnap{
+		Enabled:      true,
+		Hour:         clock.Hour(),
+		Minute:       clock.Minute(),
+		Location:     location,
+		BusinessDays: businessDays,
+		Holidays:     holidaySet,
+	}, nil
+}
+
+// Apply returns the latest snapped time at or before t. Snapping never moves a cancellation
+// later, since that could let one more billing period renew and charge the customer.
+func (c CancelSnap) Apply(t time.Time) time.Time {
+	if !c.Enabled {
+		return t
+	}
+
+	local := t.In(c.Location)
+	snapped := time.Date(local.Year(), local.Month(), local.Day(), c.Hour, c.Minute, 0, 0, c.Location)
+	if snapped.After(local) {
+		snapped = snapped.AddDate(0, 0, -1)
+	}
+	// Holidays lists are short, so this terminates within a few weeks at most
+	for c.BusinessDays && !c.isBusinessDay(snapped) {
+		snapped = snapped.AddDate(0, 0, -1)
+	}
+	return snapped
+}
+
+func (c CancelSnap) isBusinessDay(t time.Time) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	return !c.Holidays[t.Format("2006-01-02")]
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancelSnapApply(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	at := func(loc *time.Location, day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, loc)
+	}
+	// 16 October 2026 is a Friday, 19 October a Monday
+	tests := []struct {
+		name  string
+		snap  CancelSnap
+		input time.Time
+		want  time.Time
+	}{
+		{"disabled leaves the time alone", CancelSnap{}, at(time.UTC, 17, 3, 12), at(time.UTC, 17, 3, 12)},
+		{"later the same day", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC}, at(time.UTC, 14, 15, 30), at(time.UTC, 14, 9, 0)},
+		{"earlier in the day goes to the day before", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC}, at(time.UTC, 14, 8, 59), at(time.UTC, 13, 9, 0)},
+		{"exactly on the snap time", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC}, at(time.UTC, 14, 9, 0), at(time.UTC, 14, 9, 0)},
+		{"weekends allowed without business days", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC}, at(time.UTC, 18, 12, 0), at(time.UTC, 18, 9, 0)},
+		{"Saturday goes back to Friday", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC, BusinessDays: true}, at(time.UTC, 17, 12, 0), at(time.UTC, 16, 9, 0)},
+		{"Sunday goes back to Friday", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC, BusinessDays: true}, at(time.UTC, 18, 23, 0), at(time.UTC, 16, 9, 0)},
+		{"early Monday goes back to Friday", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC, BusinessDays: true}, at(time.UTC, 19, 7, 0), at(time.UTC, 16, 9, 0)},
+		{"Monday after the snap time stays", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC, BusinessDays: true}, at(time.UTC, 19, 10, 0), at(time.UTC, 19, 9, 0)},
+		{"holiday Friday goes back to Thursday", CancelSnap{Enabled: true, Hour: 9, Location: time.UTC, BusinessDays: true, Holidays: map[string]bool{"2026-10-16": true}}, at(time.UTC, 18, 12, 0), at(time.UTC, 15, 9, 0)},
+		{"snaps in the configured zone", CancelSnap{Enabled: true, Hour: 9, Minute: 30, Location: newYork, BusinessDays: true}, at(time.UTC, 17, 2, 0), at(newYork, 16, 9, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.snap.Apply(tt.input)
+			if !got.Equal(tt.want) {
+				t.Errorf("Apply(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+			if got.After(tt.input) {
+				t.Errorf("Apply(%v) = %v, which is later than the computed time", tt.input, got)
+			}
+		})
+	}
+}
+
+func TestParseCancelSnap(t *testing.T) {
+	snap, err := ParseCancelSnap("", "Not/AZone", true, "garbage")
+	if err != nil || snap.Enabled {
+		t.Errorf("ParseCancelSnap with no time of day = %+v, %v, want disabled", snap, err)
+	}
+
+	snap, err = ParseCancelSnap(" 17:45 ", "", true, "2026-12-25, 2026-12-26")
+	if err != nil {
+		t.Fatalf("ParseCancelSnap error: %v", err)
+	}
+	if !snap.Enabled || snap.Hour != 17 || snap.Minute != 45 || snap.Location != time.UTC || !snap.BusinessDays {
+		t.Errorf("ParseCancelSnap = %+v", snap)
+	}
+	if !snap.Holidays["2026-12-25"] || !snap.Holidays["2026-12-26"] || len(snap.Holidays) != 2 {
+		t.Errorf("holidays = %v", snap.Holidays)
+	}
+
+	for _, tt := range []struct{ timeOfDay, timezone, holidays string }{
+		{"25:00", "", ""},
+		{"9am", "", ""},
+		{"09:00", "Not/AZone", ""},
+		{"09:00", "", "12/25/2026"},
+	} {
+		if _, err := ParseCancelSnap(tt.timeOfDay, tt.timezone, false, tt.holidays); err == nil {
+			t.Errorf("ParseCancelSnap(%q, %q, %q) succeeded, want an error", tt.timeOfDay, tt.timezone, tt.holidays)
+		}
+	}
+}
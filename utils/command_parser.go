@@ -4,64 +4,117 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
+	"unicode"
 
 	"paymentbot/models"
 )
 
 // SplitArgsQuoted splits a command string into arguments, treating quoted substrings as single arguments.
-func SplitArgsQuoted(input string) []string {
+//
+// Arguments are separated by whitespace. A double or single quote at the start of an argument
+// groups everything up to the matching quote, including spaces and the other kind of quote,
+// so `"John's Sub"` is one argument. `""` is an empty argument. Quotes elsewhere in a word are
+// kept as-is, so `John's` needs no quoting. A closing quote also ends the argument, so
+// `"a"b` is two arguments. The exception is a quote straight after `=`, which continues the
+// argument so `desc="Two words"` is the single argument `desc=Two words`. An unterminated
+// quote is an error rather than swallowing the rest of the command.
+//
+// A backslash makes the next quote or backslash literal, inside or outside quotes, so
+// `"6\" Sub"` is `6" Sub`. Before any other character it's kept as-is.
+func SplitArgsQuoted(input string) ([]string, error) {
 	var args []string
 	var current strings.Builder
-	inQuotes := false
+	inArg := false
 	var quoteChar rune
+	quotedValue := false // the quote opened after "=", so the argument continues after it
+	escaped := false
+	var last rune
 
 	for _, r := range input {
+		prev := last
+		last = r
+		if escaped {
+			escaped = false
+			inArg = inArg || quoteChar == 0
+			if r == '"' || r == '\'' || r == '\\' {
+				current.WriteRune(r)
+				continue
+			}
+			current.WriteRune('\\')
+		}
+
 		switch {
-		case r == '"' || r == '\'':
-			if !inQuotes {
-				inQuotes = true
-				quoteChar = r
-			} else if r == quoteChar {
-				inQuotes = false
-				if current.Len() > 0 {
+		case r == '\\':
+			escaped = true
+		case quoteChar != 0:
+			if r == quoteChar {
+				if !quotedValue {
 					args = append(args, current.String())
 					current.Reset()
 				}
-			} else {
-				current.WriteRune(r)
+				quoteChar = 0
+				last = 0
+				continue
 			}
-		case r == ' ' && !inQuotes:
-			if current.Len() > 0 {
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inArg {
 				args = append(args, current.String())
 				current.Reset()
+				inArg = false
 			}
+		case (r == '"' || r == '\'') && (!inArg || prev == '='):
+			quoteChar = r
+			quotedValue = inArg
 		default:
 			current.WriteRune(r)
+			inArg = true
 		}
 	}
 
-	if current.Len() > 0 {
+	if escaped {
+		current.WriteRune('\\')
+		inArg = inArg || quoteChar == 0
+	}
+	if quoteChar != 0 {
+		return nil, fmt.Errorf("missing closing %c quote", quoteChar)
+	}
+	if inArg {
 		args = append(args, current.String())
 	}
 
-	return args
+	return args, nil
+}
+
+// commandFlags are the key=value options accepted by ParseCommandArguments
+var commandFlags = map[string]bool{
+	"interval": true, // billing interval; implies a subscription
+	"count":    true, // bill every N intervals; implies a subscription
+	"end":      true, // end the subscription after N cycles, 0 for never; implies a subscription
+	"desc":     true, // description, the same as the positional reference
 }
 
 // ParseCommandArguments parses the text from a Slack slash command.
-// Format: <amount> "<service_name>" <reference_number>
+// Format: <amount> "<service_name>" [reference_number] [subscription] [interval] [interval_count] [key=value...]
+//
+// The amount and service name always come first. After them, arguments of the form key=value
+// set an option by name (interval=month count=3 end=6 desc="Monthly retainer") and can be
+// mixed with the positional ones in any order. Options about the subscription turn it on. Each
+// option can only be given once, either by position or by name.
 func ParseCommandArguments(text string) (*models.PaymentLinkData, error) {
-	parts := SplitArgsQuoted(text)
-
+	parts, err := SplitArgsQuoted(text)
+	if err != nil {
+		return nil, err
+	}
 	if len(parts) < 2 {
-		return nil, fmt.Errorf("invalid format. Usage: <amount> \"<service_name>\" [reference_number]")
+		return nil, fmt.Errorf("invalid format. Usage: <amount> \"<service_name>\" [reference_number] [interval=month count=1 end=0 desc=\"...\"]")
 	}
 
 	// Parse amount
 	amountStr := strings.TrimSpace(parts[0])
-	amount, err := strconv.ParseFloat(amountStr, 64)
+	amount, err := ParseAmountInCurrency(amountStr, DefaultCurrency)
 	if err != nil {
-		return nil, fmt.Errorf("invalid amount '%s'. Please provide a valid number", amountStr)
+		return nil, fmt.Errorf("invalid amount: %w", err)
 	}
 	if amount <= 0 {
 		return nil, fmt.Errorf("amount must be greater than 0")
@@ -73,39 +126,98 @@ func ParseCommandArguments(text string) (*models.PaymentLinkData, error) {
 		return nil, fmt.Errorf("service name cannot be empty")
 	}
 
-	// Get reference number (optional)
-	referenceNumber := fmt.Sprintf("REF-%d", time.Now().Unix())
-	if len(parts) > 2 {
-		referenceNumber = strings.TrimSpace(parts[2])
+	// Separate named options from the remaining positional arguments
+	flags := map[string]string{}
+	var positional []string
+	for _, part := range parts[2:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			positional = append(positional, part)
+			continue
+		}
+		key = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(key), "--"))
+		if !commandFlags[key] {
+			return nil, fmt.Errorf("unknown option '%s'. Options are interval, count, end and desc", key)
+		}
+		if _, seen := flags[key]; seen {
+			return nil, fmt.Errorf("option '%s' is given more than once", key)
+		}
+		flags[key] = strings.TrimSpace(value)
+	}
+	if len(positional) > 4 {
+		return nil, fmt.Errorf("too many arguments. Usage: <amount> \"<service_name>\" [reference_number] [interval=month count=1 end=0 desc=\"...\"]")
+	}
+	// positionalOrFlag returns the option given at position i of the positional arguments or by name
+	positionalOrFlag := func(i int, key string) (string, bool, error) {
+		flag, hasFlag := flags[key]
+		if i < len(positional) {
+			if hasFlag {
+				return "", false, fmt.Errorf("%s is given both by position and as %s=", key, key)
+			}
+			return strings.TrimSpace(positional[i]), true, nil
+		}
+		return flag, hasFlag, nil
+	}
+
+	// Get reference number (optional, empty when not given)
+	referenceNumber, _, err := positionalOrFlag(0, "desc")
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse subscription options if provided
-	isSubscription := false
 	interval := "month"
 	intervalCount := int64(1)
+	endDateCycles := int64(0)
 
-	if len(parts) > 3 {
-		subStr := strings.ToLower(strings.TrimSpace(parts[3]))
+	subscriptionFlags := false
+	for _, key := range []string{"interval", "count", "end"} {
+		if _, ok := flags[key]; ok {
+			subscriptionFlags = true
+		}
+	}
+	isSubscription := subscriptionFlags
+	if len(positional) > 1 {
+		subStr := strings.ToLower(strings.TrimSpace(positional[1]))
 		isSubscription = subStr == "true" || subStr == "yes" || subStr == "1"
+		if !isSubscription && (len(positional) > 2 || subscriptionFlags) {
+			return nil, fmt.Errorf("subscription options were given, but '%s' makes this a one-time payment", positional[1])
+		}
+	}
 
-		if isSubscription {
-			if len(parts) > 4 {
-				interval = strings.ToLower(strings.TrimSpace(parts[4]))
-				if !IsValidInterval(interval) {
-					return nil, fmt.Errorf("invalid interval '%s'. Must be one of: month, week, year", interval)
-				}
+	if isSubscription {
+		raw, ok, err := positionalOrFlag(2, "interval")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			interval = strings.ToLower(raw)
+			if !IsValidInterval(interval) {
+				return nil, fmt.Errorf("invalid interval '%s'. Must be one of: day, week, month, year", interval)
 			}
+		}
 
-			if len(parts) > 5 {
-				count, err := strconv.ParseInt(strings.TrimSpace(parts[5]), 10, 64)
-				if err != nil {
-					return nil, fmt.Errorf("invalid interval count '%s'. Must be a positive number", parts[5])
-				}
-				if count < 1 {
-					return nil, fmt.Errorf("interval count must be greater than 0")
-				}
-				intervalCount = count
+		raw, ok, err = positionalOrFlag(3, "count")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval count '%s'. Must be a positive number", raw)
 			}
+			if count < 1 {
+				return nil, fmt.Errorf("interval count must be greater than 0")
+			}
+			intervalCount = count
+		}
+
+		if raw, ok := flags["end"]; ok {
+			cycles, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || cycles < 0 {
+				return nil, fmt.Errorf("invalid end '%s'. Must be a number of billing cycles, or 0 for no end date", raw)
+			}
+			endDateCycles = cycles
 		}
 	}
 
@@ -116,15 +228,91 @@ func ParseCommandArguments(text string) (*models.PaymentLinkData, error) {
 		IsSubscription:  isSubscription,
 		Interval:        interval,
 		IntervalCount:   intervalCount,
+		EndDateCycles:   endDateCycles,
 	}, nil
 }
 
 // IsValidInterval checks if the provided interval is valid
 func IsValidInterval(interval string) bool {
 	validIntervals := map[string]bool{
+		"day":   true,
 		"month": true,
 		"week":  true,
 		"year":  true,
 	}
 	return validIntervals[interval]
 }
+
+// InvoiceCounterCommand represents the parsed arguments of /invoice-counter
+type InvoiceCounterCommand struct {
+	Action string // "next" or "set"
+	Value  int    // the next invoice number to use (only for "set")
+	Force  bool   // allow setting a number lower than the current counter
+}
+
+// ParseInvoiceCounterArguments parses the text from the /invoice-counter slash command.
+// Format: [next] | set <number> [force]
+func ParseInvoiceCounterArguments(text string) (*InvoiceCounterCommand, error) {
+	usage := "usage: /invoice-counter [next | set <number> [force]]"
+	parts, err := SplitArgsQuoted(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w. %s", err, usage)
+	}
+
+	if len(parts) == 0 || strings.EqualFold(parts[0], "next") {
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("unexpected arguments after 'next'. %s", usage)
+		}
+		return &InvoiceCounterCommand{Action: "next"}, nil
+	}
+
+	if !strings.EqualFold(parts[0], "set") {
+		return nil, fmt.Errorf("unknown action '%s'. %s", parts[0], usage)
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("missing invoice number. %s", usage)
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || value <= 0 {
+		return nil, fmt.Errorf("invalid invoice number '%s'. Must be a positive integer", parts[1])
+	}
+
+	cmd := &InvoiceCounterCommand{Action: "set", Value: value}
+	if len(parts) > 2 {
+		flag := strings.ToLower(strings.TrimSpace(parts[2]))
+		if flag != "force" && flag != "--force" {
+			return nil, fmt.Errorf("unknown option '%s'. %s", parts[2], usage)
+		}
+		cmd.Force = true
+	}
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("too many arguments. %s", usage)
+	}
+
+	return cmd, nil
+}
+
+// ParseRefundArguments parses the text from the /refund-payment slash command.
+// Format: <payment_intent_or_link_id> [amount]
+func ParseRefundArguments(text string) (string, float64, error) {
+	parts, err := SplitArgsQuoted(text)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w. usage: /refund-payment <payment_intent_or_link_id> [amount]", err)
+	}
+	if len(parts) == 0 || len(parts) > 2 {
+		return "", 0, fmt.Errorf("usage: /refund-payment <payment_intent_or_link_id> [amount]")
+	}
+
+	id := strings.TrimSpace(parts[0])
+	amount := 0.0
+	if len(parts) == 2 {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || parsed <= 0 {
+			return "", 0, fmt.Errorf("invalid refund amount '%s'. Please provide a positive number", parts[1])
+		}
+		amount = parsed
+	}
+
+	return id, amount, nil
+}
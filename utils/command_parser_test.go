@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"paymentbot/models"
+)
+
+func TestSplitArgsQuoted(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{`49 "Web Hosting"`, []string{"49", "Web Hosting"}},
+		{`49 'John "JJ" Smith'`, []string{"49", `John "JJ" Smith`}},
+		{`49 John's`, []string{"49", "John's"}},
+		{`desc="Two words" end=6`, []string{"desc=Two words", "end=6"}},
+		{`"6\" Sub"`, []string{`6" Sub`}},
+		{`""`, []string{""}},
+		{`a '' b ""`, []string{"a", "", "b", ""}},
+		{"49\tWeb\n  Hosting  ", []string{"49", "Web", "Hosting"}},
+		{`O'Brien's "Tea Shop"`, []string{"O'Brien's", "Tea Shop"}},
+		{"", nil},
+		{`C:\\Temp "a\\b"`, []string{`C:\Temp`, `a\b`}},
+		{`'it\'s' it\'s`, []string{"it's", "it's"}},
+		{`\"quoted`, []string{`"quoted`}},
+		{`a\ b`, []string{`a\`, "b"}},
+		{`"foo"bar`, []string{"foo", "bar"}},
+		{`'x'"y"`, []string{"x", "y"}},
+		{`foo"bar"`, []string{`foo"bar"`}},
+		{`'a "b" c' "a 'b' c"`, []string{`a "b" c`, `a 'b' c`}},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgsQuoted(tt.input)
+		if err != nil {
+			t.Errorf("SplitArgsQuoted(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgsQuoted(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{`49 "Web Hosting`, `49 'Web Hosting`, `desc="Two words`} {
+		if _, err := SplitArgsQuoted(input); err == nil {
+			t.Errorf("SplitArgsQuoted(%q) with an unterminated quote: want error", input)
+		}
+	}
+}
+
+func TestParseCommandArguments(t *testing.T) {
+	oneTime := func(desc string) *models.PaymentLinkData {
+		return &models.PaymentLinkData{Amount: 49, ServiceName: "Web Hosting", ReferenceNumber: desc, Interval: "month", IntervalCount: 1}
+	}
+	subscription := func(desc, interval string, count, end int64) *models.PaymentLinkData {
+		return &models.PaymentLinkData{Amount: 49, ServiceName: "Web Hosting", ReferenceNumber: desc, IsSubscription: true, Interval: interval, IntervalCount: count, EndDateCycles: end}
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  *models.PaymentLinkData
+	}{
+		{"amount and service only", `49 "Web Hosting"`, oneTime("")},
+		{"positional description", `49 "Web Hosting" "Pro plan"`, oneTime("Pro plan")},
+		{"keyword description", `49 "Web Hosting" desc="Pro plan, billed yearly"`, oneTime("Pro plan, billed yearly")},
+		{"positional subscription", `49 "Web Hosting" "Pro plan" yes week 2`, subscription("Pro plan", "week", 2, 0)},
+		{"keywords imply subscription", `49 "Web Hosting" interval=year end=3`, subscription("", "year", 1, 3)},
+		{"keywords in any order", `49 "Web Hosting" end=6 count=3 desc="Pro" interval=month`, subscription("Pro", "month", 3, 6)},
+		{"positional description with keyword options", `49 "Web Hosting" "Pro plan" interval=month count=3`, subscription("Pro plan", "month", 3, 0)},
+		{"positional subscription with keyword interval", `49 "Web Hosting" "Pro plan" yes interval=year`, subscription("Pro plan", "year", 1, 0)},
+		{"positional interval with keyword count", `49 "Web Hosting" "Pro" true month count=6 end=12`, subscription("Pro", "month", 6, 12)},
+		{"dashed keyword", `49 "Web Hosting" --interval=week`, subscription("", "week", 1, 0)},
+		{"daily subscription", `49 "Web Hosting" "Pro" true day 2`, subscription("Pro", "day", 2, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommandArguments(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommandArguments(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCommandArguments(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandArgumentsAmounts(t *testing.T) {
+	for input, want := range map[string]float64{
+		`$19.99 "Web Hosting"`:      19.99,
+		`"$1,299.00" "Web Hosting"`: 1299,
+		`"1 299,00" "Web Hosting"`:  1299,
+		`19,99 "Web Hosting"`:       19.99,
+	} {
+		got, err := ParseCommandArguments(input)
+		if err != nil {
+			t.Errorf("ParseCommandArguments(%q) error: %v", input, err)
+			continue
+		}
+		if got.Amount != want {
+			t.Errorf("ParseCommandArguments(%q) amount = %v, want %v", input, got.Amount, want)
+		}
+	}
+}
+
+func TestParseCommandArgumentsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"missing service", `49`, "invalid format"},
+		{"bad amount", `abc "Web Hosting"`, "invalid amount"},
+		{"sub-cent amount", `10.999 "Web Hosting"`, "at most 2 decimal places"},
+		{"ambiguous amount", `1,234 "Web Hosting"`, "write 1234 for a whole amount"},
+		{"unknown keyword", `49 "Web Hosting" colour=red`, "unknown option 'colour'"},
+		{"repeated keyword", `49 "Web Hosting" count=2 count=3`, "more than once"},
+		{"description twice", `49 "Web Hosting" "Pro" desc="Pro plan"`, "both by position and as desc="},
+		{"keyword description takes the first position", `49 "Web Hosting" desc="Pro plan" yes year`, "both by position and as desc="},
+		{"interval twice", `49 "Web Hosting" "Pro" yes month interval=year`, "both by position and as interval="},
+		{"one-time with options", `49 "Web Hosting" "Pro" no interval=month`, "one-time payment"},
+		{"bad interval", `49 "Web Hosting" interval=fortnight`, "invalid interval"},
+		{"bad count", `49 "Web Hosting" count=0`, "greater than 0"},
+		{"bad end", `49 "Web Hosting" end=-1`, "invalid end"},
+		{"too many positional", `49 "Web Hosting" a yes month 1 extra`, "too many arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCommandArguments(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCommandArguments(%q) error = %v, want it to mention %q", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseInvoiceCounterArguments(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *InvoiceCounterCommand
+		wantErr string
+	}{
+		{"", &InvoiceCounterCommand{Action: "next"}, ""},
+		{"next", &InvoiceCounterCommand{Action: "next"}, ""},
+		{"set 2000", &InvoiceCounterCommand{Action: "set", Value: 2000}, ""},
+		{"SET 5 force", &InvoiceCounterCommand{Action: "set", Value: 5, Force: true}, ""},
+		{"set 5 --force", &InvoiceCounterCommand{Action: "set", Value: 5, Force: true}, ""},
+		{"next 5", nil, "unexpected arguments"},
+		{"set", nil, "missing invoice number"},
+		{"set 0", nil, "positive integer"},
+		{"set -3", nil, "positive integer"},
+		{"set abc", nil, "positive integer"},
+		{"set 5 now", nil, "unknown option 'now'"},
+		{"set 5 force again", nil, "too many arguments"},
+		{"reset", nil, "unknown action 'reset'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseInvoiceCounterArguments(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseInvoiceCounterArguments(%q) error = %v, want it to mention %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInvoiceCounterArguments(%q) = %+v, %v, want %+v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
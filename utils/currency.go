@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"paymentbot/money"
+)
+
+// DefaultCurrency is used when no currency is specified
+const DefaultCurrency = "USD"
+
+// CommonCurrencies are offered in the payment modal's currency select, in display order
+var CommonCurrencies = []string{
+	"USD", "EUR", "GBP", "HKD", "JPY", "CAD", "AUD", "SGD", "NZD", "CHF",
+	"CNY", "SEK", "NOK", "DKK", "KRW", "INR", "MXN", "BRL", "ZAR", "AED",
+}
+
+// iso4217Codes is the set of active ISO 4217 currency codes
+var iso4217Codes = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "ANG": true, "AOA": true, "ARS": true, "AUD": true,
+	"AWG": true, "AZN": true, "BAM": true, "BBD": true, "BDT": true, "BGN": true, "BHD": true, "BIF": true,
+	"BMD": true, "BND": true, "BOB": true, "BRL": true, "BSD": true, "BTN": true, "BWP": true, "BYN": true,
+	"BZD": true, "CAD": true, "CDF": true, "CHF": true, "CLP": true, "CNY": true, "COP": true, "CRC": true,
+	"CUP": true, "CVE": true, "CZK": true, "DJF": true, "DKK": true, "DOP": true, "DZD": true, "EGP": true,
+	"ERN": true, "ETB": true, "EUR": true, "FJD": true, "FKP": true, "GBP": true, "GEL": true, "GHS": true,
+	"GIP": true, "GMD": true, "GNF": true, "GTQ": true, "GYD": true, "HKD": true, "HNL": true, "HTG": true,
+	"HUF": true, "IDR": true, "ILS": true, "INR": true, "IQD": true, "IRR": true, "ISK": true, "JMD": true,
+	"JOD": true, "JPY": true, "KES": true, "KGS": true, "KHR": true, "KMF": true, "KPW": true, "KRW": true,
+	"KWD": true, "KYD": true, "KZT": true, "LAK": true, "LBP": true, "LKR": true, "LRD": true, "LSL": true,
+	"LYD": true, "MAD": true, "MDL": true, "MGA": true, "MKD": true, "MMK": true, "MNT": true, "MOP": true,
+	"MRU": true, "MUR": true, "MVR": true, "MWK": true, "MXN": true, "MYR": true, "MZN": true, "NAD": true,
+	"NGN": true, "NIO": true, "NOK": true, "NPR": true, "NZD": true, "OMR": true, "PAB": true, "PEN": true,
+	"PGK": true, "PHP": true, "PKR": true, "PLN": true, "PYG": true, "QAR": true, "RON": true, "RSD": true,
+	"RUB": true, "RWF": true, "SAR": true, "SBD": true, "SCR": true, "SDG": true, "SEK": true, "SGD": true,
+	"SHP": true, "SLE": true, "SOS": true, "SRD": true, "SSP": true, "STN": true, "SVC": true, "SYP": true,
+	"SZL": true, "THB": true, "TJS": true, "TMT": true, "TND": true, "TOP": true, "TRY": true, "TTD": true,
+	"TWD": true, "TZS": true, "UAH": true, "UGX": true, "USD": true, "UYU": true, "UZS": true, "VES": true,
+	"VND": true, "VUV": true, "WST": true, "XAF": true, "XCD": true, "XOF": true, "XPF": true, "YER": true,
+	"ZAR": true, "ZMW": true, "ZWL": true,
+}
+
+// IsValidCurrency checks whether code is a known ISO 4217 currency code (case-insensitive)
+func IsValidCurrency(code string) bool {
+	return iso4217Codes[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// NormalizeCurrency upper-cases and validates a currency code, defaulting to USD when empty
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if !iso4217Codes[code] {
+		return "", fmt.Errorf("unsupported currency '%s'. Please use an ISO 4217 code such as USD, EUR or HKD", code)
+	}
+	return code, nil
+}
+
+// CurrencyDecimals returns the number of minor-unit digits for a currency (2 for most)
+func CurrencyDecimals(code string) int {
+	return money.Decimals(code)
+}
+
+// CurrencyMultiplier returns the factor converting a major-unit amount to minor units
+// (100 for USD, 1 for JPY, 1000 for KWD)
+func CurrencyMultiplier(code string) float64 {
+	return money.Multiplier(code)
+}
+
+// ToMinorUnits converts an amount to the currency's smallest unit, rounding to the nearest
+// unit so float error (e.g. 19.99*100 = 1998.9999...) doesn't lose a cent
+func ToMinorUnits(amount float64, code string) int64 {
+	return money.FromMajor(amount, code).Minor
+}
+
+// currencySymbols are the prefixes used when displaying amounts. Currencies without an
+// entry are shown with their ISO code after the amount instead.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "\u20AC",
+	"GBP": "\u00A3",
+	"JPY": "\u00A5",
+	"HKD": "HK$",
+	"CAD": "C$",
+	"AUD": "A$",
+	"SGD": "S$",
+	"NZD": "NZ$",
+	"CNY": "CN\u00A5",
+	"KRW": "\u20A9",
+	"INR": "\u20B9",
+}
+
+// CurrencySymbol returns the display symbol for a currency, or "" if it has none
+func CurrencySymbol(code string) string {
+	return currencySymbols[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// FormatMoney formats m like FormatAmount
+func FormatMoney(m money.Money) string {
+	return FormatAmount(m.Major(), m.Currency)
+}
+
+// FormatAmount formats an amount with the currency's symbol and minor-unit precision,
+// e.g. "$19.99", "¥1500" or "12.500 KWD"
+func FormatAmount(amount float64, code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		code = DefaultCurrency
+	}
+	number := fmt.Sprintf("%.*f", CurrencyDecimals(code), amount)
+	if symbol := CurrencySymbol(code); symbol != "" {
+		return symbol + number
+	}
+	return number + " " + code
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "USD", false},
+		{"eur", "EUR", false},
+		{" gbp ", "GBP", false},
+		{"HKD", "HKD", false},
+		{"XYZ", "", true},
+		{"US", "", true},
+		{"dollars", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeCurrency(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeCurrency(%q) = %q, %v, want %q (error %v)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "ISO 4217") {
+			t.Errorf("NormalizeCurrency(%q) error = %v, want it to explain the expected codes", tt.input, err)
+		}
+	}
+}
+
+func TestCommonCurrenciesAreValid(t *testing.T) {
+	for _, code := range CommonCurrencies {
+		if !IsValidCurrency(code) {
+			t.Errorf("modal offers %s, which isn't a known ISO 4217 code", code)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{19.99, "USD", "$19.99"},
+		{19.99, "", "$19.99"},
+		{1234.5, "eur", "€1234.50"},
+		{7, "GBP", "£7.00"},
+		{1500, "JPY", "¥1500"},
+		{12.5, "KWD", "12.500 KWD"},
+		{100, "HKD", "HK$100.00"},
+		{50000, "KRW", "₩50000"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%v, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestCurrencySymbolsAreValidUTF8(t *testing.T) {
+	for code, symbol := range currencySymbols {
+		if !utf8.ValidString(symbol) || strings.ContainsAny(symbol, "Ã¢Â") {
+			t.Errorf("symbol for %s is %q, which looks mis-encoded", code, symbol)
+		}
+	}
+}
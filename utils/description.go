@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"paymentbot/models"
+)
+
+// Maximum description lengths (in characters) accepted by each provider
+const (
+	StripeMaxDescriptionLength    = 500
+	AirwallexMaxDescriptionLength = 255
+)
+
+// descriptionTruncationTolerance is the fraction of the limit we are willing to silently cut off.
+// Anything longer is rejected so the user can shorten it themselves.
+const descriptionTruncationTolerance = 0.1
+
+// MaxDescriptionLength returns the description length limit for a provider
+func MaxDescriptionLength(provider models.PaymentProvider) int {
+	if provider == models.ProviderAirwallex {
+		return AirwallexMaxDescriptionLength
+	}
+	return StripeMaxDescriptionLength
+}
+
+// NormalizeDescription strips control characters and collapses runs of whitespace
+// (including newlines pasted from other documents) into single spaces.
+func NormalizeDescription(text string) string {
+	var sb strings.Builder
+	pendingSpace := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			// Drop control characters and invalid UTF-8 entirely
+		default:
+			if pendingSpace && sb.Len() > 0 {
+				sb.WriteRune(' ')
+			}
+			pendingSpace = false
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// SanitizeDescription normalizes a description and caps it at maxLen characters. Small overruns are
+// truncated with an ellipsis; overruns beyond the tolerance return an error instead.
+func SanitizeDescription(text string, maxLen int) (string, error) {
+	normalized := NormalizeDescription(text)
+	runes := []rune(normalized)
+	if len(runes) <= maxLen {
+		return normalized, nil
+	}
+
+	tolerance := int(float64(maxLen) * descriptionTruncationTolerance)
+	if len(runes)-maxLen > tolerance {
+		return "", fmt.Errorf("description is too long (%d characters). Please keep it under %d characters", len(runes), maxLen)
+	}
+
+	return strings.TrimSpace(string(runes[:maxLen-1])) + "…", nil
+}
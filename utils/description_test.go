@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"paymentbot/models"
+)
+
+func TestNormalizeDescription(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "Website redesign", "Website redesign"},
+		{"multi-line", "Phase 1:\r\n  design\n\n\tPhase 2: build\n", "Phase 1: design Phase 2: build"},
+		{"control characters", "Invoice\x00 #12\x07", "Invoice #12"},
+		{"invalid UTF-8", "Caf\xe9 menu", "Caf menu"},
+		{"non-breaking spaces", "Pro\u00a0\u00a0plan", "Pro plan"},
+		{"only whitespace", " \n\t ", ""},
+		{"emoji kept", "Launch 🚀 package", "Launch 🚀 package"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeDescription(tt.input); got != tt.want {
+				t.Errorf("NormalizeDescription(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeDescriptionLengths(t *testing.T) {
+	const maxLen = 100
+	tests := []struct {
+		name      string
+		input     string
+		wantLen   int
+		truncated bool
+		wantErr   bool
+	}{
+		{"at the limit", strings.Repeat("a", maxLen), maxLen, false, false},
+		{"whitespace collapsed under the limit", strings.Repeat("ab\n\n", 30), 89, false, false},
+		{"slightly over is truncated", strings.Repeat("a", maxLen+10), maxLen, true, false},
+		{"multi-byte characters count once", strings.Repeat("é", maxLen+5), maxLen, true, false},
+		{"well over is rejected", strings.Repeat("a", maxLen+11), 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SanitizeDescription(tt.input, maxLen)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "too long") {
+					t.Errorf("SanitizeDescription error = %v, want it rejected as too long", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SanitizeDescription error: %v", err)
+			}
+			if utf8.RuneCountInString(got) != tt.wantLen {
+				t.Errorf("SanitizeDescription = %d characters, want %d", utf8.RuneCountInString(got), tt.wantLen)
+			}
+			if strings.HasSuffix(got, "…") != tt.truncated {
+				t.Errorf("SanitizeDescription = %q, want truncated with an ellipsis: %v", got, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestMaxDescriptionLength(t *testing.T) {
+	if got := MaxDescriptionLength(models.ProviderAirwallex); got != AirwallexMaxDescriptionLength {
+		t.Errorf("Airwallex limit = %d, want %d", got, AirwallexMaxDescriptionLength)
+	}
+	if got := MaxDescriptionLength(models.ProviderStripe); got != StripeMaxDescriptionLength {
+		t.Errorf("Stripe limit = %d, want %d", got, StripeMaxDescriptionLength)
+	}
+}
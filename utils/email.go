@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail checks that raw is a single email address and returns the bare address.
+// The display-name form ("Jane Doe <jane@example.com>") is accepted and reduced to the address.
+func NormalizeEmail(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+	addr, err := mail.ParseAddress(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid email address", trimmed)
+	}
+	// ParseAddress accepts dotless domains such as "foo@localhost", which are never right on an invoice
+	at := strings.LastIndex(addr.Address, "@")
+	if domain := addr.Address[at+1:]; !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("%q is not a valid email address", trimmed)
+	}
+	return addr.Address, nil
+}
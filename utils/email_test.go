@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"billing@acme.test", "billing@acme.test", false},
+		{"  billing@acme.test ", "billing@acme.test", false},
+		{"Jane Doe <jane@example.com>", "jane@example.com", false},
+		{`"Doe, Jane" <jane@example.com>`, "jane@example.com", false},
+		{"jane.doe+invoices@mail.example.co.uk", "jane.doe+invoices@mail.example.co.uk", false},
+		{"foo@", "", true},
+		{"foo@localhost", "", true},
+		{"foo@example.", "", true},
+		{"@example.com", "", true},
+		{"foo example.com", "", true},
+		{"a@example.com, b@example.com", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeEmail(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLinkExpiry is the longest expiry accepted for a payment link
+const MaxLinkExpiry = 365 * 24 * time.Hour
+
+// ParseLinkExpiry parses how long a payment link stays usable, as a whole number of hours or
+// days: "48h", "12 hours", "7d" or "30 days". An empty string means the link never expires.
+func ParseLinkExpiry(raw string) (time.Duration, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	if s == "" {
+		return 0, nil
+	}
+
+	digits := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	unit := strings.TrimSpace(s[len(digits):])
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("enter a number of hours or days, e.g. 48h or 7d")
+	}
+
+	var unitLength time.Duration
+	switch unit {
+	case "h", "hr", "hrs", "hour", "hours":
+		unitLength = time.Hour
+	case "d", "day", "days":
+		unitLength = 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("enter a number of hours or days, e.g. 48h or 7d")
+	}
+	// Compare counts rather than durations so huge numbers can't overflow
+	if int64(n) > int64(MaxLinkExpiry/unitLength) {
+		return 0, fmt.Errorf("links can expire at most %d days from now", int(MaxLinkExpiry/(24*time.Hour)))
+	}
+	return time.Duration(n) * unitLength, nil
+}
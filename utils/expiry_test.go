@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLinkExpiry(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"  ", 0, false},
+		{"48h", 48 * time.Hour, false},
+		{"12 hours", 12 * time.Hour, false},
+		{"1 HR", time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"30 days", 30 * 24 * time.Hour, false},
+		{"365d", MaxLinkExpiry, false},
+		{"366d", 0, true},
+		{"9000h", 0, true},
+		{"99999999999999999999d", 0, true},
+		{"0d", 0, true},
+		{"-2d", 0, true},
+		{"2 weeks", 0, true},
+		{"1.5d", 0, true},
+		{"days", 0, true},
+		{"48", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLinkExpiry(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLinkExpiry(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLinkExpiry(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
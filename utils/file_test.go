@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+
+	if err := WriteFileAtomic(path, []byte(`{"a":1}`), 0o600); err != nil {
+		t.Fatalf("WriteFileAtomic error: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte(`{"a":2}`), 0o600); err != nil {
+		t.Fatalf("WriteFileAtomic error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":2}` {
+		t.Errorf("file = %s, want {\"a\":2}", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+
+	// No temp files are left behind next to the store
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the store", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "store.json")
+	if err := WriteFileAtomic(path, []byte("{}"), 0o600); err == nil {
+		t.Error("WriteFileAtomic into a missing directory succeeded, want an error")
+	}
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InvoiceNumberFormat turns the counter's sequence number into an invoice number, e.g.
+// "INV-{year}-{seq:04d}" renders sequence 7 as "INV-2024-0007". The zero value renders the
+// bare sequence number.
+type InvoiceNumberFormat struct {
+	template string
+	pattern  *regexp.Regexp
+}
+
+// ParseInvoiceNumberFormat parses a template (as used by INVOICE_NUMBER_FORMAT). It must
+// contain {seq} exactly once, optionally zero-padded as {seq:04d}, and may contain {year}.
+func ParseInvoiceNumberFormat(template string) (InvoiceNumberFormat, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	seqCount := 0
+	rest := template
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		if rest[open] == '}' {
+			return InvoiceNumberFormat{}, fmt.Errorf("unexpected '}' in %q", template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(rest[:open]))
+		token, after, ok := strings.Cut(rest[open+1:], "}")
+		if !ok {
+			return InvoiceNumberFormat{}, fmt.Errorf("unclosed '{' in %q", template)
+		}
+		switch {
+		case token == "year":
+			pattern.WriteString(`\d{4}`)
+		case token == "seq" || isSeqPadding(token):
+			seqCount++
+			pattern.WriteString(`(\d+)`)
+		default:
+			return InvoiceNumberFormat{}, fmt.Errorf("unknown placeholder {%s} in %q. Use {year}, {seq} or {seq:04d}", token, template)
+		}
+		rest = after
+	}
+	pattern.WriteString("$")
+
+	if seqCount != 1 {
+		return InvoiceNumberFormat{}, fmt.Errorf("%q must contain {seq} exactly once", template)
+	}
+	return InvoiceNumberFormat{template: template, pattern: regexp.MustCompile(pattern.String())}, nil
+}
+
+// isSeqPadding reports whether token is a zero-padded sequence like seq:04d
+func isSeqPadding(token string) bool {
+	width, ok := strings.CutPrefix(token, "seq:0")
+	if !ok {
+		return false
+	}
+	width, ok = strings.CutSuffix(width, "d")
+	n, err := strconv.Atoi(width)
+	return ok && err == nil && n >= 1 && n <= 9
+}
+
+// Render formats the sequence number seq as issued at now
+func (f InvoiceNumberFormat) Render(seq int, now time.Time) string {
+	if f.pattern == nil {
+		return strconv.Itoa(seq)
+	}
+	var out strings.Builder
+	rest := f.template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			out.WriteString(rest)
+			return out.String()
+		}
+		out.WriteString(rest[:open])
+		token, after, _ := strings.Cut(rest[open+1:], "}")
+		switch {
+		case token == "year":
+			out.WriteString(strconv.Itoa(now.Year()))
+		case token == "seq":
+			out.WriteString(strconv.Itoa(seq))
+		default:
+			width, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(token, "seq:0"), "d"))
+			fmt.Fprintf(&out, "%0*d", width, seq)
+		}
+		rest = after
+	}
+}
+
+// Sequence reads the sequence number back out of an invoice number in this format. Bare
+// numbers are accepted too, so manually entered overrides keep working.
+func (f InvoiceNumberFormat) Sequence(invoiceNumber string) (int, bool) {
+	invoiceNumber = strings.TrimSpace(invoiceNumber)
+	if f.pattern != nil {
+		if match := f.pattern.FindStringSubmatch(invoiceNumber); match != nil {
+			seq, err := strconv.Atoi(match[1])
+			return seq, err == nil
+		}
+	}
+	seq, err := strconv.Atoi(invoiceNumber)
+	return seq, err == nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvoiceNumberFormatRender(t *testing.T) {
+	issued := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		template string
+		seq      int
+		want     string
+	}{
+		{"{seq}", 1001, "1001"},
+		{"INV-{year}-{seq:04d}", 7, "INV-2026-0007"},
+		{"INV-{year}-{seq:04d}", 12345, "INV-2026-12345"},
+		{"{year}/{seq:06d}", 42, "2026/000042"},
+		{"ACME {seq}", 1, "ACME 1"},
+		{"A.{seq:02d}.Z", 3, "A.03.Z"},
+	}
+	for _, tt := range tests {
+		format, err := ParseInvoiceNumberFormat(tt.template)
+		if err != nil {
+			t.Fatalf("ParseInvoiceNumberFormat(%q) error: %v", tt.template, err)
+		}
+		if got := format.Render(tt.seq, issued); got != tt.want {
+			t.Errorf("%q.Render(%d) = %q, want %q", tt.template, tt.seq, got, tt.want)
+		}
+	}
+
+	// Without a configured format numbers stay bare
+	if got := (InvoiceNumberFormat{}).Render(1001, issued); got != "1001" {
+		t.Errorf("zero format Render(1001) = %q, want 1001", got)
+	}
+}
+
+func TestParseInvoiceNumberFormatErrors(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"INV-{year}",
+		"{seq}-{seq}",
+		"INV-{seq",
+		"INV-}{seq}",
+		"INV-{month}-{seq}",
+		"{seq:4d}",
+		"{seq:00d}",
+		"{seq:010d}",
+	} {
+		if _, err := ParseInvoiceNumberFormat(template); err == nil {
+			t.Errorf("ParseInvoiceNumberFormat(%q) succeeded, want an error", template)
+		}
+	}
+}
+
+func TestInvoiceNumberSequenceRoundTrips(t *testing.T) {
+	issued := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+	for _, template := range []string{"{seq}", "INV-{year}-{seq:04d}", "{year}/{seq:06d}", "A.{seq:02d}.Z", "(INV) {seq}+"} {
+		format, err := ParseInvoiceNumberFormat(template)
+		if err != nil {
+			t.Fatalf("ParseInvoiceNumberFormat(%q) error: %v", template, err)
+		}
+		for _, seq := range []int{1, 7, 1000, 123456} {
+			rendered := format.Render(seq, issued)
+			if got, ok := format.Sequence(rendered); !ok || got != seq {
+				t.Errorf("%q: Sequence(%q) = %d, %v, want %d", template, rendered, got, ok, seq)
+			}
+		}
+	}
+
+	format, _ := ParseInvoiceNumberFormat("INV-{year}-{seq:04d}")
+	tests := []struct {
+		invoiceNumber string
+		want          int
+		wantOK        bool
+	}{
+		{" INV-2025-0042 ", 42, true}, // an earlier year still counts
+		{"1500", 1500, true},          // bare numbers are accepted for manual overrides
+		{"INV-26-0042", 0, false},
+		{"PO-2026-0042", 0, false},
+		{"INV-2026-", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := format.Sequence(tt.invoiceNumber); ok != tt.wantOK || got != tt.want {
+			t.Errorf("Sequence(%q) = %d, %v, want %d, %v", tt.invoiceNumber, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"paymentbot/models"
+)
+
+// StripeMaxLineItems is the most line items Stripe accepts on a single payment link
+const StripeMaxLineItems = 20
+
+// Limits for a quantity the customer chooses at checkout. Stripe caps the maximum at 999999
+// and defaults it to 99.
+const (
+	DefaultMinAdjustableQuantity = 1
+	DefaultMaxAdjustableQuantity = 99
+	StripeMaxAdjustableQuantity  = 999999
+)
+
+// ParseQuantityLimit parses the minimum or maximum of a customer-adjustable quantity, returning
+// def when raw is blank
+func ParseQuantityLimit(raw string, def int64) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || limit < 1 || limit > StripeMaxAdjustableQuantity {
+		return 0, fmt.Errorf("'%s' isn't a valid quantity. Enter a whole number from 1 to %d", raw, StripeMaxAdjustableQuantity)
+	}
+	return limit, nil
+}
+
+// ValidateQuantityRange checks that a customer-adjustable quantity has a usable range
+func ValidateQuantityRange(min, max int64) error {
+	if min > max {
+		return fmt.Errorf("the minimum quantity (%d) can't be more than the maximum (%d)", min, max)
+	}
+	return nil
+}
+
+// StripeMaxTrialDays is the longest free trial Stripe allows on a subscription
+const StripeMaxTrialDays = 730
+
+// ParseTrialDays parses the free trial length of a subscription, where blank means no trial
+func ParseTrialDays(raw string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	days, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || days < 0 || days > StripeMaxTrialDays {
+		return 0, fmt.Errorf("'%s' isn't a valid trial length. Enter a number of days from 0 to %d", raw, StripeMaxTrialDays)
+	}
+	return days, nil
+}
+
+// ParsePaymentLineItems parses one item per line in the format
+// "Description | Unit price | Quantity | SKU", where quantity (default 1) and SKU are optional.
+// Blank lines are skipped.
+func ParsePaymentLineItems(text string) ([]models.PaymentLineItem, error) {
+	var items []models.PaymentLineItem
+	for lineNum, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "|")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("line %d is not in the correct format. Expected: 'Description | Price | Quantity | SKU'", lineNum+1)
+		}
+
+		description := NormalizeDescription(parts[0])
+		if description == "" {
+			return nil, fmt.Errorf("description on line %d cannot be empty", lineNum+1)
+		}
+
+		priceStr := strings.TrimSpace(parts[1])
+		unitAmount, err := ParseAmount(priceStr)
+		if err != nil || unitAmount <= 0 {
+			return nil, fmt.Errorf("invalid price '%s' on line %d", priceStr, lineNum+1)
+		}
+
+		quantity := int64(1)
+		if len(parts) >= 3 && strings.TrimSpace(parts[2]) != "" {
+			quantityStr := strings.TrimSpace(parts[2])
+			quantity, err = strconv.ParseInt(quantityStr, 10, 64)
+			if err != nil || quantity <= 0 {
+				return nil, fmt.Errorf("invalid quantity '%s' on line %d", quantityStr, lineNum+1)
+			}
+		}
+
+		sku := ""
+		if len(parts) == 4 {
+			sku, err = NormalizeSKU(parts[3])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum+1, err)
+			}
+		}
+
+		items = append(items, models.PaymentLineItem{
+			Description: description,
+			UnitAmount:  unitAmount,
+			Quantity:    quantity,
+			SKU:         sku,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import "testing"
+
+func TestParseQuantityLimit(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{"", 7, false},
+		{"  ", 7, false},
+		{"1", 1, false},
+		{" 25 ", 25, false},
+		{"999999", 999999, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"1000000", 0, true},
+		{"2.5", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuantityLimit(tt.raw, 7)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseQuantityLimit(%q) = %d, %v, want %d (error %v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateQuantityRange(t *testing.T) {
+	tests := []struct {
+		min, max int64
+		wantErr  bool
+	}{
+		{1, 99, false},
+		{5, 5, false},
+		{10, 2, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateQuantityRange(tt.min, tt.max); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateQuantityRange(%d, %d) error = %v, want error %v", tt.min, tt.max, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseTrialDays(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{" 14 ", 14, false},
+		{"730", 730, false},
+		{"731", 0, true},
+		{"-1", 0, true},
+		{"two weeks", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrialDays(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTrialDays(%q) = %d, %v, want %d (error %v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// QueryParam is one key/value appended to posted payment links. Values may contain the
+// placeholders {reference} and {provider}.
+type QueryParam struct {
+	Key   string
+	Value string
+}
+
+// ParseQueryParamTemplate parses "key1=value1,key2=value2" (as used by LINK_QUERY_PARAMS)
+func ParseQueryParamTemplate(raw string) ([]QueryParam, error) {
+	var params []QueryParam
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid query parameter %q, expected key=value", pair)
+		}
+		params = append(params, QueryParam{Key: key, Value: strings.TrimSpace(value)})
+	}
+	return params, nil
+}
+
+// AppendQueryParams adds params to link, keeping any query string it already has.
+// Placeholders in values are replaced from vars, and params that end up empty are skipped.
+func AppendQueryParams(link string, params []QueryParam, vars map[string]string) (string, error) {
+	if len(params) == 0 {
+		return link, nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("not an absolute URL: %q", link)
+	}
+
+	query := u.Query()
+	for _, param := range params {
+		value := param.Value
+		for name, replacement := range vars {
+			value = strings.ReplaceAll(value, "{"+name+"}", replacement)
+		}
+		if value == "" {
+			continue
+		}
+		query.Set(param.Key, value)
+	}
+	u.RawQuery = query.Encode()
+
+	result := u.String()
+	if _, err := url.ParseRequestURI(result); err != nil {
+		return "", fmt.Errorf("link with query parameters is not a valid URL: %w", err)
+	}
+	return result, nil
+}
+
+// maxRedirectURLLength is Stripe's limit for after-completion redirect URLs
+const maxRedirectURLLength = 2048
+
+// NormalizeRedirectURL checks that raw is an absolute https URL customers can be sent to
+// after paying, and returns it trimmed
+func NormalizeRedirectURL(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%q is not a valid URL", trimmed)
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("the redirect URL must start with https://")
+	}
+	if len(trimmed) > maxRedirectURLLength {
+		return "", fmt.Errorf("the redirect URL can be at most %d characters", maxRedirectURLLength)
+	}
+	return trimmed, nil
+}
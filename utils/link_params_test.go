@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQueryParamTemplate(t *testing.T) {
+	params, err := ParseQueryParamTemplate(" client_reference_id={reference} , utm_source=slack,,utm_medium=")
+	if err != nil {
+		t.Fatalf("ParseQueryParamTemplate error: %v", err)
+	}
+	want := []QueryParam{{"client_reference_id", "{reference}"}, {"utm_source", "slack"}, {"utm_medium", ""}}
+	if len(params) != len(want) {
+		t.Fatalf("ParseQueryParamTemplate = %v, want %v", params, want)
+	}
+	for i := range want {
+		if params[i] != want[i] {
+			t.Errorf("param %d = %v, want %v", i, params[i], want[i])
+		}
+	}
+
+	for _, raw := range []string{"utm_source", "=slack"} {
+		if _, err := ParseQueryParamTemplate(raw); err == nil {
+			t.Errorf("ParseQueryParamTemplate(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestAppendQueryParams(t *testing.T) {
+	params := []QueryParam{{"client_reference_id", "{reference}"}, {"utm_source", "slack-{provider}"}}
+	vars := map[string]string{"reference": "INV 42", "provider": "stripe"}
+	tests := []struct {
+		name   string
+		link   string
+		params []QueryParam
+		want   string
+	}{
+		{"no query string", "https://buy.stripe.com/test_1", params, "https://buy.stripe.com/test_1?client_reference_id=INV+42&utm_source=slack-stripe"},
+		{"existing query string", "https://pay.test/link?lang=en", params, "https://pay.test/link?client_reference_id=INV+42&lang=en&utm_source=slack-stripe"},
+		{"overrides an existing param", "https://pay.test/link?utm_source=email", params, "https://pay.test/link?client_reference_id=INV+42&utm_source=slack-stripe"},
+		{"unknown placeholder left as is", "https://pay.test/link", []QueryParam{{"ref", "{missing}"}}, "https://pay.test/link?ref=%7Bmissing%7D"},
+		{"single param", "https://pay.test/link?a=1", []QueryParam{{"ref", "{reference}"}}, "https://pay.test/link?a=1&ref=INV+42"},
+		{"no params", "https://pay.test/link?a=1", nil, "https://pay.test/link?a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AppendQueryParams(tt.link, tt.params, vars)
+			if err != nil {
+				t.Fatalf("AppendQueryParams error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AppendQueryParams(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := AppendQueryParams("https://pay.test/link", []QueryParam{{"ref", "{reference}"}}, map[string]string{"reference": ""}); got != "https://pay.test/link" {
+		t.Errorf("param with an empty reference = %q, want it skipped", got)
+	}
+	if _, err := AppendQueryParams("/relative/link", params, vars); err == nil {
+		t.Error("AppendQueryParams accepted a relative link")
+	}
+}
+
+func TestNormalizeRedirectURL(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"https://acme.test/thanks", "https://acme.test/thanks", false},
+		{"  https://acme.test/thanks?order=1 ", "https://acme.test/thanks?order=1", false},
+		{"http://acme.test/thanks", "", true},
+		{"acme.test/thanks", "", true},
+		{"https://", "", true},
+		{"javascript:alert(1)", "", true},
+		{"https://acme.test/" + strings.Repeat("a", 2048), "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeRedirectURL(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeRedirectURL(%q) = %q, %v, want %q (error %v)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// maxRedactedPrefix is the most characters of a secret that may ever appear in logs
+const maxRedactedPrefix = 8
+
+// sensitiveFields are JSON keys whose values are masked by RedactJSON
+var sensitiveFields = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"api_key":       true,
+	"x-api-key":     true,
+	"client_secret": true,
+	"secret":        true,
+	"password":      true,
+}
+
+// Redact returns a short prefix of a secret followed by "..." so it can be identified in
+// logs without being usable. Short values are fully masked.
+func Redact(secret string) string {
+	prefix := len(secret) / 3
+	if prefix > maxRedactedPrefix {
+		prefix = maxRedactedPrefix
+	}
+	if prefix < 2 {
+		return "***"
+	}
+	return secret[:prefix] + "..."
+}
+
+// RedactJSON masks sensitive fields (tokens, keys, secrets) anywhere in a JSON document.
+// Bodies that aren't valid JSON are replaced entirely since they can't be inspected safely.
+func RedactJSON(body []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "[unparseable body redacted]"
+	}
+	redacted, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return "[unparseable body redacted]"
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s, ok := field.(string); ok && sensitiveFields[strings.ToLower(key)] {
+				v[key] = Redact(s)
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxSKULength keeps SKUs well inside Stripe's 500 character metadata value limit
+const MaxSKULength = 64
+
+// NormalizeSKU trims a SKU and checks it only uses letters, digits, '-', '_' and '.'.
+// The restricted alphabet keeps SKUs safe to embed in Stripe search queries.
+func NormalizeSKU(raw string) (string, error) {
+	sku := strings.TrimSpace(raw)
+	if sku == "" {
+		return "", nil
+	}
+	if len(sku) > MaxSKULength {
+		return "", fmt.Errorf("SKU must be at most %d characters", MaxSKULength)
+	}
+	for _, r := range sku {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlnum && r != '-' && r != '_' && r != '.' {
+			return "", fmt.Errorf("SKU may only contain letters, digits, '-', '_' and '.'")
+		}
+	}
+	return sku, nil
+}
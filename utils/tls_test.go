@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCABundle writes the test server's certificate to a PEM file, standing in for a corporate CA
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTransportTrustsTheExtraCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The server's self-signed certificate isn't in the system pool
+	if resp, err := (&http.Client{Transport: NewTransport(nil)}).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a self-signed server succeeded without the CA bundle")
+	}
+
+	pool, err := LoadCertPool(writeCABundle(t, server))
+	if err != nil {
+		t.Fatalf("LoadCertPool error: %v", err)
+	}
+	resp, err := (&http.Client{Transport: NewTransport(pool)}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestLoadCertPoolErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not-pem.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.pem"), notPEM} {
+		if _, err := LoadCertPool(path); err == nil {
+			t.Errorf("LoadCertPool(%q) succeeded, want an error", path)
+		}
+	}
+}